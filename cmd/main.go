@@ -1,21 +1,52 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"github.com/gofiber/fiber/v2"
+	"flag"
+	"fmt"
 	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/api"
 	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/delivery"
+	"github.com/golangbb/golangbb/v2/internal/integrity"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/migrations"
 	"github.com/golangbb/golangbb/v2/internal/models"
-	"gorm.io/driver/sqlite"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	"github.com/golangbb/golangbb/v2/pkg/oidc"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
 	"gorm.io/gorm"
 	"log"
+	"net/http"
+	"os"
+	"time"
 )
 
-func initialise() *sql.DB {
-	log.Println("[INIT]::INITIALISING 🏗️")
-	dbConnection, err := database.Connect(sqlite.Open(internal.DATABASENAME), gorm.Config{
-		DisableForeignKeyConstraintWhenMigrating: true,
-		SkipDefaultTransaction:                   true,
+const usage = `usage: golangbb [command]
+
+commands:
+  serve               apply pending migrations and start the server (default)
+  migrate [-dry-run]  apply pending migrations, or print their SQL with -dry-run
+  rollback            revert the most recently applied migration
+  status              list applied and pending migrations
+  integrity [-repair] report rows that reference missing parents, and
+                      delete or detach them with -repair
+  grant -action A [-group ID] [-topic ID] [-deny]
+                      allow or deny a Group, or everybody without -group, an
+                      action on a Topic, or the whole forum without -topic`
+
+func connect() *sql.DB {
+	log.Println("[INIT]::CONNECTING 🏗️")
+	dialector, err := database.Dialector(internal.DATABASEURL)
+	if err != nil {
+		log.Println("[INIT]::DATABASE_URL_ERROR 💥")
+		log.Fatal(err)
+		panic(err)
+	}
+
+	dbConnection, err := database.Connect(dialector, gorm.Config{
+		SkipDefaultTransaction: true,
 	})
 
 	if err != nil {
@@ -31,33 +62,265 @@ func initialise() *sql.DB {
 		panic(err)
 	}
 
-	err = database.Initialise(models.Models()...)
+	return sqlDb
+}
+
+func initialise() {
+	log.Println("[INIT]::INITIALISING 🏗️")
+	err := database.Initialise(migrations.All()...)
 	if err != nil {
 		log.Println("[INIT]::DATABASE_INITIALISE_ERROR 💥")
 		log.Fatal(err)
 		panic(err)
 	}
 
+	err = models.DeleteExpiredSessions()
+	if err != nil {
+		log.Println("[INIT]::DELETE_EXPIRED_SESSIONS_WARNING ⚠️")
+	}
+
+	err = models.DeleteExpiredEmailVerifications()
+	if err != nil {
+		log.Println("[INIT]::DELETE_EXPIRED_EMAIL_VERIFICATIONS_WARNING ⚠️")
+	}
+
+	err = models.DeleteExpiredPasswordResets()
+	if err != nil {
+		log.Println("[INIT]::DELETE_EXPIRED_PASSWORD_RESETS_WARNING ⚠️")
+	}
+
+	err = models.DeleteExpiredAPITokens()
+	if err != nil {
+		log.Println("[INIT]::DELETE_EXPIRED_API_TOKENS_WARNING ⚠️")
+	}
+
+	err = models.DeleteStaleLoginThrottles()
+	if err != nil {
+		log.Println("[INIT]::DELETE_STALE_LOGIN_THROTTLES_WARNING ⚠️")
+	}
+
+	err = models.DeleteFailedLoginsBefore(time.Now().Add(-internal.FAILEDLOGINRETENTION))
+	if err != nil {
+		log.Println("[INIT]::DELETE_OLD_FAILED_LOGINS_WARNING ⚠️")
+	}
+
 	log.Println("[INIT]::INITIALISATION_COMPLETE 🏗️")
-	return sqlDb
 }
 
-func main() {
-	db := initialise()
-	defer db.Close()
+// signingKey returns SECRETKEY, or a random key when it is not set. Tokens
+// signed with a random key stop working when the server restarts.
+func signingKey() []byte {
+	if internal.SECRETKEY != "" {
+		return []byte(internal.SECRETKEY)
+	}
 
-	log.Println("[MAIN]::BOOTSTRAPPING 🚀")
-	app := fiber.New()
+	log.Println("[INIT]::EMPTY_SECRETKEY_WARNING ⚠️")
+	key, err := tokens.Generate(tokens.DefaultLength)
+	if err != nil {
+		log.Println("[INIT]::GENERATE_SECRETKEY_ERROR 💥")
+		log.Fatal(err)
+	}
 
-	app.Use(func(c *fiber.Ctx) error {
-		err := c.SendStatus(200)
-		if err != nil {
-			return err
-		}
+	return []byte(key)
+}
+
+// singleSignOn returns the OpenID Connect relying party, or nil when no
+// OIDCISSUER is configured.
+func singleSignOn() *oidc.RelyingParty {
+	if internal.OIDCISSUER == "" {
+		return nil
+	}
+
+	return oidc.New(oidc.Config{
+		Issuer:       internal.OIDCISSUER,
+		ClientID:     internal.OIDCCLIENTID,
+		ClientSecret: internal.OIDCCLIENTSECRET,
+		RedirectURL:  internal.OIDCREDIRECTURL,
+	}, &http.Client{Timeout: 10 * time.Second})
+}
 
-		return c.SendString("ok")
+func serve() {
+	models.AccountLoginPolicy.FreeAttempts = internal.LOGINFREEATTEMPTS
+	models.AccountLoginPolicy.MaxDelay = internal.LOGINMAXDELAY
+	models.IPLoginPolicy.FreeAttempts = internal.LOGINIPFREEATTEMPTS
+	models.IPLoginPolicy.MaxDelay = internal.LOGINMAXDELAY
+	models.ReactionTypes = internal.REACTIONTYPES
+
+	initialise()
+	models.TokenSigningKey = signingKey()
+
+	mailer, err := mail.New(internal.SMTPURL, internal.MAILFROM)
+	if err != nil {
+		log.Println("[INIT]::SMTP_URL_ERROR 💥")
+		log.Fatal(err)
+	}
+
+	log.Println("[MAIN]::BOOTSTRAPPING 🚀")
+	s := store.New(database.DBConnection)
+	app := api.New(s, mailer, singleSignOn())
+
+	worker := delivery.New(s, mailer, delivery.Config{
+		PublicURL:   internal.PUBLICURL,
+		MaxAttempts: internal.MAILMAXATTEMPTS,
+		RetryDelay:  internal.MAILRETRYDELAY,
 	})
+	go worker.Run(context.Background(), internal.MAILPOLLINTERVAL)
 
 	log.Println("[MAIN]::BOOTSTRAPPED 🚀")
 	log.Fatal(app.Listen(":" + internal.PORT))
 }
+
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print pending SQL without executing it")
+	flags.Parse(args)
+
+	if *dryRun {
+		if err := database.DryRun(os.Stdout, migrations.All()); err != nil {
+			log.Println("[MIGRATE]::DRY_RUN_ERROR 💥")
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if err := database.Initialise(migrations.All()...); err != nil {
+		log.Println("[MIGRATE]::MIGRATE_ERROR 💥")
+		log.Fatal(err)
+	}
+}
+
+func rollback() {
+	if err := database.Rollback(migrations.All()); err != nil {
+		log.Println("[ROLLBACK]::ROLLBACK_ERROR 💥")
+		log.Fatal(err)
+	}
+}
+
+func status() {
+	applied, err := database.AppliedMigrations()
+	if err != nil {
+		log.Println("[STATUS]::SELECT_APPLIED_MIGRATIONS_ERROR 💥")
+		log.Fatal(err)
+	}
+
+	known := map[string]bool{}
+	for _, migration := range migrations.All() {
+		known[migration.ID] = true
+	}
+
+	isApplied := map[string]bool{}
+	for _, id := range applied {
+		isApplied[id] = true
+		if !known[id] {
+			fmt.Printf("unknown  %s\n", id)
+		}
+	}
+
+	for _, migration := range migrations.All() {
+		state := "pending"
+		if isApplied[migration.ID] {
+			state = "applied"
+		}
+
+		fmt.Printf("%-8s %s\n", state, migration.ID)
+	}
+}
+
+func checkIntegrity(args []string) {
+	flags := flag.NewFlagSet("integrity", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "delete or detach orphaned rows")
+	flags.Parse(args)
+
+	check := integrity.Check
+	if *repair {
+		check = integrity.Repair
+	}
+
+	orphans, err := check()
+	if err != nil {
+		log.Println("[INTEGRITY]::CHECK_ERROR 💥")
+		log.Fatal(err)
+	}
+
+	unresolved := 0
+	for _, found := range orphans {
+		state := "orphaned"
+		if found.Repaired {
+			state = "repaired"
+		} else {
+			unresolved++
+		}
+
+		relation := found.Relation
+		fmt.Printf("%-8s %6d %s.%s -> %s\n", state, found.Count, relation.Table, relation.Column, relation.References)
+	}
+
+	if unresolved > 0 {
+		os.Exit(1)
+	}
+}
+
+func grant(args []string) {
+	flags := flag.NewFlagSet("grant", flag.ExitOnError)
+	action := flags.String("action", "", "one of view, start_discussion, reply, moderate, administer")
+	groupID := flags.Uint("group", 0, "the Group the rule is for, everybody when omitted")
+	topicID := flags.Uint("topic", 0, "the Topic the rule is for, the whole forum when omitted")
+	deny := flags.Bool("deny", false, "deny the action instead of allowing it")
+	flags.Parse(args)
+
+	if err := database.Initialise(migrations.All()...); err != nil {
+		log.Println("[GRANT]::MIGRATE_ERROR 💥")
+		log.Fatal(err)
+	}
+
+	permission := &models.Permission{Action: *action, Deny: *deny}
+	if *groupID != 0 {
+		id := *groupID
+		permission.GroupID = &id
+	}
+
+	if *topicID != 0 {
+		id := *topicID
+		permission.TopicID = &id
+	}
+
+	if err := models.SetPermission(permission); err != nil {
+		log.Println("[GRANT]::SET_PERMISSION_ERROR 💥")
+		log.Fatal(err)
+	}
+
+	fmt.Printf("permission %d set\n", permission.ID)
+}
+
+func main() {
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "serve", "migrate", "rollback", "status", "integrity", "grant":
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db := connect()
+	defer db.Close()
+
+	switch command {
+	case "serve":
+		serve()
+	case "migrate":
+		migrate(os.Args[2:])
+	case "rollback":
+		rollback()
+	case "status":
+		status()
+	case "integrity":
+		checkIntegrity(os.Args[2:])
+	case "grant":
+		grant(os.Args[2:])
+	}
+}
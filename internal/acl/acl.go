@@ -0,0 +1,286 @@
+// Package acl decides what a User may do on a Topic from the Permissions
+// granted to everybody and to the Groups they belong to.
+//
+// Rules are looked up from the Topic towards the root of the tree and then for
+// the whole forum; the nearest level with a matching rule decides. On a level,
+// rules for a Group take precedence over rules for everybody, and a deny wins
+// over an allow. Allowing an action also allows the actions it implies, and
+// denying one also denies every action that implies it. When no rule matches,
+// everybody may view, signed in Users may start discussions and reply, and
+// members of the moderator group may moderate.
+//
+// Administrators of the whole forum bypass the rules of single Topics, so that
+// they cannot lock themselves out of one.
+//
+// A Policy can be restricted to the scopes of an API token, which caps it to
+// the actions those scopes imply whatever the rules allow.
+package acl
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store"
+)
+
+// implies lists, for each action, the actions that allowing it also allows.
+var implies = map[string][]string{
+	models.ActionView:            {models.ActionView},
+	models.ActionStartDiscussion: {models.ActionStartDiscussion, models.ActionView},
+	models.ActionReply:           {models.ActionReply, models.ActionView},
+	models.ActionModerate:        {models.ActionModerate, models.ActionStartDiscussion, models.ActionReply, models.ActionView},
+	models.ActionAdminister:      {models.ActionAdminister, models.ActionModerate, models.ActionStartDiscussion, models.ActionReply, models.ActionView},
+}
+
+type Checker struct {
+	store store.Store
+}
+
+func New(s store.Store) *Checker {
+	return &Checker{store: s}
+}
+
+// Can reports whether user may perform action on the Topic with topicID, or
+// on the forum as a whole when topicID is 0. A nil user is a guest.
+func (c *Checker) Can(ctx context.Context, user *models.User, action string, topicID uint) (bool, error) {
+	policy, err := c.For(ctx, user)
+	if err != nil {
+		return false, err
+	}
+
+	return policy.Can(action, topicID)
+}
+
+// For loads the rules that apply to user so that any number of Topics can be
+// checked against them, which is how listings are filtered.
+func (c *Checker) For(ctx context.Context, user *models.User) (*Policy, error) {
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+
+	rules, err := c.store.Permissions().ListForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parents, err := c.parents(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Policy{ctx: ctx, store: c.store, user: user, rules: byTopic(rules), parents: parents}, nil
+}
+
+// Allowed returns those of users who may perform action on the Topic with
+// topicID. The rules and the Topic tree are loaded once for all of them, so
+// users must come with their Groups, as Users().ListWithGroups returns them.
+func (c *Checker) Allowed(ctx context.Context, users []models.User, action string, topicID uint) ([]models.User, error) {
+	if len(users) == 0 {
+		return []models.User{}, nil
+	}
+
+	rules, err := c.store.Permissions().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parents, err := c.parents(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := []models.User{}
+	for i := range users {
+		groups := map[uint]bool{}
+		moderator := false
+		for _, group := range users[i].Groups {
+			groups[group.ID] = true
+			moderator = moderator || group.Name == internal.MODERATORGROUP
+		}
+
+		var own []models.Permission
+		for _, rule := range rules {
+			if rule.GroupID == nil || groups[*rule.GroupID] {
+				own = append(own, rule)
+			}
+		}
+
+		policy := &Policy{ctx: ctx, store: c.store, user: &users[i], rules: byTopic(own), parents: parents, moderator: &moderator}
+		ok, err := policy.Can(action, topicID)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			allowed = append(allowed, users[i])
+		}
+	}
+
+	return allowed, nil
+}
+
+// parents maps each Topic to its parent, which is only needed when some of
+// rules are scoped to a Topic.
+func (c *Checker) parents(ctx context.Context, rules []models.Permission) (map[uint]uint, error) {
+	parents := map[uint]uint{}
+	for _, rule := range rules {
+		if rule.TopicID == nil {
+			continue
+		}
+
+		topics, err := c.store.Topics().List(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, topic := range topics {
+			if topic.ParentID != nil {
+				parents[topic.ID] = *topic.ParentID
+			}
+		}
+
+		break
+	}
+
+	return parents, nil
+}
+
+func byTopic(rules []models.Permission) map[uint][]models.Permission {
+	byTopic := map[uint][]models.Permission{}
+	for _, rule := range rules {
+		var topicID uint
+		if rule.TopicID != nil {
+			topicID = *rule.TopicID
+		}
+
+		byTopic[topicID] = append(byTopic[topicID], rule)
+	}
+
+	return byTopic
+}
+
+// Policy holds the rules of a single User, keyed by Topic with the forum wide
+// rules under 0.
+type Policy struct {
+	ctx       context.Context
+	store     store.Store
+	user      *models.User
+	rules     map[uint][]models.Permission
+	parents   map[uint]uint
+	moderator *bool
+	scopes    []string
+}
+
+// Restrict limits the Policy to the actions implied by scopes. A nil slice
+// lifts the restriction.
+func (p *Policy) Restrict(scopes []string) {
+	p.scopes = scopes
+}
+
+func (p *Policy) Can(action string, topicID uint) (bool, error) {
+	if _, ok := implies[action]; !ok {
+		return false, models.ErrUnknownAction
+	}
+
+	if !p.inScope(action) {
+		return false, nil
+	}
+
+	if decided, allowed := p.decide(models.ActionAdminister, p.rules[0]); decided && allowed {
+		return true, nil
+	}
+
+	seen := map[uint]bool{}
+	for level := topicID; ; level = p.parents[level] {
+		if decided, allowed := p.decide(action, p.rules[level]); decided {
+			return allowed, nil
+		}
+
+		if level == 0 || seen[level] {
+			break
+		}
+		seen[level] = true
+	}
+
+	return p.fallback(action)
+}
+
+// decide applies the rules of one level, Group rules before rules for
+// everybody. It reports false when none of them match action.
+func (p *Policy) decide(action string, rules []models.Permission) (bool, bool) {
+	for _, forGroup := range []bool{true, false} {
+		matched, denied := false, false
+		for _, rule := range rules {
+			if (rule.GroupID != nil) != forGroup {
+				continue
+			}
+
+			if rule.Deny && contains(implies[action], rule.Action) {
+				matched, denied = true, true
+			} else if !rule.Deny && contains(implies[rule.Action], action) {
+				matched = true
+			}
+		}
+
+		if matched {
+			return true, !denied
+		}
+	}
+
+	return false, false
+}
+
+func (p *Policy) inScope(action string) bool {
+	if p.scopes == nil {
+		return true
+	}
+
+	for _, scope := range p.scopes {
+		if contains(implies[scope], action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) fallback(action string) (bool, error) {
+	switch action {
+	case models.ActionView:
+		return true, nil
+	case models.ActionStartDiscussion, models.ActionReply:
+		return p.user != nil, nil
+	case models.ActionModerate:
+		return p.isModerator()
+	}
+
+	return false, nil
+}
+
+func (p *Policy) isModerator() (bool, error) {
+	if p.user == nil {
+		return false, nil
+	}
+
+	if p.moderator == nil {
+		ok, err := p.store.Groups().IsMember(p.ctx, p.user.ID, internal.MODERATORGROUP)
+		if err != nil {
+			return false, err
+		}
+
+		p.moderator = &ok
+	}
+
+	return *p.moderator, nil
+}
+
+func contains(actions []string, action string) bool {
+	for _, candidate := range actions {
+		if candidate == action {
+			return true
+		}
+	}
+
+	return false
+}
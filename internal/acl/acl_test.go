@@ -0,0 +1,253 @@
+package acl
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ACL", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var checker *Checker
+	var member, outsider *models.User
+	var staff *models.Group
+	var forum, private, inner *models.Topic
+
+	createUser := func(userName string) *models.User {
+		user := &models.User{UserName: userName, Password: "secret"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+		return user
+	}
+
+	createGroup := func(name string, members ...*models.User) *models.Group {
+		group := &models.Group{Name: name, AuthorID: member.ID}
+		Expect(s.Groups().Create(ctx, group)).Should(Succeed())
+		for _, user := range members {
+			s.AddGroupMember(user.ID, group.ID)
+		}
+		return group
+	}
+
+	createTopic := func(title string, parent *models.Topic) *models.Topic {
+		topic := &models.Topic{Title: title, AuthorID: member.ID}
+		if parent != nil {
+			topic.ParentID = &parent.ID
+		}
+		Expect(s.Topics().Create(ctx, topic)).Should(Succeed())
+		return topic
+	}
+
+	set := func(group *models.Group, topic *models.Topic, action string, deny bool) {
+		permission := &models.Permission{Action: action, Deny: deny}
+		if group != nil {
+			permission.GroupID = &group.ID
+		}
+		if topic != nil {
+			permission.TopicID = &topic.ID
+		}
+		Expect(s.Permissions().Set(ctx, permission)).Should(Succeed())
+	}
+
+	can := func(user *models.User, action string, topic *models.Topic) bool {
+		var topicID uint
+		if topic != nil {
+			topicID = topic.ID
+		}
+
+		ok, err := checker.Can(ctx, user, action, topicID)
+		Expect(err).ShouldNot(HaveOccurred())
+		return ok
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		checker = New(s)
+
+		member = createUser("member")
+		outsider = createUser("outsider")
+		staff = createGroup("staff", member)
+
+		forum = createTopic("Forum", nil)
+		private = createTopic("Private", forum)
+		inner = createTopic("Inner", private)
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	When("no rule matches", func() {
+		It("should let everybody view and signed in Users post", func() {
+			Expect(can(nil, models.ActionView, inner)).Should(BeTrue())
+			Expect(can(nil, models.ActionReply, inner)).Should(BeFalse())
+			Expect(can(outsider, models.ActionReply, inner)).Should(BeTrue())
+			Expect(can(outsider, models.ActionStartDiscussion, inner)).Should(BeTrue())
+			Expect(can(outsider, models.ActionAdminister, nil)).Should(BeFalse())
+		})
+
+		It("should let members of the moderator group moderate", func() {
+			Expect(can(member, models.ActionModerate, inner)).Should(BeFalse())
+
+			createGroup(internal.MODERATORGROUP, member)
+			Expect(can(member, models.ActionModerate, inner)).Should(BeTrue())
+			Expect(can(outsider, models.ActionModerate, inner)).Should(BeFalse())
+		})
+	})
+
+	When("a Topic is restricted to a Group", func() {
+		BeforeEach(func() {
+			set(nil, private, models.ActionView, true)
+			set(staff, private, models.ActionView, false)
+		})
+
+		It("should deny everybody else on the Topic and every Topic below it", func() {
+			Expect(can(outsider, models.ActionView, private)).Should(BeFalse())
+			Expect(can(outsider, models.ActionView, inner)).Should(BeFalse())
+			Expect(can(nil, models.ActionView, inner)).Should(BeFalse())
+			Expect(can(outsider, models.ActionView, forum)).Should(BeTrue())
+		})
+
+		It("should let the Group through because its rule is more specific", func() {
+			Expect(can(member, models.ActionView, inner)).Should(BeTrue())
+		})
+
+		It("should deny actions that imply the denied one", func() {
+			Expect(can(outsider, models.ActionReply, inner)).Should(BeFalse())
+			Expect(can(outsider, models.ActionStartDiscussion, private)).Should(BeFalse())
+		})
+	})
+
+	When("a nearer Topic overrides a rule further up", func() {
+		It("should use the nearest rule", func() {
+			set(staff, nil, models.ActionModerate, false)
+			set(staff, inner, models.ActionModerate, true)
+
+			Expect(can(member, models.ActionModerate, private)).Should(BeTrue())
+			Expect(can(member, models.ActionModerate, inner)).Should(BeFalse())
+			Expect(can(member, models.ActionReply, inner)).Should(BeTrue())
+		})
+	})
+
+	When("allow and deny rules for the same level both match", func() {
+		It("should let the deny win", func() {
+			other := createGroup("other", member)
+			set(staff, private, models.ActionReply, false)
+			set(other, private, models.ActionReply, true)
+
+			Expect(can(member, models.ActionReply, private)).Should(BeFalse())
+		})
+	})
+
+	When("a Group is allowed a higher capability", func() {
+		It("should allow every action it implies", func() {
+			set(staff, nil, models.ActionAdminister, false)
+
+			Expect(can(member, models.ActionAdminister, nil)).Should(BeTrue())
+			Expect(can(member, models.ActionModerate, inner)).Should(BeTrue())
+			Expect(can(outsider, models.ActionAdminister, nil)).Should(BeFalse())
+		})
+	})
+
+	When("a forum administrator is denied on a Topic", func() {
+		It("should still let them in", func() {
+			set(staff, nil, models.ActionAdminister, false)
+			set(nil, private, models.ActionView, true)
+
+			Expect(can(member, models.ActionAdminister, inner)).Should(BeTrue())
+			Expect(can(outsider, models.ActionView, inner)).Should(BeFalse())
+		})
+	})
+
+	When("the Group has been deleted", func() {
+		It("should no longer grant anything", func() {
+			set(staff, nil, models.ActionAdminister, false)
+			Expect(s.Groups().Delete(ctx, staff.ID)).Should(Succeed())
+
+			Expect(can(member, models.ActionAdminister, nil)).Should(BeFalse())
+		})
+	})
+
+	When("the Policy is restricted to scopes", func() {
+		It("should only allow what the scopes imply and the rules allow", func() {
+			set(staff, nil, models.ActionAdminister, false)
+			set(nil, private, models.ActionView, true)
+
+			policy, err := checker.For(ctx, member)
+			Expect(err).ShouldNot(HaveOccurred())
+			policy.Restrict([]string{models.ActionReply})
+
+			for action, expected := range map[string]bool{models.ActionView: true, models.ActionReply: true, models.ActionModerate: false, models.ActionAdminister: false} {
+				ok, err := policy.Can(action, inner.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(Equal(expected))
+			}
+
+			policy, err = checker.For(ctx, outsider)
+			Expect(err).ShouldNot(HaveOccurred())
+			policy.Restrict([]string{models.ActionModerate})
+
+			ok, err := policy.Can(models.ActionView, inner.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ok).Should(BeFalse())
+		})
+	})
+
+	When("the action is unknown", func() {
+		It("should return ErrUnknownAction", func() {
+			_, err := checker.Can(ctx, member, "fly", 0)
+			Expect(err).Should(Equal(models.ErrUnknownAction))
+		})
+	})
+
+	When("checking many Topics", func() {
+		It("should answer from a single Policy", func() {
+			set(nil, private, models.ActionView, true)
+
+			policy, err := checker.For(ctx, outsider)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			for topic, expected := range map[*models.Topic]bool{forum: true, private: false, inner: false} {
+				ok, err := policy.Can(models.ActionView, topic.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(Equal(expected))
+			}
+		})
+	})
+
+	When("checking many Users", func() {
+		It("should answer like a Policy of each of them", func() {
+			set(nil, private, models.ActionView, true)
+			set(staff, private, models.ActionView, false)
+			moderator := createUser("moderator")
+			createGroup(internal.MODERATORGROUP, moderator)
+
+			users, err := s.Users().ListWithGroups(ctx, []uint{member.ID, outsider.ID, moderator.ID})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			viewers, err := checker.Allowed(ctx, users, models.ActionView, inner.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(viewers).Should(HaveLen(1))
+			Expect(viewers[0].ID).Should(Equal(member.ID))
+
+			moderators, err := checker.Allowed(ctx, users, models.ActionModerate, forum.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(moderators).Should(HaveLen(1))
+			Expect(moderators[0].ID).Should(Equal(moderator.ID))
+
+			Expect(s.Groups().Delete(ctx, staff.ID)).Should(Succeed())
+			users, err = s.Users().ListWithGroups(ctx, []uint{member.ID})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			viewers, err = checker.Allowed(ctx, users, models.ActionView, inner.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(viewers).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,395 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/acl"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	"github.com/golangbb/golangbb/v2/pkg/oidc"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+)
+
+const defaultPageLimit = 20
+const maxPageLimit = 100
+
+var errInvalidID = fiber.NewError(fiber.StatusBadRequest, "invalid id")
+var errForbidden = fiber.NewError(fiber.StatusForbidden, "not allowed")
+
+var modelErrorStatuses = map[error]int{
+	models.ErrEmptyID:                     fiber.StatusBadRequest,
+	models.ErrEmptyUserID:                 fiber.StatusBadRequest,
+	models.ErrEmptyUserName:               fiber.StatusBadRequest,
+	models.ErrEmptyDisplayName:            fiber.StatusBadRequest,
+	models.ErrEmptyEmail:                  fiber.StatusBadRequest,
+	models.ErrEmptyPassword:               fiber.StatusBadRequest,
+	models.ErrEmptyName:                   fiber.StatusBadRequest,
+	models.ErrEmptyTitle:                  fiber.StatusBadRequest,
+	models.ErrEmptyContent:                fiber.StatusBadRequest,
+	models.ErrContentTooLong:              fiber.StatusBadRequest,
+	models.ErrUnknownFormat:               fiber.StatusBadRequest,
+	models.ErrReasonTooLong:               fiber.StatusBadRequest,
+	models.ErrEmptyPostID:                 fiber.StatusBadRequest,
+	models.ErrUnknownReaction:             fiber.StatusBadRequest,
+	models.ErrEmptyConversationID:         fiber.StatusBadRequest,
+	models.ErrConversationWithoutMessage:  fiber.StatusBadRequest,
+	models.ErrNoRecipients:                fiber.StatusBadRequest,
+	models.ErrNotParticipant:              fiber.StatusNotFound,
+	models.ErrUserBlocked:                 fiber.StatusForbidden,
+	models.ErrBlockSelf:                   fiber.StatusBadRequest,
+	models.ErrEmptyQuery:                  fiber.StatusBadRequest,
+	models.ErrEmptyDiscussionID:           fiber.StatusBadRequest,
+	models.ErrEmptyTopicID:                fiber.StatusBadRequest,
+	models.ErrDiscussionWithoutSinglePost: fiber.StatusBadRequest,
+	models.ErrTopicNotEmpty:               fiber.StatusConflict,
+	models.ErrDeletedParent:               fiber.StatusConflict,
+	models.ErrUserHasOwnership:            fiber.StatusConflict,
+	models.ErrInvalidSession:              fiber.StatusUnauthorized,
+	models.ErrTopicCycle:                  fiber.StatusConflict,
+	models.ErrTopicTooDeep:                fiber.StatusConflict,
+	models.ErrUnknownAction:               fiber.StatusBadRequest,
+	models.ErrInvalidEmail:                fiber.StatusBadRequest,
+	models.ErrInvalidToken:                fiber.StatusBadRequest,
+	models.ErrEmailVerified:               fiber.StatusConflict,
+	models.ErrEmailNotVerified:            fiber.StatusConflict,
+	models.ErrTwoFactorEnabled:            fiber.StatusConflict,
+	models.ErrTwoFactorNotEnabled:         fiber.StatusConflict,
+	models.ErrTwoFactorRequired:           fiber.StatusConflict,
+	models.ErrInvalidTwoFactorCode:        fiber.StatusBadRequest,
+	models.ErrEmptyScopes:                 fiber.StatusBadRequest,
+	models.ErrInvalidAPIToken:             fiber.StatusUnauthorized,
+	models.ErrIdentityLinked:              fiber.StatusConflict,
+	models.ErrUserDeleted:                 fiber.StatusForbidden,
+	models.ErrEmptyIPAddress:              fiber.StatusBadRequest,
+	models.ErrUnknownNotificationType:     fiber.StatusBadRequest,
+	models.ErrReplyOutsideDiscussion:      fiber.StatusBadRequest,
+	models.ErrUnknownEmailDelivery:        fiber.StatusBadRequest,
+	models.ErrLatestRevision:              fiber.StatusUnprocessableEntity,
+}
+
+type errorBody struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type listResponse struct {
+	Data interface{} `json:"data"`
+}
+
+type pageResponse struct {
+	Data   interface{} `json:"data"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+type handler struct {
+	store  store.Store
+	acl    *acl.Checker
+	mailer mail.Mailer
+	sso    *oidc.RelyingParty
+}
+
+// New returns the API. Single sign-on is disabled when sso is nil.
+func New(s store.Store, mailer mail.Mailer, sso *oidc.RelyingParty) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: errorHandler,
+	})
+
+	Register(app, s, mailer, sso)
+	app.Use(func(c *fiber.Ctx) error {
+		return fiber.ErrNotFound
+	})
+
+	return app
+}
+
+func Register(app *fiber.App, s store.Store, mailer mail.Mailer, sso *oidc.RelyingParty) {
+	h := &handler{store: s, acl: acl.New(s), mailer: mailer, sso: sso}
+	api := app.Group("/api", h.loadSession)
+
+	auth := api.Group("/auth")
+	auth.Post("/login", h.login)
+	auth.Post("/logout", requireSession, requireInteractive, h.logout)
+	auth.Post("/logout/all", requireSession, requireInteractive, h.logoutAll)
+	auth.Get("/me", requireSession, h.me)
+	auth.Post("/password/forgot", h.forgotPassword)
+	auth.Post("/password/reset", h.resetPassword)
+	auth.Get("/two-factor", requireSession, requireInteractive, h.twoFactorStatus)
+	auth.Post("/two-factor", requireSession, requireInteractive, h.enrolTwoFactor)
+	auth.Delete("/two-factor", requireSession, requireInteractive, h.disableTwoFactor)
+	auth.Post("/two-factor/confirm", requireSession, requireInteractive, h.confirmTwoFactor)
+	auth.Post("/two-factor/recovery-codes", requireSession, requireInteractive, h.regenerateRecoveryCodes)
+	auth.Get("/tokens", requireSession, requireInteractive, h.listAPITokens)
+	auth.Post("/tokens", requireSession, requireInteractive, h.createAPIToken)
+	auth.Delete("/tokens/:id", requireSession, requireInteractive, h.revokeAPIToken)
+	auth.Get("/oidc/login", requireInteractive, h.oidcLogin)
+	auth.Get("/oidc/callback", requireInteractive, h.oidcCallback)
+
+	v1 := api.Group("/v1", h.enforceTwoFactor)
+	v1.Get("/topics", h.listTopics)
+	v1.Post("/topics", requireSession, h.createTopic)
+	v1.Get("/topics/tree", h.topicTree)
+	v1.Get("/topics/unread", requireSession, h.unreadTopics)
+	v1.Post("/topics/read", requireSession, h.markAllRead)
+	v1.Get("/topics/:id", h.getTopic)
+	v1.Patch("/topics/:id", requireSession, h.updateTopic)
+	v1.Delete("/topics/:id", requireSession, h.deleteTopic)
+	v1.Get("/topics/:id/ancestors", h.topicAncestors)
+	v1.Get("/topics/:id/descendants", h.topicDescendants)
+	v1.Post("/topics/:id/move", requireSession, h.moveTopic)
+	v1.Post("/topics/:id/read", requireSession, h.markTopicRead)
+	v1.Put("/topics/:id/subscription", requireSession, h.subscribeTopic)
+	v1.Delete("/topics/:id/subscription", requireSession, h.unsubscribeTopic)
+	v1.Get("/topics/:id/discussions", h.listDiscussions)
+	v1.Post("/topics/:id/discussions", requireSession, h.createDiscussion)
+
+	v1.Get("/discussions/:id", h.getDiscussion)
+	v1.Patch("/discussions/:id", requireSession, h.updateDiscussion)
+	v1.Delete("/discussions/:id", requireSession, h.deleteDiscussion)
+	v1.Get("/discussions/:id/posts", h.listPosts)
+	v1.Post("/discussions/:id/posts", requireSession, h.createPost)
+	v1.Post("/discussions/:id/read", requireSession, h.markDiscussionRead)
+	v1.Get("/discussions/:id/unread", requireSession, h.firstUnread)
+	v1.Put("/discussions/:id/subscription", requireSession, h.subscribeDiscussion)
+	v1.Delete("/discussions/:id/subscription", requireSession, h.unsubscribeDiscussion)
+
+	v1.Get("/posts/:id", h.getPost)
+	v1.Patch("/posts/:id", requireSession, h.updatePost)
+	v1.Delete("/posts/:id", requireSession, h.deletePost)
+	v1.Get("/posts/:id/revisions", h.listPostRevisions)
+	v1.Get("/posts/:id/revisions/diff", h.diffPostRevisions)
+	v1.Get("/posts/:id/reactions", h.listReactions)
+	v1.Put("/posts/:id/reactions/:type", requireSession, h.addReaction)
+	v1.Delete("/posts/:id/reactions/:type", requireSession, h.removeReaction)
+	v1.Get("/reaction-types", h.listReactionTypes)
+	v1.Get("/mentions", requireSession, h.listMentions)
+
+	v1.Get("/search", h.search)
+
+	v1.Get("/users/:id", h.getUser)
+
+	v1.Get("/emails", requireSession, requireInteractive, h.listEmails)
+	v1.Post("/emails", requireSession, requireInteractive, h.createEmail)
+	v1.Get("/emails/verify", h.verifyEmail)
+	v1.Post("/emails/verify", h.verifyEmail)
+	v1.Post("/emails/verification", requireSession, requireInteractive, h.resendVerification)
+	v1.Post("/emails/primary", requireSession, requireInteractive, h.setPrimaryEmail)
+
+	v1.Get("/conversations", requireSession, requireInteractive, h.listConversations)
+	v1.Post("/conversations", requireSession, requireInteractive, h.createConversation)
+	v1.Get("/conversations/unread", requireSession, requireInteractive, h.unreadMessages)
+	v1.Get("/conversations/:id", requireSession, requireInteractive, h.getConversation)
+	v1.Delete("/conversations/:id", requireSession, requireInteractive, participate(h.store.Conversations().Clear))
+	v1.Get("/conversations/:id/messages", requireSession, requireInteractive, h.listMessages)
+	v1.Post("/conversations/:id/messages", requireSession, requireInteractive, h.sendMessage)
+	v1.Post("/conversations/:id/participants", requireSession, requireInteractive, h.addConversationParticipant)
+	v1.Post("/conversations/:id/read", requireSession, requireInteractive, participate(h.store.Conversations().MarkRead))
+	v1.Post("/conversations/:id/mute", requireSession, requireInteractive, participate(h.store.Conversations().Mute))
+	v1.Post("/conversations/:id/unmute", requireSession, requireInteractive, participate(h.store.Conversations().Unmute))
+	v1.Post("/conversations/:id/leave", requireSession, requireInteractive, participate(h.store.Conversations().Leave))
+
+	v1.Get("/notifications", requireSession, h.listNotifications)
+	v1.Get("/notifications/unread", requireSession, h.unreadNotifications)
+	v1.Post("/notifications/read", requireSession, h.markAllNotificationsRead)
+	v1.Get("/notifications/preferences", requireSession, h.listNotificationPreferences)
+	v1.Put("/notifications/preferences", requireSession, h.setNotificationPreference)
+	v1.Get("/notifications/unsubscribe", h.unsubscribeEmails)
+	v1.Post("/notifications/unsubscribe", h.unsubscribeEmails)
+	v1.Post("/notifications/:id/read", requireSession, h.setNotificationRead(true))
+	v1.Post("/notifications/:id/unread", requireSession, h.setNotificationRead(false))
+	v1.Get("/subscriptions", requireSession, h.listSubscriptions)
+
+	v1.Get("/blocks", requireSession, requireInteractive, h.listBlocks)
+	v1.Put("/blocks/:id", requireSession, requireInteractive, h.blockUser)
+	v1.Delete("/blocks/:id", requireSession, requireInteractive, h.unblockUser)
+
+	v1.Get("/permissions", requireSession, h.requirePermission(models.ActionAdminister), h.listPermissions)
+	v1.Put("/permissions", requireSession, h.setPermission)
+	v1.Delete("/permissions/:id", requireSession, h.deletePermission)
+
+	v1.Put("/groups/:id/two-factor", requireSession, h.requirePermission(models.ActionAdminister), h.setGroupTwoFactor)
+
+	v1.Get("/failed-logins", requireSession, h.requirePermission(models.ActionAdminister), h.listFailedLogins)
+	v1.Post("/users/:id/unlock", requireSession, h.requirePermission(models.ActionAdminister), moderate(h.store.LoginAttempts().Unlock))
+
+	v1.Post("/topics/:id/restore", requireSession, h.requirePermission(models.ActionModerate), moderate(h.store.Topics().Restore))
+	v1.Delete("/topics/:id/purge", requireSession, h.requirePermission(models.ActionModerate), moderate(h.store.Topics().Purge))
+	v1.Post("/discussions/:id/restore", requireSession, h.moderateIn(h.store.Discussions().TopicID, h.store.Discussions().Restore))
+	v1.Delete("/discussions/:id/purge", requireSession, h.moderateIn(h.store.Discussions().TopicID, h.store.Discussions().Purge))
+	v1.Post("/posts/:id/restore", requireSession, h.moderateIn(h.store.Posts().TopicID, h.store.Posts().Restore))
+	v1.Delete("/posts/:id/purge", requireSession, h.moderateIn(h.store.Posts().TopicID, h.store.Posts().Purge))
+	v1.Post("/revisions/:id/hide", requireSession, h.moderateIn(h.revisionTopicID, h.store.Posts().HideRevision))
+	v1.Post("/revisions/:id/unhide", requireSession, h.moderateIn(h.revisionTopicID, h.store.Posts().UnhideRevision))
+	v1.Delete("/users/:id", requireSession, h.requirePermission(models.ActionModerate), moderate(h.store.Users().Delete))
+	v1.Post("/users/:id/restore", requireSession, h.requirePermission(models.ActionModerate), moderate(h.store.Users().Restore))
+	v1.Delete("/users/:id/purge", requireSession, h.requirePermission(models.ActionModerate), moderate(h.store.Users().Purge))
+}
+
+func errorHandler(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	message := "internal server error"
+
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &fiberErr):
+		status = fiberErr.Code
+		message = fiberErr.Message
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = fiber.StatusNotFound
+		message = "resource not found"
+	default:
+		if modelStatus, ok := modelErrorStatus(err); ok {
+			status = modelStatus
+			message = err.Error()
+			break
+		}
+
+		log.Printf("[API]::UNHANDLED_ERROR 💥 %s %s: %v\n", c.Method(), c.Path(), err)
+	}
+
+	return c.Status(status).JSON(errorResponse{
+		Error: errorBody{
+			Status:  status,
+			Message: message,
+		},
+	})
+}
+
+func modelErrorStatus(err error) (int, bool) {
+	for modelErr, status := range modelErrorStatuses {
+		if errors.Is(err, modelErr) {
+			return status, true
+		}
+	}
+
+	return 0, false
+}
+
+func paramID(c *fiber.Ctx) (uint, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, errInvalidID
+	}
+
+	return uint(id), nil
+}
+
+func pagination(c *fiber.Ctx) (int, int) {
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageLimit
+	}
+
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	return offset, limit
+}
+
+func currentSession(c *fiber.Ctx) *models.Session {
+	return c.Locals(localsSession).(*models.Session)
+}
+
+// currentUser returns the signed in User, or nil for a guest.
+func currentUser(c *fiber.Ctx) *models.User {
+	session, ok := c.Locals(localsSession).(*models.Session)
+	if !ok {
+		return nil
+	}
+
+	return &session.User
+}
+
+// policy loads the permission rules of the current User once per request,
+// capped to the scopes of the API token the request was made with.
+func (h *handler) policy(c *fiber.Ctx) (*acl.Policy, error) {
+	if policy, ok := c.Locals(localsPolicy).(*acl.Policy); ok {
+		return policy, nil
+	}
+
+	policy, err := h.acl.For(c.Context(), currentUser(c))
+	if err != nil {
+		return nil, err
+	}
+
+	if token := currentAPIToken(c); token != nil {
+		policy.Restrict(token.ScopeList())
+	}
+
+	c.Locals(localsPolicy, policy)
+	return policy, nil
+}
+
+// authorize fails with errForbidden unless the current User may perform
+// action on the Topic with topicID, or on the whole forum when it is 0.
+func (h *handler) authorize(c *fiber.Ctx, action string, topicID uint) error {
+	policy, err := h.policy(c)
+	if err != nil {
+		return err
+	}
+
+	ok, err := policy.Can(action, topicID)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errForbidden
+	}
+
+	return nil
+}
+
+// authorizeAuthor lets authors change their own content for as long as they
+// may still reply where it lives. Anybody else has to be able to moderate.
+func (h *handler) authorizeAuthor(c *fiber.Ctx, authorID uint, topicID uint) error {
+	if currentSession(c).UserID == authorID {
+		if err := h.authorize(c, models.ActionReply, topicID); err != errForbidden {
+			return err
+		}
+	}
+
+	return h.authorize(c, models.ActionModerate, topicID)
+}
+
+// viewable drops the Topics, and the sub-Topics in their Children, that the
+// current User may not view.
+func (h *handler) viewable(c *fiber.Ctx, topics []models.Topic) ([]models.Topic, error) {
+	policy, err := h.policy(c)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []models.Topic{}
+	for _, topic := range topics {
+		ok, err := policy.Can(models.ActionView, topic.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if topic.Children, err = h.viewable(c, topic.Children); err != nil {
+			return nil, err
+		}
+
+		visible = append(visible, topic)
+	}
+
+	return visible, nil
+}
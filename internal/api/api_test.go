@@ -0,0 +1,236 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+)
+
+const testSessionToken = "some token"
+
+func expectSessionQuery(mock sqlmock.Sqlmock, userID uint) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `sessions` WHERE id = ? AND expires_at > ? LIMIT 1")).
+		WithArgs(tokens.Hash(testSessionToken), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(tokens.Hash(testSessionToken), userID))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL")).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "display_name"}).AddRow(userID, "MotherOfDragons", "Mother Of Dragons"))
+}
+
+// expectTwoFactorPolicyQuery expects the check that keeps members of Groups
+// requiring two-factor authentication out of /api/v1, and passes the User.
+func expectTwoFactorPolicyQuery(mock sqlmock.Sqlmock, userID uint) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `groups` WHERE (require_two_factor = ? AND id IN (SELECT group_id FROM `users_groups` WHERE user_id = ?)) AND `groups`.`deleted_at` IS NULL")).
+		WithArgs(true, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
+
+// expectPermissionsQuery expects the rules of a User, or of a guest when
+// userID is 0, to be loaded and returns none of them.
+func expectPermissionsQuery(mock sqlmock.Sqlmock, userID uint) {
+	query := "SELECT * FROM `permissions` WHERE group_id IS NULL ORDER BY id"
+	if userID != 0 {
+		query = "SELECT * FROM `permissions` WHERE group_id IS NULL OR group_id IN (SELECT `id` FROM `groups` WHERE id IN (SELECT group_id FROM `users_groups` WHERE user_id = ?) AND `groups`.`deleted_at` IS NULL) ORDER BY id"
+	}
+
+	expectation := mock.ExpectQuery(regexp.QuoteMeta(query))
+	if userID != 0 {
+		expectation = expectation.WithArgs(userID)
+	}
+
+	expectation.WillReturnRows(sqlmock.NewRows([]string{"id", "group_id", "topic_id", "action", "deny"}))
+}
+
+// expectAdministratorPermissionsQuery lets the User administer the whole
+// forum through a Group.
+func expectAdministratorPermissionsQuery(mock sqlmock.Sqlmock, userID uint) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `permissions` WHERE group_id IS NULL OR group_id IN (SELECT `id` FROM `groups` WHERE id IN (SELECT group_id FROM `users_groups` WHERE user_id = ?) AND `groups`.`deleted_at` IS NULL) ORDER BY id")).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "group_id", "topic_id", "action", "deny"}).AddRow(1, 1, nil, models.ActionAdminister, false))
+}
+
+func expectModeratorQuery(mock sqlmock.Sqlmock, userID uint, moderator bool) {
+	count := 0
+	if moderator {
+		count = 1
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `groups` WHERE (name = ? AND id IN (SELECT group_id FROM `users_groups` WHERE user_id = ?))")).
+		WithArgs(internal.MODERATORGROUP, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+}
+
+func newRequest(method, target, body string) *http.Request {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	request := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+
+	return request
+}
+
+func newSessionRequest(method, target, body string) *http.Request {
+	request := newRequest(method, target, body)
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: testSessionToken})
+	return request
+}
+
+func decodeError(response *http.Response) errorBody {
+	body := &errorResponse{}
+	Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+	return body.Error
+}
+
+var _ = Describe("API", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		db.Close()
+	})
+
+	Context("errorHandler", func() {
+		var app *fiber.App
+
+		BeforeEach(func() {
+			app = fiber.New(fiber.Config{ErrorHandler: errorHandler})
+		})
+
+		respond := func(err error) (*http.Response, errorBody) {
+			app.Get("/", func(c *fiber.Ctx) error {
+				return err
+			})
+
+			response, testErr := app.Test(newRequest(fiber.MethodGet, "/", ""))
+			Expect(testErr).ShouldNot(HaveOccurred())
+			return response, decodeError(response)
+		}
+
+		When("a handler returns a model validation error", func() {
+			It("should respond 400 with the validation message", func() {
+				response, body := respond(models.ErrEmptyTitle)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+				Expect(body.Status).Should(Equal(fiber.StatusBadRequest))
+				Expect(body.Message).Should(Equal(models.ErrEmptyTitle.Error()))
+			})
+		})
+
+		When("a handler returns a wrapped model validation error", func() {
+			It("should respond with the status of the wrapped error", func() {
+				response, _ := respond(fmt.Errorf("creating: %w", models.ErrDiscussionWithoutSinglePost))
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+			})
+		})
+
+		When("a handler returns gorm.ErrRecordNotFound", func() {
+			It("should respond 404", func() {
+				response, body := respond(gorm.ErrRecordNotFound)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+				Expect(body.Message).ShouldNot(ContainSubstring("record"))
+			})
+		})
+
+		When("a handler returns an unexpected error", func() {
+			It("should respond 500 without leaking the error", func() {
+				response, body := respond(errors.New("near \"SELECT\": syntax error"))
+				Expect(response.StatusCode).Should(Equal(fiber.StatusInternalServerError))
+				Expect(body.Message).ShouldNot(ContainSubstring("SELECT"))
+			})
+		})
+
+		When("a handler returns a fiber.Error", func() {
+			It("should respond with its status and message", func() {
+				response, body := respond(errForbidden)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+				Expect(body.Message).Should(Equal(errForbidden.Message))
+			})
+		})
+	})
+
+	Context("pagination", func() {
+		paginate := func(query string) (int, int) {
+			var offset, limit int
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				offset, limit = pagination(c)
+				return nil
+			})
+
+			_, err := app.Test(newRequest(fiber.MethodGet, "/"+query, ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			return offset, limit
+		}
+
+		When("no pagination parameters are given", func() {
+			It("should use the default limit from the start", func() {
+				offset, limit := paginate("")
+				Expect(offset).Should(Equal(0))
+				Expect(limit).Should(Equal(defaultPageLimit))
+			})
+		})
+
+		When("valid pagination parameters are given", func() {
+			It("should use them", func() {
+				offset, limit := paginate("?offset=40&limit=10")
+				Expect(offset).Should(Equal(40))
+				Expect(limit).Should(Equal(10))
+			})
+		})
+
+		When("the limit exceeds the maximum or the offset is negative", func() {
+			It("should clamp them", func() {
+				offset, limit := paginate("?offset=-5&limit=1000")
+				Expect(offset).Should(Equal(0))
+				Expect(limit).Should(Equal(maxPageLimit))
+			})
+		})
+	})
+
+	Context("unknown routes", func() {
+		It("should respond 404 with a structured error", func() {
+			response, err := New(store.New(database.DBConnection), &mail.Outbox{}, nil).Test(newRequest(fiber.MethodGet, "/api/v1/nothing-here", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+			Expect(decodeError(response).Status).Should(Equal(fiber.StatusNotFound))
+
+			err = mock.ExpectationsWereMet()
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
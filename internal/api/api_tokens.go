@@ -0,0 +1,143 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"strings"
+	"time"
+)
+
+const localsAPIToken = "apiToken"
+const bearerPrefix = "Bearer "
+
+var errInvalidAPIToken = fiber.NewError(fiber.StatusUnauthorized, "invalid api token")
+var errInteractiveOnly = fiber.NewError(fiber.StatusForbidden, "not allowed with an api token")
+var errExpiresInPast = fiber.NewError(fiber.StatusBadRequest, "expiresAt must be in the future")
+
+// apiTokenRequest names the actions the token may perform. ExpiresAt defaults
+// to APITOKENLIFETIME from now.
+type apiTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type apiTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// createdAPITokenResponse is the only response that carries the secret.
+type createdAPITokenResponse struct {
+	apiTokenResponse
+	Token string `json:"token"`
+}
+
+func newAPITokenResponse(token *models.APIToken) apiTokenResponse {
+	return apiTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.ScopeList(),
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+func (h *handler) listAPITokens(c *fiber.Ctx) error {
+	apiTokens, err := h.store.APITokens().List(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	data := make([]apiTokenResponse, len(apiTokens))
+	for i := range apiTokens {
+		data[i] = newAPITokenResponse(&apiTokens[i])
+	}
+
+	return c.JSON(listResponse{Data: data})
+}
+
+func (h *handler) createAPIToken(c *fiber.Ctx) error {
+	request := &apiTokenRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	expiresAt := time.Now().Add(internal.APITOKENLIFETIME)
+	if request.ExpiresAt != nil {
+		if !request.ExpiresAt.After(time.Now()) {
+			return errExpiresInPast
+		}
+
+		expiresAt = *request.ExpiresAt
+	}
+
+	token := &models.APIToken{
+		Name:      request.Name,
+		Scopes:    strings.Join(request.Scopes, " "),
+		ExpiresAt: expiresAt,
+		UserID:    currentSession(c).UserID,
+	}
+
+	secret, err := h.store.APITokens().Create(c.Context(), token)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(createdAPITokenResponse{
+		apiTokenResponse: newAPITokenResponse(token),
+		Token:            secret,
+	})
+}
+
+func (h *handler) revokeAPIToken(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.APITokens().Revoke(c.Context(), currentSession(c).UserID, id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// loadAPIToken signs the request in as the owner of the bearer token. Unlike
+// a stale cookie, a bad token is rejected rather than treated as a guest, so
+// that scripts notice.
+func (h *handler) loadAPIToken(c *fiber.Ctx, header string) error {
+	token, err := h.store.APITokens().Authenticate(c.Context(), strings.TrimPrefix(header, bearerPrefix))
+	if err == models.ErrInvalidAPIToken {
+		return errInvalidAPIToken
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.Locals(localsSession, &models.Session{UserID: token.UserID, User: token.User})
+	c.Locals(localsAPIToken, token)
+	return c.Next()
+}
+
+func currentAPIToken(c *fiber.Ctx) *models.APIToken {
+	token, _ := c.Locals(localsAPIToken).(*models.APIToken)
+	return token
+}
+
+// requireInteractive keeps API tokens away from the account itself, so that a
+// leaked token cannot be used to mint more tokens or lock its owner out.
+func requireInteractive(c *fiber.Ctx) error {
+	if currentAPIToken(c) != nil {
+		return errInteractiveOnly
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ = Describe("API tokens", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var user *models.User
+	var cookie *http.Cookie
+
+	send := func(request *http.Request) *http.Response {
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	withCookie := func(method, target, body string) *http.Response {
+		request := newRequest(method, target, body)
+		request.AddCookie(cookie)
+		return send(request)
+	}
+
+	withToken := func(secret, method, target, body string) *http.Response {
+		request := newRequest(method, target, body)
+		request.Header.Set(fiber.HeaderAuthorization, "Bearer "+secret)
+		return send(request)
+	}
+
+	create := func(body string) *createdAPITokenResponse {
+		response := withCookie(fiber.MethodPost, "/api/auth/tokens", body)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+
+		created := &createdAPITokenResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(created)).Should(Succeed())
+		return created
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		user = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+
+		session, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		cookie = &http.Cookie{Name: sessionCookieName, Value: session}
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	Context("POST /api/auth/tokens", func() {
+		It("should show the secret once and list the token without it", func() {
+			created := create(`{"name":"announcer","scopes":["start_discussion"]}`)
+			Expect(strings.HasPrefix(created.Token, models.APITokenPrefix)).Should(BeTrue())
+			Expect(created.Scopes).Should(Equal([]string{models.ActionStartDiscussion}))
+			Expect(created.ExpiresAt).Should(BeTemporally(">", time.Now().Add(24*time.Hour)))
+
+			response := withCookie(fiber.MethodGet, "/api/auth/tokens", "")
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			var body map[string][]map[string]interface{}
+			Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+			Expect(body["data"]).Should(HaveLen(1))
+			Expect(body["data"][0]).ShouldNot(HaveKey("token"))
+		})
+
+		It("should reject unknown scopes and past expiry dates", func() {
+			Expect(withCookie(fiber.MethodPost, "/api/auth/tokens", `{"name":"bot","scopes":["fly"]}`).StatusCode).Should(Equal(fiber.StatusBadRequest))
+			Expect(withCookie(fiber.MethodPost, "/api/auth/tokens", `{"name":"bot","scopes":[]}`).StatusCode).Should(Equal(fiber.StatusBadRequest))
+			Expect(withCookie(fiber.MethodPost, "/api/auth/tokens", `{"name":"bot","scopes":["view"],"expiresAt":"2000-01-01T00:00:00Z"}`).StatusCode).Should(Equal(fiber.StatusBadRequest))
+		})
+	})
+
+	Context("Authorization: Bearer", func() {
+		It("should act as the User within the scopes of the token", func() {
+			poster := create(`{"name":"poster","scopes":["start_discussion"]}`)
+			reader := create(`{"name":"reader","scopes":["view"]}`)
+
+			response := withToken(poster.Token, fiber.MethodGet, "/api/auth/me", "")
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			topic := &models.Topic{Title: "Announcements", AuthorID: user.ID}
+			Expect(s.Topics().Create(ctx, topic)).Should(Succeed())
+			target := fmt.Sprintf("/api/v1/topics/%d/discussions", topic.ID)
+
+			response = withToken(poster.Token, fiber.MethodPost, target, `{"title":"Winter","content":"is coming"}`)
+			Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+
+			response = withToken(reader.Token, fiber.MethodPost, target, `{"title":"Rumours","content":"abound"}`)
+			Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			Expect(withToken(reader.Token, fiber.MethodGet, "/api/v1/topics", "").StatusCode).Should(Equal(fiber.StatusOK))
+		})
+
+		It("should keep the token away from the account", func() {
+			created := create(`{"name":"bot","scopes":["administer"]}`)
+
+			Expect(withToken(created.Token, fiber.MethodPost, "/api/auth/tokens", `{"name":"more","scopes":["view"]}`).StatusCode).Should(Equal(fiber.StatusForbidden))
+			Expect(withToken(created.Token, fiber.MethodPost, "/api/auth/two-factor", "").StatusCode).Should(Equal(fiber.StatusForbidden))
+			Expect(withToken(created.Token, fiber.MethodGet, "/api/v1/emails", "").StatusCode).Should(Equal(fiber.StatusForbidden))
+		})
+
+		It("should reject an unknown or revoked token", func() {
+			created := create(`{"name":"bot","scopes":["view"]}`)
+
+			response := withCookie(fiber.MethodDelete, fmt.Sprintf("/api/auth/tokens/%d", created.ID), "")
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+
+			response = withToken(created.Token, fiber.MethodGet, "/api/v1/topics", "")
+			Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+			Expect(decodeError(response).Message).Should(Equal("invalid api token"))
+			Expect(withToken("gbb_nonsense", fiber.MethodGet, "/api/v1/topics", "").StatusCode).Should(Equal(fiber.StatusUnauthorized))
+		})
+	})
+
+	Context("DELETE /api/auth/tokens/:id", func() {
+		It("should not revoke the tokens of other Users", func() {
+			other := &models.User{UserName: "AryaStark", Password: "needle"}
+			Expect(s.Users().Create(ctx, other)).Should(Succeed())
+			token := &models.APIToken{Name: "bot", Scopes: "view", UserID: other.ID, ExpiresAt: time.Now().Add(time.Hour)}
+			_, err := s.APITokens().Create(ctx, token)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			response := withCookie(fiber.MethodDelete, fmt.Sprintf("/api/auth/tokens/%d", token.ID), "")
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+const sessionCookieName = "golangbb_session"
+const localsSession = "session"
+const localsPolicy = "policy"
+const maxUserAgentLength = 255
+
+var errInvalidCredentials = fiber.NewError(fiber.StatusUnauthorized, "invalid user name, email or password")
+var errUnauthenticated = fiber.NewError(fiber.StatusUnauthorized, "authentication required")
+var errMalformedBody = fiber.NewError(fiber.StatusBadRequest, "malformed request body")
+
+// loginRequest identifies the User by UserName or by a verified Email. Code
+// is only needed once the User has enabled two-factor authentication.
+type loginRequest struct {
+	UserName string `json:"userName"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type userResponse struct {
+	ID          uint      `json:"id"`
+	UserName    string    `json:"userName"`
+	DisplayName string    `json:"displayName"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func newUserResponse(user *models.User) userResponse {
+	return userResponse{
+		ID:          user.ID,
+		UserName:    user.UserName,
+		DisplayName: user.DisplayName,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+func (h *handler) login(c *fiber.Ctx) error {
+	request := &loginRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if (request.UserName == "" && request.Email == "") || request.Password == "" {
+		return errInvalidCredentials
+	}
+
+	user, err := h.loginUser(c, request)
+	if err == gorm.ErrRecordNotFound {
+		user = nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := h.checkLoginLock(c, user); err != nil {
+		return err
+	}
+
+	if user == nil {
+		log.Println("[API_LOGIN]::UNKNOWN_USER_NAME_WARNING ⚠️")
+		if err := models.VerifyDummyPassword(request.Password); err != nil {
+			return err
+		}
+
+		return h.loginFailed(c, request, nil, models.LoginFailureUnknownUser, errInvalidCredentials)
+	}
+
+	ok, err := h.store.Users().VerifyPassword(c.Context(), user, request.Password)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		log.Println("[API_LOGIN]::INCORRECT_PASSWORD_WARNING ⚠️")
+		return h.loginFailed(c, request, user, models.LoginFailurePassword, errInvalidCredentials)
+	}
+
+	err = h.loginTwoFactor(c, user, request.Code)
+	if err == errInvalidTwoFactorCode {
+		return h.loginFailed(c, request, user, models.LoginFailureTwoFactor, err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.LoginAttempts().Unlock(c.Context(), user.ID); err != nil {
+		return err
+	}
+
+	if err := h.startSession(c, user); err != nil {
+		return err
+	}
+
+	return c.JSON(newUserResponse(user))
+}
+
+// startSession signs the User in on this browser.
+func (h *handler) startSession(c *fiber.Ctx, user *models.User) error {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	session := &models.Session{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(internal.SESSIONLIFETIME),
+		UserAgent: userAgent,
+		IPAddress: c.IP(),
+	}
+
+	token, err := h.store.Sessions().Create(c.Context(), session)
+	if err != nil {
+		return err
+	}
+
+	setSessionCookie(c, token, session.ExpiresAt)
+	return nil
+}
+
+// loginUser finds the User a login request names. Unverified addresses are
+// treated as unknown, since anybody could have added them.
+func (h *handler) loginUser(c *fiber.Ctx, request *loginRequest) (*models.User, error) {
+	if request.UserName != "" {
+		return h.store.Users().GetByUserName(c.Context(), request.UserName)
+	}
+
+	email, err := h.store.Emails().Get(c.Context(), request.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if !email.Verified {
+		log.Println("[API_LOGIN]::UNVERIFIED_EMAIL_WARNING ⚠️")
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return h.store.Users().Get(c.Context(), email.UserID)
+}
+
+// loginTwoFactor checks the second factor of Users who enabled it.
+func (h *handler) loginTwoFactor(c *fiber.Ctx, user *models.User, code string) error {
+	twoFactor, err := h.store.TwoFactor().Get(c.Context(), user.ID)
+	if err == gorm.ErrRecordNotFound || err == nil && !twoFactor.Confirmed {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if code == "" {
+		return errTwoFactorCodeRequired
+	}
+
+	err = h.store.TwoFactor().Verify(c.Context(), user.ID, code)
+	if err == models.ErrInvalidTwoFactorCode {
+		log.Println("[API_LOGIN]::INCORRECT_TWO_FACTOR_CODE_WARNING ⚠️")
+		return errInvalidTwoFactorCode
+	}
+
+	return err
+}
+
+// logout ends the session of the cookie.
+func (h *handler) logout(c *fiber.Ctx) error {
+	token := c.Cookies(sessionCookieName)
+	if token == "" {
+		return errUnauthenticated
+	}
+
+	if err := h.store.Sessions().Delete(c.Context(), token); err != nil {
+		return err
+	}
+
+	clearSessionCookie(c)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) logoutAll(c *fiber.Ctx) error {
+	session := currentSession(c)
+	if err := h.store.Sessions().DeleteForUser(c.Context(), session.UserID); err != nil {
+		return err
+	}
+
+	clearSessionCookie(c)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) me(c *fiber.Ctx) error {
+	session := currentSession(c)
+	return c.JSON(newUserResponse(&session.User))
+}
+
+// loadSession resolves the API token or the session cookie, if there is one,
+// for every request so that handlers open to guests still know who is signed
+// in.
+func (h *handler) loadSession(c *fiber.Ctx) error {
+	if header := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(header, bearerPrefix) {
+		return h.loadAPIToken(c, header)
+	}
+
+	token := c.Cookies(sessionCookieName)
+	if token == "" {
+		return c.Next()
+	}
+
+	session, err := h.store.Sessions().Get(c.Context(), token)
+	if err == models.ErrInvalidSession {
+		clearSessionCookie(c)
+		return c.Next()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.Locals(localsSession, session)
+	return c.Next()
+}
+
+func requireSession(c *fiber.Ctx) error {
+	if currentUser(c) == nil {
+		return errUnauthenticated
+	}
+
+	return c.Next()
+}
+
+func setSessionCookie(c *fiber.Ctx, token string, expiresAt time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   internal.COOKIESECURE,
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+}
+
+func clearSessionCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		Secure:   internal.COOKIESECURE,
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+}
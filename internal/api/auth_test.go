@@ -0,0 +1,286 @@
+package api
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"net/http"
+	"regexp"
+)
+
+var _ = Describe("Auth", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+	var app *fiber.App
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		app = New(store.New(database.DBConnection), &mail.Outbox{}, nil)
+	})
+	AfterEach(func() {
+		db.Close()
+	})
+
+	sessionCookie := func(response *http.Response) *http.Cookie {
+		for _, cookie := range response.Cookies() {
+			if cookie.Name == sessionCookieName {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	Context("POST /api/auth/login", func() {
+		login := func(body string) *http.Response {
+			response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/login", body))
+			Expect(err).ShouldNot(HaveOccurred())
+			return response
+		}
+
+		expectLoginLockQuery := func(args ...driver.Value) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_throttles` WHERE throttle_key IN")).
+				WithArgs(append(args, sqlmock.AnyArg())...).
+				WillReturnRows(sqlmock.NewRows([]string{"throttle_key"}))
+		}
+
+		expectFailedLogin := func(reason string, keys ...string) {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `failed_logins`")).
+				WithArgs(sqlmock.AnyArg(), "MotherOfDragons", reason, "0.0.0.0", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			for _, key := range keys {
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `login_throttles`")).
+					WithArgs(key, 0, sqlmock.AnyArg(), nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `login_throttles` SET `failures`=CASE")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), key).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_throttles` WHERE throttle_key = ? LIMIT 1")).
+					WithArgs(key).
+					WillReturnRows(sqlmock.NewRows([]string{"throttle_key", "failures"}).AddRow(key, 1))
+			}
+			mock.ExpectCommit()
+		}
+
+		When("logging in with a correct user name and password", func() {
+			It("should create a Session and set a secure HttpOnly session cookie", func() {
+				hash, err := models.PasswordHasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE user_name = ? AND `users`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs("MotherOfDragons").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "display_name", "password"}).AddRow(1, "MotherOfDragons", "Mother Of Dragons", hash))
+				expectLoginLockQuery("ip:0.0.0.0", "user:1")
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `two_factors` WHERE user_id = ? LIMIT 1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `login_throttles` WHERE throttle_key = ?")).
+					WithArgs("user:1").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `sessions` (`id`,`created_at`,`updated_at`,`expires_at`,`user_agent`,`ip_address`,`user_id`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				response := login(`{"userName":"MotherOfDragons","password":"password"}`)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				cookie := sessionCookie(response)
+				Expect(cookie).ShouldNot(BeNil())
+				Expect(cookie.Value).ShouldNot(BeEmpty())
+				Expect(cookie.HttpOnly).Should(BeTrue())
+				Expect(cookie.Secure).Should(BeTrue())
+
+				body := &userResponse{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(body.ID).Should(Equal(uint(1)))
+				Expect(body.UserName).Should(Equal("MotherOfDragons"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("logging in with an incorrect password", func() {
+			It("should respond 401 without creating a Session", func() {
+				hash, err := models.PasswordHasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE user_name = ? AND `users`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs("MotherOfDragons").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "password"}).AddRow(1, "MotherOfDragons", hash))
+				expectLoginLockQuery("ip:0.0.0.0", "user:1")
+				expectFailedLogin(models.LoginFailurePassword, "ip:0.0.0.0", "user:1")
+
+				response := login(`{"userName":"MotherOfDragons","password":"not the password"}`)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+				Expect(sessionCookie(response)).Should(BeNil())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("logging in with an unknown user name", func() {
+			It("should respond 401 without creating a Session", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE user_name = ? AND `users`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs("MotherOfDragons").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "password"}))
+				expectLoginLockQuery("ip:0.0.0.0")
+				expectFailedLogin(models.LoginFailureUnknownUser, "ip:0.0.0.0")
+
+				response := login(`{"userName":"MotherOfDragons","password":"password"}`)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+				Expect(sessionCookie(response)).Should(BeNil())
+
+				err := mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("logging in without a password", func() {
+			It("should respond 401 without executing any sql on database", func() {
+				response := login(`{"userName":"MotherOfDragons"}`)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+
+				err := mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("logging in with a malformed body", func() {
+			It("should respond 400 with a structured error", func() {
+				response := login(`{"userName":`)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+
+				body := decodeError(response)
+				Expect(body.Status).Should(Equal(fiber.StatusBadRequest))
+				Expect(body.Message).ShouldNot(BeEmpty())
+			})
+		})
+	})
+
+	Context("GET /api/auth/me", func() {
+		When("requesting without a session cookie", func() {
+			It("should respond 401", func() {
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/auth/me", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+			})
+		})
+
+		When("requesting with a valid session cookie", func() {
+			It("should respond with the logged in User", func() {
+				expectSessionQuery(mock, 1)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodGet, "/api/auth/me", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				body := &userResponse{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(body.ID).Should(Equal(uint(1)))
+				Expect(body.DisplayName).Should(Equal("Mother Of Dragons"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("requesting with an expired session cookie", func() {
+			It("should respond 401 and clear the session cookie", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `sessions` WHERE id = ? AND expires_at > ? LIMIT 1")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}))
+
+				response, err := app.Test(newSessionRequest(fiber.MethodGet, "/api/auth/me", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+
+				cookie := sessionCookie(response)
+				Expect(cookie).ShouldNot(BeNil())
+				Expect(cookie.Value).Should(BeEmpty())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("POST /api/auth/logout", func() {
+		When("logging out with a valid session cookie", func() {
+			It("should delete the current Session and clear the session cookie", func() {
+				expectSessionQuery(mock, 1)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE id = ?")).
+					WithArgs(tokens.Hash(testSessionToken)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/auth/logout", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+				Expect(sessionCookie(response).Value).Should(BeEmpty())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("logging out without a session cookie", func() {
+			It("should respond 401", func() {
+				response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/logout", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("POST /api/auth/logout/all", func() {
+		When("logging out of all devices with a valid session cookie", func() {
+			It("should delete every Session for the User", func() {
+				expectSessionQuery(mock, 1)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE user_id = ?")).
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/auth/logout/all", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+				Expect(sessionCookie(response).Value).Should(BeEmpty())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+})
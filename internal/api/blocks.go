@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+type blockResponse struct {
+	UserID    uint      `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (h *handler) listBlocks(c *fiber.Ctx) error {
+	blocks, err := h.store.Blocks().List(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	response := make([]blockResponse, len(blocks))
+	for i, block := range blocks {
+		response[i] = blockResponse{UserID: block.BlockedUserID, CreatedAt: block.CreatedAt}
+	}
+
+	return c.JSON(listResponse{Data: response})
+}
+
+func (h *handler) blockUser(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.store.Users().Get(c.Context(), id); err != nil {
+		return err
+	}
+
+	if err := h.store.Blocks().Block(c.Context(), currentSession(c).UserID, id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) unblockUser(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Blocks().Unblock(c.Context(), currentSession(c).UserID, id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"time"
+)
+
+type createConversationRequest struct {
+	Title          string `json:"title"`
+	ParticipantIDs []uint `json:"participantIds"`
+	Content        string `json:"content"`
+	Format         string `json:"format"`
+}
+
+type messageRequest struct {
+	Content string `json:"content"`
+	Format  string `json:"format"`
+}
+
+type participantRequest struct {
+	UserID uint `json:"userId"`
+}
+
+type conversationResponse struct {
+	ID             uint      `json:"id"`
+	Title          string    `json:"title"`
+	ParticipantIDs []uint    `json:"participantIds,omitempty"`
+	Muted          bool      `json:"muted"`
+	Unread         int64     `json:"unread"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type messageResponse struct {
+	ID             uint      `json:"id"`
+	ConversationID uint      `json:"conversationId"`
+	AuthorID       *uint     `json:"authorId"`
+	Content        string    `json:"content"`
+	Format         string    `json:"format"`
+	ContentHTML    string    `json:"contentHtml"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type unreadMessagesResponse struct {
+	Unread int64 `json:"unread"`
+}
+
+func newConversationResponse(conversation *models.Conversation, participant *models.ConversationParticipant, unread int64) conversationResponse {
+	response := conversationResponse{
+		ID:        conversation.ID,
+		Title:     conversation.Title,
+		Muted:     participant.Muted,
+		Unread:    unread,
+		CreatedAt: conversation.CreatedAt,
+		UpdatedAt: conversation.UpdatedAt,
+	}
+
+	for _, p := range conversation.Participants {
+		response.ParticipantIDs = append(response.ParticipantIDs, p.UserID)
+	}
+
+	return response
+}
+
+func newMessageResponse(message *models.Message) messageResponse {
+	return messageResponse{
+		ID:             message.ID,
+		ConversationID: message.ConversationID,
+		AuthorID:       message.AuthorID,
+		Content:        message.Content,
+		Format:         message.Format,
+		ContentHTML:    message.ContentHTML,
+		CreatedAt:      message.CreatedAt,
+	}
+}
+
+func (h *handler) listConversations(c *fiber.Ctx) error {
+	userID := currentSession(c).UserID
+	offset, limit := pagination(c)
+	participants, err := h.store.Conversations().List(c.Context(), userID, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint, len(participants))
+	for i := range participants {
+		ids[i] = participants[i].ConversationID
+	}
+
+	unread, err := h.store.Conversations().CountUnread(c.Context(), userID, ids)
+	if err != nil {
+		return err
+	}
+
+	response := make([]conversationResponse, len(participants))
+	for i := range participants {
+		response[i] = newConversationResponse(&participants[i].Conversation, &participants[i], unread[ids[i]])
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+func (h *handler) getConversation(c *fiber.Ctx) error {
+	conversation, participant, err := h.ownConversation(c)
+	if err != nil {
+		return err
+	}
+
+	unread, err := h.store.Conversations().CountUnread(c.Context(), participant.UserID, []uint{conversation.ID})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(newConversationResponse(conversation, participant, unread[conversation.ID]))
+}
+
+func (h *handler) createConversation(c *fiber.Ctx) error {
+	request := &createConversationRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	authorID := currentSession(c).UserID
+	conversation := &models.Conversation{
+		Title:    request.Title,
+		Messages: []models.Message{{AuthorID: &authorID, Content: request.Content, Format: request.Format}},
+	}
+
+	for _, userID := range request.ParticipantIDs {
+		if _, err := h.store.Users().Get(c.Context(), userID); err != nil {
+			return err
+		}
+
+		conversation.Participants = append(conversation.Participants, models.ConversationParticipant{UserID: userID})
+	}
+
+	if err := h.store.Conversations().Create(c.Context(), conversation); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newConversationResponse(conversation, &conversation.Participants[0], 0))
+}
+
+func (h *handler) unreadMessages(c *fiber.Ctx) error {
+	unread, err := h.store.Conversations().CountAllUnread(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(unreadMessagesResponse{Unread: unread})
+}
+
+func (h *handler) listMessages(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	offset, limit := pagination(c)
+	messages, err := h.store.Conversations().ListMessages(c.Context(), id, currentSession(c).UserID, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	response := make([]messageResponse, len(messages))
+	for i := range messages {
+		response[i] = newMessageResponse(&messages[i])
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+func (h *handler) sendMessage(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	request := &messageRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	authorID := currentSession(c).UserID
+	message := &models.Message{ConversationID: id, AuthorID: &authorID, Content: request.Content, Format: request.Format}
+	if err := h.store.Conversations().Send(c.Context(), message); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newMessageResponse(message))
+}
+
+func (h *handler) addConversationParticipant(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	request := &participantRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if _, err := h.store.Users().Get(c.Context(), request.UserID); err != nil {
+		return err
+	}
+
+	if err := h.store.Conversations().AddParticipant(c.Context(), id, currentSession(c).UserID, request.UserID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// participate adapts a repository method acting on the current User's part
+// in the Conversation of the :id param into a handler that replies 204.
+func participate(action func(ctx context.Context, conversationID, userID uint) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		if err := action(c.Context(), id, currentSession(c).UserID); err != nil {
+			return err
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// ownConversation loads the Conversation of the :id param, which only its
+// participants may see.
+func (h *handler) ownConversation(c *fiber.Ctx) (*models.Conversation, *models.ConversationParticipant, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conversation, err := h.store.Conversations().Get(c.Context(), id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range conversation.Participants {
+		if conversation.Participants[i].UserID == currentSession(c).UserID {
+			return conversation, &conversation.Participants[i], nil
+		}
+	}
+
+	return nil, nil, models.ErrNotParticipant
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"time"
+)
+
+var _ = Describe("Conversations", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var arya, sansa, bran *models.User
+	var aryaCookie, sansaCookie, branCookie *http.Cookie
+
+	send := func(method, target, body string, cookie *http.Cookie) *http.Response {
+		request := newRequest(method, target, body)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	login := func(user *models.User) *http.Cookie {
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		return &http.Cookie{Name: sessionCookieName, Value: token}
+	}
+
+	createUser := func(userName string) (*models.User, *http.Cookie) {
+		user := &models.User{UserName: userName, Password: "winterfell"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+		return user, login(user)
+	}
+
+	startConversation := func(cookie *http.Cookie, participantIDs ...uint) *http.Response {
+		ids, err := json.Marshal(participantIDs)
+		Expect(err).ShouldNot(HaveOccurred())
+		return send(fiber.MethodPost, "/api/v1/conversations", fmt.Sprintf(`{"title":"The Starks","participantIds":%s,"content":"Winter is here"}`, ids), cookie)
+	}
+
+	decodeConversation := func(response *http.Response) conversationResponse {
+		body := conversationResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body
+	}
+
+	unread := func(cookie *http.Cookie) int64 {
+		response := send(fiber.MethodGet, "/api/v1/conversations/unread", "", cookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		body := unreadMessagesResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body.Unread
+	}
+
+	listMessages := func(id uint, cookie *http.Cookie) []messageResponse {
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/conversations/%d/messages", id), "", cookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		var body struct {
+			Data []messageResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body.Data
+	}
+
+	BeforeEach(func() {
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		arya, aryaCookie = createUser("Arya")
+		sansa, sansaCookie = createUser("Sansa")
+		bran, branCookie = createUser("Bran")
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should start a Conversation that its participants see as unread", func() {
+		response := startConversation(aryaCookie, sansa.ID, bran.ID)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+		conversation := decodeConversation(response)
+		Expect(conversation.ParticipantIDs).Should(ConsistOf(arya.ID, sansa.ID, bran.ID))
+
+		Expect(unread(aryaCookie)).Should(BeZero())
+		Expect(unread(sansaCookie)).Should(Equal(int64(1)))
+
+		response = send(fiber.MethodGet, "/api/v1/conversations", "", sansaCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		var body struct {
+			Data []conversationResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		Expect(body.Data).Should(HaveLen(1))
+		Expect(body.Data[0].Unread).Should(Equal(int64(1)))
+
+		Expect(send(fiber.MethodPost, fmt.Sprintf("/api/v1/conversations/%d/read", conversation.ID), "", sansaCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(unread(sansaCookie)).Should(BeZero())
+	})
+
+	It("should keep the Conversation from Users who do not take part", func() {
+		conversation := decodeConversation(startConversation(aryaCookie, sansa.ID))
+
+		Expect(send(fiber.MethodGet, fmt.Sprintf("/api/v1/conversations/%d", conversation.ID), "", branCookie).StatusCode).Should(Equal(fiber.StatusNotFound))
+		Expect(send(fiber.MethodGet, fmt.Sprintf("/api/v1/conversations/%d/messages", conversation.ID), "", branCookie).StatusCode).Should(Equal(fiber.StatusNotFound))
+		Expect(send(fiber.MethodPost, fmt.Sprintf("/api/v1/conversations/%d/messages", conversation.ID), `{"content":"Hodor"}`, branCookie).StatusCode).Should(Equal(fiber.StatusNotFound))
+		Expect(send(fiber.MethodGet, "/api/v1/conversations", "", nil).StatusCode).Should(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("should not count muted Conversations towards the unread total", func() {
+		conversation := decodeConversation(startConversation(aryaCookie, sansa.ID))
+		Expect(send(fiber.MethodPost, fmt.Sprintf("/api/v1/conversations/%d/mute", conversation.ID), "", sansaCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(unread(sansaCookie)).Should(BeZero())
+
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/conversations/%d", conversation.ID), "", sansaCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		body := decodeConversation(response)
+		Expect(body.Muted).Should(BeTrue())
+		Expect(body.Unread).Should(Equal(int64(1)))
+	})
+
+	It("should let a participant delete the Conversation for themselves alone", func() {
+		conversation := decodeConversation(startConversation(aryaCookie, sansa.ID))
+		Expect(send(fiber.MethodDelete, fmt.Sprintf("/api/v1/conversations/%d", conversation.ID), "", sansaCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+
+		Expect(listMessages(conversation.ID, sansaCookie)).Should(BeEmpty())
+		Expect(listMessages(conversation.ID, aryaCookie)).Should(HaveLen(1))
+	})
+
+	It("should let participants leave and bring others in", func() {
+		conversation := decodeConversation(startConversation(aryaCookie, sansa.ID))
+
+		body := fmt.Sprintf(`{"userId":%d}`, bran.ID)
+		Expect(send(fiber.MethodPost, fmt.Sprintf("/api/v1/conversations/%d/participants", conversation.ID), body, sansaCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(listMessages(conversation.ID, branCookie)).Should(HaveLen(1))
+
+		Expect(send(fiber.MethodPost, fmt.Sprintf("/api/v1/conversations/%d/leave", conversation.ID), "", branCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(send(fiber.MethodGet, fmt.Sprintf("/api/v1/conversations/%d", conversation.ID), "", branCookie).StatusCode).Should(Equal(fiber.StatusNotFound))
+	})
+
+	It("should honour blocks in both directions", func() {
+		Expect(send(fiber.MethodPut, fmt.Sprintf("/api/v1/blocks/%d", arya.ID), "", sansaCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(startConversation(aryaCookie, sansa.ID).StatusCode).Should(Equal(fiber.StatusForbidden))
+		Expect(startConversation(sansaCookie, arya.ID).StatusCode).Should(Equal(fiber.StatusForbidden))
+
+		conversation := decodeConversation(startConversation(aryaCookie, bran.ID))
+		target, body := fmt.Sprintf("/api/v1/conversations/%d/participants", conversation.ID), fmt.Sprintf(`{"userId":%d}`, sansa.ID)
+		Expect(send(fiber.MethodPost, target, body, branCookie).StatusCode).Should(Equal(fiber.StatusForbidden))
+
+		Expect(send(fiber.MethodDelete, fmt.Sprintf("/api/v1/blocks/%d", arya.ID), "", sansaCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(send(fiber.MethodPost, target, body, branCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(send(fiber.MethodPut, fmt.Sprintf("/api/v1/blocks/%d", arya.ID), "", sansaCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(send(fiber.MethodPost, fmt.Sprintf("/api/v1/conversations/%d/messages", conversation.ID), `{"content":"Not today"}`, aryaCookie).StatusCode).Should(Equal(fiber.StatusCreated))
+		Expect(listMessages(conversation.ID, sansaCookie)).Should(BeEmpty())
+		Expect(unread(sansaCookie)).Should(BeZero())
+
+		response := send(fiber.MethodGet, "/api/v1/blocks", "", sansaCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		var blocks struct {
+			Data []blockResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&blocks)).Should(Succeed())
+		Expect(blocks.Data).Should(HaveLen(1))
+		Expect(blocks.Data[0].UserID).Should(Equal(arya.ID))
+
+		Expect(send(fiber.MethodDelete, fmt.Sprintf("/api/v1/blocks/%d", arya.ID), "", sansaCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(listMessages(conversation.ID, sansaCookie)).Should(HaveLen(2))
+		Expect(send(fiber.MethodPut, fmt.Sprintf("/api/v1/blocks/%d", sansa.ID), "", sansaCookie).StatusCode).Should(Equal(fiber.StatusBadRequest))
+	})
+})
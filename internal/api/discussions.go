@@ -0,0 +1,197 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"time"
+)
+
+type createDiscussionRequest struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Format  string `json:"format"`
+}
+
+type updateDiscussionRequest struct {
+	Title   *string `json:"title"`
+	TopicID *uint   `json:"topicId"`
+}
+
+type discussionResponse struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	TopicID   uint      `json:"topicId"`
+	AuthorID  uint      `json:"authorId"`
+	Unread    int64     `json:"unread,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func newDiscussionResponse(discussion *models.Discussion) discussionResponse {
+	return discussionResponse{
+		ID:        discussion.ID,
+		Title:     discussion.Title,
+		TopicID:   discussion.TopicID,
+		AuthorID:  discussion.AuthorID,
+		CreatedAt: discussion.CreatedAt,
+		UpdatedAt: discussion.UpdatedAt,
+	}
+}
+
+func (h *handler) listDiscussions(c *fiber.Ctx) error {
+	topicID, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.store.Topics().Get(c.Context(), topicID); err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionView, topicID); err != nil {
+		return err
+	}
+
+	offset, limit := pagination(c)
+	discussions, err := h.store.Discussions().List(c.Context(), topicID, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	unread := map[uint]int64{}
+	if user := currentUser(c); user != nil {
+		ids := make([]uint, len(discussions))
+		for i := range discussions {
+			ids[i] = discussions[i].ID
+		}
+
+		if unread, err = h.store.ReadStates().CountByDiscussion(c.Context(), user.ID, ids); err != nil {
+			return err
+		}
+	}
+
+	response := make([]discussionResponse, len(discussions))
+	for i := range discussions {
+		response[i] = newDiscussionResponse(&discussions[i])
+		response[i].Unread = unread[discussions[i].ID]
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+func (h *handler) getDiscussion(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	discussion, err := h.store.Discussions().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionView, discussion.TopicID); err != nil {
+		return err
+	}
+
+	return c.JSON(newDiscussionResponse(discussion))
+}
+
+func (h *handler) createDiscussion(c *fiber.Ctx) error {
+	topicID, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	request := &createDiscussionRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if _, err := h.store.Topics().Get(c.Context(), topicID); err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionStartDiscussion, topicID); err != nil {
+		return err
+	}
+
+	discussion := &models.Discussion{
+		Title:    request.Title,
+		AuthorID: currentSession(c).UserID,
+		TopicID:  topicID,
+		Posts:    []models.Post{{Content: request.Content, Format: request.Format}},
+	}
+
+	if err := h.store.Discussions().Create(c.Context(), discussion); err != nil {
+		return err
+	}
+
+	h.dropHiddenMentions(c, topicID, &discussion.Posts[0])
+	h.notifyPost(c, discussion, &discussion.Posts[0])
+
+	return c.Status(fiber.StatusCreated).JSON(newDiscussionResponse(discussion))
+}
+
+func (h *handler) updateDiscussion(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	request := &updateDiscussionRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	discussion, err := h.store.Discussions().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorizeAuthor(c, discussion.AuthorID, discussion.TopicID); err != nil {
+		return err
+	}
+
+	if request.Title != nil {
+		discussion.Title = *request.Title
+	}
+
+	if request.TopicID != nil && *request.TopicID != discussion.TopicID {
+		if _, err := h.store.Topics().Get(c.Context(), *request.TopicID); err != nil {
+			return err
+		}
+		if err := h.authorize(c, models.ActionStartDiscussion, *request.TopicID); err != nil {
+			return err
+		}
+		discussion.TopicID = *request.TopicID
+	}
+
+	if err := h.store.Discussions().Update(c.Context(), discussion); err != nil {
+		return err
+	}
+
+	return c.JSON(newDiscussionResponse(discussion))
+}
+
+func (h *handler) deleteDiscussion(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	discussion, err := h.store.Discussions().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorizeAuthor(c, discussion.AuthorID, discussion.TopicID); err != nil {
+		return err
+	}
+
+	if err := h.store.Discussions().Delete(c.Context(), id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Discussions", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+	var app *fiber.App
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		app = New(store.New(database.DBConnection), &mail.Outbox{}, nil)
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	expectTopic := func(id uint) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`id` = ? AND `topics`.`deleted_at` IS NULL LIMIT 1")).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(id, "Marvel"))
+	}
+
+	expectDiscussion := func(id, authorID uint) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions` WHERE `discussions`.`id` = ? AND `discussions`.`deleted_at` IS NULL LIMIT 1")).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "topic_id", "author_id"}).AddRow(id, "Marvel vs DC", 20, authorID))
+	}
+
+	Context("GET /api/v1/topics/:id/discussions", func() {
+		When("the Topic exists", func() {
+			It("should respond with a page of Discussions", func() {
+				expectTopic(20)
+				expectPermissionsQuery(mock, 0)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions` WHERE topic_id = ? AND `discussions`.`deleted_at` IS NULL ORDER BY id DESC LIMIT 5 OFFSET 10")).
+					WithArgs(20).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title", "topic_id"}).AddRow(12, "Marvel vs DC", 20))
+
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/20/discussions?offset=10&limit=5", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				body := &struct {
+					Data   []discussionResponse
+					Offset int
+					Limit  int
+				}{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(body.Data).Should(HaveLen(1))
+				Expect(body.Offset).Should(Equal(10))
+				Expect(body.Limit).Should(Equal(5))
+			})
+		})
+
+		When("the Topic does not exist", func() {
+			It("should respond 404", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/20/discussions", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+			})
+		})
+	})
+
+	Context("POST /api/v1/topics/:id/discussions", func() {
+		When("creating a Discussion with a Title and Content", func() {
+			It("should create the Discussion and its opening Post", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectTopic(20)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussions` (`created_at`,`updated_at`,`deleted_at`,`title`,`author_id`,`topic_id`) VALUES (?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "Marvel vs DC", 10, 20).
+					WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectExec("SAVEPOINT .").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "who would <win>?", "plain", "<p>who would &lt;win&gt;?</p>\n", 10, 3, nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id FROM discussion_subscriptions WHERE discussion_id = ? UNION SELECT user_id FROM topic_subscriptions WHERE topic_id = ?")).
+					WithArgs(3, 20).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(10))
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/topics/20/discussions", `{"title":"Marvel vs DC","content":"who would <win>?","format":"plain"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+
+				body := &discussionResponse{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(body.ID).Should(Equal(uint(3)))
+				Expect(body.TopicID).Should(Equal(uint(20)))
+			})
+		})
+
+		When("creating a Discussion without Content", func() {
+			It("should respond 400 with the validation error", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectTopic(20)
+				expectPermissionsQuery(mock, 10)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/topics/20/discussions", `{"title":"Marvel vs DC"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+				Expect(decodeError(response).Message).Should(Equal("empty Content not allowed"))
+			})
+		})
+	})
+
+	Context("GET /api/v1/discussions/:id", func() {
+		It("should respond with the Discussion", func() {
+			expectDiscussion(3, 10)
+			expectPermissionsQuery(mock, 0)
+
+			response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/discussions/3", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			body := &discussionResponse{}
+			Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+			Expect(body.Title).Should(Equal("Marvel vs DC"))
+		})
+	})
+
+	Context("PATCH /api/v1/discussions/:id", func() {
+		When("the current User authored the Discussion", func() {
+			It("should update the Title", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectDiscussion(3, 10)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussions` SET `updated_at`=?,`title`=?,`topic_id`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), "DC vs Marvel", 20, 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPatch, "/api/v1/discussions/3", `{"title":"DC vs Marvel"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+			})
+		})
+
+		When("moving the Discussion to a Topic that does not exist", func() {
+			It("should respond 404", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectDiscussion(3, 10)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics`")).
+					WithArgs(21).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPatch, "/api/v1/discussions/3", `{"topicId":21}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+			})
+		})
+
+		When("the current User did not author the Discussion", func() {
+			It("should respond 403", func() {
+				expectSessionQuery(mock, 11)
+				expectTwoFactorPolicyQuery(mock, 11)
+				expectDiscussion(3, 10)
+				expectPermissionsQuery(mock, 11)
+				expectModeratorQuery(mock, 11, false)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPatch, "/api/v1/discussions/3", `{"title":"DC vs Marvel"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+	})
+
+	Context("DELETE /api/v1/discussions/:id", func() {
+		It("should soft delete the Discussion and its Posts", func() {
+			expectSessionQuery(mock, 10)
+			expectTwoFactorPolicyQuery(mock, 10)
+			expectDiscussion(3, 10)
+			expectPermissionsQuery(mock, 10)
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `deleted_at`=?")).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussions` SET `deleted_at`=?")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			response, err := app.Test(newSessionRequest(fiber.MethodDelete, "/api/v1/discussions/3", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		})
+	})
+})
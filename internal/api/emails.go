@@ -0,0 +1,180 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"gorm.io/gorm"
+	"net/url"
+	"time"
+)
+
+const verificationBody = `Hello,
+
+please confirm that you receive mail at %s by opening this link:
+
+%s/api/v1/emails/verify?token=%s
+
+If you did not add this address to your account, you can ignore this message.
+`
+
+var errEmailTaken = fiber.NewError(fiber.StatusConflict, "email address is already in use")
+
+type emailRequest struct {
+	Email string `json:"email"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type emailResponse struct {
+	Email     string    `json:"email"`
+	Verified  bool      `json:"verified"`
+	Primary   bool      `json:"primary"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newEmailResponse(email *models.Email) emailResponse {
+	return emailResponse{
+		Email:     email.Email,
+		Verified:  email.Verified,
+		Primary:   email.Primary,
+		CreatedAt: email.CreatedAt,
+	}
+}
+
+func (h *handler) listEmails(c *fiber.Ctx) error {
+	emails, err := h.store.Emails().List(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	response := make([]emailResponse, len(emails))
+	for i := range emails {
+		response[i] = newEmailResponse(&emails[i])
+	}
+
+	return c.JSON(listResponse{Data: response})
+}
+
+// createEmail adds an unverified address to the current User and mails it a
+// verification link.
+func (h *handler) createEmail(c *fiber.Ctx) error {
+	request := &emailRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if _, err := h.store.Emails().Get(c.Context(), request.Email); err != gorm.ErrRecordNotFound {
+		if err == nil {
+			return errEmailTaken
+		}
+
+		return err
+	}
+
+	email := &models.Email{Email: request.Email, UserID: currentSession(c).UserID}
+	if err := h.store.Emails().Create(c.Context(), email); err != nil {
+		return err
+	}
+
+	if err := h.sendVerification(c, email); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newEmailResponse(email))
+}
+
+// resendVerification mails a new link for an address of the current User.
+// Links sent before keep working until they expire.
+func (h *handler) resendVerification(c *fiber.Ctx) error {
+	request := &emailRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	email, err := h.ownEmail(c, request.Email)
+	if err != nil {
+		return err
+	}
+
+	if err := h.sendVerification(c, email); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// verifyEmail accepts the token from the link as a query parameter, or in the
+// body for clients that post it themselves.
+func (h *handler) verifyEmail(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		request := &verifyEmailRequest{}
+		if err := c.BodyParser(request); err != nil {
+			return errMalformedBody
+		}
+		token = request.Token
+	}
+
+	email, err := h.store.Emails().Verify(c.Context(), token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(newEmailResponse(email))
+}
+
+func (h *handler) setPrimaryEmail(c *fiber.Ctx) error {
+	request := &emailRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if _, err := h.ownEmail(c, request.Email); err != nil {
+		return err
+	}
+
+	if err := h.store.Emails().SetPrimary(c.Context(), request.Email); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ownEmail looks up an address of the current User. Addresses of other Users
+// are reported as not found, so that this cannot be used to probe for them.
+func (h *handler) ownEmail(c *fiber.Ctx, address string) (*models.Email, error) {
+	email, err := h.store.Emails().Get(c.Context(), address)
+	if err != nil {
+		return nil, err
+	}
+
+	if email.UserID != currentSession(c).UserID {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return email, nil
+}
+
+func (h *handler) sendVerification(c *fiber.Ctx, email *models.Email) error {
+	verification := &models.EmailVerification{
+		Email:     email.Email,
+		UserID:    email.UserID,
+		ExpiresAt: time.Now().Add(internal.EMAILTOKENLIFETIME),
+	}
+
+	token, err := h.store.Emails().CreateVerification(c.Context(), verification)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(c.Context(), mail.Message{
+		To:      email.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf(verificationBody, email.Email, internal.PUBLICURL, url.QueryEscape(token)),
+	})
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("Emails", func() {
+	ctx := context.Background()
+	tokenPattern := regexp.MustCompile(`token=(\S+)`)
+	var s *storetest.Store
+	var outbox *mail.Outbox
+	var app *fiber.App
+	var user *models.User
+	var cookie *http.Cookie
+
+	requestAs := func(method, target, body string) *http.Request {
+		request := newRequest(method, target, body)
+		request.AddCookie(cookie)
+		return request
+	}
+
+	lastToken := func() string {
+		messages := outbox.Messages()
+		Expect(messages).ShouldNot(BeEmpty())
+
+		match := tokenPattern.FindStringSubmatch(messages[len(messages)-1].Body)
+		Expect(match).Should(HaveLen(2))
+
+		token, err := url.QueryUnescape(match[1])
+		Expect(err).ShouldNot(HaveOccurred())
+		return token
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		models.TokenSigningKey = []byte("secret")
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		outbox = &mail.Outbox{}
+		app = New(s, outbox, nil)
+
+		user = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		cookie = &http.Cookie{Name: sessionCookieName, Value: token}
+
+		response, err := app.Test(requestAs(fiber.MethodPost, "/api/v1/emails", `{"email":"jon@nightswatch.org"}`))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	Context("POST /api/v1/emails", func() {
+		It("should mail a verification link to the address", func() {
+			messages := outbox.Messages()
+			Expect(messages).Should(HaveLen(1))
+			Expect(messages[0].To).Should(Equal("jon@nightswatch.org"))
+			Expect(messages[0].Body).Should(ContainSubstring("/api/v1/emails/verify?token="))
+		})
+
+		When("the address is already in use", func() {
+			It("should respond 409", func() {
+				response, err := app.Test(requestAs(fiber.MethodPost, "/api/v1/emails", `{"email":"jon@nightswatch.org"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusConflict))
+			})
+		})
+
+		When("the address is invalid", func() {
+			It("should respond 400", func() {
+				response, err := app.Test(requestAs(fiber.MethodPost, "/api/v1/emails", `{"email":"Jon <jon@nightswatch.org>"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+			})
+		})
+	})
+
+	Context("GET /api/v1/emails/verify", func() {
+		It("should verify the address once and make it primary", func() {
+			target := "/api/v1/emails/verify?token=" + url.QueryEscape(lastToken())
+			response, err := app.Test(newRequest(fiber.MethodGet, target, ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			body := &emailResponse{}
+			Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+			Expect(body.Verified).Should(BeTrue())
+			Expect(body.Primary).Should(BeTrue())
+
+			response, err = app.Test(newRequest(fiber.MethodGet, target, ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+		})
+
+		When("the token has been tampered with", func() {
+			It("should respond 400", func() {
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/emails/verify?token=Zm9v.YmFy", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+			})
+		})
+	})
+
+	Context("POST /api/v1/emails/verify", func() {
+		It("should accept the token in the body", func() {
+			body := fmt.Sprintf(`{"token":%q}`, lastToken())
+			response, err := app.Test(newRequest(fiber.MethodPost, "/api/v1/emails/verify", body))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		})
+	})
+
+	Context("POST /api/v1/emails/primary", func() {
+		When("the address is not verified", func() {
+			It("should respond 409", func() {
+				response, err := app.Test(requestAs(fiber.MethodPost, "/api/v1/emails/primary", `{"email":"jon@nightswatch.org"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusConflict))
+			})
+		})
+
+		When("the address belongs to another User", func() {
+			It("should respond 404", func() {
+				other := &models.User{UserName: "AryaStark", Password: "needle", Emails: []models.Email{{Email: "arya@winterfell.org"}}}
+				Expect(s.Users().Create(ctx, other)).Should(Succeed())
+
+				response, err := app.Test(requestAs(fiber.MethodPost, "/api/v1/emails/primary", `{"email":"arya@winterfell.org"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+			})
+		})
+	})
+
+	Context("POST /api/auth/login", func() {
+		body := `{"email":"jon@nightswatch.org","password":"ghost"}`
+
+		When("the address is not verified", func() {
+			It("should respond 401", func() {
+				response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/login", body))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+			})
+		})
+
+		When("the address is verified", func() {
+			It("should sign the User in", func() {
+				_, err := s.Emails().Verify(ctx, lastToken())
+				Expect(err).ShouldNot(HaveOccurred())
+
+				response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/login", body))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+			})
+		})
+	})
+})
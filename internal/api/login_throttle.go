@@ -0,0 +1,99 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+var errTooManyLogins = fiber.NewError(fiber.StatusTooManyRequests, "too many failed logins, try again later")
+
+type failedLoginResponse struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Identifier string    `json:"identifier"`
+	Reason     string    `json:"reason"`
+	IPAddress  string    `json:"ipAddress"`
+	UserID     *uint     `json:"userId"`
+}
+
+func newFailedLoginResponse(failure *models.FailedLogin) failedLoginResponse {
+	return failedLoginResponse{
+		ID:         failure.ID,
+		CreatedAt:  failure.CreatedAt,
+		Identifier: failure.Identifier,
+		Reason:     failure.Reason,
+		IPAddress:  failure.IPAddress,
+		UserID:     failure.UserID,
+	}
+}
+
+// checkLoginLock refuses logins as a locked User, or from a locked address,
+// before the password is looked at. user is nil when the login named nobody.
+func (h *handler) checkLoginLock(c *fiber.Ctx, user *models.User) error {
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+
+	until, err := h.store.LoginAttempts().LockedUntil(c.Context(), userID, c.IP())
+	if err != nil {
+		return err
+	}
+
+	if until.IsZero() {
+		return nil
+	}
+
+	log.Println("[API_LOGIN]::LOGIN_LOCKED_WARNING ⚠️")
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+	return errTooManyLogins
+}
+
+// loginFailed records the failure and returns err, which is what the client is
+// told about this attempt. Lockouts it causes apply to the next one.
+func (h *handler) loginFailed(c *fiber.Ctx, request *loginRequest, user *models.User, reason string, err error) error {
+	failure := &models.FailedLogin{Identifier: request.UserName, Reason: reason, IPAddress: c.IP()}
+	if failure.Identifier == "" {
+		failure.Identifier = request.Email
+	}
+
+	if user != nil {
+		failure.UserID = &user.ID
+	}
+
+	if _, recordErr := h.store.LoginAttempts().RecordFailure(c.Context(), failure); recordErr != nil {
+		return recordErr
+	}
+
+	return err
+}
+
+// listFailedLogins returns the audit trail, optionally narrowed to a User with
+// ?userId= and to an address with ?ip=.
+func (h *handler) listFailedLogins(c *fiber.Ctx) error {
+	var userID uint
+	if query := c.Query("userId"); query != "" {
+		id, err := strconv.ParseUint(query, 10, 32)
+		if err != nil || id == 0 {
+			return errInvalidID
+		}
+		userID = uint(id)
+	}
+
+	offset, limit := pagination(c)
+	failures, err := h.store.LoginAttempts().ListFailures(c.Context(), userID, c.Query("ip"), offset, limit)
+	if err != nil {
+		return err
+	}
+
+	response := make([]failedLoginResponse, len(failures))
+	for i := range failures {
+		response[i] = newFailedLoginResponse(&failures[i])
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var _ = Describe("Login throttling", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var user *models.User
+	var adminCookie *http.Cookie
+
+	login := func(userName, password string) *http.Response {
+		body := fmt.Sprintf(`{"userName":%q,"password":%q}`, userName, password)
+		response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/login", body))
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	asAdmin := func(method, target string) *http.Response {
+		request := newRequest(method, target, "")
+		request.AddCookie(adminCookie)
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	lockOut := func() {
+		for i := 0; i <= models.AccountLoginPolicy.FreeAttempts; i++ {
+			Expect(login("JonSnow", "wolf").StatusCode).Should(Equal(fiber.StatusUnauthorized))
+		}
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		user = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+
+		admin := &models.User{UserName: "MotherOfDragons", Password: "drogon"}
+		Expect(s.Users().Create(ctx, admin)).Should(Succeed())
+		admins := &models.Group{Name: "admins", AuthorID: admin.ID}
+		Expect(s.Groups().Create(ctx, admins)).Should(Succeed())
+		s.AddGroupMember(admin.ID, admins.ID)
+		Expect(s.Permissions().Set(ctx, &models.Permission{GroupID: &admins.ID, Action: models.ActionAdminister})).Should(Succeed())
+
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: admin.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		adminCookie = &http.Cookie{Name: sessionCookieName, Value: token}
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should lock the account after the free attempts, even for the right password", func() {
+		lockOut()
+
+		response := login("JonSnow", "ghost")
+		Expect(response.StatusCode).Should(Equal(fiber.StatusTooManyRequests))
+		Expect(decodeError(response).Message).Should(Equal("too many failed logins, try again later"))
+
+		retryAfter, err := strconv.Atoi(response.Header.Get(fiber.HeaderRetryAfter))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(retryAfter).Should(BeNumerically(">", 0))
+
+		Expect(login("MotherOfDragons", "drogon").StatusCode).Should(Equal(fiber.StatusOK))
+	})
+
+	It("should forget the failures after a successful login", func() {
+		for i := 0; i < models.AccountLoginPolicy.FreeAttempts; i++ {
+			Expect(login("JonSnow", "wolf").StatusCode).Should(Equal(fiber.StatusUnauthorized))
+		}
+
+		Expect(login("JonSnow", "ghost").StatusCode).Should(Equal(fiber.StatusOK))
+		Expect(login("JonSnow", "wolf").StatusCode).Should(Equal(fiber.StatusUnauthorized))
+		Expect(login("JonSnow", "ghost").StatusCode).Should(Equal(fiber.StatusOK))
+	})
+
+	It("should let administrators read the audit trail and lift the lockout", func() {
+		lockOut()
+		Expect(login("Nobody", "guess").StatusCode).Should(Equal(fiber.StatusUnauthorized))
+
+		response := asAdmin(fiber.MethodGet, fmt.Sprintf("/api/v1/failed-logins?userId=%d", user.ID))
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		var body struct {
+			Data []failedLoginResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		Expect(body.Data).Should(HaveLen(models.AccountLoginPolicy.FreeAttempts + 1))
+		Expect(body.Data[0].Reason).Should(Equal(models.LoginFailurePassword))
+
+		response = asAdmin(fiber.MethodGet, "/api/v1/failed-logins?ip=0.0.0.0&limit=1")
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		Expect(body.Data).Should(HaveLen(1))
+		Expect(body.Data[0].Reason).Should(Equal(models.LoginFailureUnknownUser))
+		Expect(body.Data[0].UserID).Should(BeNil())
+
+		Expect(asAdmin(fiber.MethodPost, fmt.Sprintf("/api/v1/users/%d/unlock", user.ID)).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(login("JonSnow", "ghost").StatusCode).Should(Equal(fiber.StatusOK))
+	})
+
+	It("should keep the audit trail and unlocking away from other Users", func() {
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		adminCookie = &http.Cookie{Name: sessionCookieName, Value: token}
+
+		Expect(asAdmin(fiber.MethodGet, "/api/v1/failed-logins").StatusCode).Should(Equal(fiber.StatusForbidden))
+		Expect(asAdmin(fiber.MethodPost, fmt.Sprintf("/api/v1/users/%d/unlock", user.ID)).StatusCode).Should(Equal(fiber.StatusForbidden))
+	})
+})
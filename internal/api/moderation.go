@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+)
+
+// requirePermission only lets through Users who may perform action on the
+// forum as a whole.
+func (h *handler) requirePermission(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := h.authorize(c, action, 0); err != nil {
+			return err
+		}
+
+		return c.Next()
+	}
+}
+
+// moderate adapts a repository method taking an id into a handler that replies
+// 204 on success, which is all the restore and purge endpoints need.
+func moderate(action func(ctx context.Context, id uint) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		if err := action(c.Context(), id); err != nil {
+			return err
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// moderateIn is moderate for content that lives in a Topic. topicOf finds the
+// Topic of the :id param, which the current User has to be able to moderate.
+func (h *handler) moderateIn(topicOf func(ctx context.Context, id uint) (uint, error), action func(ctx context.Context, id uint) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		topicID, err := topicOf(c.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		if err := h.authorize(c, models.ActionModerate, topicID); err != nil {
+			return err
+		}
+
+		return moderate(action)(c)
+	}
+}
+
+// revisionTopicID returns the Topic of the Post a revision belongs to.
+func (h *handler) revisionTopicID(ctx context.Context, id uint) (uint, error) {
+	revision, err := h.store.Posts().GetRevision(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return h.store.Posts().TopicID(ctx, revision.PostID)
+}
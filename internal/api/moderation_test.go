@@ -0,0 +1,173 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Moderation", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+	var app *fiber.App
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		app = New(store.New(database.DBConnection), &mail.Outbox{}, nil)
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	expectModerator := func(userID uint, moderator bool) {
+		expectSessionQuery(mock, userID)
+		expectTwoFactorPolicyQuery(mock, userID)
+		expectPermissionsQuery(mock, userID)
+		expectModeratorQuery(mock, userID, moderator)
+	}
+
+	expectPostTopicIDQuery := func(postID, topicID uint) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `discussions`.`topic_id` FROM `posts` JOIN discussions ON discussions.id = posts.discussion_id WHERE posts.id = ?")).
+			WithArgs(postID).
+			WillReturnRows(sqlmock.NewRows([]string{"topic_id"}).AddRow(topicID))
+	}
+
+	Context("POST /api/v1/posts/:id/restore", func() {
+		When("the current User is a moderator", func() {
+			It("should restore the Post", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectPostTopicIDQuery(7, 5)
+				expectPermissionsQuery(mock, 10)
+				expectModeratorQuery(mock, 10, true)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts` WHERE deleted_at IS NOT NULL")).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "discussion_id"}).AddRow(7, 3))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions`")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `deleted_at`=?")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/posts/7/restore", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+			})
+		})
+
+		When("the current User is not a moderator", func() {
+			It("should respond 403 without touching the Post", func() {
+				expectSessionQuery(mock, 11)
+				expectTwoFactorPolicyQuery(mock, 11)
+				expectPostTopicIDQuery(7, 5)
+				expectPermissionsQuery(mock, 11)
+				expectModeratorQuery(mock, 11, false)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/posts/7/restore", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+
+		When("the current User may only moderate another Topic", func() {
+			It("should respond 403 without touching the Post", func() {
+				expectSessionQuery(mock, 12)
+				expectTwoFactorPolicyQuery(mock, 12)
+				expectPostTopicIDQuery(7, 5)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `permissions`")).
+					WithArgs(12).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "group_id", "topic_id", "action", "deny"}).AddRow(1, 2, 6, models.ActionModerate, false))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "parent_id"}).AddRow(5, nil).AddRow(6, nil))
+				expectModeratorQuery(mock, 12, false)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/posts/7/restore", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+
+		When("there is no session", func() {
+			It("should respond 401", func() {
+				response, err := app.Test(newRequest(fiber.MethodPost, "/api/v1/posts/7/restore", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+			})
+		})
+	})
+
+	Context("DELETE /api/v1/topics/:id/purge", func() {
+		When("the Topic still has Discussions", func() {
+			It("should respond 409", func() {
+				expectModerator(10, true)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics` WHERE parent_id = ?")).
+					WithArgs(20).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `discussions` WHERE topic_id = ?")).
+					WithArgs(20).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodDelete, "/api/v1/topics/20/purge", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusConflict))
+				Expect(decodeError(response).Message).Should(Equal("a Topic with sub-Topics or Discussions cannot be deleted"))
+			})
+		})
+	})
+
+	Context("DELETE /api/v1/users/:id/purge", func() {
+		When("the User authored a Topic", func() {
+			It("should respond 409", func() {
+				expectModerator(10, true)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics` WHERE author_id = ?")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `groups` WHERE author_id = ?")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectRollback()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodDelete, "/api/v1/users/4/purge", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusConflict))
+			})
+		})
+
+		When("the id is not a number", func() {
+			It("should respond 400", func() {
+				expectModerator(10, true)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodDelete, "/api/v1/users/dany/purge", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+			})
+		})
+	})
+})
@@ -0,0 +1,360 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// blockquote matches a Markdown blockquote line, which is how a reply quotes
+// the Post it replies to.
+var blockquote = regexp.MustCompile(`(?m)^ {0,3}>`)
+
+type notificationResponse struct {
+	ID           uint       `json:"id"`
+	Type         string     `json:"type"`
+	ActorID      uint       `json:"actorId"`
+	DiscussionID uint       `json:"discussionId"`
+	PostID       uint       `json:"postId"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	ReadAt       *time.Time `json:"readAt"`
+}
+
+type unreadNotificationsResponse struct {
+	Unread int64 `json:"unread"`
+}
+
+// notificationPreferenceRequest changes only the fields it carries, so that
+// turning the inbox off for a type keeps how it is mailed and vice versa.
+type notificationPreferenceRequest struct {
+	Type  string  `json:"type"`
+	InApp *bool   `json:"inApp"`
+	Email *string `json:"email"`
+}
+
+type notificationPreferenceResponse struct {
+	Type  string `json:"type"`
+	InApp bool   `json:"inApp"`
+	Email string `json:"email"`
+}
+
+type unsubscribeRequest struct {
+	Token string `json:"token"`
+}
+
+type unsubscribeResponse struct {
+	Type string `json:"type,omitempty"`
+}
+
+type subscriptionsResponse struct {
+	DiscussionIDs []uint `json:"discussionIds"`
+	TopicIDs      []uint `json:"topicIds"`
+}
+
+func newNotificationResponse(notification *models.Notification) notificationResponse {
+	return notificationResponse{
+		ID:           notification.ID,
+		Type:         notification.Type,
+		ActorID:      notification.ActorID,
+		DiscussionID: notification.DiscussionID,
+		PostID:       notification.PostID,
+		CreatedAt:    notification.CreatedAt,
+		ReadAt:       notification.ReadAt,
+	}
+}
+
+func (h *handler) listNotifications(c *fiber.Ctx) error {
+	offset, limit := pagination(c)
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, err := h.store.Notifications().List(c.Context(), currentSession(c).UserID, unreadOnly, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	response := make([]notificationResponse, len(notifications))
+	for i := range notifications {
+		response[i] = newNotificationResponse(&notifications[i])
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+func (h *handler) unreadNotifications(c *fiber.Ctx) error {
+	unread, err := h.store.Notifications().CountUnread(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(unreadNotificationsResponse{Unread: unread})
+}
+
+func (h *handler) markAllNotificationsRead(c *fiber.Ctx) error {
+	if err := h.store.Notifications().MarkAllRead(c.Context(), currentSession(c).UserID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// setNotificationRead returns a handler that marks the Notification of the :id
+// param read or unread.
+func (h *handler) setNotificationRead(read bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		if err := h.store.Notifications().SetRead(c.Context(), id, currentSession(c).UserID, read); err != nil {
+			return err
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func (h *handler) listNotificationPreferences(c *fiber.Ctx) error {
+	preferences, err := h.store.Notifications().ListPreferences(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	response := make([]notificationPreferenceResponse, len(preferences))
+	for i, preference := range preferences {
+		response[i] = newNotificationPreferenceResponse(&preference)
+	}
+
+	return c.JSON(listResponse{Data: response})
+}
+
+func (h *handler) setNotificationPreference(c *fiber.Ctx) error {
+	request := &notificationPreferenceRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	preferences, err := h.store.Notifications().ListPreferences(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	preference := &models.NotificationPreference{UserID: currentSession(c).UserID, Type: request.Type}
+	for i := range preferences {
+		if preferences[i].Type == request.Type {
+			preference = &preferences[i]
+		}
+	}
+
+	if request.InApp != nil {
+		preference.InApp = *request.InApp
+	}
+
+	if request.Email != nil {
+		preference.Email = *request.Email
+	}
+
+	if err := h.store.Notifications().SetPreference(c.Context(), preference); err != nil {
+		return err
+	}
+
+	return c.JSON(newNotificationPreferenceResponse(preference))
+}
+
+func newNotificationPreferenceResponse(preference *models.NotificationPreference) notificationPreferenceResponse {
+	return notificationPreferenceResponse{Type: preference.Type, InApp: preference.InApp, Email: preference.Email}
+}
+
+// unsubscribeEmails follows the link at the bottom of a notification email,
+// or the one-click unsubscribe of a mail client, which POSTs to the same URL.
+// The signed token stands in for a session.
+func (h *handler) unsubscribeEmails(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		request := &unsubscribeRequest{}
+		if err := c.BodyParser(request); err != nil {
+			return errMalformedBody
+		}
+		token = request.Token
+	}
+
+	userID, notificationType, err := models.ParseUnsubscribeToken(token)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Notifications().DisableEmails(c.Context(), userID, notificationType); err != nil {
+		return err
+	}
+
+	return c.JSON(unsubscribeResponse{Type: notificationType})
+}
+
+func (h *handler) listSubscriptions(c *fiber.Ctx) error {
+	discussions, topics, err := h.store.Subscriptions().List(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	response := subscriptionsResponse{DiscussionIDs: make([]uint, len(discussions)), TopicIDs: make([]uint, len(topics))}
+	for i, subscription := range discussions {
+		response.DiscussionIDs[i] = subscription.DiscussionID
+	}
+
+	for i, subscription := range topics {
+		response.TopicIDs[i] = subscription.TopicID
+	}
+
+	return c.JSON(response)
+}
+
+func (h *handler) subscribeDiscussion(c *fiber.Ctx) error {
+	discussion, err := h.viewableDiscussion(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Subscriptions().SubscribeDiscussion(c.Context(), currentSession(c).UserID, discussion.ID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) unsubscribeDiscussion(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Subscriptions().UnsubscribeDiscussion(c.Context(), currentSession(c).UserID, id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) subscribeTopic(c *fiber.Ctx) error {
+	topic, err := h.viewableTopic(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Subscriptions().SubscribeTopic(c.Context(), currentSession(c).UserID, topic.ID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) unsubscribeTopic(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Subscriptions().UnsubscribeTopic(c.Context(), currentSession(c).UserID, id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// notifyPost tells the subscribers of the Discussion and its Topic about a new
+// Post, the author of the Post it replies to that it did, and the Users it
+// mentions. Users who may not view the Topic are left out. The Post is already
+// stored, so failing to notify is logged rather than failing the request.
+func (h *handler) notifyPost(c *fiber.Ctx, discussion *models.Discussion, post *models.Post) {
+	recipients, err := h.recipients(c, discussion, post)
+	if err != nil {
+		log.Println("[API_NOTIFY_POST]::LIST_RECIPIENTS_ERROR 💥")
+		return
+	}
+
+	delete(recipients, post.AuthorID)
+	userIDs := make([]uint, 0, len(recipients))
+	for userID := range recipients {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	users, err := h.store.Users().ListWithGroups(c.Context(), userIDs)
+	if err != nil {
+		log.Println("[API_NOTIFY_POST]::LIST_RECIPIENT_USERS_ERROR 💥")
+		return
+	}
+
+	viewers, err := h.acl.Allowed(c.Context(), users, models.ActionView, discussion.TopicID)
+	if err != nil {
+		log.Println("[API_NOTIFY_POST]::CHECK_PERMISSION_ERROR 💥")
+		return
+	}
+
+	notifications := make([]models.Notification, len(viewers))
+	for i, viewer := range viewers {
+		notifications[i] = models.Notification{
+			UserID:       viewer.ID,
+			Type:         recipients[viewer.ID],
+			ActorID:      post.AuthorID,
+			DiscussionID: discussion.ID,
+			PostID:       post.ID,
+		}
+	}
+
+	if _, err := h.store.Notifications().Notify(c.Context(), notifications); err != nil {
+		log.Println("[API_NOTIFY_POST]::NOTIFY_ERROR 💥")
+	}
+}
+
+// recipients maps each User concerned by the Post to the most specific type of
+// Notification they should get.
+func (h *handler) recipients(c *fiber.Ctx, discussion *models.Discussion, post *models.Post) (map[uint]string, error) {
+	recipients := map[uint]string{}
+	notify := func(userID uint, notificationType string) {
+		if rank(notificationType) > rank(recipients[userID]) {
+			recipients[userID] = notificationType
+		}
+	}
+
+	subscribers, err := h.store.Subscriptions().ListSubscribers(c.Context(), discussion.ID, discussion.TopicID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range subscribers {
+		notify(userID, models.NotificationTypePost)
+	}
+
+	if post.ReplyToID != nil {
+		repliedTo, err := h.store.Posts().Get(c.Context(), *post.ReplyToID)
+		if err != nil {
+			return nil, err
+		}
+
+		if blockquote.MatchString(post.Content) {
+			notify(repliedTo.AuthorID, models.NotificationTypeQuote)
+		} else {
+			notify(repliedTo.AuthorID, models.NotificationTypeReply)
+		}
+	}
+
+	for _, mention := range post.Mentions {
+		notify(mention.UserID, models.NotificationTypeMention)
+	}
+
+	return recipients, nil
+}
+
+// rank orders types of Notification from the least specific; "" ranks lowest.
+func rank(notificationType string) int {
+	for i, known := range models.NotificationTypes {
+		if known == notificationType {
+			return i + 1
+		}
+	}
+
+	return 0
+}
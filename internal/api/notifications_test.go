@@ -0,0 +1,316 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var _ = Describe("Notifications", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var jon, sam *models.User
+	var jonCookie, samCookie *http.Cookie
+	var north *models.Topic
+
+	send := func(method, target, body string, cookie *http.Cookie) *http.Response {
+		request := newRequest(method, target, body)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	login := func(user *models.User) *http.Cookie {
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		return &http.Cookie{Name: sessionCookieName, Value: token}
+	}
+
+	discuss := func(cookie *http.Cookie, title, content string) discussionResponse {
+		response := send(fiber.MethodPost, fmt.Sprintf("/api/v1/topics/%d/discussions", north.ID), fmt.Sprintf(`{"title":%q,"content":%q}`, title, content), cookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+
+		body := discussionResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body
+	}
+
+	reply := func(cookie *http.Cookie, discussionID uint, content string, replyToID uint) postResponse {
+		body := fmt.Sprintf(`{"content":%q}`, content)
+		if replyToID != 0 {
+			body = fmt.Sprintf(`{"content":%q,"replyToId":%d}`, content, replyToID)
+		}
+
+		response := send(fiber.MethodPost, fmt.Sprintf("/api/v1/discussions/%d/posts", discussionID), body, cookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+
+		post := postResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&post)).Should(Succeed())
+		return post
+	}
+
+	inbox := func(cookie *http.Cookie, query string) []notificationResponse {
+		response := send(fiber.MethodGet, "/api/v1/notifications"+query, "", cookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		var body struct {
+			Data []notificationResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body.Data
+	}
+
+	unread := func(cookie *http.Cookie) int64 {
+		response := send(fiber.MethodGet, "/api/v1/notifications/unread", "", cookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		body := unreadNotificationsResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body.Unread
+	}
+
+	BeforeEach(func() {
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		jon = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, jon)).Should(Succeed())
+		sam = &models.User{UserName: "Samwell", Password: "books"}
+		Expect(s.Users().Create(ctx, sam)).Should(Succeed())
+		jonCookie, samCookie = login(jon), login(sam)
+
+		north = &models.Topic{Title: "The North", AuthorID: jon.ID}
+		Expect(s.Topics().Create(ctx, north)).Should(Succeed())
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should notify Topic subscribers and the authors of Posts replied to or quoted", func() {
+		response := send(fiber.MethodPut, fmt.Sprintf("/api/v1/topics/%d/subscription", north.ID), "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+
+		wall := discuss(jonCookie, "The Wall", "Winter is coming")
+		Expect(inbox(samCookie, "")).Should(HaveLen(1))
+
+		posts, err := s.Posts().List(ctx, wall.ID, 0, 1)
+		Expect(err).ShouldNot(HaveOccurred())
+		quote := reply(samCookie, wall.ID, "> Winter is coming\n\nIt is here", posts[0].ID)
+		Expect(*quote.ReplyToID).Should(Equal(posts[0].ID))
+
+		reply(jonCookie, wall.ID, "Then we march", quote.ID)
+
+		jonInbox := inbox(jonCookie, "")
+		Expect(jonInbox).Should(HaveLen(1))
+		Expect(jonInbox[0].Type).Should(Equal(models.NotificationTypeQuote))
+		Expect(jonInbox[0].ActorID).Should(Equal(sam.ID))
+
+		samInbox := inbox(samCookie, "")
+		Expect(samInbox).Should(HaveLen(2))
+		Expect(samInbox[0].Type).Should(Equal(models.NotificationTypeReply))
+		Expect(samInbox[1].Type).Should(Equal(models.NotificationTypePost))
+	})
+
+	It("should mark Notifications read and unread", func() {
+		wall := discuss(jonCookie, "The Wall", "Winter is coming")
+		posts, err := s.Posts().List(ctx, wall.ID, 0, 1)
+		Expect(err).ShouldNot(HaveOccurred())
+		reply(samCookie, wall.ID, "Indeed", posts[0].ID)
+		reply(samCookie, wall.ID, "Still here", 0)
+		Expect(unread(jonCookie)).Should(Equal(int64(2)))
+
+		notifications := inbox(jonCookie, "")
+		response := send(fiber.MethodPost, fmt.Sprintf("/api/v1/notifications/%d/read", notifications[0].ID), "", jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(inbox(jonCookie, "?unread=true")).Should(HaveLen(1))
+
+		response = send(fiber.MethodPost, fmt.Sprintf("/api/v1/notifications/%d/read", notifications[0].ID), "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+
+		response = send(fiber.MethodPost, "/api/v1/notifications/read", "", jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(unread(jonCookie)).Should(BeZero())
+
+		response = send(fiber.MethodPost, fmt.Sprintf("/api/v1/notifications/%d/unread", notifications[1].ID), "", jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(unread(jonCookie)).Should(Equal(int64(1)))
+
+		response = send(fiber.MethodGet, "/api/v1/notifications", "", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("should leave out the types a User turned off and the Topics they may not view", func() {
+		response := send(fiber.MethodPut, "/api/v1/notifications/preferences", `{"type":"post","inApp":false}`, jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		response = send(fiber.MethodPut, "/api/v1/notifications/preferences", `{"type":"shout","inApp":false}`, jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+
+		response = send(fiber.MethodGet, "/api/v1/notifications/preferences", "", jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		var preferences struct {
+			Data []notificationPreferenceResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&preferences)).Should(Succeed())
+		Expect(preferences.Data).Should(ContainElement(notificationPreferenceResponse{Type: models.NotificationTypePost, InApp: false, Email: models.EmailDeliveryDaily}))
+		Expect(preferences.Data).Should(ContainElement(notificationPreferenceResponse{Type: models.NotificationTypeReply, InApp: true, Email: models.EmailDeliveryImmediate}))
+
+		wall := discuss(jonCookie, "The Wall", "Winter is coming")
+		reply(samCookie, wall.ID, "Indeed", 0)
+		Expect(inbox(jonCookie, "")).Should(BeEmpty())
+
+		Expect(s.Subscriptions().SubscribeTopic(ctx, sam.ID, north.ID)).Should(Succeed())
+		watchers := &models.Group{Name: "Watchers", AuthorID: jon.ID}
+		Expect(s.Groups().Create(ctx, watchers)).Should(Succeed())
+		s.AddGroupMember(sam.ID, watchers.ID)
+		Expect(s.Permissions().Set(ctx, &models.Permission{GroupID: &watchers.ID, TopicID: &north.ID, Action: models.ActionView, Deny: true})).Should(Succeed())
+
+		discuss(jonCookie, "Beyond the Wall", "Wights")
+		Expect(inbox(samCookie, "")).Should(BeEmpty())
+	})
+
+	It("should notify and list the Users mentioned in new Posts who may view them", func() {
+		mentions := func(cookie *http.Cookie) []postResponse {
+			response := send(fiber.MethodGet, "/api/v1/mentions", "", cookie)
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			var body struct {
+				Data []postResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+			return body.Data
+		}
+
+		wall := discuss(jonCookie, "The Wall", "Ask @Samwell, not @Gilly")
+		samInbox := inbox(samCookie, "")
+		Expect(samInbox).Should(HaveLen(1))
+		Expect(samInbox[0].Type).Should(Equal(models.NotificationTypeMention))
+
+		post := reply(samCookie, wall.ID, "Thanks @JonSnow, and `@JonSnow`", 0)
+		Expect(post.ContentHTML).Should(Equal(fmt.Sprintf(`<p>Thanks <a href="/api/v1/users/%d" class="mention">@JonSnow</a>, and <code>@JonSnow</code></p>`+"\n", jon.ID)))
+		jonInbox := inbox(jonCookie, "")
+		Expect(jonInbox).Should(HaveLen(1))
+		Expect(jonInbox[0].Type).Should(Equal(models.NotificationTypeMention))
+
+		Expect(mentions(jonCookie)).Should(HaveLen(1))
+		samMentions := mentions(samCookie)
+		Expect(samMentions).Should(HaveLen(1))
+		Expect(samMentions[0].DiscussionID).Should(Equal(wall.ID))
+
+		watchers := &models.Group{Name: "Watchers", AuthorID: jon.ID}
+		Expect(s.Groups().Create(ctx, watchers)).Should(Succeed())
+		s.AddGroupMember(sam.ID, watchers.ID)
+		Expect(s.Permissions().Set(ctx, &models.Permission{GroupID: &watchers.ID, TopicID: &north.ID, Action: models.ActionView, Deny: true})).Should(Succeed())
+
+		discuss(jonCookie, "Beyond the Wall", "Come along, @Samwell")
+		Expect(inbox(samCookie, "")).Should(HaveLen(1))
+		Expect(mentions(samCookie)).Should(BeEmpty())
+
+		stored, err := s.Posts().ListMentions(ctx, sam.ID, nil, 0, 10)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(stored).Should(HaveLen(1))
+		Expect(stored[0].DiscussionID).Should(Equal(wall.ID))
+
+		edited := send(fiber.MethodPatch, fmt.Sprintf("/api/v1/posts/%d", stored[0].ID), `{"content":"Ask @Samwell again"}`, jonCookie)
+		Expect(edited.StatusCode).Should(Equal(fiber.StatusOK))
+		Expect(s.Posts().ListMentions(ctx, sam.ID, nil, 0, 10)).Should(BeEmpty())
+
+		response := send(fiber.MethodGet, "/api/v1/mentions", "", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("should change how a type is mailed without touching the inbox", func() {
+		response := send(fiber.MethodPut, "/api/v1/notifications/preferences", `{"type":"reply","email":"hourly"}`, jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		preference := notificationPreferenceResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&preference)).Should(Succeed())
+		Expect(preference).Should(Equal(notificationPreferenceResponse{Type: models.NotificationTypeReply, InApp: true, Email: models.EmailDeliveryHourly}))
+
+		response = send(fiber.MethodPut, "/api/v1/notifications/preferences", `{"type":"reply","email":"weekly"}`, jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+
+		wall := discuss(jonCookie, "The Wall", "Winter is coming")
+		posts, err := s.Posts().List(ctx, wall.ID, 0, 1)
+		Expect(err).ShouldNot(HaveOccurred())
+		reply(samCookie, wall.ID, "Indeed", posts[0].ID)
+
+		due, err := s.Notifications().ListDue(ctx, time.Now(), 10)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(due).Should(BeEmpty())
+
+		due, err = s.Notifications().ListDue(ctx, time.Now().Add(time.Hour), 10)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(due).Should(HaveLen(1))
+	})
+
+	It("should unsubscribe from emails with the signed link alone", func() {
+		target := "/api/v1/notifications/unsubscribe?token=" + url.QueryEscape(models.UnsubscribeToken(jon.ID, models.NotificationTypeReply))
+		response := send(fiber.MethodPost, target, "List-Unsubscribe=One-Click", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		preferences, err := s.Notifications().ListPreferences(ctx, jon.ID)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(preferences).Should(ContainElement(models.NotificationPreference{UserID: jon.ID, Type: models.NotificationTypeReply, InApp: true, Email: models.EmailDeliveryOff}))
+		Expect(preferences).Should(ContainElement(models.NotificationPreference{UserID: jon.ID, Type: models.NotificationTypeQuote, InApp: true, Email: models.EmailDeliveryImmediate}))
+
+		response = send(fiber.MethodGet, "/api/v1/notifications/unsubscribe?token="+url.QueryEscape(models.UnsubscribeToken(sam.ID, "")), "", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		preferences, err = s.Notifications().ListPreferences(ctx, sam.ID)
+		Expect(err).ShouldNot(HaveOccurred())
+		for _, preference := range preferences {
+			Expect(preference.Email).Should(Equal(models.EmailDeliveryOff))
+		}
+
+		response = send(fiber.MethodGet, "/api/v1/notifications/unsubscribe?token=forged.token", "", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+	})
+
+	It("should refuse to reply to a Post of another Discussion", func() {
+		wall := discuss(jonCookie, "The Wall", "Winter is coming")
+		other := discuss(jonCookie, "Castle Black", "The Watch")
+		posts, err := s.Posts().List(ctx, other.ID, 0, 1)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		response := send(fiber.MethodPost, fmt.Sprintf("/api/v1/discussions/%d/posts", wall.ID), fmt.Sprintf(`{"content":"Wrong","replyToId":%d}`, posts[0].ID), samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+	})
+
+	It("should list and remove subscriptions", func() {
+		wall := discuss(jonCookie, "The Wall", "Winter is coming")
+		reply(samCookie, wall.ID, "Indeed", 0)
+
+		response := send(fiber.MethodPut, fmt.Sprintf("/api/v1/topics/%d/subscription", north.ID), "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+
+		response = send(fiber.MethodGet, "/api/v1/subscriptions", "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		body := subscriptionsResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		Expect(body).Should(Equal(subscriptionsResponse{DiscussionIDs: []uint{wall.ID}, TopicIDs: []uint{north.ID}}))
+
+		target := fmt.Sprintf("/api/v1/discussions/%d/subscription", wall.ID)
+		response = send(fiber.MethodDelete, target, "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		response = send(fiber.MethodDelete, target, "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+
+		response = send(fiber.MethodPut, target, "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+	})
+})
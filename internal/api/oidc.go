@@ -0,0 +1,315 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/pkg/oidc"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+const oidcCookieName = "golangbb_oidc"
+const oidcCookiePath = "/api/auth/oidc"
+const oidcFlowLifetime = 10 * time.Minute
+const maxGeneratedUserName = 28
+const maxDisplayName = 32
+const maxUserNameAttempts = 100
+
+var errInvalidSSOState = fiber.NewError(fiber.StatusBadRequest, "single sign-on state is missing, expired or does not match")
+var errSSOFailed = fiber.NewError(fiber.StatusUnauthorized, "single sign-on failed")
+var errSSOTwoFactor = fiber.NewError(fiber.StatusForbidden, "two-factor authentication is required, sign in with your password and code instead")
+
+// oidcFlow is kept in a signed cookie between leaving for the provider and
+// coming back. UserID is set when a signed in User started the flow to link
+// the identity to their account.
+type oidcFlow struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	UserID    uint      `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// oidcLogin sends the browser to the provider. Users who are signed in
+// already link the identity instead.
+func (h *handler) oidcLogin(c *fiber.Ctx) error {
+	if h.sso == nil {
+		return fiber.ErrNotFound
+	}
+
+	flow := oidcFlow{ExpiresAt: time.Now().Add(oidcFlowLifetime)}
+	for _, value := range []*string{&flow.State, &flow.Nonce} {
+		random, err := tokens.Generate(tokens.DefaultLength)
+		if err != nil {
+			return err
+		}
+		*value = random
+	}
+
+	verifier, err := oidc.GenerateVerifier()
+	if err != nil {
+		return err
+	}
+	flow.Verifier = verifier
+
+	if user := currentUser(c); user != nil {
+		flow.UserID = user.ID
+	}
+
+	target, err := h.sso.AuthCodeURL(c.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		log.Println("[API_OIDC_LOGIN]::DISCOVERY_ERROR 💥")
+		return err
+	}
+
+	payload, err := json.Marshal(flow)
+	if err != nil {
+		return err
+	}
+
+	setOIDCCookie(c, tokens.Sign(models.TokenSigningKey, string(payload)), flow.ExpiresAt)
+	return c.Redirect(target, fiber.StatusFound)
+}
+
+// oidcCallback finishes the flow. The provider is trusted to have
+// authenticated the User, so forum two-factor codes are not asked for.
+func (h *handler) oidcCallback(c *fiber.Ctx) error {
+	if h.sso == nil {
+		return fiber.ErrNotFound
+	}
+
+	flow, err := readOIDCFlow(c)
+	clearOIDCCookie(c)
+	if err != nil {
+		return err
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		log.Printf("[API_OIDC_CALLBACK]::PROVIDER_ERROR_WARNING ⚠️ %s\n", providerError)
+		return errSSOFailed
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(flow.State)) != 1 {
+		return errInvalidSSOState
+	}
+
+	idToken, err := h.sso.Exchange(c.Context(), c.Query("code"), flow.Verifier)
+	if err != nil {
+		log.Printf("[API_OIDC_CALLBACK]::EXCHANGE_CODE_ERROR 💥 %v\n", err)
+		return errSSOFailed
+	}
+
+	claims, err := h.sso.Verify(c.Context(), idToken, flow.Nonce)
+	if err != nil {
+		log.Printf("[API_OIDC_CALLBACK]::VERIFY_ID_TOKEN_ERROR 💥 %v\n", err)
+		return errSSOFailed
+	}
+
+	if flow.UserID != 0 {
+		return h.linkIdentity(c, flow.UserID, claims)
+	}
+
+	user, err := h.store.Identities().GetUser(c.Context(), h.sso.Issuer(), claims.Subject)
+	if err == gorm.ErrRecordNotFound {
+		user, err = h.createSSOUser(c, claims)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := h.checkSSOTwoFactor(c, user); err != nil {
+		return err
+	}
+
+	if err := h.startSession(c, user); err != nil {
+		return err
+	}
+
+	return c.Redirect(internal.PUBLICURL, fiber.StatusSeeOther)
+}
+
+// checkSSOTwoFactor refuses single sign-on to Users who enabled two-factor
+// authentication or belong to a Group that requires it. The provider sends
+// them back with a redirect, which has no way to ask for their code.
+func (h *handler) checkSSOTwoFactor(c *fiber.Ctx, user *models.User) error {
+	required, err := h.store.TwoFactor().IsRequired(c.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	if !required {
+		twoFactor, err := h.store.TwoFactor().Get(c.Context(), user.ID)
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		required = twoFactor.Confirmed
+	}
+
+	if required {
+		log.Println("[API_OIDC_CALLBACK]::TWO_FACTOR_REQUIRED_WARNING ⚠️")
+		return errSSOTwoFactor
+	}
+
+	return nil
+}
+
+// linkIdentity only links to the User who started the flow, so that a link
+// started in one browser cannot be finished by whoever is signed in another.
+func (h *handler) linkIdentity(c *fiber.Ctx, userID uint, claims *oidc.Claims) error {
+	user := currentUser(c)
+	if user == nil || user.ID != userID {
+		return errInvalidSSOState
+	}
+
+	identity := &models.Identity{Issuer: h.sso.Issuer(), Subject: claims.Subject, UserID: userID}
+	if err := h.store.Identities().Link(c.Context(), identity); err != nil {
+		return err
+	}
+
+	return c.Redirect(internal.PUBLICURL, fiber.StatusSeeOther)
+}
+
+// createSSOUser creates the account of a first time sign in. It gets a random
+// password, which the User can replace through a password reset, and the
+// address of the provider when the provider has verified it.
+func (h *handler) createSSOUser(c *fiber.Ctx, claims *oidc.Claims) (*models.User, error) {
+	userName, err := h.freeUserName(c, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := tokens.Generate(tokens.DefaultLength)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		UserName:    userName,
+		DisplayName: displayNameFrom(claims.Name, userName),
+		Password:    password,
+		Identities:  []models.Identity{{Issuer: h.sso.Issuer(), Subject: claims.Subject}},
+	}
+
+	if claims.Email != "" && claims.EmailVerified {
+		_, err := h.store.Emails().Get(c.Context(), claims.Email)
+		if err == gorm.ErrRecordNotFound {
+			user.Emails = []models.Email{{Email: claims.Email, Verified: true, Primary: true}}
+		} else {
+			log.Println("[API_OIDC_CALLBACK]::EMAIL_NOT_ATTACHED_WARNING ⚠️")
+		}
+	}
+
+	if err := h.store.Users().Create(c.Context(), user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// freeUserName derives a UserName from the claims and numbers it until it is
+// not taken.
+func (h *handler) freeUserName(c *fiber.Ctx, claims *oidc.Claims) (string, error) {
+	base := userNameFrom(claims.PreferredUsername)
+	if base == "" {
+		base = userNameFrom(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 2; attempt <= maxUserNameAttempts+1; attempt++ {
+		_, err := h.store.Users().GetByUserName(c.Context(), candidate)
+		if err == gorm.ErrRecordNotFound {
+			return candidate, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		candidate = fmt.Sprintf("%s%d", base, attempt)
+	}
+
+	suffix, err := tokens.Generate(3)
+	if err != nil {
+		return "", err
+	}
+
+	return base + "-" + suffix, nil
+}
+
+func userNameFrom(claim string) string {
+	var b strings.Builder
+	for _, r := range claim {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.' {
+			b.WriteRune(r)
+		}
+
+		if b.Len() == maxGeneratedUserName {
+			break
+		}
+	}
+
+	return b.String()
+}
+
+// displayNameFrom cuts the name claim to what the DisplayName column holds and
+// falls back to userName when the provider sent none.
+func displayNameFrom(claim, userName string) string {
+	name := []rune(strings.TrimSpace(claim))
+	if len(name) > maxDisplayName {
+		name = []rune(strings.TrimSpace(string(name[:maxDisplayName])))
+	}
+
+	if len(name) == 0 {
+		return userName
+	}
+
+	return string(name)
+}
+
+func readOIDCFlow(c *fiber.Ctx) (*oidcFlow, error) {
+	payload, err := tokens.Verify(models.TokenSigningKey, c.Cookies(oidcCookieName))
+	if err != nil {
+		return nil, errInvalidSSOState
+	}
+
+	flow := &oidcFlow{}
+	if err := json.Unmarshal([]byte(payload), flow); err != nil || !flow.ExpiresAt.After(time.Now()) {
+		return nil, errInvalidSSOState
+	}
+
+	return flow, nil
+}
+
+// setOIDCCookie uses SameSite Lax because the provider sends the browser back
+// with a top level redirect from another site.
+func setOIDCCookie(c *fiber.Ctx, value string, expiresAt time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcCookieName,
+		Value:    value,
+		Path:     oidcCookiePath,
+		Expires:  expiresAt,
+		Secure:   internal.COOKIESECURE,
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+}
+
+func clearOIDCCookie(c *fiber.Ctx) {
+	setOIDCCookie(c, "", time.Unix(0, 0))
+}
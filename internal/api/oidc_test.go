@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/oidc"
+	"github.com/golangbb/golangbb/v2/pkg/oidc/oidctest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Single sign-on", func() {
+	const callbackURL = "http://forum.test/api/auth/oidc/callback"
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var issuer *oidctest.Server
+
+	cookieNamed := func(response *http.Response, name string) *http.Cookie {
+		for _, cookie := range response.Cookies() {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+
+		return nil
+	}
+
+	// signIn runs the whole flow in a browser carrying cookies and returns the
+	// response to the callback.
+	signIn := func(cookies ...*http.Cookie) *http.Response {
+		request := newRequest(fiber.MethodGet, "/api/auth/oidc/login", "")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(response.StatusCode).Should(Equal(fiber.StatusFound))
+		flow := cookieNamed(response, oidcCookieName)
+		Expect(flow).ShouldNot(BeNil())
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		response, err = client.Get(response.Header.Get(fiber.HeaderLocation))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		callback, err := url.Parse(response.Header.Get(fiber.HeaderLocation))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		request = newRequest(fiber.MethodGet, callback.RequestURI(), "")
+		request.AddCookie(flow)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+
+		response, err = app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	me := func(session *http.Cookie) userResponse {
+		request := newRequest(fiber.MethodGet, "/api/auth/me", "")
+		request.AddCookie(session)
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		user := userResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&user)).Should(Succeed())
+		return user
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		models.TokenSigningKey = []byte("secret")
+
+		var err error
+		issuer, err = oidctest.NewServer("forum", "client secret")
+		Expect(err).ShouldNot(HaveOccurred())
+		issuer.Subject = "c0ffee"
+		issuer.Claims["preferred_username"] = "ygritte"
+		issuer.Claims["name"] = "Ygritte"
+		issuer.Claims["email"] = "ygritte@wildlings.test"
+		issuer.Claims["email_verified"] = true
+
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, oidc.New(issuer.Config(callbackURL), nil))
+	})
+	AfterEach(func() {
+		issuer.Close()
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should create the account on the first sign in and reuse it afterwards", func() {
+		response := signIn()
+		Expect(response.StatusCode).Should(Equal(fiber.StatusSeeOther))
+		first := me(cookieNamed(response, sessionCookieName))
+		Expect(first.UserName).Should(Equal("ygritte"))
+		Expect(first.DisplayName).Should(Equal("Ygritte"))
+
+		email, err := s.Emails().Get(ctx, "ygritte@wildlings.test")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(email.Verified).Should(BeTrue())
+		Expect(email.UserID).Should(Equal(first.ID))
+
+		response = signIn()
+		Expect(response.StatusCode).Should(Equal(fiber.StatusSeeOther))
+		Expect(me(cookieNamed(response, sessionCookieName)).ID).Should(Equal(first.ID))
+	})
+
+	It("should pick a free UserName and not take over accounts with the same name", func() {
+		Expect(s.Users().Create(ctx, &models.User{UserName: "ygritte", Password: "secret"})).Should(Succeed())
+
+		response := signIn()
+		Expect(response.StatusCode).Should(Equal(fiber.StatusSeeOther))
+		Expect(me(cookieNamed(response, sessionCookieName)).UserName).Should(Equal("ygritte2"))
+	})
+
+	It("should link the identity when a signed in User starts the flow", func() {
+		user := &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		response := signIn(&http.Cookie{Name: sessionCookieName, Value: token})
+		Expect(response.StatusCode).Should(Equal(fiber.StatusSeeOther))
+
+		linked, err := s.Identities().GetUser(ctx, issuer.URL, "c0ffee")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(linked.ID).Should(Equal(user.ID))
+	})
+
+	It("should refuse Users who have been deleted", func() {
+		response := signIn()
+		user := me(cookieNamed(response, sessionCookieName))
+		Expect(s.Users().Delete(ctx, user.ID)).Should(Succeed())
+
+		Expect(signIn().StatusCode).Should(Equal(fiber.StatusForbidden))
+	})
+
+	It("should cut a long name to fit the DisplayName and fall back to the UserName", func() {
+		issuer.Claims["name"] = strings.Repeat("Ygritte ", 4) + "of the Free Folk"
+		first := me(cookieNamed(signIn(), sessionCookieName))
+		Expect(first.DisplayName).Should(Equal(strings.Repeat("Ygritte ", 4)[:31]))
+
+		issuer.Subject = "decaf"
+		issuer.Claims["preferred_username"] = "tormund"
+		issuer.Claims["name"] = " "
+		second := me(cookieNamed(signIn(), sessionCookieName))
+		Expect(second.DisplayName).Should(Equal("tormund"))
+	})
+
+	It("should refuse Users who have to give a two-factor code", func() {
+		user := me(cookieNamed(signIn(), sessionCookieName))
+		group := &models.Group{Name: "Night's Watch", AuthorID: user.ID}
+		Expect(s.Groups().Create(ctx, group)).Should(Succeed())
+		Expect(s.Groups().SetRequireTwoFactor(ctx, group.ID, true)).Should(Succeed())
+		s.AddGroupMember(user.ID, group.ID)
+
+		response := signIn()
+		Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+		Expect(cookieNamed(response, sessionCookieName)).Should(BeNil())
+	})
+
+	It("should reject a callback without the cookie of the flow", func() {
+		response, err := app.Test(newRequest(fiber.MethodGet, "/api/auth/oidc/callback?code=x&state=y", ""))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+	})
+
+	When("single sign-on is not configured", func() {
+		It("should not be found", func() {
+			response, err := New(s, &mail.Outbox{}, nil).Test(newRequest(fiber.MethodGet, "/api/auth/oidc/login", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"gorm.io/gorm"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+var errTooManyResets = fiber.NewError(fiber.StatusTooManyRequests, "too many password reset requests, try again later")
+
+const passwordResetBody = `Hello,
+
+somebody asked to reset the password of the account that %s belongs to. To
+choose a new password, use this token within %s:
+
+%s
+
+If you did not ask for this, you can ignore this message.
+`
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// forgotPassword mails a reset token to a verified address. It responds the
+// same, and as fast, whether or not the address is known, so that it cannot be
+// used to find out who has an account: the token is issued and mailed in the
+// background. Requests are throttled for each address and each IP address.
+func (h *handler) forgotPassword(c *fiber.Ctx) error {
+	request := &forgotPasswordRequest{}
+	if err := c.BodyParser(request); err != nil || request.Email == "" {
+		return errMalformedBody
+	}
+
+	until, err := h.store.LoginAttempts().ThrottlePasswordReset(c.Context(), request.Email, c.IP())
+	if err != nil {
+		return err
+	}
+
+	if !until.IsZero() {
+		log.Println("[API_FORGOT_PASSWORD]::THROTTLED_WARNING ⚠️")
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+		return errTooManyResets
+	}
+
+	email, err := h.store.Emails().Get(c.Context(), request.Email)
+	if err == gorm.ErrRecordNotFound {
+		log.Println("[API_FORGOT_PASSWORD]::UNKNOWN_EMAIL_WARNING ⚠️")
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !email.Verified {
+		log.Println("[API_FORGOT_PASSWORD]::UNVERIFIED_EMAIL_WARNING ⚠️")
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	go h.mailPasswordReset(email.UserID, email.Email)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// mailPasswordReset issues a reset token to the User and mails it to address.
+// It runs after the request has been answered, so failures are only logged.
+func (h *handler) mailPasswordReset(userID uint, address string) {
+	ctx := context.Background()
+	reset := &models.PasswordReset{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(internal.PASSWORDRESETLIFETIME),
+	}
+
+	token, err := h.store.Users().CreatePasswordReset(ctx, reset)
+	if err != nil {
+		log.Println("[API_FORGOT_PASSWORD]::CREATE_PASSWORD_RESET_ERROR 💥")
+		return
+	}
+
+	err = h.mailer.Send(ctx, mail.Message{
+		To:      address,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf(passwordResetBody, address, internal.PASSWORDRESETLIFETIME, token),
+	})
+	if err != nil {
+		log.Println("[API_FORGOT_PASSWORD]::SEND_MAIL_ERROR 💥")
+	}
+}
+
+// resetPassword sets a new password with a token from forgotPassword. The
+// User is signed out everywhere, this client included, and their API tokens
+// are revoked.
+func (h *handler) resetPassword(c *fiber.Ctx) error {
+	request := &resetPasswordRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if request.Token == "" {
+		return models.ErrInvalidToken
+	}
+
+	if err := h.store.Users().ResetPassword(c.Context(), request.Token, request.Password); err != nil {
+		return err
+	}
+
+	clearSessionCookie(c)
+	return c.SendStatus(fiber.StatusNoContent)
+}
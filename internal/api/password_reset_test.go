@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("Password reset", func() {
+	ctx := context.Background()
+	tokenPattern := regexp.MustCompile(`(?m)^(\S+\.\S+)$`)
+	var s *storetest.Store
+	var outbox *mail.Outbox
+	var app *fiber.App
+	var user *models.User
+
+	forgot := func(address string) *http.Response {
+		response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/password/forgot", fmt.Sprintf(`{"email":%q}`, address)))
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	reset := func(token, password string) *http.Response {
+		body := fmt.Sprintf(`{"token":%q,"password":%q}`, token, password)
+		response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/password/reset", body))
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	mailedToken := func() string {
+		Eventually(outbox.Messages).Should(HaveLen(1))
+		messages := outbox.Messages()
+
+		match := tokenPattern.FindStringSubmatch(messages[0].Body)
+		Expect(match).Should(HaveLen(2))
+		return match[1]
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		models.TokenSigningKey = []byte("secret")
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		outbox = &mail.Outbox{}
+		app = New(s, outbox, nil)
+
+		user = &models.User{UserName: "JonSnow", Password: "ghost", Emails: []models.Email{{Email: "jon@nightswatch.org"}, {Email: "snow@winterfell.org"}}}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+
+		token, err := s.Emails().CreateVerification(ctx, &models.EmailVerification{Email: "jon@nightswatch.org", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = s.Emails().Verify(ctx, token)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	Context("POST /api/auth/password/forgot", func() {
+		It("should mail a token to a verified address", func() {
+			Expect(forgot("jon@nightswatch.org").StatusCode).Should(Equal(fiber.StatusNoContent))
+			Eventually(outbox.Messages).Should(HaveLen(1))
+			Expect(outbox.Messages()[0].To).Should(Equal("jon@nightswatch.org"))
+		})
+
+		It("should respond the same for unknown and unverified addresses without mailing them", func() {
+			Expect(forgot("sam@nightswatch.org").StatusCode).Should(Equal(fiber.StatusNoContent))
+			Expect(forgot("snow@winterfell.org").StatusCode).Should(Equal(fiber.StatusNoContent))
+			Consistently(outbox.Messages, 50*time.Millisecond).Should(BeEmpty())
+		})
+
+		It("should throttle the requests for an address, known or not", func() {
+			for _, address := range []string{"jon@nightswatch.org", "sam@nightswatch.org"} {
+				for i := 0; i <= models.PasswordResetPolicy.FreeAttempts; i++ {
+					Expect(forgot(address).StatusCode).Should(Equal(fiber.StatusNoContent))
+				}
+
+				response := forgot(address)
+				Expect(response.StatusCode).Should(Equal(fiber.StatusTooManyRequests))
+				Expect(response.Header.Get(fiber.HeaderRetryAfter)).ShouldNot(BeEmpty())
+			}
+
+			Eventually(outbox.Messages).Should(HaveLen(models.PasswordResetPolicy.FreeAttempts + 1))
+		})
+
+		It("should throttle the requests from an IP address", func() {
+			for i := 0; i <= models.PasswordResetIPPolicy.FreeAttempts; i++ {
+				Expect(forgot(fmt.Sprintf("crow%d@nightswatch.org", i)).StatusCode).Should(Equal(fiber.StatusNoContent))
+			}
+
+			Expect(forgot("jon@nightswatch.org").StatusCode).Should(Equal(fiber.StatusTooManyRequests))
+		})
+	})
+
+	Context("POST /api/auth/password/reset", func() {
+		It("should set the new password once and sign the User out everywhere", func() {
+			session, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+			Expect(err).ShouldNot(HaveOccurred())
+			apiToken, err := s.APITokens().Create(ctx, &models.APIToken{Name: "bot", Scopes: models.ActionView, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			forgot("jon@nightswatch.org")
+			token := mailedToken()
+			Expect(reset(token, "longclaw").StatusCode).Should(Equal(fiber.StatusNoContent))
+			Expect(reset(token, "needle").StatusCode).Should(Equal(fiber.StatusBadRequest))
+
+			_, err = s.Sessions().Get(ctx, session)
+			Expect(err).Should(MatchError(models.ErrInvalidSession))
+			_, err = s.APITokens().Authenticate(ctx, apiToken)
+			Expect(err).Should(HaveOccurred())
+
+			response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/login", `{"userName":"JonSnow","password":"longclaw"}`))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		})
+
+		When("the token has been tampered with", func() {
+			It("should respond 400", func() {
+				Expect(reset("Zm9v.YmFy", "longclaw").StatusCode).Should(Equal(fiber.StatusBadRequest))
+			})
+		})
+	})
+})
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+var errUnknownTopic = fiber.NewError(fiber.StatusUnprocessableEntity, "topic does not exist")
+var errUnknownGroup = fiber.NewError(fiber.StatusUnprocessableEntity, "group does not exist")
+
+type permissionRequest struct {
+	GroupID *uint  `json:"groupId"`
+	TopicID *uint  `json:"topicId"`
+	Action  string `json:"action"`
+	Deny    bool   `json:"deny"`
+}
+
+type permissionResponse struct {
+	ID        uint      `json:"id"`
+	GroupID   *uint     `json:"groupId"`
+	TopicID   *uint     `json:"topicId"`
+	Action    string    `json:"action"`
+	Deny      bool      `json:"deny"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func newPermissionResponse(permission *models.Permission) permissionResponse {
+	return permissionResponse{
+		ID:        permission.ID,
+		GroupID:   permission.GroupID,
+		TopicID:   permission.TopicID,
+		Action:    permission.Action,
+		Deny:      permission.Deny,
+		CreatedAt: permission.CreatedAt,
+		UpdatedAt: permission.UpdatedAt,
+	}
+}
+
+func (h *handler) listPermissions(c *fiber.Ctx) error {
+	permissions, err := h.store.Permissions().List(c.Context())
+	if err != nil {
+		return err
+	}
+
+	response := make([]permissionResponse, len(permissions))
+	for i := range permissions {
+		response[i] = newPermissionResponse(&permissions[i])
+	}
+
+	return c.JSON(listResponse{Data: response})
+}
+
+// setPermission grants or denies an action. Administering a Topic is enough to
+// change the rules below it. The Topic and Group the rule names have to exist.
+func (h *handler) setPermission(c *fiber.Ctx) error {
+	request := &permissionRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if err := h.authorize(c, models.ActionAdminister, topicOrForum(request.TopicID)); err != nil {
+		return err
+	}
+
+	if request.TopicID != nil {
+		if _, err := h.store.Topics().Get(c.Context(), *request.TopicID); err == gorm.ErrRecordNotFound {
+			return errUnknownTopic
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if request.GroupID != nil {
+		if _, err := h.store.Groups().Get(c.Context(), *request.GroupID); err == gorm.ErrRecordNotFound {
+			return errUnknownGroup
+		} else if err != nil {
+			return err
+		}
+	}
+
+	permission := &models.Permission{
+		GroupID: request.GroupID,
+		TopicID: request.TopicID,
+		Action:  request.Action,
+		Deny:    request.Deny,
+	}
+
+	if err := h.store.Permissions().Set(c.Context(), permission); err != nil {
+		return err
+	}
+
+	return c.JSON(newPermissionResponse(permission))
+}
+
+func (h *handler) deletePermission(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	permission, err := h.store.Permissions().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionAdminister, topicOrForum(permission.TopicID)); err != nil {
+		return err
+	}
+
+	if err := h.store.Permissions().Delete(c.Context(), id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"time"
+)
+
+var _ = Describe("Permissions", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var admin, member *models.User
+	var admins, staff *models.Group
+	var tokens map[uint]string
+
+	createUser := func(name string) *models.User {
+		user := &models.User{UserName: name, Password: "secret"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		tokens[user.ID] = token
+		return user
+	}
+
+	requestAs := func(user *models.User, method, target, body string) *http.Request {
+		request := newRequest(method, target, body)
+		request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tokens[user.ID]})
+		return request
+	}
+
+	grant := func(groupID, topicID *uint, action string, deny bool) {
+		Expect(s.Permissions().Set(ctx, &models.Permission{GroupID: groupID, TopicID: topicID, Action: action, Deny: deny})).Should(Succeed())
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+		tokens = map[uint]string{}
+
+		admin = createUser("MotherOfDragons")
+		member = createUser("KingInTheNorth")
+
+		admins = &models.Group{Name: "admins", AuthorID: admin.ID}
+		Expect(s.Groups().Create(ctx, admins)).Should(Succeed())
+		s.AddGroupMember(admin.ID, admins.ID)
+		grant(&admins.ID, nil, models.ActionAdminister, false)
+
+		staff = &models.Group{Name: "staff", AuthorID: admin.ID}
+		Expect(s.Groups().Create(ctx, staff)).Should(Succeed())
+		s.AddGroupMember(member.ID, staff.ID)
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	Context("PUT /api/v1/permissions", func() {
+		When("the current User administers the forum", func() {
+			It("should create the rule and list it", func() {
+				body := fmt.Sprintf(`{"groupId":%d,"action":"moderate"}`, staff.ID)
+				response, err := app.Test(requestAs(admin, fiber.MethodPut, "/api/v1/permissions", body))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				response, err = app.Test(requestAs(admin, fiber.MethodGet, "/api/v1/permissions", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				list := &struct{ Data []permissionResponse }{}
+				Expect(json.NewDecoder(response.Body).Decode(list)).Should(Succeed())
+				Expect(list.Data).Should(HaveLen(2))
+				Expect(*list.Data[1].GroupID).Should(Equal(staff.ID))
+				Expect(list.Data[1].Action).Should(Equal(models.ActionModerate))
+			})
+		})
+
+		When("the action is unknown", func() {
+			It("should respond 400", func() {
+				response, err := app.Test(requestAs(admin, fiber.MethodPut, "/api/v1/permissions", `{"action":"fly"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+			})
+		})
+
+		When("the Topic or the Group does not exist", func() {
+			It("should respond 422 without creating the rule", func() {
+				response, err := app.Test(requestAs(admin, fiber.MethodPut, "/api/v1/permissions", `{"topicId":99,"action":"view"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnprocessableEntity))
+				Expect(decodeError(response).Message).Should(Equal("topic does not exist"))
+
+				response, err = app.Test(requestAs(admin, fiber.MethodPut, "/api/v1/permissions", `{"groupId":99,"action":"view"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnprocessableEntity))
+				Expect(decodeError(response).Message).Should(Equal("group does not exist"))
+
+				permissions, err := s.Permissions().List(ctx)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(permissions).Should(HaveLen(1))
+			})
+		})
+
+		When("the current User does not administer the forum", func() {
+			It("should respond 403", func() {
+				response, err := app.Test(requestAs(member, fiber.MethodPut, "/api/v1/permissions", `{"action":"administer"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+
+				response, err = app.Test(requestAs(member, fiber.MethodGet, "/api/v1/permissions", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+
+		When("the current User administers the Topic only", func() {
+			It("should only let them change the rules of that Topic", func() {
+				topic := &models.Topic{Title: "Comics", AuthorID: admin.ID}
+				Expect(s.Topics().Create(ctx, topic)).Should(Succeed())
+				grant(&staff.ID, &topic.ID, models.ActionAdminister, false)
+
+				body := fmt.Sprintf(`{"topicId":%d,"action":"reply","deny":true}`, topic.ID)
+				response, err := app.Test(requestAs(member, fiber.MethodPut, "/api/v1/permissions", body))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				response, err = app.Test(requestAs(member, fiber.MethodPut, "/api/v1/permissions", `{"action":"reply","deny":true}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+	})
+
+	Context("DELETE /api/v1/permissions/:id", func() {
+		It("should remove the rule", func() {
+			grant(&staff.ID, nil, models.ActionModerate, false)
+			permissions, err := s.Permissions().List(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			target := fmt.Sprintf("/api/v1/permissions/%d", permissions[1].ID)
+			response, err := app.Test(requestAs(admin, fiber.MethodDelete, target, ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+
+			permissions, err = s.Permissions().List(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(permissions).Should(HaveLen(1))
+		})
+
+		It("should respond 404 for a rule that does not exist", func() {
+			response, err := app.Test(requestAs(admin, fiber.MethodDelete, "/api/v1/permissions/99", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+		})
+	})
+
+	Context("enforcing rules", func() {
+		var private *models.Topic
+
+		BeforeEach(func() {
+			private = &models.Topic{Title: "Staff room", AuthorID: admin.ID}
+			Expect(s.Topics().Create(ctx, private)).Should(Succeed())
+			Expect(s.Topics().Create(ctx, &models.Topic{Title: "Lobby", AuthorID: admin.ID})).Should(Succeed())
+
+			grant(nil, &private.ID, models.ActionView, true)
+			grant(&staff.ID, &private.ID, models.ActionReply, false)
+		})
+
+		It("should hide denied Topics from guests", func() {
+			response, err := app.Test(newRequest(fiber.MethodGet, fmt.Sprintf("/api/v1/topics/%d", private.ID), ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+
+			response, err = app.Test(newRequest(fiber.MethodGet, fmt.Sprintf("/api/v1/topics/%d/ancestors", private.ID), ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+
+			response, err = app.Test(newRequest(fiber.MethodGet, "/api/v1/topics", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			body := &struct{ Data []topicResponse }{}
+			Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+			Expect(body.Data).Should(HaveLen(1))
+			Expect(body.Data[0].Title).Should(Equal("Lobby"))
+		})
+
+		It("should let a Group rule override the rule for everybody", func() {
+			response, err := app.Test(requestAs(member, fiber.MethodGet, fmt.Sprintf("/api/v1/topics/%d", private.ID), ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			body := `{"title":"Rota","content":"who is on call?"}`
+			response, err = app.Test(requestAs(member, fiber.MethodPost, fmt.Sprintf("/api/v1/topics/%d/discussions", private.ID), body))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+		})
+
+		It("should not apply to forum administrators", func() {
+			body := `{"title":"Rota","content":"who is on call?"}`
+			response, err := app.Test(requestAs(admin, fiber.MethodPost, fmt.Sprintf("/api/v1/topics/%d/discussions", private.ID), body))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+		})
+	})
+})
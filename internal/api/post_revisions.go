@@ -0,0 +1,143 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/pkg/diff"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+var errRevisionHidden = fiber.NewError(fiber.StatusForbidden, "revision content is hidden")
+
+type revisionResponse struct {
+	ID        uint      `json:"id"`
+	PostID    uint      `json:"postId"`
+	AuthorID  *uint     `json:"authorId"`
+	Reason    string    `json:"reason"`
+	Content   string    `json:"content"`
+	Format    string    `json:"format"`
+	Hidden    bool      `json:"hidden"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type revisionDiffResponse struct {
+	From  uint        `json:"from"`
+	To    uint        `json:"to"`
+	Lines []diff.Line `json:"lines"`
+}
+
+// newRevisionResponse leaves the Content of hidden revisions out unless the
+// current User may moderate them.
+func newRevisionResponse(revision *models.PostRevision, moderator bool) revisionResponse {
+	response := revisionResponse{
+		ID:        revision.ID,
+		PostID:    revision.PostID,
+		AuthorID:  revision.AuthorID,
+		Reason:    revision.Reason,
+		Content:   revision.Content,
+		Format:    revision.Format,
+		Hidden:    revision.Hidden,
+		CreatedAt: revision.CreatedAt,
+	}
+
+	if revision.Hidden && !moderator {
+		response.Content = ""
+	}
+
+	return response
+}
+
+// viewPost loads the Post of the :id param once the current User is known to
+// be allowed to view it, and tells whether they may also moderate it.
+func (h *handler) viewPost(c *fiber.Ctx) (*models.Post, bool, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return nil, false, err
+	}
+
+	post, err := h.store.Posts().Get(c.Context(), id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	topicID, err := h.topicOf(c, post)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := h.authorize(c, models.ActionView, topicID); err != nil {
+		return nil, false, err
+	}
+
+	err = h.authorize(c, models.ActionModerate, topicID)
+	if err == errForbidden {
+		return post, false, nil
+	}
+
+	return post, err == nil, err
+}
+
+func (h *handler) listPostRevisions(c *fiber.Ctx) error {
+	post, moderator, err := h.viewPost(c)
+	if err != nil {
+		return err
+	}
+
+	offset, limit := pagination(c)
+	revisions, err := h.store.Posts().ListRevisions(c.Context(), post.ID, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	response := make([]revisionResponse, len(revisions))
+	for i := range revisions {
+		response[i] = newRevisionResponse(&revisions[i], moderator)
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+// diffPostRevisions compares the revisions ?from= and ?to= of a Post line by
+// line.
+func (h *handler) diffPostRevisions(c *fiber.Ctx) error {
+	post, moderator, err := h.viewPost(c)
+	if err != nil {
+		return err
+	}
+
+	from, err := h.revisionOf(c, post, "from", moderator)
+	if err != nil {
+		return err
+	}
+
+	to, err := h.revisionOf(c, post, "to", moderator)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(revisionDiffResponse{From: from.ID, To: to.ID, Lines: diff.Lines(from.Content, to.Content)})
+}
+
+func (h *handler) revisionOf(c *fiber.Ctx, post *models.Post, query string, moderator bool) (*models.PostRevision, error) {
+	id, err := strconv.ParseUint(c.Query(query), 10, 32)
+	if err != nil || id == 0 {
+		return nil, errInvalidID
+	}
+
+	revision, err := h.store.Posts().GetRevision(c.Context(), uint(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if revision.PostID != post.ID {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if revision.Hidden && !moderator {
+		return nil, errRevisionHidden
+	}
+
+	return revision, nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/diff"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"time"
+)
+
+var _ = Describe("Post revisions", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var post *models.Post
+	var authorCookie, moderatorCookie *http.Cookie
+
+	send := func(method, target, body string, cookie *http.Cookie) *http.Response {
+		request := newRequest(method, target, body)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	login := func(user *models.User) *http.Cookie {
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		return &http.Cookie{Name: sessionCookieName, Value: token}
+	}
+
+	listRevisions := func(cookie *http.Cookie) []revisionResponse {
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d/revisions", post.ID), "", cookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		var body struct {
+			Data []revisionResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body.Data
+	}
+
+	BeforeEach(func() {
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		author := &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, author)).Should(Succeed())
+		authorCookie = login(author)
+
+		moderator := &models.User{UserName: "Varys", Password: "birds"}
+		Expect(s.Users().Create(ctx, moderator)).Should(Succeed())
+		moderators := &models.Group{Name: internal.MODERATORGROUP, AuthorID: moderator.ID}
+		Expect(s.Groups().Create(ctx, moderators)).Should(Succeed())
+		s.AddGroupMember(moderator.ID, moderators.ID)
+		moderatorCookie = login(moderator)
+
+		topic := &models.Topic{Title: "The North", AuthorID: moderator.ID}
+		Expect(s.Topics().Create(ctx, topic)).Should(Succeed())
+		discussion := &models.Discussion{Title: "Winter", AuthorID: author.ID, TopicID: topic.ID, Posts: []models.Post{{Content: "Winter is coming"}}}
+		Expect(s.Discussions().Create(ctx, discussion)).Should(Succeed())
+		post = &discussion.Posts[0]
+
+		body := `{"content":"Winter is coming\nfor real","reason":"emphasis"}`
+		Expect(send(fiber.MethodPatch, fmt.Sprintf("/api/v1/posts/%d", post.ID), body, authorCookie).StatusCode).Should(Equal(fiber.StatusOK))
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should keep a revision of every version of the Post", func() {
+		revisions := listRevisions(nil)
+		Expect(revisions).Should(HaveLen(2))
+		Expect(revisions[0].Content).Should(Equal("Winter is coming"))
+		Expect(revisions[1].Content).Should(Equal("Winter is coming\nfor real"))
+		Expect(revisions[1].Reason).Should(Equal("emphasis"))
+	})
+
+	It("should diff two revisions line by line", func() {
+		revisions := listRevisions(nil)
+
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d/revisions/diff?from=%d&to=%d", post.ID, revisions[0].ID, revisions[1].ID), "", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		body := &revisionDiffResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+		Expect(body.Lines).Should(Equal([]diff.Line{
+			{Op: diff.Unchanged, Text: "Winter is coming"},
+			{Op: diff.Added, Text: "for real"},
+		}))
+	})
+
+	It("should not diff revisions of another Post", func() {
+		other := &models.Post{Content: "Hodor", AuthorID: post.AuthorID, DiscussionID: post.DiscussionID}
+		Expect(s.Posts().Create(ctx, other)).Should(Succeed())
+		revisions := listRevisions(nil)
+
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d/revisions/diff?from=%d&to=%d", other.ID, revisions[0].ID, revisions[1].ID), "", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+	})
+
+	It("should let moderators hide the content of a revision", func() {
+		first := listRevisions(nil)[0]
+		target := fmt.Sprintf("/api/v1/revisions/%d/hide", first.ID)
+
+		Expect(send(fiber.MethodPost, target, "", authorCookie).StatusCode).Should(Equal(fiber.StatusForbidden))
+		Expect(send(fiber.MethodPost, target, "", moderatorCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+
+		hidden := listRevisions(authorCookie)[0]
+		Expect(hidden.Hidden).Should(BeTrue())
+		Expect(hidden.Content).Should(BeEmpty())
+		Expect(listRevisions(moderatorCookie)[0].Content).Should(Equal("Winter is coming"))
+
+		revisions := listRevisions(nil)
+		diffTarget := fmt.Sprintf("/api/v1/posts/%d/revisions/diff?from=%d&to=%d", post.ID, revisions[0].ID, revisions[1].ID)
+		response := send(fiber.MethodGet, diffTarget, "", authorCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+		Expect(decodeError(response).Message).Should(Equal("revision content is hidden"))
+		Expect(send(fiber.MethodGet, diffTarget, "", moderatorCookie).StatusCode).Should(Equal(fiber.StatusOK))
+
+		Expect(send(fiber.MethodPost, fmt.Sprintf("/api/v1/revisions/%d/unhide", first.ID), "", moderatorCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(listRevisions(nil)[0].Content).Should(Equal("Winter is coming"))
+	})
+
+	It("should refuse to hide the revision the Post shows", func() {
+		latest := listRevisions(nil)[1]
+
+		response := send(fiber.MethodPost, fmt.Sprintf("/api/v1/revisions/%d/hide", latest.ID), "", moderatorCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusUnprocessableEntity))
+		Expect(listRevisions(nil)[1].Hidden).Should(BeFalse())
+	})
+})
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"log"
+	"time"
+)
+
+type postRequest struct {
+	Content   string `json:"content"`
+	Format    string `json:"format"`
+	Reason    string `json:"reason"`
+	ReplyToID *uint  `json:"replyToId"`
+}
+
+type postResponse struct {
+	ID           uint             `json:"id"`
+	Content      string           `json:"content"`
+	Format       string           `json:"format"`
+	ContentHTML  string           `json:"contentHtml"`
+	DiscussionID uint             `json:"discussionId"`
+	ReplyToID    *uint            `json:"replyToId"`
+	AuthorID     uint             `json:"authorId"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	UpdatedAt    time.Time        `json:"updatedAt"`
+	Reactions    map[string]int64 `json:"reactions"`
+}
+
+// newPostResponse counts reactions of each type. Types nobody used are left
+// out of reactions.
+func newPostResponse(post *models.Post, reactions map[string]int64) postResponse {
+	if reactions == nil {
+		reactions = map[string]int64{}
+	}
+
+	return postResponse{
+		ID:           post.ID,
+		Content:      post.Content,
+		Format:       post.Format,
+		ContentHTML:  post.ContentHTML,
+		DiscussionID: post.DiscussionID,
+		ReplyToID:    post.ReplyToID,
+		AuthorID:     post.AuthorID,
+		CreatedAt:    post.CreatedAt,
+		UpdatedAt:    post.UpdatedAt,
+		Reactions:    reactions,
+	}
+}
+
+func (h *handler) listPosts(c *fiber.Ctx) error {
+	discussionID, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	discussion, err := h.store.Discussions().Get(c.Context(), discussionID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionView, discussion.TopicID); err != nil {
+		return err
+	}
+
+	offset, limit := pagination(c)
+	posts, err := h.store.Posts().List(c.Context(), discussionID, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	reactions, err := h.store.Reactions().CountForPosts(c.Context(), ids)
+	if err != nil {
+		return err
+	}
+
+	if user := currentUser(c); user != nil && len(posts) > 0 {
+		if err := h.store.ReadStates().MarkDiscussionRead(c.Context(), user.ID, discussionID, ids[len(ids)-1]); err != nil {
+			return err
+		}
+	}
+
+	response := make([]postResponse, len(posts))
+	for i := range posts {
+		response[i] = newPostResponse(&posts[i], reactions[posts[i].ID])
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+// listMentions lists the Posts that mention the current User, leaving out
+// those in Topics they may not view.
+func (h *handler) listMentions(c *fiber.Ctx) error {
+	topicIDs, err := h.searchableTopics(c, 0)
+	if err != nil {
+		return err
+	}
+
+	offset, limit := pagination(c)
+	posts, err := h.store.Posts().ListMentions(c.Context(), currentSession(c).UserID, topicIDs, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	reactions, err := h.store.Reactions().CountForPosts(c.Context(), ids)
+	if err != nil {
+		return err
+	}
+
+	response := make([]postResponse, len(posts))
+	for i := range posts {
+		response[i] = newPostResponse(&posts[i], reactions[posts[i].ID])
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+// dropHiddenMentions forgets the mentions of Users who may not view the Topic
+// of the Post, so that nobody is pinged into a Topic they cannot see.
+func (h *handler) dropHiddenMentions(c *fiber.Ctx, topicID uint, post *models.Post) {
+	if len(post.Mentions) == 0 {
+		return
+	}
+
+	userIDs := make([]uint, len(post.Mentions))
+	for i, mention := range post.Mentions {
+		userIDs[i] = mention.UserID
+	}
+
+	users, err := h.store.Users().ListWithGroups(c.Context(), userIDs)
+	if err != nil {
+		log.Println("[API_DROP_HIDDEN_MENTIONS]::LIST_MENTIONED_USERS_ERROR 💥")
+		return
+	}
+
+	viewers, err := h.acl.Allowed(c.Context(), users, models.ActionView, topicID)
+	if err != nil {
+		log.Println("[API_DROP_HIDDEN_MENTIONS]::CHECK_PERMISSION_ERROR 💥")
+		return
+	}
+
+	allowed := make(map[uint]bool, len(viewers))
+	for _, viewer := range viewers {
+		allowed[viewer.ID] = true
+	}
+
+	var hidden []uint
+	var kept []models.Mention
+	for _, mention := range post.Mentions {
+		if allowed[mention.UserID] {
+			kept = append(kept, mention)
+		} else {
+			hidden = append(hidden, mention.UserID)
+		}
+	}
+
+	if err := h.store.Posts().DeleteMentions(c.Context(), post.ID, hidden); err != nil {
+		log.Println("[API_DROP_HIDDEN_MENTIONS]::DELETE_MENTIONS_ERROR 💥")
+		return
+	}
+
+	post.Mentions = kept
+}
+
+func (h *handler) getPost(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.store.Posts().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	topicID, err := h.topicOf(c, post)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionView, topicID); err != nil {
+		return err
+	}
+
+	reactions, err := h.postReactions(c, post.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(newPostResponse(post, reactions))
+}
+
+func (h *handler) createPost(c *fiber.Ctx) error {
+	discussionID, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	request := &postRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	discussion, err := h.store.Discussions().Get(c.Context(), discussionID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionReply, discussion.TopicID); err != nil {
+		return err
+	}
+
+	post := &models.Post{
+		Content:      request.Content,
+		Format:       request.Format,
+		AuthorID:     currentSession(c).UserID,
+		DiscussionID: discussionID,
+		ReplyToID:    request.ReplyToID,
+	}
+
+	if err := h.store.Posts().Create(c.Context(), post); err != nil {
+		return err
+	}
+
+	h.dropHiddenMentions(c, discussion.TopicID, post)
+	h.notifyPost(c, discussion, post)
+
+	return c.Status(fiber.StatusCreated).JSON(newPostResponse(post, nil))
+}
+
+func (h *handler) updatePost(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	request := &postRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	post, err := h.store.Posts().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	topicID, err := h.topicOf(c, post)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorizeAuthor(c, post.AuthorID, topicID); err != nil {
+		return err
+	}
+
+	post.Content = request.Content
+	if request.Format != "" {
+		post.Format = request.Format
+	}
+
+	if err := h.store.Posts().Update(c.Context(), post, currentSession(c).UserID, request.Reason); err != nil {
+		return err
+	}
+
+	h.dropHiddenMentions(c, topicID, post)
+
+	reactions, err := h.postReactions(c, post.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(newPostResponse(post, reactions))
+}
+
+func (h *handler) deletePost(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.store.Posts().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	topicID, err := h.topicOf(c, post)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorizeAuthor(c, post.AuthorID, topicID); err != nil {
+		return err
+	}
+
+	if err := h.store.Posts().Delete(c.Context(), id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// topicOf looks up the Topic a Post was made in, which is what its
+// permissions are decided on.
+func (h *handler) topicOf(c *fiber.Ctx, post *models.Post) (uint, error) {
+	discussion, err := h.store.Discussions().Get(c.Context(), post.DiscussionID)
+	if err != nil {
+		return 0, err
+	}
+
+	return discussion.TopicID, nil
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+)
+
+var _ = Describe("Posts", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+	var app *fiber.App
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		app = New(store.New(database.DBConnection), &mail.Outbox{}, nil)
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	expectDiscussion := func(id uint) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions` WHERE `discussions`.`id` = ? AND `discussions`.`deleted_at` IS NULL LIMIT 1")).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "topic_id"}).AddRow(id, "Marvel vs DC", 20))
+	}
+
+	expectPost := func(id, authorID uint) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts` WHERE `posts`.`id` = ? AND `posts`.`deleted_at` IS NULL LIMIT 1")).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "content", "format", "discussion_id", "author_id"}).AddRow(id, "some content", "plain", 3, authorID))
+	}
+
+	expectReactionCounts := func(postIDs ...driver.Value) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT post_id, type, COUNT(*) AS count FROM `reactions` WHERE post_id IN")).
+			WithArgs(postIDs...).
+			WillReturnRows(sqlmock.NewRows([]string{"post_id", "type", "count"}).AddRow(postIDs[0], "like", 2))
+	}
+
+	Context("GET /api/v1/discussions/:id/posts", func() {
+		It("should respond with a page of Posts", func() {
+			expectDiscussion(3)
+			expectPermissionsQuery(mock, 0)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts` WHERE discussion_id = ? AND `posts`.`deleted_at` IS NULL ORDER BY id LIMIT 20")).
+				WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "content"}).AddRow(1, "first").AddRow(2, "second"))
+			expectReactionCounts(1, 2)
+
+			response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/discussions/3/posts", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			body := &struct{ Data []postResponse }{}
+			Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+			Expect(body.Data).Should(HaveLen(2))
+			Expect(body.Data[0].Content).Should(Equal("first"))
+			Expect(body.Data[0].Reactions).Should(Equal(map[string]int64{"like": 2}))
+			Expect(body.Data[1].Reactions).Should(BeEmpty())
+		})
+	})
+
+	Context("POST /api/v1/discussions/:id/posts", func() {
+		When("replying with Content", func() {
+			It("should create the Post authored by the current User", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectDiscussion(3)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "a **reply**", "markdown", "<p>a <strong>reply</strong></p>\n", 10, 3, nil).
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id FROM discussion_subscriptions WHERE discussion_id = ? UNION SELECT user_id FROM topic_subscriptions WHERE topic_id = ?")).
+					WithArgs(3, 20).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(10))
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/discussions/3/posts", `{"content":"a **reply**"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+
+				body := &postResponse{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(body.ID).Should(Equal(uint(7)))
+				Expect(body.AuthorID).Should(Equal(uint(10)))
+				Expect(body.Format).Should(Equal("markdown"))
+				Expect(body.ContentHTML).Should(Equal("<p>a <strong>reply</strong></p>\n"))
+			})
+		})
+
+		When("replying in a Discussion with many subscribers", func() {
+			It("should check who may view it with a fixed number of queries", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectDiscussion(3)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts`")).
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions`")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id FROM discussion_subscriptions WHERE discussion_id = ? UNION SELECT user_id FROM topic_subscriptions WHERE topic_id = ?")).
+					WithArgs(3, 20).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(10).AddRow(11).AddRow(12).AddRow(13))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE id IN (?,?,?) AND `users`.`deleted_at` IS NULL ORDER BY id")).
+					WithArgs(11, 12, 13).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(11, "arya").AddRow(12, "sansa").AddRow(13, "bran"))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users_groups` WHERE `users_groups`.`user_id` IN (?,?,?)")).
+					WithArgs(11, 12, 13).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "group_id"}).AddRow(12, 2))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `groups` WHERE `groups`.`id` = ? AND `groups`.`deleted_at` IS NULL")).
+					WithArgs(2).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "starks"))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `permissions` ORDER BY id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "group_id", "topic_id", "action", "deny"}).
+						AddRow(1, nil, 20, models.ActionView, true).
+						AddRow(2, 2, 20, models.ActionView, false))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(20, "Winterfell"))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `notification_preferences` WHERE user_id IN (?)")).
+					WithArgs(12).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `notifications`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/discussions/3/posts", `{"content":"a reply"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+			})
+		})
+
+		When("replying in an unknown Format", func() {
+			It("should respond 400 with the validation error", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectDiscussion(3)
+				expectPermissionsQuery(mock, 10)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/discussions/3/posts", `{"content":"[b]a reply[/b]","format":"bbcode"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+				Expect(decodeError(response).Message).Should(Equal("unknown Post Format"))
+			})
+		})
+
+		When("replying with more Content than a Post holds", func() {
+			It("should respond 400 with the validation error", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectDiscussion(3)
+				expectPermissionsQuery(mock, 10)
+
+				content := strings.Repeat("winter ", models.MaxContentLength)
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/discussions/3/posts", `{"content":"`+content+`"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+				Expect(decodeError(response).Message).Should(Equal("Content is too long"))
+			})
+		})
+
+		When("replying to a Discussion that does not exist", func() {
+			It("should respond 404", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/discussions/3/posts", `{"content":"a reply"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+			})
+		})
+
+		When("replying without Content", func() {
+			It("should respond 400 with the validation error", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectDiscussion(3)
+				expectPermissionsQuery(mock, 10)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/discussions/3/posts", `{"content":""}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+				Expect(decodeError(response).Message).Should(Equal("empty Content not allowed"))
+			})
+		})
+	})
+
+	Context("GET /api/v1/posts/:id", func() {
+		It("should respond with the Post", func() {
+			expectPost(7, 10)
+			expectDiscussion(3)
+			expectPermissionsQuery(mock, 0)
+			expectReactionCounts(7)
+
+			response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/posts/7", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		})
+	})
+
+	Context("PATCH /api/v1/posts/:id", func() {
+		When("the current User authored the Post", func() {
+			It("should update the Content, keeping its Format, and save a revision", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectPost(7, 10)
+				expectDiscussion(3)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `updated_at`=?,`content`=?,`format`=?,`content_html`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), "*edited*", "plain", "<p>*edited*</p>\n", 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `mentions` WHERE post_id = ?")).
+					WithArgs(7).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions` (`created_at`,`post_id`,`author_id`,`reason`,`content`,`format`,`hidden`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), 7, 10, "typo", "*edited*", "plain", false).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				expectReactionCounts(7)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPatch, "/api/v1/posts/7", `{"content":"*edited*","reason":"typo"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+			})
+
+			It("should switch the Format when one is given", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectPost(7, 10)
+				expectDiscussion(3)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `updated_at`=?,`content`=?,`format`=?,`content_html`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), "*edited*", "markdown", "<p><em>edited</em></p>\n", 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `mentions` WHERE post_id = ?")).
+					WithArgs(7).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				expectReactionCounts(7)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPatch, "/api/v1/posts/7", `{"content":"*edited*","format":"markdown"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+			})
+		})
+
+		When("the current User did not author the Post", func() {
+			It("should respond 403", func() {
+				expectSessionQuery(mock, 11)
+				expectTwoFactorPolicyQuery(mock, 11)
+				expectPost(7, 10)
+				expectDiscussion(3)
+				expectPermissionsQuery(mock, 11)
+				expectModeratorQuery(mock, 11, false)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPatch, "/api/v1/posts/7", `{"content":"edited"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+	})
+
+	Context("DELETE /api/v1/posts/:id", func() {
+		It("should soft delete the Post", func() {
+			expectSessionQuery(mock, 10)
+			expectTwoFactorPolicyQuery(mock, 10)
+			expectPost(7, 10)
+			expectDiscussion(3)
+			expectPermissionsQuery(mock, 10)
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `deleted_at`=? WHERE `posts`.`id` = ? AND `posts`.`deleted_at` IS NULL")).
+				WithArgs(sqlmock.AnyArg(), 7).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			response, err := app.Test(newSessionRequest(fiber.MethodDelete, "/api/v1/posts/7", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		})
+	})
+})
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"time"
+)
+
+type reactionResponse struct {
+	UserID    uint      `json:"userId"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (h *handler) listReactionTypes(c *fiber.Ctx) error {
+	return c.JSON(listResponse{Data: models.ReactionTypes})
+}
+
+func (h *handler) listReactions(c *fiber.Ctx) error {
+	post, _, err := h.viewPost(c)
+	if err != nil {
+		return err
+	}
+
+	reactionType := c.Query("type")
+	if reactionType != "" && !models.IsReactionType(reactionType) {
+		return models.ErrUnknownReaction
+	}
+
+	offset, limit := pagination(c)
+	reactions, err := h.store.Reactions().List(c.Context(), post.ID, reactionType, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	response := make([]reactionResponse, len(reactions))
+	for i, reaction := range reactions {
+		response[i] = reactionResponse{UserID: reaction.UserID, Type: reaction.Type, CreatedAt: reaction.CreatedAt}
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+func (h *handler) addReaction(c *fiber.Ctx) error {
+	post, err := h.reactablePost(c)
+	if err != nil {
+		return err
+	}
+
+	reaction := &models.Reaction{PostID: post.ID, UserID: currentSession(c).UserID, Type: reactionTypeParam(c)}
+	if err := h.store.Reactions().Add(c.Context(), reaction); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) removeReaction(c *fiber.Ctx) error {
+	post, err := h.reactablePost(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Reactions().Remove(c.Context(), post.ID, currentSession(c).UserID, reactionTypeParam(c)); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// reactablePost loads the Post of the :id param once the current User is
+// known to be allowed to reply to it, which is what reacting requires.
+func (h *handler) reactablePost(c *fiber.Ctx) (*models.Post, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := h.store.Posts().Get(c.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	topicID, err := h.topicOf(c, post)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.authorize(c, models.ActionReply, topicID); err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// reactionTypeParam copies the :type param, which fiber reuses once the
+// request is done, so that it can be stored.
+func reactionTypeParam(c *fiber.Ctx) string {
+	return utils.CopyString(c.Params("type"))
+}
+
+func (h *handler) postReactions(c *fiber.Ctx, postID uint) (map[string]int64, error) {
+	counts, err := h.store.Reactions().CountForPosts(c.Context(), []uint{postID})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts[postID], nil
+}
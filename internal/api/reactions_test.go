@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"time"
+)
+
+var _ = Describe("Reactions", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var author, reader *models.User
+	var post *models.Post
+	var authorCookie, readerCookie *http.Cookie
+
+	send := func(method, target string, cookie *http.Cookie) *http.Response {
+		request := newRequest(method, target, "")
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	login := func(user *models.User) *http.Cookie {
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		return &http.Cookie{Name: sessionCookieName, Value: token}
+	}
+
+	react := func(method, reactionType string, cookie *http.Cookie) int {
+		return send(method, fmt.Sprintf("/api/v1/posts/%d/reactions/%s", post.ID, reactionType), cookie).StatusCode
+	}
+
+	BeforeEach(func() {
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		author = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, author)).Should(Succeed())
+		authorCookie = login(author)
+
+		reader = &models.User{UserName: "Samwell", Password: "books"}
+		Expect(s.Users().Create(ctx, reader)).Should(Succeed())
+		readerCookie = login(reader)
+
+		topic := &models.Topic{Title: "The North", AuthorID: author.ID}
+		Expect(s.Topics().Create(ctx, topic)).Should(Succeed())
+		discussion := &models.Discussion{Title: "Winter", AuthorID: author.ID, TopicID: topic.ID, Posts: []models.Post{{Content: "Winter is coming"}}}
+		Expect(s.Discussions().Create(ctx, discussion)).Should(Succeed())
+		post = &discussion.Posts[0]
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should list the configured reaction types", func() {
+		response := send(fiber.MethodGet, "/api/v1/reaction-types", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		var body struct {
+			Data []string `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		Expect(body.Data).Should(Equal(models.ReactionTypes))
+	})
+
+	It("should count each reaction once per User with the Post", func() {
+		Expect(react(fiber.MethodPut, "like", readerCookie)).Should(Equal(fiber.StatusNoContent))
+		Expect(react(fiber.MethodPut, "like", readerCookie)).Should(Equal(fiber.StatusNoContent))
+		Expect(react(fiber.MethodPut, "like", authorCookie)).Should(Equal(fiber.StatusNoContent))
+		Expect(react(fiber.MethodPut, "wow", readerCookie)).Should(Equal(fiber.StatusNoContent))
+
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d", post.ID), nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		body := &postResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+		Expect(body.Reactions).Should(Equal(map[string]int64{"like": 2, "wow": 1}))
+	})
+
+	It("should list who reacted, optionally by type", func() {
+		Expect(react(fiber.MethodPut, "like", readerCookie)).Should(Equal(fiber.StatusNoContent))
+		Expect(react(fiber.MethodPut, "sad", authorCookie)).Should(Equal(fiber.StatusNoContent))
+
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d/reactions?type=like", post.ID), nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		var body struct {
+			Data []reactionResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		Expect(body.Data).Should(HaveLen(1))
+		Expect(body.Data[0].UserID).Should(Equal(reader.ID))
+		Expect(body.Data[0].Type).Should(Equal("like"))
+
+		response = send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d/reactions?type=meh", post.ID), nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+	})
+
+	It("should remove a reaction of the current User", func() {
+		Expect(react(fiber.MethodPut, "like", readerCookie)).Should(Equal(fiber.StatusNoContent))
+		Expect(react(fiber.MethodDelete, "like", authorCookie)).Should(Equal(fiber.StatusNotFound))
+		Expect(react(fiber.MethodDelete, "like", readerCookie)).Should(Equal(fiber.StatusNoContent))
+
+		counts, err := s.Reactions().CountForPosts(ctx, []uint{post.ID})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(counts).Should(BeEmpty())
+	})
+
+	It("should reject unknown reaction types and anonymous reactions", func() {
+		Expect(react(fiber.MethodPut, "meh", readerCookie)).Should(Equal(fiber.StatusBadRequest))
+		Expect(react(fiber.MethodPut, "like", nil)).Should(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("should roll the reactions to a User's Posts up into their profile", func() {
+		Expect(react(fiber.MethodPut, "like", readerCookie)).Should(Equal(fiber.StatusNoContent))
+		Expect(react(fiber.MethodPut, "love", readerCookie)).Should(Equal(fiber.StatusNoContent))
+
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/users/%d", author.ID), nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		body := &userProfileResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+		Expect(body.UserName).Should(Equal("JonSnow"))
+		Expect(body.Reactions).Should(Equal(map[string]int64{"like": 1, "love": 1}))
+	})
+})
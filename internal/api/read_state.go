@@ -0,0 +1,157 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"gorm.io/gorm"
+)
+
+type markReadRequest struct {
+	PostID uint `json:"postId"`
+}
+
+type unreadTopicResponse struct {
+	TopicID uint  `json:"topicId"`
+	Unread  int64 `json:"unread"`
+}
+
+type firstUnreadResponse struct {
+	PostID uint  `json:"postId"`
+	Offset int64 `json:"offset"`
+	Unread int64 `json:"unread"`
+}
+
+func (h *handler) unreadTopics(c *fiber.Ctx) error {
+	topics, err := h.store.Topics().List(c.Context())
+	if err != nil {
+		return err
+	}
+
+	if topics, err = h.viewable(c, topics); err != nil {
+		return err
+	}
+
+	ids := make([]uint, len(topics))
+	for i := range topics {
+		ids[i] = topics[i].ID
+	}
+
+	unread, err := h.store.ReadStates().CountByTopic(c.Context(), currentSession(c).UserID, ids)
+	if err != nil {
+		return err
+	}
+
+	response := []unreadTopicResponse{}
+	for _, id := range ids {
+		if unread[id] > 0 {
+			response = append(response, unreadTopicResponse{TopicID: id, Unread: unread[id]})
+		}
+	}
+
+	return c.JSON(listResponse{Data: response})
+}
+
+func (h *handler) markAllRead(c *fiber.Ctx) error {
+	if err := h.store.ReadStates().MarkAllRead(c.Context(), currentSession(c).UserID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) markTopicRead(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.store.Topics().Get(c.Context(), id); err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionView, id); err != nil {
+		return err
+	}
+
+	if err := h.store.ReadStates().MarkTopicRead(c.Context(), currentSession(c).UserID, id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// markDiscussionRead marks the Discussion read up to the Post in the body, or
+// up to its last Post when the body is empty.
+func (h *handler) markDiscussionRead(c *fiber.Ctx) error {
+	discussion, err := h.viewableDiscussion(c)
+	if err != nil {
+		return err
+	}
+
+	request := &markReadRequest{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(request); err != nil {
+			return errMalformedBody
+		}
+	}
+
+	if request.PostID != 0 {
+		post, err := h.store.Posts().Get(c.Context(), request.PostID)
+		if err != nil {
+			return err
+		}
+
+		if post.DiscussionID != discussion.ID {
+			return gorm.ErrRecordNotFound
+		}
+	}
+
+	if err := h.store.ReadStates().MarkDiscussionRead(c.Context(), currentSession(c).UserID, discussion.ID, request.PostID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// firstUnread tells where the current User should pick a Discussion up: the
+// first Post they have not read and how many Posts come before it, so that
+// clients can open the right page.
+func (h *handler) firstUnread(c *fiber.Ctx) error {
+	discussion, err := h.viewableDiscussion(c)
+	if err != nil {
+		return err
+	}
+
+	userID := currentSession(c).UserID
+	post, offset, err := h.store.ReadStates().FirstUnread(c.Context(), userID, discussion.ID)
+	if err != nil {
+		return err
+	}
+
+	unread, err := h.store.ReadStates().CountByDiscussion(c.Context(), userID, []uint{discussion.ID})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(firstUnreadResponse{PostID: post.ID, Offset: offset, Unread: unread[discussion.ID]})
+}
+
+// viewableDiscussion loads the Discussion of the :id param if the current User
+// may view it.
+func (h *handler) viewableDiscussion(c *fiber.Ctx) (*models.Discussion, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	discussion, err := h.store.Discussions().Get(c.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.authorize(c, models.ActionView, discussion.TopicID); err != nil {
+		return nil, err
+	}
+
+	return discussion, nil
+}
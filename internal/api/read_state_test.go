@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"time"
+)
+
+var _ = Describe("ReadState", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var jon, sam *models.User
+	var samCookie *http.Cookie
+	var north, crypts *models.Topic
+	var wall, kings *models.Discussion
+
+	send := func(method, target, body string, cookie *http.Cookie) *http.Response {
+		request := newRequest(method, target, body)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	createTopic := func(title string) *models.Topic {
+		topic := &models.Topic{Title: title, AuthorID: jon.ID}
+		Expect(s.Topics().Create(ctx, topic)).Should(Succeed())
+		return topic
+	}
+
+	discuss := func(topic *models.Topic, title string, contents ...string) *models.Discussion {
+		discussion := &models.Discussion{Title: title, AuthorID: jon.ID, TopicID: topic.ID, Posts: []models.Post{{Content: contents[0]}}}
+		Expect(s.Discussions().Create(ctx, discussion)).Should(Succeed())
+
+		for _, content := range contents[1:] {
+			Expect(s.Posts().Create(ctx, &models.Post{Content: content, AuthorID: jon.ID, DiscussionID: discussion.ID})).Should(Succeed())
+		}
+
+		return discussion
+	}
+
+	unreadTopics := func() []unreadTopicResponse {
+		response := send(fiber.MethodGet, "/api/v1/topics/unread", "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		var body struct {
+			Data []unreadTopicResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body.Data
+	}
+
+	firstUnread := func(discussion *models.Discussion) firstUnreadResponse {
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/discussions/%d/unread", discussion.ID), "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		body := firstUnreadResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body
+	}
+
+	BeforeEach(func() {
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		jon = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, jon)).Should(Succeed())
+		sam = &models.User{UserName: "Samwell", Password: "books"}
+		Expect(s.Users().Create(ctx, sam)).Should(Succeed())
+
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: sam.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		samCookie = &http.Cookie{Name: sessionCookieName, Value: token}
+
+		north = createTopic("The North")
+		crypts = createTopic("The Crypts")
+		wall = discuss(north, "The Wall", "Winter is coming", "The Night's Watch", "Hardhome")
+		kings = discuss(crypts, "Winter kings", "Winter is here")
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should count unread Posts per Topic the User may view", func() {
+		Expect(unreadTopics()).Should(ConsistOf(
+			unreadTopicResponse{TopicID: north.ID, Unread: 3},
+			unreadTopicResponse{TopicID: crypts.ID, Unread: 1},
+		))
+
+		Expect(s.Permissions().Set(ctx, &models.Permission{TopicID: &crypts.ID, Action: models.ActionView, Deny: true})).Should(Succeed())
+		Expect(unreadTopics()).Should(ConsistOf(unreadTopicResponse{TopicID: north.ID, Unread: 3}))
+
+		response := send(fiber.MethodGet, "/api/v1/topics/unread", "", nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("should mark the Posts a User lists as read and jump to the first unread one", func() {
+		first := firstUnread(wall)
+		Expect(first.PostID).Should(Equal(wall.Posts[0].ID))
+		Expect(first.Offset).Should(BeZero())
+		Expect(first.Unread).Should(Equal(int64(3)))
+
+		response := send(fiber.MethodGet, fmt.Sprintf("/api/v1/discussions/%d/posts?limit=2", wall.ID), "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		first = firstUnread(wall)
+		Expect(first.Offset).Should(Equal(int64(2)))
+		Expect(first.Unread).Should(Equal(int64(1)))
+
+		response = send(fiber.MethodGet, fmt.Sprintf("/api/v1/topics/%d/discussions", north.ID), "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+		var body struct {
+			Data []discussionResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		Expect(body.Data).Should(HaveLen(1))
+		Expect(body.Data[0].Unread).Should(Equal(int64(1)))
+	})
+
+	It("should mark a Discussion read up to a Post of it, or all of it", func() {
+		target := fmt.Sprintf("/api/v1/discussions/%d/read", wall.ID)
+		response := send(fiber.MethodPost, target, fmt.Sprintf(`{"postId":%d}`, wall.Posts[0].ID), samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(firstUnread(wall).Unread).Should(Equal(int64(2)))
+
+		response = send(fiber.MethodPost, target, fmt.Sprintf(`{"postId":%d}`, kings.Posts[0].ID), samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+
+		response = send(fiber.MethodPost, target, "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(firstUnread(wall).Unread).Should(BeZero())
+	})
+
+	It("should mark a Topic or everything as read", func() {
+		response := send(fiber.MethodPost, fmt.Sprintf("/api/v1/topics/%d/read", north.ID), "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(unreadTopics()).Should(ConsistOf(unreadTopicResponse{TopicID: crypts.ID, Unread: 1}))
+
+		Expect(s.Posts().Create(ctx, &models.Post{Content: "The dead are coming", AuthorID: jon.ID, DiscussionID: wall.ID})).Should(Succeed())
+		Expect(unreadTopics()).Should(HaveLen(2))
+
+		response = send(fiber.MethodPost, "/api/v1/topics/read", "", samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(unreadTopics()).Should(BeEmpty())
+	})
+})
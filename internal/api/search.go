@@ -0,0 +1,175 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/search"
+	"github.com/golangbb/golangbb/v2/pkg/fulltext"
+	"strconv"
+	"time"
+)
+
+const searchDateLayout = "2006-01-02"
+
+var errInvalidSearchFilter = fiber.NewError(fiber.StatusBadRequest, "invalid search filter")
+
+type searchResultResponse struct {
+	Kind         string    `json:"kind"`
+	ID           uint      `json:"id"`
+	DiscussionID uint      `json:"discussionId"`
+	TopicID      uint      `json:"topicId"`
+	AuthorID     uint      `json:"authorId"`
+	Title        string    `json:"title"`
+	Snippet      string    `json:"snippet"`
+	Relevance    float64   `json:"relevance"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// search finds Discussions and Posts in the Topics the current User may view.
+// The q parameter takes words and "quoted phrases", all of which must match.
+// Results can be narrowed to an author, to a topic and its sub-Topics, and to
+// those created since or until a date or time.
+func (h *handler) search(c *fiber.Ctx) error {
+	offset, limit := pagination(c)
+	query := search.Query{Terms: fulltext.Terms(c.Query("q")), Offset: offset, Limit: limit}
+
+	var err error
+	if query.AuthorID, err = searchIDFilter(c, "author"); err != nil {
+		return err
+	}
+
+	if query.Since, err = searchTimeFilter(c, "since", false); err != nil {
+		return err
+	}
+
+	if query.Until, err = searchTimeFilter(c, "until", true); err != nil {
+		return err
+	}
+
+	topicID, err := searchIDFilter(c, "topic")
+	if err != nil {
+		return err
+	}
+
+	if query.TopicIDs, err = h.searchableTopics(c, topicID); err != nil {
+		return err
+	}
+
+	results, err := h.store.Search().Find(c.Context(), query)
+	if err != nil {
+		return err
+	}
+
+	response := make([]searchResultResponse, len(results))
+	for i, result := range results {
+		response[i] = searchResultResponse{
+			Kind:         result.Kind,
+			ID:           result.ID,
+			DiscussionID: result.DiscussionID,
+			TopicID:      result.TopicID,
+			AuthorID:     result.AuthorID,
+			Title:        result.Title,
+			Snippet:      result.Snippet,
+			Relevance:    result.Relevance,
+			CreatedAt:    result.CreatedAt,
+		}
+	}
+
+	return c.JSON(pageResponse{Data: response, Offset: offset, Limit: limit})
+}
+
+// searchableTopics lists the Topics the current User may view, limited to
+// the Topic with topicID and its sub-Topics unless topicID is 0.
+func (h *handler) searchableTopics(c *fiber.Ctx, topicID uint) ([]uint, error) {
+	if topicID != 0 {
+		if _, err := h.store.Topics().Get(c.Context(), topicID); err != nil {
+			return nil, err
+		}
+
+		if err := h.authorize(c, models.ActionView, topicID); err != nil {
+			return nil, err
+		}
+	}
+
+	topics, err := h.store.Topics().List(c.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	parents := map[uint]*uint{}
+	for _, topic := range topics {
+		parents[topic.ID] = topic.ParentID
+	}
+
+	if topics, err = h.viewable(c, topics); err != nil {
+		return nil, err
+	}
+
+	ids := []uint{}
+	for _, topic := range topics {
+		if topicID == 0 || isWithinTopic(topic.ID, topicID, parents) {
+			ids = append(ids, topic.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// isWithinTopic tells whether the Topic with id is ancestorID or one of its
+// sub-Topics, following the parents towards the root.
+func isWithinTopic(id, ancestorID uint, parents map[uint]*uint) bool {
+	seen := map[uint]bool{}
+	for !seen[id] {
+		if id == ancestorID {
+			return true
+		}
+
+		seen[id] = true
+		parentID := parents[id]
+		if parentID == nil {
+			return false
+		}
+
+		id = *parentID
+	}
+
+	return false
+}
+
+func searchIDFilter(c *fiber.Ctx, name string) (uint, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errInvalidSearchFilter
+	}
+
+	return uint(id), nil
+}
+
+// searchTimeFilter parses an RFC 3339 time or a date. A date used as the end
+// of a range includes the whole day.
+func searchTimeFilter(c *fiber.Ctx, name string, end bool) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(searchDateLayout, value)
+	if err != nil {
+		return time.Time{}, errInvalidSearchFilter
+	}
+
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
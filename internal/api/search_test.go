@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/search"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var _ = Describe("Search", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var jon, sam *models.User
+	var north, winterfell, crypts *models.Topic
+
+	find := func(query url.Values) *http.Response {
+		response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/search?"+query.Encode(), ""))
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	found := func(query url.Values) []searchResultResponse {
+		response := find(query)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		var body struct {
+			Data []searchResultResponse `json:"data"`
+		}
+		Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+		return body.Data
+	}
+
+	createTopic := func(title string, parent *models.Topic) *models.Topic {
+		topic := &models.Topic{Title: title, AuthorID: jon.ID}
+		if parent != nil {
+			topic.ParentID = &parent.ID
+		}
+
+		Expect(s.Topics().Create(ctx, topic)).Should(Succeed())
+		return topic
+	}
+
+	discuss := func(topic *models.Topic, author *models.User, title, content string) {
+		discussion := &models.Discussion{Title: title, AuthorID: author.ID, TopicID: topic.ID, Posts: []models.Post{{Content: content}}}
+		Expect(s.Discussions().Create(ctx, discussion)).Should(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		jon = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, jon)).Should(Succeed())
+		sam = &models.User{UserName: "Samwell", Password: "books"}
+		Expect(s.Users().Create(ctx, sam)).Should(Succeed())
+
+		north = createTopic("The North", nil)
+		winterfell = createTopic("Winterfell", north)
+		crypts = createTopic("The Crypts", nil)
+		Expect(s.Permissions().Set(ctx, &models.Permission{TopicID: &crypts.ID, Action: models.ActionView, Deny: true})).Should(Succeed())
+
+		discuss(north, jon, "The Wall", "Winter is coming")
+		discuss(winterfell, sam, "Maesters", "The Citadel says <winter> has come")
+		discuss(crypts, jon, "Winter kings", "Winter is here")
+
+		conversation := &models.Conversation{
+			Title:        "Secrets",
+			Participants: []models.ConversationParticipant{{UserID: sam.ID}},
+			Messages:     []models.Message{{AuthorID: &jon.ID, Content: "Winter is a secret"}},
+		}
+		Expect(s.Conversations().Create(ctx, conversation)).Should(Succeed())
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should find matching Discussions and Posts in the Topics the User may view", func() {
+		results := found(url.Values{"q": {"winter"}})
+		Expect(results).Should(HaveLen(2))
+		for _, result := range results {
+			Expect(result.Kind).Should(Equal(search.KindPost))
+			Expect(result.TopicID).ShouldNot(Equal(crypts.ID))
+			Expect(result.Snippet).ShouldNot(ContainSubstring("secret"))
+		}
+
+		results = found(url.Values{"q": {`"has come"`}})
+		Expect(results).Should(HaveLen(1))
+		Expect(results[0].Title).Should(Equal("Maesters"))
+		Expect(results[0].Snippet).Should(Equal("The Citadel says &lt;winter&gt; <mark>has come</mark>"))
+	})
+
+	It("should narrow the results down to an author, a Topic with its sub-Topics and a date range", func() {
+		Expect(found(url.Values{"q": {"winter"}, "author": {fmt.Sprint(sam.ID)}})).Should(HaveLen(1))
+		Expect(found(url.Values{"q": {"winter"}, "topic": {fmt.Sprint(north.ID)}})).Should(HaveLen(2))
+		Expect(found(url.Values{"q": {"winter"}, "topic": {fmt.Sprint(winterfell.ID)}})).Should(HaveLen(1))
+
+		today := time.Now().UTC().Format(searchDateLayout)
+		Expect(found(url.Values{"q": {"winter"}, "since": {today}, "until": {today}})).Should(HaveLen(2))
+		Expect(found(url.Values{"q": {"winter"}, "since": {time.Now().Add(time.Hour).Format(time.RFC3339)}})).Should(BeEmpty())
+	})
+
+	It("should refuse to search a Topic the User may not view", func() {
+		Expect(find(url.Values{"q": {"winter"}, "topic": {fmt.Sprint(crypts.ID)}}).StatusCode).Should(Equal(fiber.StatusForbidden))
+	})
+
+	It("should reject empty queries and malformed filters", func() {
+		Expect(find(url.Values{"q": {`  "" `}}).StatusCode).Should(Equal(fiber.StatusBadRequest))
+		Expect(find(url.Values{"q": {"winter"}, "author": {"jon"}}).StatusCode).Should(Equal(fiber.StatusBadRequest))
+		Expect(find(url.Values{"q": {"winter"}, "since": {"last winter"}}).StatusCode).Should(Equal(fiber.StatusBadRequest))
+	})
+})
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"strings"
+)
+
+// These specs walk through whole features on the gorm store over SQLite, end
+// to end, rather than one handler at a time.
+var _ = Describe("SQLite store", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var jon, sam *models.User
+	var jonCookie, samCookie *http.Cookie
+
+	send := func(method, target, body string, cookie *http.Cookie) *http.Response {
+		request := newRequest(method, target, body)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	decode := func(response *http.Response, status int, body interface{}) {
+		Expect(response.StatusCode).Should(Equal(status))
+		Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+	}
+
+	login := func(userName, password string) *http.Cookie {
+		response := send(fiber.MethodPost, "/api/auth/login", fmt.Sprintf(`{"userName":%q,"password":%q}`, userName, password), nil)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		for _, cookie := range response.Cookies() {
+			if cookie.Name == sessionCookieName {
+				return cookie
+			}
+		}
+
+		Fail("no session cookie")
+		return nil
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		jon = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, jon)).Should(Succeed())
+		sam = &models.User{UserName: "Samwell", Password: "books"}
+		Expect(s.Users().Create(ctx, sam)).Should(Succeed())
+
+		watch := &models.Group{Name: "Night's Watch", AuthorID: jon.ID}
+		Expect(s.Groups().Create(ctx, watch)).Should(Succeed())
+		s.AddGroupMember(jon.ID, watch.ID)
+		Expect(s.Permissions().Set(ctx, &models.Permission{GroupID: &watch.ID, Action: models.ActionAdminister})).Should(Succeed())
+
+		jonCookie, samCookie = login("JonSnow", "ghost"), login("Samwell", "books")
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should carry a Discussion from its Topic to notifications, revisions, reactions and search", func() {
+		topic := topicResponse{}
+		decode(send(fiber.MethodPost, "/api/v1/topics", `{"title":"The North"}`, jonCookie), fiber.StatusCreated, &topic)
+		Expect(send(fiber.MethodPut, fmt.Sprintf("/api/v1/topics/%d/subscription", topic.ID), "", samCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+
+		discussion := discussionResponse{}
+		decode(send(fiber.MethodPost, fmt.Sprintf("/api/v1/topics/%d/discussions", topic.ID), `{"title":"The Wall","content":"Winter is coming"}`, jonCookie), fiber.StatusCreated, &discussion)
+
+		post := postResponse{}
+		decode(send(fiber.MethodPost, fmt.Sprintf("/api/v1/discussions/%d/posts", discussion.ID), `{"content":"@JonSnow it is here"}`, samCookie), fiber.StatusCreated, &post)
+		Expect(post.ContentHTML).Should(ContainSubstring(fmt.Sprintf(`href="/api/v1/users/%d"`, jon.ID)))
+
+		var notifications struct {
+			Data []notificationResponse `json:"data"`
+		}
+		decode(send(fiber.MethodGet, "/api/v1/notifications", "", samCookie), fiber.StatusOK, &notifications)
+		Expect(notifications.Data).Should(HaveLen(1))
+		Expect(notifications.Data[0].Type).Should(Equal(models.NotificationTypePost))
+		decode(send(fiber.MethodGet, "/api/v1/notifications", "", jonCookie), fiber.StatusOK, &notifications)
+		Expect(notifications.Data).Should(HaveLen(1))
+		Expect(notifications.Data[0].Type).Should(Equal(models.NotificationTypeMention))
+
+		var mentions struct {
+			Data []postResponse `json:"data"`
+		}
+		decode(send(fiber.MethodGet, "/api/v1/mentions", "", jonCookie), fiber.StatusOK, &mentions)
+		Expect(mentions.Data).Should(HaveLen(1))
+		Expect(mentions.Data[0].ID).Should(Equal(post.ID))
+
+		decode(send(fiber.MethodPatch, fmt.Sprintf("/api/v1/posts/%d", post.ID), `{"content":"@JonSnow it is here\nand cold","reason":"weather"}`, samCookie), fiber.StatusOK, &post)
+
+		var revisions struct {
+			Data []revisionResponse `json:"data"`
+		}
+		decode(send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d/revisions", post.ID), "", nil), fiber.StatusOK, &revisions)
+		Expect(revisions.Data).Should(HaveLen(2))
+
+		diff := revisionDiffResponse{}
+		target := fmt.Sprintf("/api/v1/posts/%d/revisions/diff?from=%d&to=%d", post.ID, revisions.Data[1].ID, revisions.Data[0].ID)
+		decode(send(fiber.MethodGet, target, "", nil), fiber.StatusOK, &diff)
+		Expect(diff.Lines).Should(HaveLen(2))
+		Expect(diff.Lines[1].Text).Should(Equal("and cold"))
+
+		Expect(send(fiber.MethodPut, fmt.Sprintf("/api/v1/posts/%d/reactions/like", post.ID), "", jonCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		decode(send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d", post.ID), "", nil), fiber.StatusOK, &post)
+		Expect(post.Reactions).Should(Equal(map[string]int64{"like": 1}))
+
+		var results struct {
+			Data []searchResultResponse `json:"data"`
+		}
+		decode(send(fiber.MethodGet, "/api/v1/search?q=cold", "", nil), fiber.StatusOK, &results)
+		Expect(results.Data).Should(HaveLen(1))
+		Expect(results.Data[0].ID).Should(Equal(post.ID))
+
+		Expect(send(fiber.MethodDelete, fmt.Sprintf("/api/v1/posts/%d", post.ID), "", samCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d", post.ID), "", nil).StatusCode).Should(Equal(fiber.StatusNotFound))
+		Expect(send(fiber.MethodPost, fmt.Sprintf("/api/v1/posts/%d/restore", post.ID), "", jonCookie).StatusCode).Should(Equal(fiber.StatusNoContent))
+		Expect(send(fiber.MethodGet, fmt.Sprintf("/api/v1/posts/%d", post.ID), "", nil).StatusCode).Should(Equal(fiber.StatusOK))
+	})
+
+	It("should apply the Permissions stored in the database", func() {
+		topic := topicResponse{}
+		decode(send(fiber.MethodPost, "/api/v1/topics", `{"title":"The Citadel"}`, jonCookie), fiber.StatusCreated, &topic)
+		Expect(send(fiber.MethodPost, "/api/v1/topics", `{"title":"Oldtown"}`, samCookie).StatusCode).Should(Equal(fiber.StatusForbidden))
+
+		response := send(fiber.MethodPut, "/api/v1/permissions", fmt.Sprintf(`{"topicId":%d,"action":"view","deny":true}`, topic.ID), jonCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		Expect(send(fiber.MethodGet, fmt.Sprintf("/api/v1/topics/%d", topic.ID), "", samCookie).StatusCode).Should(Equal(fiber.StatusNotFound))
+		Expect(send(fiber.MethodGet, fmt.Sprintf("/api/v1/topics/%d", topic.ID), "", jonCookie).StatusCode).Should(Equal(fiber.StatusOK))
+	})
+
+	It("should refuse Posts longer than the content column", func() {
+		topic := topicResponse{}
+		decode(send(fiber.MethodPost, "/api/v1/topics", `{"title":"The North"}`, jonCookie), fiber.StatusCreated, &topic)
+
+		content := strings.Repeat("winter ", models.MaxContentLength)
+		response := send(fiber.MethodPost, fmt.Sprintf("/api/v1/topics/%d/discussions", topic.ID), fmt.Sprintf(`{"title":"The Wall","content":%q}`, content), samCookie)
+		Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+	})
+
+	It("should lock an account after repeated failed logins", func() {
+		body := `{"userName":"JonSnow","password":"wrong"}`
+		for i := 0; i < models.AccountLoginPolicy.FreeAttempts; i++ {
+			Expect(send(fiber.MethodPost, "/api/auth/login", body, nil).StatusCode).Should(Equal(fiber.StatusUnauthorized))
+		}
+
+		Expect(send(fiber.MethodPost, "/api/auth/login", body, nil).StatusCode).Should(Equal(fiber.StatusUnauthorized))
+		Expect(send(fiber.MethodPost, "/api/auth/login", `{"userName":"JonSnow","password":"ghost"}`, nil).StatusCode).Should(Equal(fiber.StatusTooManyRequests))
+	})
+
+	It("should deliver Messages between the participants of a Conversation", func() {
+		conversation := conversationResponse{}
+		body := fmt.Sprintf(`{"title":"Ravens","participantIds":[%d],"content":"Come to the Citadel"}`, jon.ID)
+		decode(send(fiber.MethodPost, "/api/v1/conversations", body, samCookie), fiber.StatusCreated, &conversation)
+
+		var conversations struct {
+			Data []conversationResponse `json:"data"`
+		}
+		decode(send(fiber.MethodGet, "/api/v1/conversations", "", jonCookie), fiber.StatusOK, &conversations)
+		Expect(conversations.Data).Should(HaveLen(1))
+		Expect(conversations.Data[0].ID).Should(Equal(conversation.ID))
+	})
+})
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"time"
+)
+
+var _ = Describe("Topic tree", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var user *models.User
+	var moderators *models.Group
+	var token string
+
+	createTopic := func(title string, parent *models.Topic) *models.Topic {
+		topic := &models.Topic{Title: title, AuthorID: user.ID}
+		if parent != nil {
+			topic.ParentID = &parent.ID
+		}
+
+		Expect(s.Topics().Create(ctx, topic)).Should(Succeed())
+		return topic
+	}
+
+	moderatorRequest := func(method, target, body string) *http.Request {
+		request := newRequest(method, target, body)
+		request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		return request
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		user = &models.User{UserName: "MotherOfDragons", Password: "secret"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+
+		moderators = &models.Group{Name: internal.MODERATORGROUP, AuthorID: user.ID}
+		Expect(s.Groups().Create(ctx, moderators)).Should(Succeed())
+		s.AddGroupMember(user.ID, moderators.ID)
+
+		token, err = s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	Context("GET /api/v1/topics/tree", func() {
+		It("should respond with the nested Topics", func() {
+			comics := createTopic("Comics", nil)
+			createTopic("Marvel", comics)
+			createTopic("Films", nil)
+
+			response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/tree", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			body := &struct {
+				Data []topicTreeResponse `json:"data"`
+			}{}
+			Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+			Expect(body.Data).Should(HaveLen(2))
+			Expect(body.Data[0].Title).Should(Equal("Comics"))
+			Expect(body.Data[0].Children).Should(HaveLen(1))
+			Expect(body.Data[0].Children[0].Title).Should(Equal("Marvel"))
+			Expect(body.Data[1].Children).Should(BeEmpty())
+		})
+	})
+
+	Context("GET /api/v1/topics/:id/ancestors", func() {
+		It("should respond with the breadcrumbs from the root", func() {
+			comics := createTopic("Comics", nil)
+			marvel := createTopic("Marvel", comics)
+			xMen := createTopic("X-Men", marvel)
+
+			response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/"+fmt.Sprint(xMen.ID)+"/ancestors", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			body := &struct {
+				Data []topicResponse `json:"data"`
+			}{}
+			Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+			Expect(body.Data).Should(HaveLen(2))
+			Expect(body.Data[0].Title).Should(Equal("Comics"))
+			Expect(body.Data[1].Title).Should(Equal("Marvel"))
+		})
+
+		It("should respond 404 for a Topic that does not exist", func() {
+			response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/99/ancestors", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+		})
+	})
+
+	Context("GET /api/v1/topics/:id/descendants", func() {
+		It("should respond with the sub-Topics as a tree", func() {
+			comics := createTopic("Comics", nil)
+			marvel := createTopic("Marvel", comics)
+			createTopic("X-Men", marvel)
+
+			response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/"+fmt.Sprint(comics.ID)+"/descendants", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			body := &struct {
+				Data []topicTreeResponse `json:"data"`
+			}{}
+			Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+			Expect(body.Data).Should(HaveLen(1))
+			Expect(body.Data[0].Children[0].Title).Should(Equal("X-Men"))
+		})
+	})
+
+	Context("POST /api/v1/topics/:id/move", func() {
+		administer := func(topic *models.Topic) {
+			permission := &models.Permission{GroupID: &moderators.ID, Action: models.ActionAdminister}
+			if topic != nil {
+				permission.TopicID = &topic.ID
+			}
+
+			Expect(s.Permissions().Set(ctx, permission)).Should(Succeed())
+		}
+
+		When("an administrator moves a Topic", func() {
+			It("should re-parent it at the requested position", func() {
+				comics := createTopic("Comics", nil)
+				createTopic("Marvel", comics)
+				films := createTopic("Films", nil)
+				administer(nil)
+
+				response, err := app.Test(moderatorRequest(fiber.MethodPost, "/api/v1/topics/"+fmt.Sprint(films.ID)+"/move", `{"parentId":`+fmt.Sprint(comics.ID)+`,"position":0}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				body := &topicResponse{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(*body.ParentID).Should(Equal(comics.ID))
+				Expect(body.Position).Should(Equal(0))
+
+				children, err := s.Topics().Descendants(ctx, comics.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(children[0].Title).Should(Equal("Films"))
+				Expect(children[1].Title).Should(Equal("Marvel"))
+			})
+		})
+
+		When("the move would create a cycle", func() {
+			It("should respond 409", func() {
+				comics := createTopic("Comics", nil)
+				marvel := createTopic("Marvel", comics)
+				administer(nil)
+
+				response, err := app.Test(moderatorRequest(fiber.MethodPost, "/api/v1/topics/"+fmt.Sprint(comics.ID)+"/move", `{"parentId":`+fmt.Sprint(marvel.ID)+`}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusConflict))
+				Expect(decodeError(response).Message).Should(Equal(models.ErrTopicCycle.Error()))
+			})
+		})
+
+		When("the current User only moderates", func() {
+			It("should respond 403 without moving the Topic", func() {
+				comics := createTopic("Comics", nil)
+				films := createTopic("Films", nil)
+
+				response, err := app.Test(moderatorRequest(fiber.MethodPost, "/api/v1/topics/"+fmt.Sprint(films.ID)+"/move", `{"parentId":`+fmt.Sprint(comics.ID)+`}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+
+				topic, err := s.Topics().Get(ctx, films.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(topic.ParentID).Should(BeNil())
+			})
+		})
+
+		When("the current User only administers the new parent", func() {
+			It("should respond 403", func() {
+				comics := createTopic("Comics", nil)
+				films := createTopic("Films", nil)
+				administer(comics)
+
+				response, err := app.Test(moderatorRequest(fiber.MethodPost, "/api/v1/topics/"+fmt.Sprint(films.ID)+"/move", `{"parentId":`+fmt.Sprint(comics.ID)+`}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+
+		When("the current User administers both parents", func() {
+			It("should move the Topic between them", func() {
+				comics := createTopic("Comics", nil)
+				marvel := createTopic("Marvel", comics)
+				xMen := createTopic("X-Men", marvel)
+				administer(comics)
+
+				response, err := app.Test(moderatorRequest(fiber.MethodPost, "/api/v1/topics/"+fmt.Sprint(xMen.ID)+"/move", `{"parentId":`+fmt.Sprint(comics.ID)+`}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+			})
+		})
+	})
+})
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"gorm.io/gorm"
+	"math"
+	"time"
+)
+
+type topicRequest struct {
+	Title    string `json:"title"`
+	ParentID *uint  `json:"parentId"`
+}
+
+type moveTopicRequest struct {
+	ParentID *uint `json:"parentId"`
+	Position *int  `json:"position"`
+}
+
+type topicResponse struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	ParentID  *uint     `json:"parentId"`
+	Position  int       `json:"position"`
+	AuthorID  uint      `json:"authorId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type topicTreeResponse struct {
+	topicResponse
+	Children []topicTreeResponse `json:"children"`
+}
+
+func newTopicResponse(topic *models.Topic) topicResponse {
+	return topicResponse{
+		ID:        topic.ID,
+		Title:     topic.Title,
+		ParentID:  topic.ParentID,
+		Position:  topic.Position,
+		AuthorID:  topic.AuthorID,
+		CreatedAt: topic.CreatedAt,
+		UpdatedAt: topic.UpdatedAt,
+	}
+}
+
+func newTopicTreeResponse(topics []models.Topic) []topicTreeResponse {
+	response := make([]topicTreeResponse, len(topics))
+	for i := range topics {
+		response[i] = topicTreeResponse{
+			topicResponse: newTopicResponse(&topics[i]),
+			Children:      newTopicTreeResponse(topics[i].Children),
+		}
+	}
+
+	return response
+}
+
+func (h *handler) listTopics(c *fiber.Ctx) error {
+	topics, err := h.store.Topics().List(c.Context())
+	if err != nil {
+		return err
+	}
+
+	if topics, err = h.viewable(c, topics); err != nil {
+		return err
+	}
+
+	response := make([]topicResponse, len(topics))
+	for i := range topics {
+		response[i] = newTopicResponse(&topics[i])
+	}
+
+	return c.JSON(listResponse{Data: response})
+}
+
+func (h *handler) getTopic(c *fiber.Ctx) error {
+	topic, err := h.viewableTopic(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(newTopicResponse(topic))
+}
+
+func (h *handler) topicTree(c *fiber.Ctx) error {
+	tree, err := h.store.Topics().Tree(c.Context())
+	if err != nil {
+		return err
+	}
+
+	if tree, err = h.viewable(c, tree); err != nil {
+		return err
+	}
+
+	return c.JSON(listResponse{Data: newTopicTreeResponse(tree)})
+}
+
+func (h *handler) topicAncestors(c *fiber.Ctx) error {
+	topic, err := h.viewableTopic(c)
+	if err != nil {
+		return err
+	}
+
+	ancestors, err := h.store.Topics().Ancestors(c.Context(), topic.ID)
+	if err != nil {
+		return err
+	}
+
+	response := make([]topicResponse, len(ancestors))
+	for i := range ancestors {
+		response[i] = newTopicResponse(&ancestors[i])
+	}
+
+	return c.JSON(listResponse{Data: response})
+}
+
+func (h *handler) topicDescendants(c *fiber.Ctx) error {
+	topic, err := h.viewableTopic(c)
+	if err != nil {
+		return err
+	}
+
+	descendants, err := h.store.Topics().Descendants(c.Context(), topic.ID)
+	if err != nil {
+		return err
+	}
+
+	if descendants, err = h.viewable(c, descendants); err != nil {
+		return err
+	}
+
+	return c.JSON(listResponse{Data: newTopicTreeResponse(descendants)})
+}
+
+func (h *handler) createTopic(c *fiber.Ctx) error {
+	request := &topicRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if err := h.authorize(c, models.ActionAdminister, topicOrForum(request.ParentID)); err != nil {
+		return err
+	}
+
+	topic := &models.Topic{
+		Title:    request.Title,
+		ParentID: request.ParentID,
+		AuthorID: currentSession(c).UserID,
+	}
+
+	if err := h.store.Topics().Create(c.Context(), topic); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newTopicResponse(topic))
+}
+
+func (h *handler) updateTopic(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	request := &topicRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	topic, err := h.store.Topics().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorizeAuthor(c, topic.AuthorID, topic.ID); err != nil {
+		return err
+	}
+
+	topic.Title = request.Title
+	if err := h.store.Topics().Update(c.Context(), topic); err != nil {
+		return err
+	}
+
+	return c.JSON(newTopicResponse(topic))
+}
+
+func (h *handler) deleteTopic(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	topic, err := h.store.Topics().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorizeAuthor(c, topic.AuthorID, topic.ID); err != nil {
+		return err
+	}
+
+	if err := h.store.Topics().Delete(c.Context(), id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// moveTopic re-parents a Topic, which takes administering both its old and its
+// new parent, as creating it there would. Without a position the Topic goes
+// after its new siblings.
+func (h *handler) moveTopic(c *fiber.Ctx) error {
+	request := &moveTopicRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	topic, err := h.viewableTopic(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionAdminister, topicOrForum(topic.ParentID)); err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionAdminister, topicOrForum(request.ParentID)); err != nil {
+		return err
+	}
+
+	position := math.MaxInt32
+	if request.Position != nil {
+		position = *request.Position
+	}
+
+	if err := h.store.Topics().Move(c.Context(), topic.ID, request.ParentID, position); err != nil {
+		return err
+	}
+
+	topic, err = h.store.Topics().Get(c.Context(), topic.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(newTopicResponse(topic))
+}
+
+// viewableTopic loads the Topic of the :id param. Topics the current User may
+// not view are reported missing, so that their ids do not give them away.
+func (h *handler) viewableTopic(c *fiber.Ctx) (*models.Topic, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return nil, err
+	}
+
+	topic, err := h.store.Topics().Get(c.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.authorize(c, models.ActionView, topic.ID); err != nil {
+		if err == errForbidden {
+			return nil, gorm.ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return topic, nil
+}
+
+// parentOf maps a missing parent to 0, which permissions treat as the forum.
+func topicOrForum(parentID *uint) uint {
+	if parentID == nil {
+		return 0
+	}
+
+	return *parentID
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Topics", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+	var app *fiber.App
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		app = New(store.New(database.DBConnection), &mail.Outbox{}, nil)
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	expectTopic := func(id, authorID uint) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`id` = ? AND `topics`.`deleted_at` IS NULL LIMIT 1")).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author_id"}).AddRow(id, "Marvel", authorID))
+	}
+
+	Context("GET /api/v1/topics", func() {
+		It("should list every Topic", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY id")).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title", "parent_id"}).AddRow(1, "Comics", nil).AddRow(2, "Marvel", 1))
+			expectPermissionsQuery(mock, 0)
+
+			response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics", ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+			body := &struct{ Data []topicResponse }{}
+			Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+			Expect(body.Data).Should(HaveLen(2))
+			Expect(body.Data[0].ParentID).Should(BeNil())
+			Expect(*body.Data[1].ParentID).Should(Equal(uint(1)))
+		})
+	})
+
+	Context("GET /api/v1/topics/:id", func() {
+		When("the Topic exists", func() {
+			It("should respond with the Topic", func() {
+				expectTopic(2, 10)
+				expectPermissionsQuery(mock, 0)
+
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/2", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				body := &topicResponse{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(body.ID).Should(Equal(uint(2)))
+				Expect(body.Title).Should(Equal("Marvel"))
+			})
+		})
+
+		When("the Topic does not exist", func() {
+			It("should respond 404", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/2", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+			})
+		})
+
+		When("the id is not a number", func() {
+			It("should respond 400 without executing any sql on database", func() {
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/topics/marvel", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+			})
+		})
+	})
+
+	Context("POST /api/v1/topics", func() {
+		When("an administrator creates a Topic", func() {
+			It("should create the Topic authored by the current User", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectAdministratorPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY position,id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "parent_id"}).AddRow(1, nil))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`position`,`author_id`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "Marvel", 1, 0, 10).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/topics", `{"title":"Marvel","parentId":1}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+
+				body := &topicResponse{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(body.ID).Should(Equal(uint(2)))
+				Expect(body.AuthorID).Should(Equal(uint(10)))
+			})
+		})
+
+		When("a member without administer rights creates a Topic", func() {
+			It("should respond 403", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectPermissionsQuery(mock, 10)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/topics", `{"title":"Marvel"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+
+		When("creating a Topic without a Title", func() {
+			It("should respond 400 with the validation error", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectAdministratorPermissionsQuery(mock, 10)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPost, "/api/v1/topics", `{"title":""}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusBadRequest))
+				Expect(decodeError(response).Message).Should(Equal("empty Title not allowed"))
+			})
+		})
+
+		When("creating a Topic without being logged in", func() {
+			It("should respond 401", func() {
+				response, err := app.Test(newRequest(fiber.MethodPost, "/api/v1/topics", `{"title":"Marvel"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+			})
+		})
+	})
+
+	Context("PATCH /api/v1/topics/:id", func() {
+		When("the current User authored the Topic", func() {
+			It("should update the Title", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectTopic(2, 10)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `updated_at`=?,`title`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), "Marvel Comics", 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPatch, "/api/v1/topics/2", `{"title":"Marvel Comics"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				body := &topicResponse{}
+				Expect(json.NewDecoder(response.Body).Decode(body)).Should(Succeed())
+				Expect(body.Title).Should(Equal("Marvel Comics"))
+			})
+		})
+
+		When("the current User did not author the Topic", func() {
+			It("should respond 403", func() {
+				expectSessionQuery(mock, 11)
+				expectTwoFactorPolicyQuery(mock, 11)
+				expectTopic(2, 10)
+				expectPermissionsQuery(mock, 11)
+				expectModeratorQuery(mock, 11, false)
+
+				response, err := app.Test(newSessionRequest(fiber.MethodPatch, "/api/v1/topics/2", `{"title":"Marvel Comics"}`))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusForbidden))
+			})
+		})
+	})
+
+	Context("DELETE /api/v1/topics/:id", func() {
+		When("the Topic still has Discussions", func() {
+			It("should respond 409", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectTopic(2, 10)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics`")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `discussions`")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectRollback()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodDelete, "/api/v1/topics/2", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusConflict))
+			})
+		})
+
+		When("the Topic is empty", func() {
+			It("should respond 204", func() {
+				expectSessionQuery(mock, 10)
+				expectTwoFactorPolicyQuery(mock, 10)
+				expectTopic(2, 10)
+				expectPermissionsQuery(mock, 10)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics`")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `discussions`")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `deleted_at`=?")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				response, err := app.Test(newSessionRequest(fiber.MethodDelete, "/api/v1/topics/2", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+			})
+		})
+	})
+})
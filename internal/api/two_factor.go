@@ -0,0 +1,179 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/pkg/totp"
+	"gorm.io/gorm"
+)
+
+var errTwoFactorCodeRequired = fiber.NewError(fiber.StatusUnauthorized, "two-factor code required")
+var errInvalidTwoFactorCode = fiber.NewError(fiber.StatusUnauthorized, "invalid two-factor code")
+var errTwoFactorSetupRequired = fiber.NewError(fiber.StatusForbidden, "two-factor authentication must be set up first")
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type twoFactorStatusResponse struct {
+	Enabled  bool `json:"enabled"`
+	Pending  bool `json:"pending"`
+	Required bool `json:"required"`
+}
+
+type twoFactorEnrolmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type groupTwoFactorRequest struct {
+	Required bool `json:"required"`
+}
+
+func (h *handler) twoFactorStatus(c *fiber.Ctx) error {
+	userID := currentSession(c).UserID
+
+	required, err := h.store.TwoFactor().IsRequired(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	response := twoFactorStatusResponse{Required: required}
+	twoFactor, err := h.store.TwoFactor().Get(c.Context(), userID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	if err == nil {
+		response.Enabled = twoFactor.Confirmed
+		response.Pending = !twoFactor.Confirmed
+	}
+
+	return c.JSON(response)
+}
+
+// enrolTwoFactor returns a new secret together with the otpauth URI to show as
+// a QR code. Nothing changes for the User until they confirm it.
+func (h *handler) enrolTwoFactor(c *fiber.Ctx) error {
+	session := currentSession(c)
+
+	twoFactor, err := h.store.TwoFactor().Enrol(c.Context(), session.UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(twoFactorEnrolmentResponse{
+		Secret: twoFactor.Secret,
+		URI:    totp.URI(internal.TOTPISSUER, session.User.UserName, twoFactor.Secret),
+	})
+}
+
+// confirmTwoFactor enables the enrolment and returns the recovery codes, which
+// are never shown again.
+func (h *handler) confirmTwoFactor(c *fiber.Ctx) error {
+	request := &twoFactorCodeRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	codes, err := h.store.TwoFactor().Confirm(c.Context(), currentSession(c).UserID, request.Code)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *handler) regenerateRecoveryCodes(c *fiber.Ctx) error {
+	if err := h.verifyTwoFactorCode(c); err != nil {
+		return err
+	}
+
+	codes, err := h.store.TwoFactor().RegenerateRecoveryCodes(c.Context(), currentSession(c).UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *handler) disableTwoFactor(c *fiber.Ctx) error {
+	if err := h.verifyTwoFactorCode(c); err != nil {
+		return err
+	}
+
+	if err := h.store.TwoFactor().Disable(c.Context(), currentSession(c).UserID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// verifyTwoFactorCode asks for a current code before the enrolment can be
+// changed, so that a stolen session alone is not enough.
+func (h *handler) verifyTwoFactorCode(c *fiber.Ctx) error {
+	request := &twoFactorCodeRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	err := h.store.TwoFactor().Verify(c.Context(), currentSession(c).UserID, request.Code)
+	if err == models.ErrInvalidTwoFactorCode {
+		return errInvalidTwoFactorCode
+	}
+
+	return err
+}
+
+// enforceTwoFactor keeps members of Groups that require two-factor
+// authentication out until they have enrolled. The enrolment endpoints live
+// under /api/auth, which it does not guard.
+func (h *handler) enforceTwoFactor(c *fiber.Ctx) error {
+	if currentUser(c) == nil {
+		return c.Next()
+	}
+
+	userID := currentSession(c).UserID
+	required, err := h.store.TwoFactor().IsRequired(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	if !required {
+		return c.Next()
+	}
+
+	twoFactor, err := h.store.TwoFactor().Get(c.Context(), userID)
+	if err == gorm.ErrRecordNotFound || err == nil && !twoFactor.Confirmed {
+		return errTwoFactorSetupRequired
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.Next()
+}
+
+func (h *handler) setGroupTwoFactor(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	request := &groupTwoFactorRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return errMalformedBody
+	}
+
+	if err := h.store.Groups().SetRequireTwoFactor(c.Context(), id, request.Required); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	"github.com/golangbb/golangbb/v2/pkg/totp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var _ = Describe("Two-factor authentication", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var app *fiber.App
+	var user *models.User
+	var cookie *http.Cookie
+
+	requestAs := func(method, target, body string) *http.Response {
+		request := newRequest(method, target, body)
+		request.AddCookie(cookie)
+
+		response, err := app.Test(request)
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	login := func(code string) *http.Response {
+		body := fmt.Sprintf(`{"userName":"JonSnow","password":"ghost","code":%q}`, code)
+		response, err := app.Test(newRequest(fiber.MethodPost, "/api/auth/login", body))
+		Expect(err).ShouldNot(HaveOccurred())
+		return response
+	}
+
+	codeAt := func(secret string, offset int64) string {
+		code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+		Expect(err).ShouldNot(HaveOccurred())
+		return code
+	}
+
+	// enrol sets up two-factor authentication for user through the API and
+	// returns the secret, the code it was confirmed with and the recovery codes.
+	enrol := func() (string, string, []string) {
+		response := requestAs(fiber.MethodPost, "/api/auth/two-factor", "")
+		Expect(response.StatusCode).Should(Equal(fiber.StatusCreated))
+
+		enrolment := &twoFactorEnrolmentResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(enrolment)).Should(Succeed())
+
+		uri, err := url.Parse(enrolment.URI)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(uri.Query().Get("secret")).Should(Equal(enrolment.Secret))
+
+		confirmed := codeAt(enrolment.Secret, 0)
+		response = requestAs(fiber.MethodPost, "/api/auth/two-factor/confirm", fmt.Sprintf(`{"code":%q}`, confirmed))
+		Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+		codes := &recoveryCodesResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(codes)).Should(Succeed())
+		Expect(codes.RecoveryCodes).Should(HaveLen(models.RecoveryCodeCount))
+		return enrolment.Secret, confirmed, codes.RecoveryCodes
+	}
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+
+		user = &models.User{UserName: "JonSnow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, user)).Should(Succeed())
+
+		token, err := s.Sessions().Create(ctx, &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		Expect(err).ShouldNot(HaveOccurred())
+		cookie = &http.Cookie{Name: sessionCookieName, Value: token}
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	Context("POST /api/auth/login", func() {
+		When("the User has enabled two-factor authentication", func() {
+			It("should ask for a code and accept a fresh one", func() {
+				secret, confirmed, _ := enrol()
+
+				response := login("")
+				Expect(response.StatusCode).Should(Equal(fiber.StatusUnauthorized))
+				Expect(decodeError(response).Message).Should(Equal("two-factor code required"))
+
+				Expect(login(confirmed).StatusCode).Should(Equal(fiber.StatusUnauthorized))
+				Expect(login(codeAt(secret, 1)).StatusCode).Should(Equal(fiber.StatusOK))
+			})
+
+			It("should accept each recovery code once", func() {
+				_, _, recoveryCodes := enrol()
+
+				Expect(login(recoveryCodes[0]).StatusCode).Should(Equal(fiber.StatusOK))
+				Expect(login(recoveryCodes[0]).StatusCode).Should(Equal(fiber.StatusUnauthorized))
+			})
+		})
+
+		When("the User never confirmed the enrolment", func() {
+			It("should not ask for a code", func() {
+				Expect(requestAs(fiber.MethodPost, "/api/auth/two-factor", "").StatusCode).Should(Equal(fiber.StatusCreated))
+				Expect(login("").StatusCode).Should(Equal(fiber.StatusOK))
+			})
+		})
+	})
+
+	Context("DELETE /api/auth/two-factor", func() {
+		It("should need a current code", func() {
+			secret, _, _ := enrol()
+
+			Expect(requestAs(fiber.MethodDelete, "/api/auth/two-factor", `{"code":"000000"}`).StatusCode).Should(Equal(fiber.StatusUnauthorized))
+			Expect(requestAs(fiber.MethodDelete, "/api/auth/two-factor", fmt.Sprintf(`{"code":%q}`, codeAt(secret, 1))).StatusCode).Should(Equal(fiber.StatusNoContent))
+			Expect(login("").StatusCode).Should(Equal(fiber.StatusOK))
+		})
+	})
+
+	Context("Groups that require two-factor authentication", func() {
+		var admin *models.User
+		var staff *models.Group
+
+		BeforeEach(func() {
+			admin = &models.User{UserName: "MotherOfDragons", Password: "drogon"}
+			Expect(s.Users().Create(ctx, admin)).Should(Succeed())
+
+			admins := &models.Group{Name: "admins", AuthorID: admin.ID}
+			Expect(s.Groups().Create(ctx, admins)).Should(Succeed())
+			s.AddGroupMember(admin.ID, admins.ID)
+			Expect(s.Permissions().Set(ctx, &models.Permission{GroupID: &admins.ID, Action: models.ActionAdminister})).Should(Succeed())
+
+			staff = &models.Group{Name: "staff", AuthorID: admin.ID}
+			Expect(s.Groups().Create(ctx, staff)).Should(Succeed())
+			s.AddGroupMember(user.ID, staff.ID)
+		})
+
+		It("should only let forum administrators change the policy", func() {
+			target := fmt.Sprintf("/api/v1/groups/%d/two-factor", staff.ID)
+			Expect(requestAs(fiber.MethodPut, target, `{"required":true}`).StatusCode).Should(Equal(fiber.StatusForbidden))
+
+			token, err := s.Sessions().Create(ctx, &models.Session{UserID: admin.ID, ExpiresAt: time.Now().Add(time.Hour)})
+			Expect(err).ShouldNot(HaveOccurred())
+			request := newRequest(fiber.MethodPut, target, `{"required":true}`)
+			request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+
+			response, err := app.Test(request)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).Should(Equal(fiber.StatusNoContent))
+		})
+
+		It("should keep members out until they enrol and stop them disabling it", func() {
+			Expect(s.Groups().SetRequireTwoFactor(ctx, staff.ID, true)).Should(Succeed())
+
+			Expect(requestAs(fiber.MethodGet, "/api/v1/topics", "").StatusCode).Should(Equal(fiber.StatusForbidden))
+
+			response := requestAs(fiber.MethodGet, "/api/auth/two-factor", "")
+			status := &twoFactorStatusResponse{}
+			Expect(json.NewDecoder(response.Body).Decode(status)).Should(Succeed())
+			Expect(status.Required).Should(BeTrue())
+			Expect(status.Enabled).Should(BeFalse())
+
+			secret, _, _ := enrol()
+			Expect(requestAs(fiber.MethodGet, "/api/v1/topics", "").StatusCode).Should(Equal(fiber.StatusOK))
+
+			response = requestAs(fiber.MethodDelete, "/api/auth/two-factor", fmt.Sprintf(`{"code":%q}`, codeAt(secret, 1)))
+			Expect(response.StatusCode).Should(Equal(fiber.StatusConflict))
+		})
+	})
+})
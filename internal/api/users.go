@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/models"
+)
+
+type userProfileResponse struct {
+	userResponse
+	Reactions map[string]int64 `json:"reactions"`
+}
+
+func (h *handler) getUser(c *fiber.Ctx) error {
+	id, err := paramID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorize(c, models.ActionView, 0); err != nil {
+		return err
+	}
+
+	user, err := h.store.Users().Get(c.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	reactions, err := h.store.Reactions().CountForUser(c.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(userProfileResponse{userResponse: newUserResponse(user), Reactions: reactions})
+}
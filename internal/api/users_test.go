@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Users", func() {
+	var s *storetest.Store
+	var app *fiber.App
+
+	BeforeEach(func() {
+		models.PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		app = New(s, &mail.Outbox{}, nil)
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	Context("GET /api/v1/users/:id", func() {
+		When("the User exists", func() {
+			It("should respond with the public profile", func() {
+				user := &models.User{UserName: "MotherOfDragons", DisplayName: "Mother Of Dragons", Password: "secret"}
+				Expect(s.Users().Create(context.Background(), user)).Should(Succeed())
+
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/users/1", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusOK))
+
+				body := map[string]interface{}{}
+				Expect(json.NewDecoder(response.Body).Decode(&body)).Should(Succeed())
+				Expect(body).Should(HaveKeyWithValue("userName", "MotherOfDragons"))
+				Expect(body).ShouldNot(HaveKey("password"))
+			})
+		})
+
+		When("the User has been deleted", func() {
+			It("should respond 404", func() {
+				user := &models.User{UserName: "MotherOfDragons", Password: "secret"}
+				Expect(s.Users().Create(context.Background(), user)).Should(Succeed())
+				Expect(s.Users().Delete(context.Background(), user.ID)).Should(Succeed())
+
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/users/1", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+			})
+		})
+
+		When("the User does not exist", func() {
+			It("should respond 404", func() {
+				response, err := app.Test(newRequest(fiber.MethodGet, "/api/v1/users/4", ""))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.StatusCode).Should(Equal(fiber.StatusNotFound))
+			})
+		})
+	})
+})
@@ -23,13 +23,13 @@ func Connect(dialector gorm.Dialector, config gorm.Config) (*gorm.DB, error) {
 	return DBConnection, nil
 }
 
-func Initialise(models ...interface{}) error {
+func Initialise(migrations ...Migration) error {
 	log.Println("[DATABASE]::RUNNING_DATABASE_MIGRATIONS 💾")
 	if DBConnection == nil {
 		return NoDatabaseConnectionErr
 	}
 
-	err := DBConnection.AutoMigrate(models...)
+	err := Migrate(migrations)
 	if err != nil {
 		log.Println("[DATABASE]::MIGRATION_ERROR 💥")
 		return err
@@ -59,7 +59,7 @@ var _ = Describe("database", func() {
 			})
 		})
 
-		When("initialising after connecting and gorm.AutoMigrate returns an error", func() {
+		When("initialising after connecting and creating schema_migrations returns an error", func() {
 			It("should return an error", func() {
 				_, err := Connect(sqlite.Dialector{
 					DriverName: "sqlite",
@@ -67,10 +67,12 @@ var _ = Describe("database", func() {
 				}, gorm.Config{})
 				Expect(err).ShouldNot(HaveOccurred())
 
-				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `` ()")).
+				mock.ExpectQuery(regexp.QuoteMeta("PRAGMA foreign_keys")).
+					WillReturnRows(sqlmock.NewRows([]string{"foreign_keys"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `schema_migrations`")).
 					WillReturnError(errors.New("some db error"))
 
-				err = Initialise(struct{}{})
+				err = Initialise()
 				Expect(err).Should(HaveOccurred())
 			})
 		})
@@ -83,6 +85,13 @@ var _ = Describe("database", func() {
 				}, gorm.Config{})
 				Expect(err).ShouldNot(HaveOccurred())
 
+				mock.ExpectQuery(regexp.QuoteMeta("PRAGMA foreign_keys")).
+					WillReturnRows(sqlmock.NewRows([]string{"foreign_keys"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `schema_migrations`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `schema_migrations` ORDER BY id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
 				err = Initialise()
 				Expect(err).ShouldNot(HaveOccurred())
 				Expect(err).Should(BeNil())
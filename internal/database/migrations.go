@@ -0,0 +1,353 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"time"
+)
+
+var ErrInvalidMigration = errors.New("migration must have a unique ID and an Up step")
+var ErrSchemaAhead = errors.New("database has migrations this binary does not know about")
+var ErrIrreversibleMigration = errors.New("migration has no Down step")
+var ErrNoMigrationApplied = errors.New("no migration has been applied")
+var ErrForeignKeyViolation = errors.New("migration left rows that violate a foreign key, run `golangbb integrity -repair` first")
+
+// Migration is a single, ordered schema change. Migrations run in the order
+// they are given and each one is applied inside its own transaction together
+// with its schema_migrations record. MySQL commits DDL implicitly, so there a
+// failed migration can be left partially applied.
+type Migration struct {
+	ID   string
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+}
+
+type schemaMigration struct {
+	ID        string    `gorm:"primaryKey;size:255"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// SQL builds a migration step from plain SQL statements, executed in order.
+func SQL(statements ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// AppliedMigrations lists applied migration IDs. A database that has never
+// been migrated has no schema_migrations table and nothing applied.
+func AppliedMigrations() ([]string, error) {
+	if DBConnection == nil {
+		return nil, NoDatabaseConnectionErr
+	}
+
+	if !DBConnection.Migrator().HasTable(&schemaMigration{}) {
+		return nil, nil
+	}
+
+	return appliedMigrations(DBConnection)
+}
+
+func PendingMigrations(migrations []Migration) ([]Migration, error) {
+	applied, err := AppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingMigrations(migrations, applied)
+}
+
+func Migrate(migrations []Migration) error {
+	if DBConnection == nil {
+		return NoDatabaseConnectionErr
+	}
+
+	return withoutForeignKeys(func(db *gorm.DB) error {
+		if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+			log.Println("[DATABASE]::CREATE_SCHEMA_MIGRATIONS_ERROR 💥")
+			return err
+		}
+
+		applied, err := appliedMigrations(db)
+		if err != nil {
+			return err
+		}
+
+		pending, err := pendingMigrations(migrations, applied)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range pending {
+			log.Printf("[DATABASE]::APPLYING_MIGRATION 💾 %s\n", migration.ID)
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				if err := apply(tx, migration); err != nil {
+					return err
+				}
+
+				return checkForeignKeys(tx)
+			}); err != nil {
+				log.Printf("[DATABASE]::APPLY_MIGRATION_ERROR 💥 %s\n", migration.ID)
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Rollback reverts the most recently applied migration.
+func Rollback(migrations []Migration) error {
+	if err := validateMigrations(migrations); err != nil {
+		return err
+	}
+
+	applied, err := AppliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	if err := checkSchema(migrations, applied); err != nil {
+		return err
+	}
+
+	var last *Migration
+	for i := range migrations {
+		if contains(applied, migrations[i].ID) {
+			last = &migrations[i]
+		}
+	}
+
+	if last == nil {
+		return ErrNoMigrationApplied
+	}
+
+	if last.Down == nil {
+		return ErrIrreversibleMigration
+	}
+
+	log.Printf("[DATABASE]::REVERTING_MIGRATION 💾 %s\n", last.ID)
+	return withoutForeignKeys(func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := last.Down(tx); err != nil {
+				log.Printf("[DATABASE]::REVERT_MIGRATION_ERROR 💥 %s\n", last.ID)
+				return err
+			}
+
+			if err := tx.Delete(&schemaMigration{ID: last.ID}).Error; err != nil {
+				return err
+			}
+
+			return checkForeignKeys(tx)
+		})
+	})
+}
+
+// DryRun writes the SQL that Migrate would execute to w without changing the
+// database. Reads still reach the database so that migrations can inspect the
+// current schema; every write is printed and skipped instead.
+func DryRun(w io.Writer, migrations []Migration) error {
+	if DBConnection == nil {
+		return NoDatabaseConnectionErr
+	}
+
+	tx := DBConnection.Session(&gorm.Session{Context: context.Background(), SkipDefaultTransaction: true})
+	tx.Statement.ConnPool = dryRunConn{ConnPool: tx.Statement.ConnPool, dialector: tx.Dialector, out: w}
+
+	var applied []string
+	if tx.Migrator().HasTable(&schemaMigration{}) {
+		var err error
+		if applied, err = appliedMigrations(tx); err != nil {
+			return err
+		}
+	} else if err := tx.Migrator().CreateTable(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	pending, err := pendingMigrations(migrations, applied)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		if err := apply(tx, migration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func apply(tx *gorm.DB, migration Migration) error {
+	if err := migration.Up(tx); err != nil {
+		return err
+	}
+
+	return tx.Create(&schemaMigration{ID: migration.ID, AppliedAt: time.Now()}).Error
+}
+
+// withoutForeignKeys runs fn on a single connection with SQLite foreign key
+// enforcement switched off, so that migrations can rebuild tables that are
+// referenced by others. The pragma cannot be changed inside a transaction and
+// only applies to the connection it is issued on.
+func withoutForeignKeys(fn func(db *gorm.DB) error) error {
+	if DBConnection.Dialector.Name() != "sqlite" {
+		return fn(DBConnection)
+	}
+
+	sqlDB, err := DBConnection.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	db := DBConnection.Session(&gorm.Session{Context: ctx})
+	db.Statement.ConnPool = conn
+
+	var enabled bool
+	if err := db.Raw("PRAGMA foreign_keys").Scan(&enabled).Error; err != nil {
+		log.Println("[DATABASE]::SELECT_FOREIGN_KEYS_PRAGMA_ERROR 💥")
+		return err
+	}
+
+	if !enabled {
+		return fn(db)
+	}
+
+	if err := db.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+		return err
+	}
+
+	err = fn(db)
+	if restoreErr := db.Exec("PRAGMA foreign_keys = ON").Error; restoreErr != nil {
+		log.Println("[DATABASE]::ENABLE_FOREIGN_KEYS_ERROR 💥")
+		if err == nil {
+			err = restoreErr
+		}
+	}
+
+	return err
+}
+
+// checkForeignKeys fails a migration that leaves dangling references behind
+// while SQLite enforcement is switched off. Other dialects enforce foreign keys
+// as each statement runs.
+func checkForeignKeys(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return nil
+	}
+
+	rows, err := tx.Raw("PRAGMA foreign_key_check").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		log.Println("[DATABASE]::FOREIGN_KEY_CHECK_ERROR 💥")
+		return ErrForeignKeyViolation
+	}
+
+	return rows.Err()
+}
+
+func appliedMigrations(db *gorm.DB) ([]string, error) {
+	var applied []string
+	if err := db.Model(&schemaMigration{}).Order("id").Pluck("id", &applied).Error; err != nil {
+		log.Println("[DATABASE]::SELECT_SCHEMA_MIGRATIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func pendingMigrations(migrations []Migration, applied []string) ([]Migration, error) {
+	if err := validateMigrations(migrations); err != nil {
+		return nil, err
+	}
+
+	if err := checkSchema(migrations, applied); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if !contains(applied, migration.ID) {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func validateMigrations(migrations []Migration) error {
+	seen := map[string]bool{}
+	for _, migration := range migrations {
+		if migration.ID == "" || migration.Up == nil || seen[migration.ID] {
+			return ErrInvalidMigration
+		}
+
+		seen[migration.ID] = true
+	}
+
+	return nil
+}
+
+func checkSchema(migrations []Migration, applied []string) error {
+	known := map[string]bool{}
+	for _, migration := range migrations {
+		known[migration.ID] = true
+	}
+
+	for _, id := range applied {
+		if !known[id] {
+			log.Printf("[DATABASE]::UNKNOWN_MIGRATION_ERROR 💥 %s\n", id)
+			return ErrSchemaAhead
+		}
+	}
+
+	return nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+type dryRunConn struct {
+	gorm.ConnPool
+	dialector gorm.Dialector
+	out       io.Writer
+}
+
+func (c dryRunConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	fmt.Fprintf(c.out, "%s;\n", c.dialector.Explain(query, args...))
+	return driver.RowsAffected(0), nil
+}
@@ -0,0 +1,327 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("migrations", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	migrations := []Migration{
+		{
+			ID:   "0001_create_dragons",
+			Up:   SQL("CREATE TABLE dragons (id integer)"),
+			Down: SQL("DROP TABLE dragons"),
+		},
+		{
+			ID:   "0002_add_dragon_name",
+			Up:   SQL("ALTER TABLE dragons ADD COLUMN name text"),
+			Down: SQL("ALTER TABLE dragons DROP COLUMN name"),
+		},
+	}
+
+	expectSchemaMigrationsTable := func() {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?")).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `schema_migrations` (`id` text,`applied_at` datetime NOT NULL,PRIMARY KEY (`id`))")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	expectHasSchemaMigrationsTable := func() {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?")).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	}
+
+	expectApplied := func(ids ...string) {
+		rows := sqlmock.NewRows([]string{"id"})
+		for _, id := range ids {
+			rows.AddRow(id)
+		}
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `schema_migrations` ORDER BY id")).
+			WillReturnRows(rows)
+	}
+
+	expectForeignKeys := func(enabled int) {
+		mock.ExpectQuery(regexp.QuoteMeta("PRAGMA foreign_keys")).
+			WillReturnRows(sqlmock.NewRows([]string{"foreign_keys"}).AddRow(enabled))
+	}
+
+	expectForeignKeyCheck := func() {
+		mock.ExpectQuery(regexp.QuoteMeta("PRAGMA foreign_key_check")).
+			WillReturnRows(sqlmock.NewRows([]string{"table", "rowid", "parent", "fkid"}))
+	}
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		db.Close()
+	})
+
+	Context("Migrate", func() {
+		When("some migrations have not been applied", func() {
+			It("should apply and record only the pending migrations, in order", func() {
+				expectForeignKeys(0)
+				expectSchemaMigrationsTable()
+				expectApplied("0001_create_dragons")
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE dragons ADD COLUMN name text")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `schema_migrations` (`id`,`applied_at`) VALUES (?,?)")).
+					WithArgs("0002_add_dragon_name", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectForeignKeyCheck()
+				mock.ExpectCommit()
+
+				err := Migrate(migrations)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("a migration fails", func() {
+			It("should rollback that migration and stop", func() {
+				expectForeignKeys(0)
+				expectSchemaMigrationsTable()
+				expectApplied()
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE dragons (id integer)")).
+					WillReturnError(errors.New("some db error"))
+				mock.ExpectRollback()
+
+				err := Migrate(migrations)
+				Expect(err).Should(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("foreign keys are enforced", func() {
+			It("should switch enforcement off while migrating and back on afterwards", func() {
+				expectForeignKeys(1)
+				mock.ExpectExec(regexp.QuoteMeta("PRAGMA foreign_keys = OFF")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectSchemaMigrationsTable()
+				expectApplied("0001_create_dragons", "0002_add_dragon_name")
+				mock.ExpectExec(regexp.QuoteMeta("PRAGMA foreign_keys = ON")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err := Migrate(migrations)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("a migration leaves a row referencing a missing parent", func() {
+			It("should rollback that migration and return ErrForeignKeyViolation", func() {
+				expectForeignKeys(0)
+				expectSchemaMigrationsTable()
+				expectApplied("0001_create_dragons")
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE dragons ADD COLUMN name text")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `schema_migrations` (`id`,`applied_at`) VALUES (?,?)")).
+					WithArgs("0002_add_dragon_name", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("PRAGMA foreign_key_check")).
+					WillReturnRows(sqlmock.NewRows([]string{"table", "rowid", "parent", "fkid"}).AddRow("posts", 1, "discussions", 0))
+				mock.ExpectRollback()
+
+				err := Migrate(migrations)
+				Expect(err).Should(Equal(ErrForeignKeyViolation))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("migrating a PostgreSQL database", func() {
+			It("should apply the migrations without SQLite foreign key pragmas", func() {
+				_, err := Connect(postgres.New(postgres.Config{Conn: db}), gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1 AND table_type = $2")).
+					WithArgs("schema_migrations", "BASE TABLE").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE "schema_migrations" ("id" varchar(255),"applied_at" timestamptz NOT NULL,PRIMARY KEY ("id"))`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "schema_migrations" ORDER BY id`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("0001_create_dragons"))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE dragons ADD COLUMN name text")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "schema_migrations" ("id","applied_at") VALUES ($1,$2)`)).
+					WithArgs("0002_add_dragon_name", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err = Migrate(migrations)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("the database has a migration the binary does not know about", func() {
+			It("should return ErrSchemaAhead without applying anything", func() {
+				expectForeignKeys(0)
+				expectSchemaMigrationsTable()
+				expectApplied("0001_create_dragons", "0002_add_dragon_name", "0003_from_the_future")
+
+				err := Migrate(migrations)
+				Expect(err).Should(Equal(ErrSchemaAhead))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("two migrations share an ID", func() {
+			It("should return ErrInvalidMigration without applying anything", func() {
+				expectForeignKeys(0)
+				expectSchemaMigrationsTable()
+				expectApplied()
+
+				err := Migrate([]Migration{migrations[0], migrations[0]})
+				Expect(err).Should(Equal(ErrInvalidMigration))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("migrating without a connection", func() {
+			It("should return an error", func() {
+				DBConnection = nil
+				err := Migrate(migrations)
+				Expect(err).Should(Equal(NoDatabaseConnectionErr))
+			})
+		})
+	})
+
+	Context("PendingMigrations", func() {
+		When("some migrations have been applied", func() {
+			It("should return the rest", func() {
+				expectHasSchemaMigrationsTable()
+				expectApplied("0001_create_dragons")
+
+				pending, err := PendingMigrations(migrations)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(pending).Should(HaveLen(1))
+				Expect(pending[0].ID).Should(Equal("0002_add_dragon_name"))
+			})
+		})
+	})
+
+	Context("Rollback", func() {
+		When("migrations have been applied", func() {
+			It("should revert and forget the most recent one", func() {
+				expectHasSchemaMigrationsTable()
+				expectApplied("0001_create_dragons", "0002_add_dragon_name")
+				expectForeignKeys(0)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE dragons DROP COLUMN name")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `schema_migrations` WHERE `schema_migrations`.`id` = ?")).
+					WithArgs("0002_add_dragon_name").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectForeignKeyCheck()
+				mock.ExpectCommit()
+
+				err := Rollback(migrations)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("the most recent migration has no Down step", func() {
+			It("should return ErrIrreversibleMigration", func() {
+				expectHasSchemaMigrationsTable()
+				expectApplied("0001_create_dragons")
+
+				err := Rollback([]Migration{{ID: "0001_create_dragons", Up: migrations[0].Up}})
+				Expect(err).Should(Equal(ErrIrreversibleMigration))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("the database has never been migrated", func() {
+			It("should return ErrNoMigrationApplied", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?")).
+					WithArgs("schema_migrations").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+				err := Rollback(migrations)
+				Expect(err).Should(Equal(ErrNoMigrationApplied))
+			})
+		})
+	})
+
+	Context("DryRun", func() {
+		When("some migrations have not been applied", func() {
+			It("should print the pending SQL without executing it", func() {
+				expectHasSchemaMigrationsTable()
+				expectApplied("0001_create_dragons")
+
+				out := &bytes.Buffer{}
+				err := DryRun(out, migrations)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(out.String()).Should(HavePrefix("ALTER TABLE dragons ADD COLUMN name text;\nINSERT INTO `schema_migrations` (`id`,`applied_at`) VALUES (\"0002_add_dragon_name\","))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("schema_migrations does not exist yet", func() {
+			It("should include its creation and every migration", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?")).
+					WithArgs("schema_migrations").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+				out := &bytes.Buffer{}
+				err := DryRun(out, migrations)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(out.String()).Should(HavePrefix("CREATE TABLE `schema_migrations`"))
+				Expect(out.String()).Should(ContainSubstring("CREATE TABLE dragons (id integer);\n"))
+				Expect(out.String()).Should(ContainSubstring("ALTER TABLE dragons ADD COLUMN name text;\n"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+})
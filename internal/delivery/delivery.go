@@ -0,0 +1,289 @@
+// Package delivery mails Notifications to their Users. Due Notifications are
+// composed into one email per User and queued in the outbox, which is then
+// sent through a mail.Mailer, retrying failed deliveries with backoff.
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	"gorm.io/gorm"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const excerptLength = 280
+
+// maxRetryDelay caps the backoff, so that a long outage of the mail server
+// does not put the next attempt days away.
+const maxRetryDelay = 12 * time.Hour
+
+var summaries = map[string]string{
+	models.NotificationTypePost:    "%s posted in %s",
+	models.NotificationTypeReply:   "%s replied to your post in %s",
+	models.NotificationTypeQuote:   "%s quoted your post in %s",
+	models.NotificationTypeMention: "%s mentioned you in %s",
+}
+
+type Config struct {
+	// PublicURL is where the forum is reached, to link to from the emails.
+	PublicURL string
+	// MaxAttempts is how often an email is tried before it is given up on.
+	MaxAttempts int
+	// RetryDelay is the wait after the first failed attempt, doubled after
+	// every further one.
+	RetryDelay time.Duration
+	// BatchSize is how many Notifications and emails a Tick handles at most.
+	BatchSize int
+}
+
+type Worker struct {
+	store  store.Store
+	mailer mail.Mailer
+	config Config
+}
+
+func New(s store.Store, mailer mail.Mailer, config Config) *Worker {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+
+	if config.BatchSize < 1 {
+		config.BatchSize = 100
+	}
+
+	return &Worker{store: s, mailer: mailer, config: config}
+}
+
+// Run calls Tick every interval until ctx is done.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		w.Tick(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick queues the emails for the Notifications due by now and sends the
+// emails due by then. Failures are logged and tried again on the next Tick.
+func (w *Worker) Tick(ctx context.Context, now time.Time) {
+	if err := w.Compose(ctx, now); err != nil {
+		log.Println("[DELIVERY]::COMPOSE_ERROR 💥")
+	}
+
+	if err := w.Deliver(ctx, now); err != nil {
+		log.Println("[DELIVERY]::DELIVER_ERROR 💥")
+	}
+}
+
+// Compose queues one email for each User with Notifications due by now. The
+// Notifications they already read, or have no verified primary Email to mail
+// to, are dropped instead.
+func (w *Worker) Compose(ctx context.Context, now time.Time) error {
+	due, err := w.store.Notifications().ListDue(ctx, now, w.config.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(due); {
+		end := start
+		for end < len(due) && due[end].UserID == due[start].UserID {
+			end++
+		}
+
+		if err := w.composeFor(ctx, now, due[start:end]); err != nil {
+			return err
+		}
+
+		start = end
+	}
+
+	return nil
+}
+
+// composeFor queues the email for the due Notifications of a single User, to
+// be sent from now on.
+func (w *Worker) composeFor(ctx context.Context, now time.Time, notifications []models.Notification) error {
+	userID := notifications[0].UserID
+
+	ids := make([]uint, len(notifications))
+	unread := []models.Notification{}
+	for i, notification := range notifications {
+		ids[i] = notification.ID
+		if notification.ReadAt == nil {
+			unread = append(unread, notification)
+		}
+	}
+
+	if len(unread) == 0 {
+		return w.store.Notifications().ClearEmails(ctx, ids)
+	}
+
+	user, err := w.store.Users().Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	address, err := w.store.Emails().GetPrimary(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return w.store.Notifications().ClearEmails(ctx, ids)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	email, err := w.render(user, address.Email, unread)
+	if err != nil {
+		return err
+	}
+
+	email.NextAttemptAt = &now
+	return w.store.Outbox().Queue(ctx, email, ids)
+}
+
+func (w *Worker) render(user *models.User, address string, notifications []models.Notification) (*models.OutboundEmail, error) {
+	data := digest{
+		Name:           user.DisplayName,
+		Items:          make([]item, len(notifications)),
+		PreferencesURL: w.config.PublicURL + "/api/v1/notifications/preferences",
+	}
+
+	if data.Name == "" {
+		data.Name = user.UserName
+	}
+
+	notificationType := notifications[0].Type
+	for i, notification := range notifications {
+		data.Items[i] = item{
+			Summary: summary(&notification),
+			Excerpt: excerpt(notification.Post.Content),
+			URL:     fmt.Sprintf("%s/api/v1/posts/%d", w.config.PublicURL, notification.PostID),
+		}
+
+		if notification.Type != notificationType {
+			notificationType = ""
+		}
+	}
+
+	data.Unsubscribe = w.config.PublicURL + "/api/v1/notifications/unsubscribe?token=" +
+		url.QueryEscape(models.UnsubscribeToken(user.ID, notificationType))
+
+	subject := data.Items[0].Summary
+	if len(notifications) > 1 {
+		subject = fmt.Sprintf("%d new notifications", len(notifications))
+	}
+
+	text := &bytes.Buffer{}
+	if err := textTemplate.Execute(text, data); err != nil {
+		return nil, err
+	}
+
+	html := &bytes.Buffer{}
+	if err := htmlTemplate.Execute(html, data); err != nil {
+		return nil, err
+	}
+
+	return &models.OutboundEmail{
+		UserID:      user.ID,
+		Recipient:   address,
+		Subject:     subject,
+		Text:        text.String(),
+		HTML:        html.String(),
+		Unsubscribe: data.Unsubscribe,
+	}, nil
+}
+
+func summary(notification *models.Notification) string {
+	actor := notification.Actor.DisplayName
+	if actor == "" {
+		actor = notification.Actor.UserName
+	}
+
+	return fmt.Sprintf(summaries[notification.Type], actor, notification.Discussion.Title)
+}
+
+// excerpt shortens content to excerptLength runes, on a word boundary where
+// there is one.
+func excerpt(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) <= excerptLength {
+		return content
+	}
+
+	cut := string(runes[:excerptLength])
+	if space := strings.LastIndex(cut, " "); space > 0 {
+		cut = cut[:space]
+	}
+
+	return cut + "…"
+}
+
+// Deliver sends the emails due by now. An email that fails is tried again
+// after a delay that doubles with every attempt, until MaxAttempts is reached.
+func (w *Worker) Deliver(ctx context.Context, now time.Time) error {
+	emails, err := w.store.Outbox().ListDue(ctx, now, w.config.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, email := range emails {
+		err := w.mailer.Send(ctx, mail.Message{
+			To:          email.Recipient,
+			Subject:     email.Subject,
+			Body:        email.Text,
+			HTML:        email.HTML,
+			Unsubscribe: email.Unsubscribe,
+		})
+
+		if err == nil {
+			if err := w.store.Outbox().MarkSent(ctx, email.ID); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		log.Println("[DELIVERY]::SEND_EMAIL_WARNING ⚠️")
+
+		var retryAt *time.Time
+		if attempts := email.Attempts + 1; attempts < w.config.MaxAttempts {
+			next := now.Add(w.retryDelay(attempts))
+			retryAt = &next
+		}
+
+		if err := w.store.Outbox().RecordFailure(ctx, email.ID, err.Error(), retryAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retryDelay is the wait after the given number of failed attempts.
+func (w *Worker) retryDelay(attempts int) time.Duration {
+	delay := w.config.RetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,143 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"github.com/golangbb/golangbb/v2/internal/mail"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store/storetest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+	"time"
+)
+
+// failingMailer fails every Message it is asked to send.
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, message mail.Message) error {
+	return errors.New("connection refused")
+}
+
+var _ = Describe("Worker", func() {
+	ctx := context.Background()
+	var s *storetest.Store
+	var outbox *mail.Outbox
+	var worker *Worker
+	var jon, sam *models.User
+	var wall *models.Discussion
+
+	config := Config{PublicURL: "https://forum.example.com", MaxAttempts: 3, RetryDelay: time.Minute, BatchSize: 100}
+
+	notify := func(notificationType string, userID, actorID uint) models.Notification {
+		notified, err := s.Notifications().Notify(ctx, []models.Notification{
+			{UserID: userID, Type: notificationType, ActorID: actorID, DiscussionID: wall.ID, PostID: wall.Posts[0].ID},
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(notified).Should(HaveLen(1))
+		return notified[0]
+	}
+
+	BeforeEach(func() {
+		var err error
+		s, err = storetest.New()
+		Expect(err).ShouldNot(HaveOccurred())
+		outbox = &mail.Outbox{}
+		worker = New(s, outbox, config)
+
+		jon = &models.User{UserName: "JonSnow", DisplayName: "Jon Snow", Password: "ghost"}
+		Expect(s.Users().Create(ctx, jon)).Should(Succeed())
+		sam = &models.User{UserName: "Samwell", Password: "books"}
+		Expect(s.Users().Create(ctx, sam)).Should(Succeed())
+
+		Expect(s.Emails().Create(ctx, &models.Email{Email: "jon@example.com", UserID: jon.ID, Verified: true, Primary: true})).Should(Succeed())
+
+		north := &models.Topic{Title: "The North", AuthorID: jon.ID}
+		Expect(s.Topics().Create(ctx, north)).Should(Succeed())
+		wall = &models.Discussion{Title: "The Wall", AuthorID: jon.ID, TopicID: north.ID, Posts: []models.Post{{Content: "Winter <is> coming"}}}
+		Expect(s.Discussions().Create(ctx, wall)).Should(Succeed())
+	})
+	AfterEach(func() {
+		Expect(s.Close()).Should(Succeed())
+	})
+
+	It("should mail a reply right away with a way to unsubscribe from replies", func() {
+		notify(models.NotificationTypeReply, jon.ID, sam.ID)
+		worker.Tick(ctx, time.Now())
+
+		Expect(outbox.Messages()).Should(HaveLen(1))
+		message := outbox.Messages()[0]
+		Expect(message.To).Should(Equal("jon@example.com"))
+		Expect(message.Subject).Should(Equal("Samwell replied to your post in The Wall"))
+		Expect(message.Body).Should(ContainSubstring("Hello Jon Snow,"))
+		Expect(message.Body).Should(ContainSubstring("Winter <is> coming"))
+		Expect(message.Body).Should(ContainSubstring("https://forum.example.com/api/v1/posts/"))
+		Expect(message.HTML).Should(ContainSubstring("Winter &lt;is&gt; coming"))
+		Expect(message.Unsubscribe).Should(HavePrefix("https://forum.example.com/api/v1/notifications/unsubscribe?token="))
+
+		userID, notificationType, err := models.ParseUnsubscribeToken(strings.SplitN(message.Unsubscribe, "token=", 2)[1])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(userID).Should(Equal(jon.ID))
+		Expect(notificationType).Should(Equal(models.NotificationTypeReply))
+
+		worker.Tick(ctx, time.Now())
+		Expect(outbox.Messages()).Should(HaveLen(1))
+	})
+
+	It("should collect new Posts in a daily digest", func() {
+		notify(models.NotificationTypePost, jon.ID, sam.ID)
+		notify(models.NotificationTypePost, jon.ID, sam.ID)
+		worker.Tick(ctx, time.Now())
+		Expect(outbox.Messages()).Should(BeEmpty())
+
+		worker.Tick(ctx, time.Now().Add(24*time.Hour))
+		Expect(outbox.Messages()).Should(HaveLen(1))
+		Expect(outbox.Messages()[0].Subject).Should(Equal("2 new notifications"))
+		Expect(strings.Count(outbox.Messages()[0].Body, "Samwell posted in The Wall")).Should(Equal(2))
+	})
+
+	It("should not mail what was already read or who has no verified address", func() {
+		read := notify(models.NotificationTypeReply, jon.ID, sam.ID)
+		Expect(s.Notifications().SetRead(ctx, read.ID, jon.ID, true)).Should(Succeed())
+		notify(models.NotificationTypeReply, sam.ID, jon.ID)
+
+		worker.Tick(ctx, time.Now())
+		Expect(outbox.Messages()).Should(BeEmpty())
+		Expect(s.OutboundEmails()).Should(BeEmpty())
+
+		due, err := s.Notifications().ListDue(ctx, time.Now(), 10)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(due).Should(BeEmpty())
+	})
+
+	It("should retry with a growing delay and then give up", func() {
+		worker = New(s, failingMailer{}, config)
+		notify(models.NotificationTypeReply, jon.ID, sam.ID)
+
+		now := time.Now()
+		worker.Tick(ctx, now)
+		email := s.OutboundEmails()[0]
+		Expect(email.Attempts).Should(Equal(1))
+		Expect(email.LastError).Should(Equal("connection refused"))
+		Expect(*email.NextAttemptAt).Should(BeTemporally("~", now.Add(time.Minute)))
+
+		now = now.Add(time.Minute)
+		worker.Tick(ctx, now)
+		email = s.OutboundEmails()[0]
+		Expect(*email.NextAttemptAt).Should(BeTemporally("~", now.Add(2*time.Minute)))
+
+		worker.Tick(ctx, now.Add(2*time.Minute))
+		email = s.OutboundEmails()[0]
+		Expect(email.Attempts).Should(Equal(3))
+		Expect(email.NextAttemptAt).Should(BeNil())
+		Expect(email.FailedAt).ShouldNot(BeNil())
+		Expect(email.SentAt).Should(BeNil())
+	})
+
+	It("should cap the delay between attempts", func() {
+		worker = New(s, failingMailer{}, Config{RetryDelay: time.Hour, MaxAttempts: 10})
+		Expect(worker.retryDelay(1)).Should(Equal(time.Hour))
+		Expect(worker.retryDelay(3)).Should(Equal(4 * time.Hour))
+		Expect(worker.retryDelay(9)).Should(Equal(maxRetryDelay))
+	})
+})
@@ -0,0 +1,54 @@
+package delivery
+
+import (
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+const textDigest = `Hello {{.Name}},
+{{range .Items}}
+{{.Summary}}:
+
+{{.Excerpt}}
+
+{{.URL}}
+{{end}}
+--
+{{if .Unsubscribe}}Stop these emails: {{.Unsubscribe}}
+{{end}}Choose which emails you get: {{.PreferencesURL}}
+`
+
+const htmlDigest = `<!DOCTYPE html>
+<html>
+<body>
+<p>Hello {{.Name}},</p>
+{{range .Items}}
+<div>
+<p><strong>{{.Summary}}</strong></p>
+<blockquote>{{.Excerpt}}</blockquote>
+<p><a href="{{.URL}}">Open the post</a></p>
+</div>
+{{end}}
+<hr>
+<p>{{if .Unsubscribe}}<a href="{{.Unsubscribe}}">Stop these emails</a> &middot; {{end}}<a href="{{.PreferencesURL}}">Choose which emails you get</a></p>
+</body>
+</html>
+`
+
+var (
+	textTemplate = texttemplate.Must(texttemplate.New("digest.txt").Parse(textDigest))
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Parse(htmlDigest))
+)
+
+type digest struct {
+	Name           string
+	Items          []item
+	Unsubscribe    string
+	PreferencesURL string
+}
+
+type item struct {
+	Summary string
+	Excerpt string
+	URL     string
+}
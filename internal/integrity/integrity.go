@@ -0,0 +1,170 @@
+package integrity
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+)
+
+type Strategy int
+
+const (
+	// Report leaves orphaned rows in place for an administrator to resolve.
+	Report Strategy = iota
+	// Delete removes orphaned rows, as ON DELETE CASCADE would have.
+	Delete
+	// SetNull clears the dangling reference, as ON DELETE SET NULL would have.
+	SetNull
+)
+
+type Relation struct {
+	Table      string
+	Column     string
+	References string
+	Repair     Strategy
+}
+
+// Relations lists every foreign key with parents before children, so that a
+// repair which deletes rows is followed by the repair of their own children.
+var Relations = []Relation{
+	{Table: "emails", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "sessions", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "email_verifications", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "password_resets", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "two_factors", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "recovery_codes", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "api_tokens", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "identities", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "failed_logins", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "groups", Column: "author_id", References: "users", Repair: Report},
+	{Table: "users_groups", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "users_groups", Column: "group_id", References: "groups", Repair: Delete},
+	{Table: "topics", Column: "author_id", References: "users", Repair: Report},
+	{Table: "topics", Column: "parent_id", References: "topics", Repair: SetNull},
+	{Table: "discussions", Column: "author_id", References: "users", Repair: Delete},
+	{Table: "discussions", Column: "topic_id", References: "topics", Repair: Delete},
+	{Table: "posts", Column: "author_id", References: "users", Repair: Delete},
+	{Table: "posts", Column: "discussion_id", References: "discussions", Repair: Delete},
+	{Table: "posts", Column: "reply_to_id", References: "posts", Repair: SetNull},
+	{Table: "post_revisions", Column: "post_id", References: "posts", Repair: Delete},
+	{Table: "post_revisions", Column: "author_id", References: "users", Repair: SetNull},
+	{Table: "reactions", Column: "post_id", References: "posts", Repair: Delete},
+	{Table: "reactions", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "mentions", Column: "post_id", References: "posts", Repair: Delete},
+	{Table: "mentions", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "conversation_participants", Column: "conversation_id", References: "conversations", Repair: Delete},
+	{Table: "conversation_participants", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "messages", Column: "conversation_id", References: "conversations", Repair: Delete},
+	{Table: "messages", Column: "author_id", References: "users", Repair: SetNull},
+	{Table: "user_blocks", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "user_blocks", Column: "blocked_user_id", References: "users", Repair: Delete},
+	{Table: "discussion_reads", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "discussion_reads", Column: "discussion_id", References: "discussions", Repair: Delete},
+	{Table: "topic_reads", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "topic_reads", Column: "topic_id", References: "topics", Repair: Delete},
+	{Table: "discussion_subscriptions", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "discussion_subscriptions", Column: "discussion_id", References: "discussions", Repair: Delete},
+	{Table: "topic_subscriptions", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "topic_subscriptions", Column: "topic_id", References: "topics", Repair: Delete},
+	{Table: "notifications", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "notifications", Column: "actor_id", References: "users", Repair: Delete},
+	{Table: "notifications", Column: "post_id", References: "posts", Repair: Delete},
+	{Table: "notifications", Column: "discussion_id", References: "discussions", Repair: Delete},
+	{Table: "notification_preferences", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "outbound_emails", Column: "user_id", References: "users", Repair: Delete},
+	{Table: "permissions", Column: "group_id", References: "groups", Repair: Delete},
+	{Table: "permissions", Column: "topic_id", References: "topics", Repair: Delete},
+}
+
+type Orphans struct {
+	Relation Relation
+	Count    int64
+	Repaired bool
+}
+
+// Check counts the rows of each relation that reference a missing parent.
+// Only relations with orphaned rows are returned.
+func Check() ([]Orphans, error) {
+	if database.DBConnection == nil {
+		return nil, database.NoDatabaseConnectionErr
+	}
+
+	return check(database.DBConnection, false)
+}
+
+// Repair resolves orphaned rows according to each relation's Strategy in a
+// single transaction. Rows with the Report strategy are returned unrepaired.
+func Repair() ([]Orphans, error) {
+	if database.DBConnection == nil {
+		return nil, database.NoDatabaseConnectionErr
+	}
+
+	var orphans []Orphans
+	err := database.DBConnection.Transaction(func(tx *gorm.DB) error {
+		var err error
+		orphans, err = check(tx, true)
+		return err
+	})
+
+	return orphans, err
+}
+
+func check(db *gorm.DB, repair bool) ([]Orphans, error) {
+	var orphans []Orphans
+	for _, relation := range Relations {
+		var count int64
+		if err := relation.count(db, &count); err != nil {
+			log.Printf("[INTEGRITY]::COUNT_ORPHANS_ERROR 💥 %s.%s\n", relation.Table, relation.Column)
+			return nil, err
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		found := Orphans{Relation: relation, Count: count}
+		if repair && relation.Repair != Report {
+			if err := relation.repair(db); err != nil {
+				log.Printf("[INTEGRITY]::REPAIR_ORPHANS_ERROR 💥 %s.%s\n", relation.Table, relation.Column)
+				return nil, err
+			}
+
+			found.Repaired = true
+		}
+
+		orphans = append(orphans, found)
+	}
+
+	return orphans, nil
+}
+
+func (r Relation) count(db *gorm.DB, count *int64) error {
+	table, column, parent := r.clauses()
+	return db.Raw(
+		"SELECT count(*) FROM ? WHERE ? IS NOT NULL AND ? NOT IN (SELECT id FROM ?)",
+		table, column, column, parent,
+	).Scan(count).Error
+}
+
+func (r Relation) repair(db *gorm.DB) error {
+	table, column, parent := r.clauses()
+	switch r.Repair {
+	case Delete:
+		return db.Exec(
+			"DELETE FROM ? WHERE ? IS NOT NULL AND ? NOT IN (SELECT id FROM ?)",
+			table, column, column, parent,
+		).Error
+	case SetNull:
+		return db.Exec(
+			"UPDATE ? SET ? = NULL WHERE ? IS NOT NULL AND ? NOT IN (SELECT id FROM ?)",
+			table, column, column, column, parent,
+		).Error
+	}
+
+	return nil
+}
+
+func (r Relation) clauses() (clause.Table, clause.Column, clause.Table) {
+	return clause.Table{Name: r.Table}, clause.Column{Name: r.Column}, clause.Table{Name: r.References}
+}
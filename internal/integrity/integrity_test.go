@@ -0,0 +1,165 @@
+package integrity
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("integrity", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	orphaned := func(relation Relation) string {
+		return fmt.Sprintf(
+			"`%s` WHERE `%s` IS NOT NULL AND `%s` NOT IN (SELECT id FROM `%s`)",
+			relation.Table, relation.Column, relation.Column, relation.References,
+		)
+	}
+
+	expectCount := func(relation Relation, count int) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM " + orphaned(relation))).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+	}
+
+	find := func(table, column string) Relation {
+		for _, relation := range Relations {
+			if relation.Table == table && relation.Column == column {
+				return relation
+			}
+		}
+
+		Fail("no relation " + table + "." + column)
+		return Relation{}
+	}
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{SkipDefaultTransaction: true})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		db.Close()
+	})
+
+	When("Relations is read", func() {
+		It("should list each parent before the relations of its own rows", func() {
+			for i, relation := range Relations {
+				for _, earlier := range Relations[:i] {
+					Expect(earlier.References).ShouldNot(Equal(relation.Table),
+						"%s.%s must come before %s.%s", relation.Table, relation.Column, earlier.Table, earlier.Column)
+				}
+			}
+		})
+	})
+
+	Context("Check", func() {
+		When("some rows reference a missing parent", func() {
+			It("should report only the relations with orphaned rows", func() {
+				for _, relation := range Relations {
+					count := 0
+					if relation.Table == "posts" && relation.Column == "discussion_id" {
+						count = 3
+					}
+
+					expectCount(relation, count)
+				}
+
+				orphans, err := Check()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(orphans).Should(Equal([]Orphans{{Relation: find("posts", "discussion_id"), Count: 3}}))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("counting returns an error", func() {
+			It("should return the error", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM")).
+					WillReturnError(errors.New("some db error"))
+
+				orphans, err := Check()
+				Expect(err).Should(HaveOccurred())
+				Expect(orphans).Should(BeNil())
+			})
+		})
+
+		When("checking without a connection", func() {
+			It("should return an error", func() {
+				database.DBConnection = nil
+				_, err := Check()
+				Expect(err).Should(Equal(database.NoDatabaseConnectionErr))
+			})
+		})
+	})
+
+	Context("Repair", func() {
+		When("rows reference a missing parent", func() {
+			It("should repair each relation by its strategy in one transaction", func() {
+				mock.ExpectBegin()
+				for _, relation := range Relations {
+					switch {
+					case relation.Table == "topics" && relation.Column == "author_id":
+						expectCount(relation, 1)
+					case relation.Table == "topics" && relation.Column == "parent_id":
+						expectCount(relation, 2)
+						mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `parent_id` = NULL WHERE `parent_id` IS NOT NULL AND `parent_id` NOT IN (SELECT id FROM `topics`)")).
+							WillReturnResult(sqlmock.NewResult(0, 2))
+					case relation.Table == "discussions" && relation.Column == "topic_id":
+						expectCount(relation, 4)
+						mock.ExpectExec(regexp.QuoteMeta("DELETE FROM " + orphaned(relation))).
+							WillReturnResult(sqlmock.NewResult(0, 4))
+					default:
+						expectCount(relation, 0)
+					}
+				}
+				mock.ExpectCommit()
+
+				orphans, err := Repair()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(orphans).Should(Equal([]Orphans{
+					{Relation: find("topics", "author_id"), Count: 1},
+					{Relation: find("topics", "parent_id"), Count: 2, Repaired: true},
+					{Relation: find("discussions", "topic_id"), Count: 4, Repaired: true},
+				}))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("a repair returns an error", func() {
+			It("should rollback every repair and return the error", func() {
+				mock.ExpectBegin()
+				relation := Relations[0]
+				expectCount(relation, 1)
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM " + orphaned(relation))).
+					WillReturnError(errors.New("some db error"))
+				mock.ExpectRollback()
+
+				orphans, err := Repair()
+				Expect(err).Should(HaveOccurred())
+				Expect(orphans).Should(BeNil())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+})
@@ -2,14 +2,79 @@ package internal
 
 import (
 	"github.com/golangbb/golangbb/v2/pkg/helpers"
+	"time"
 )
 
 var (
-	keyPORT             = "PORT"
-	defaultPORT         = "3000"
-	keyDATABASENAME     = "DATABASENAME"
-	defaultDATABASENAME = "golangbb.db"
+	keyPORT                      = "PORT"
+	defaultPORT                  = "3000"
+	keyDATABASENAME              = "DATABASENAME"
+	defaultDATABASENAME          = "golangbb.db"
+	keyDATABASEURL               = "DATABASE_URL"
+	keySESSIONLIFETIME           = "SESSIONLIFETIME"
+	defaultSESSIONLIFETIME       = 14 * 24 * time.Hour
+	keyCOOKIESECURE              = "COOKIESECURE"
+	defaultCOOKIESECURE          = true
+	keyMODERATORGROUP            = "MODERATORGROUP"
+	defaultMODERATORGROUP        = "moderators"
+	keySECRETKEY                 = "SECRETKEY"
+	keyPUBLICURL                 = "PUBLICURL"
+	keySMTPURL                   = "SMTPURL"
+	keyMAILFROM                  = "MAILFROM"
+	defaultMAILFROM              = "golangbb <noreply@localhost>"
+	keyMAILMAXATTEMPTS           = "MAILMAXATTEMPTS"
+	defaultMAILMAXATTEMPTS       = 8
+	keyMAILRETRYDELAY            = "MAILRETRYDELAY"
+	defaultMAILRETRYDELAY        = time.Minute
+	keyMAILPOLLINTERVAL          = "MAILPOLLINTERVAL"
+	defaultMAILPOLLINTERVAL      = 30 * time.Second
+	keyEMAILTOKENLIFETIME        = "EMAILTOKENLIFETIME"
+	defaultEMAILTOKENLIFETIME    = 48 * time.Hour
+	keyPASSWORDRESETLIFETIME     = "PASSWORDRESETLIFETIME"
+	defaultPASSWORDRESETLIFETIME = time.Hour
+	keyTOTPISSUER                = "TOTPISSUER"
+	defaultTOTPISSUER            = "golangbb"
+	keyAPITOKENLIFETIME          = "APITOKENLIFETIME"
+	defaultAPITOKENLIFETIME      = 90 * 24 * time.Hour
+	keyOIDCISSUER                = "OIDCISSUER"
+	keyOIDCCLIENTID              = "OIDCCLIENTID"
+	keyOIDCCLIENTSECRET          = "OIDCCLIENTSECRET"
+	keyOIDCREDIRECTURL           = "OIDCREDIRECTURL"
+	keyLOGINFREEATTEMPTS         = "LOGINFREEATTEMPTS"
+	defaultLOGINFREEATTEMPTS     = 5
+	keyLOGINIPFREEATTEMPTS       = "LOGINIPFREEATTEMPTS"
+	defaultLOGINIPFREEATTEMPTS   = 20
+	keyLOGINMAXDELAY             = "LOGINMAXDELAY"
+	defaultLOGINMAXDELAY         = 15 * time.Minute
+	keyFAILEDLOGINRETENTION      = "FAILEDLOGINRETENTION"
+	defaultFAILEDLOGINRETENTION  = 90 * 24 * time.Hour
+	keyREACTIONTYPES             = "REACTIONTYPES"
+	defaultREACTIONTYPES         = []string{"like", "love", "laugh", "wow", "sad", "angry"}
 
-	PORT         = helpers.GetEnv(keyPORT, defaultPORT)
-	DATABASENAME = helpers.GetEnv(keyDATABASENAME, defaultDATABASENAME)
+	PORT                  = helpers.GetEnv(keyPORT, defaultPORT)
+	DATABASENAME          = helpers.GetEnv(keyDATABASENAME, defaultDATABASENAME)
+	DATABASEURL           = helpers.GetEnv(keyDATABASEURL, "sqlite://"+DATABASENAME)
+	SESSIONLIFETIME       = helpers.GetEnvDuration(keySESSIONLIFETIME, defaultSESSIONLIFETIME)
+	COOKIESECURE          = helpers.GetEnvBool(keyCOOKIESECURE, defaultCOOKIESECURE)
+	MODERATORGROUP        = helpers.GetEnv(keyMODERATORGROUP, defaultMODERATORGROUP)
+	SECRETKEY             = helpers.GetEnv(keySECRETKEY, "")
+	PUBLICURL             = helpers.GetEnv(keyPUBLICURL, "http://localhost:"+PORT)
+	SMTPURL               = helpers.GetEnv(keySMTPURL, "")
+	MAILFROM              = helpers.GetEnv(keyMAILFROM, defaultMAILFROM)
+	MAILMAXATTEMPTS       = helpers.GetEnvInt(keyMAILMAXATTEMPTS, defaultMAILMAXATTEMPTS)
+	MAILRETRYDELAY        = helpers.GetEnvDuration(keyMAILRETRYDELAY, defaultMAILRETRYDELAY)
+	MAILPOLLINTERVAL      = helpers.GetEnvDuration(keyMAILPOLLINTERVAL, defaultMAILPOLLINTERVAL)
+	EMAILTOKENLIFETIME    = helpers.GetEnvDuration(keyEMAILTOKENLIFETIME, defaultEMAILTOKENLIFETIME)
+	PASSWORDRESETLIFETIME = helpers.GetEnvDuration(keyPASSWORDRESETLIFETIME, defaultPASSWORDRESETLIFETIME)
+	TOTPISSUER            = helpers.GetEnv(keyTOTPISSUER, defaultTOTPISSUER)
+	APITOKENLIFETIME      = helpers.GetEnvDuration(keyAPITOKENLIFETIME, defaultAPITOKENLIFETIME)
+	OIDCISSUER            = helpers.GetEnv(keyOIDCISSUER, "")
+	OIDCCLIENTID          = helpers.GetEnv(keyOIDCCLIENTID, "")
+	OIDCCLIENTSECRET      = helpers.GetEnv(keyOIDCCLIENTSECRET, "")
+	OIDCREDIRECTURL       = helpers.GetEnv(keyOIDCREDIRECTURL, PUBLICURL+"/api/auth/oidc/callback")
+	LOGINFREEATTEMPTS     = helpers.GetEnvInt(keyLOGINFREEATTEMPTS, defaultLOGINFREEATTEMPTS)
+	LOGINIPFREEATTEMPTS   = helpers.GetEnvInt(keyLOGINIPFREEATTEMPTS, defaultLOGINIPFREEATTEMPTS)
+	LOGINMAXDELAY         = helpers.GetEnvDuration(keyLOGINMAXDELAY, defaultLOGINMAXDELAY)
+	FAILEDLOGINRETENTION  = helpers.GetEnvDuration(keyFAILEDLOGINRETENTION, defaultFAILEDLOGINRETENTION)
+	REACTIONTYPES         = helpers.GetEnvSlice(keyREACTIONTYPES, defaultREACTIONTYPES)
 )
@@ -20,4 +20,137 @@ var _ = Describe("Constants", func() {
 			})
 		})
 	})
+	Context("DATABASEURL", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should fall back to a SQLite database named DATABASENAME", func() {
+				Expect(DATABASEURL).Should(Equal("sqlite://" + DATABASENAME))
+			})
+		})
+	})
+	Context("SESSIONLIFETIME", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(SESSIONLIFETIME).Should(BeIdenticalTo(defaultSESSIONLIFETIME))
+			})
+		})
+	})
+	Context("COOKIESECURE", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(COOKIESECURE).Should(BeIdenticalTo(defaultCOOKIESECURE))
+			})
+		})
+	})
+	Context("MODERATORGROUP", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(MODERATORGROUP).Should(BeIdenticalTo(defaultMODERATORGROUP))
+			})
+		})
+	})
+	Context("PUBLICURL", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should fall back to the local server on PORT", func() {
+				Expect(PUBLICURL).Should(Equal("http://localhost:" + PORT))
+			})
+		})
+	})
+	Context("MAILFROM", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(MAILFROM).Should(BeIdenticalTo(defaultMAILFROM))
+			})
+		})
+	})
+	Context("MAILMAXATTEMPTS", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(MAILMAXATTEMPTS).Should(BeIdenticalTo(defaultMAILMAXATTEMPTS))
+			})
+		})
+	})
+	Context("MAILRETRYDELAY", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(MAILRETRYDELAY).Should(BeIdenticalTo(defaultMAILRETRYDELAY))
+			})
+		})
+	})
+	Context("MAILPOLLINTERVAL", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(MAILPOLLINTERVAL).Should(BeIdenticalTo(defaultMAILPOLLINTERVAL))
+			})
+		})
+	})
+	Context("EMAILTOKENLIFETIME", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(EMAILTOKENLIFETIME).Should(BeIdenticalTo(defaultEMAILTOKENLIFETIME))
+			})
+		})
+	})
+	Context("PASSWORDRESETLIFETIME", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(PASSWORDRESETLIFETIME).Should(BeIdenticalTo(defaultPASSWORDRESETLIFETIME))
+			})
+		})
+	})
+	Context("TOTPISSUER", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(TOTPISSUER).Should(BeIdenticalTo(defaultTOTPISSUER))
+			})
+		})
+	})
+	Context("APITOKENLIFETIME", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(APITOKENLIFETIME).Should(BeIdenticalTo(defaultAPITOKENLIFETIME))
+			})
+		})
+	})
+	Context("OIDCREDIRECTURL", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should fall back to the callback under PUBLICURL", func() {
+				Expect(OIDCREDIRECTURL).Should(Equal(PUBLICURL + "/api/auth/oidc/callback"))
+			})
+		})
+	})
+	Context("LOGINFREEATTEMPTS", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(LOGINFREEATTEMPTS).Should(BeIdenticalTo(defaultLOGINFREEATTEMPTS))
+			})
+		})
+	})
+	Context("LOGINIPFREEATTEMPTS", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(LOGINIPFREEATTEMPTS).Should(BeIdenticalTo(defaultLOGINIPFREEATTEMPTS))
+			})
+		})
+	})
+	Context("LOGINMAXDELAY", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(LOGINMAXDELAY).Should(BeIdenticalTo(defaultLOGINMAXDELAY))
+			})
+		})
+	})
+	Context("FAILEDLOGINRETENTION", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(FAILEDLOGINRETENTION).Should(BeIdenticalTo(defaultFAILEDLOGINRETENTION))
+			})
+		})
+	})
+	Context("REACTIONTYPES", func() {
+		When("constant is accessed without environment variable being set", func() {
+			It("should return the default/fallback value", func() {
+				Expect(REACTIONTYPES).Should(Equal(defaultREACTIONTYPES))
+			})
+		})
+	})
 })
@@ -0,0 +1,111 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// The types below are a snapshot of the models when migrations were
+// introduced. They must not follow later changes to internal/models.
+
+type user0001 struct {
+	gorm.Model
+	UserName    string      `gorm:"uniqueIndex"`
+	DisplayName string      `gorm:"not null"`
+	Password    string      `gorm:"not null;size:255"`
+	Emails      []email0001 `gorm:"foreignKey:UserID"`
+}
+
+func (user0001) TableName() string { return "users" }
+
+type email0001 struct {
+	Email     string `gorm:"primaryKey;size:128"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	UserID    uint
+}
+
+func (email0001) TableName() string { return "emails" }
+
+type group0001 struct {
+	gorm.Model
+	Name     string   `gorm:"not null;size:64"`
+	Author   user0001 `gorm:"foreignKey:AuthorID"`
+	AuthorID uint
+}
+
+func (group0001) TableName() string { return "groups" }
+
+type userGroup0001 struct {
+	UserID  uint `gorm:"primaryKey"`
+	User    user0001
+	GroupID uint `gorm:"primaryKey"`
+	Group   group0001
+}
+
+func (userGroup0001) TableName() string { return "users_groups" }
+
+type session0001 struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UserAgent string    `gorm:"size:255"`
+	IPAddress string    `gorm:"size:64"`
+	User      user0001  `gorm:"foreignKey:UserID"`
+	UserID    uint      `gorm:"not null;index"`
+}
+
+func (session0001) TableName() string { return "sessions" }
+
+type topic0001 struct {
+	gorm.Model
+	Title    string `gorm:"uniqueIndex"`
+	ParentID *uint
+	Author   user0001 `gorm:"foreignKey:AuthorID"`
+	AuthorID uint
+}
+
+func (topic0001) TableName() string { return "topics" }
+
+type discussion0001 struct {
+	gorm.Model
+	Title    string     `gorm:"not null"`
+	Author   user0001   `gorm:"foreignKey:AuthorID"`
+	AuthorID uint       `gorm:"not null"`
+	Topic    topic0001  `gorm:"foreignKey:TopicID"`
+	TopicID  uint       `gorm:"not null"`
+	Posts    []post0001 `gorm:"foreignKey:DiscussionID"`
+}
+
+func (discussion0001) TableName() string { return "discussions" }
+
+type post0001 struct {
+	gorm.Model
+	Content      string   `gorm:"size:4096"`
+	Author       user0001 `gorm:"foreignKey:AuthorID"`
+	AuthorID     uint     `gorm:"not null"`
+	DiscussionID uint     `gorm:"not null"`
+}
+
+func (post0001) TableName() string { return "posts" }
+
+// initialSchema creates the tables previously created by AutoMigrate. It is
+// idempotent so databases created before migrations existed adopt it cleanly.
+var initialSchema = database.Migration{
+	ID: "0001_initial_schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&user0001{}, &email0001{}, &group0001{}, &userGroup0001{},
+			&session0001{}, &topic0001{}, &discussion0001{}, &post0001{},
+		)
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(
+			&post0001{}, &discussion0001{}, &topic0001{}, &session0001{},
+			&userGroup0001{}, &group0001{}, &email0001{}, &user0001{},
+		)
+	},
+}
@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the schema with every relation constrained and given explicit
+// ON DELETE behaviour. Content is removed with its author, memberships with
+// either side, while Topics and Groups must be reassigned before their author
+// or parent can go.
+
+type user0002 struct {
+	gorm.Model
+	UserName    string      `gorm:"uniqueIndex"`
+	DisplayName string      `gorm:"not null"`
+	Password    string      `gorm:"not null;size:255"`
+	Emails      []email0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+func (user0002) TableName() string { return "users" }
+
+type email0002 struct {
+	Email     string `gorm:"primaryKey;size:128"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	UserID    uint
+}
+
+func (email0002) TableName() string { return "emails" }
+
+type group0002 struct {
+	gorm.Model
+	Name     string   `gorm:"not null;size:64"`
+	Author   user0002 `gorm:"foreignKey:AuthorID;constraint:OnDelete:RESTRICT"`
+	AuthorID uint
+}
+
+func (group0002) TableName() string { return "groups" }
+
+type userGroup0002 struct {
+	UserID  uint      `gorm:"primaryKey"`
+	User    user0002  `gorm:"constraint:OnDelete:CASCADE"`
+	GroupID uint      `gorm:"primaryKey"`
+	Group   group0002 `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (userGroup0002) TableName() string { return "users_groups" }
+
+type session0002 struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UserAgent string    `gorm:"size:255"`
+	IPAddress string    `gorm:"size:64"`
+	User      user0002  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID    uint      `gorm:"not null;index"`
+}
+
+func (session0002) TableName() string { return "sessions" }
+
+type topic0002 struct {
+	gorm.Model
+	Title    string      `gorm:"uniqueIndex"`
+	ParentID *uint       `gorm:"index"`
+	Children []topic0002 `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT"`
+	Author   user0002    `gorm:"foreignKey:AuthorID;constraint:OnDelete:RESTRICT"`
+	AuthorID uint
+}
+
+func (topic0002) TableName() string { return "topics" }
+
+type discussion0002 struct {
+	gorm.Model
+	Title    string     `gorm:"not null"`
+	Author   user0002   `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE"`
+	AuthorID uint       `gorm:"not null;index"`
+	Topic    topic0002  `gorm:"foreignKey:TopicID;constraint:OnDelete:RESTRICT"`
+	TopicID  uint       `gorm:"not null;index"`
+	Posts    []post0002 `gorm:"foreignKey:DiscussionID;constraint:OnDelete:CASCADE"`
+}
+
+func (discussion0002) TableName() string { return "discussions" }
+
+type post0002 struct {
+	gorm.Model
+	Content      string   `gorm:"size:4096"`
+	Author       user0002 `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE"`
+	AuthorID     uint     `gorm:"not null;index"`
+	DiscussionID uint     `gorm:"not null;index"`
+}
+
+func (post0002) TableName() string { return "posts" }
+
+var foreignKeys = database.Migration{
+	ID: "0002_foreign_keys",
+	Up: func(tx *gorm.DB) error {
+		return replaceConstraints(tx, []constrainedTable{
+			{&user0002{}, []string{"fk_users_emails"}},
+			{&group0002{}, []string{"fk_groups_author"}},
+			{&userGroup0002{}, []string{"fk_users_groups_user", "fk_users_groups_group"}},
+			{&email0002{}, nil},
+			{&session0002{}, []string{"fk_sessions_user"}},
+			{&topic0002{}, []string{"fk_topics_author", "fk_topics_children"}},
+			{&discussion0002{}, []string{"fk_discussions_author", "fk_discussions_topic", "fk_discussions_posts"}},
+			{&post0002{}, []string{"fk_posts_author"}},
+		})
+	},
+	Down: func(tx *gorm.DB) error {
+		return replaceConstraints(tx, []constrainedTable{
+			{&user0001{}, []string{"fk_users_emails"}},
+			{&group0001{}, []string{"fk_groups_author"}},
+			{&userGroup0001{}, []string{"fk_users_groups_user", "fk_users_groups_group"}},
+			{&email0001{}, nil},
+			{&session0001{}, []string{"fk_sessions_user"}},
+			{&topic0001{}, []string{"fk_topics_author"}},
+			{&discussion0001{}, []string{"fk_discussions_author", "fk_discussions_topic", "fk_discussions_posts"}},
+			{&post0001{}, []string{"fk_posts_author"}},
+		})
+	},
+}
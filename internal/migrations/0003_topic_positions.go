@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+)
+
+// Snapshot of topics with a position that orders siblings in the tree.
+
+type topic0003 struct {
+	gorm.Model
+	Title    string      `gorm:"uniqueIndex"`
+	ParentID *uint       `gorm:"index"`
+	Children []topic0003 `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT"`
+	Position int         `gorm:"not null;default:0"`
+	Author   user0002    `gorm:"foreignKey:AuthorID;constraint:OnDelete:RESTRICT"`
+	AuthorID uint
+}
+
+func (topic0003) TableName() string { return "topics" }
+
+var topicPositions = database.Migration{
+	ID: "0003_topic_positions",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().AddColumn(&topic0003{}, "Position")
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "sqlite" {
+			return rebuildSQLiteTables(tx, []constrainedTable{{&topic0002{}, nil}})
+		}
+
+		return tx.Migrator().DropColumn(&topic0003{}, "Position")
+	},
+}
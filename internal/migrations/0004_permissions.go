@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the permission rules granted to Groups on Topics.
+
+type permission0004 struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	GroupID   *uint      `gorm:"index"`
+	Group     *group0002 `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE"`
+	TopicID   *uint      `gorm:"index"`
+	Topic     *topic0003 `gorm:"foreignKey:TopicID;constraint:OnDelete:CASCADE"`
+	Action    string     `gorm:"not null;size:32"`
+	Deny      bool       `gorm:"not null;default:false"`
+}
+
+func (permission0004) TableName() string { return "permissions" }
+
+var permissions = database.Migration{
+	ID: "0004_permissions",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&permission0004{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&permission0004{})
+	},
+}
@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of emails with the flags set once an address is verified, and of
+// the pending verifications.
+
+type email0005 struct {
+	Email     string `gorm:"primaryKey;size:128"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Verified  bool           `gorm:"not null;default:false"`
+	Primary   bool           `gorm:"column:is_primary;not null;default:false"`
+	UserID    uint
+}
+
+func (email0005) TableName() string { return "emails" }
+
+type emailVerification0005 struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	Email     string    `gorm:"not null;size:128;index"`
+	User      user0002  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID    uint      `gorm:"not null;index"`
+}
+
+func (emailVerification0005) TableName() string { return "email_verifications" }
+
+var emailVerification = database.Migration{
+	ID: "0005_email_verification",
+	Up: func(tx *gorm.DB) error {
+		for _, column := range []string{"Verified", "Primary"} {
+			if err := tx.Migrator().AddColumn(&email0005{}, column); err != nil {
+				return err
+			}
+		}
+
+		return tx.Migrator().CreateTable(&emailVerification0005{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&emailVerification0005{}); err != nil {
+			return err
+		}
+
+		if tx.Dialector.Name() == "sqlite" {
+			return rebuildSQLiteTables(tx, []constrainedTable{{&email0002{}, nil}})
+		}
+
+		for _, column := range []string{"Verified", "Primary"} {
+			if err := tx.Migrator().DropColumn(&email0005{}, column); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
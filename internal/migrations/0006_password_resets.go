@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the pending password resets.
+
+type passwordReset0006 struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	User      user0002  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID    uint      `gorm:"not null;index"`
+}
+
+func (passwordReset0006) TableName() string { return "password_resets" }
+
+var passwordResets = database.Migration{
+	ID: "0006_password_resets",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&passwordReset0006{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&passwordReset0006{})
+	},
+}
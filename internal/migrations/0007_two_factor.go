@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of groups that can require two-factor authentication, and of the
+// TOTP enrolments and recovery codes of Users.
+
+type group0007 struct {
+	gorm.Model
+	Name             string   `gorm:"not null;size:64"`
+	Author           user0002 `gorm:"foreignKey:AuthorID;constraint:OnDelete:RESTRICT"`
+	AuthorID         uint
+	RequireTwoFactor bool `gorm:"not null;default:false"`
+}
+
+func (group0007) TableName() string { return "groups" }
+
+type twoFactor0007 struct {
+	UserID    uint     `gorm:"primaryKey;autoIncrement:false"`
+	User      user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Secret    string   `gorm:"not null;size:64"`
+	Confirmed bool     `gorm:"not null;default:false"`
+	LastStep  int64    `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (twoFactor0007) TableName() string { return "two_factors" }
+
+type recoveryCode0007 struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Code      string   `gorm:"not null;size:64;index"`
+	User      user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID    uint     `gorm:"not null;index"`
+}
+
+func (recoveryCode0007) TableName() string { return "recovery_codes" }
+
+var twoFactor = database.Migration{
+	ID: "0007_two_factor",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&group0007{}, "RequireTwoFactor"); err != nil {
+			return err
+		}
+
+		return tx.Migrator().CreateTable(&twoFactor0007{}, &recoveryCode0007{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&recoveryCode0007{}, &twoFactor0007{}); err != nil {
+			return err
+		}
+
+		if tx.Dialector.Name() == "sqlite" {
+			return rebuildSQLiteTables(tx, []constrainedTable{{&group0002{}, nil}})
+		}
+
+		return tx.Migrator().DropColumn(&group0007{}, "RequireTwoFactor")
+	},
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the personal API tokens.
+
+type apiToken0008 struct {
+	ID         uint `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	Name       string    `gorm:"not null;size:64"`
+	Digest     string    `gorm:"not null;size:64;uniqueIndex"`
+	Scopes     string    `gorm:"not null;size:255"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	LastUsedAt *time.Time
+	User       user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID     uint     `gorm:"not null;index"`
+}
+
+func (apiToken0008) TableName() string { return "api_tokens" }
+
+var apiTokens = database.Migration{
+	ID: "0008_api_tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&apiToken0008{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&apiToken0008{})
+	},
+}
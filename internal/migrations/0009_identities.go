@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the links between OpenID Connect subjects and Users.
+
+type identity0009 struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Issuer    string   `gorm:"not null;size:255;uniqueIndex:idx_identities_issuer_subject"`
+	Subject   string   `gorm:"not null;size:255;uniqueIndex:idx_identities_issuer_subject"`
+	User      user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID    uint     `gorm:"not null;index"`
+}
+
+func (identity0009) TableName() string { return "identities" }
+
+var identities = database.Migration{
+	ID: "0009_identities",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&identity0009{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&identity0009{})
+	},
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the failed login counters and their audit trail.
+
+type loginThrottle0010 struct {
+	Key           string `gorm:"column:throttle_key;primaryKey;size:64"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time `gorm:"index"`
+}
+
+func (loginThrottle0010) TableName() string { return "login_throttles" }
+
+type failedLogin0010 struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"index"`
+	Identifier string    `gorm:"not null;size:128"`
+	Reason     string    `gorm:"not null;size:32"`
+	IPAddress  string    `gorm:"not null;size:45;index"`
+	User       *user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID     *uint     `gorm:"index"`
+}
+
+func (failedLogin0010) TableName() string { return "failed_logins" }
+
+var loginThrottling = database.Migration{
+	ID: "0010_login_throttling",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&loginThrottle0010{}, &failedLogin0010{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&failedLogin0010{}, &loginThrottle0010{})
+	},
+}
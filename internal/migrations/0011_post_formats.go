@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"html"
+	"strings"
+)
+
+// Snapshot of posts that keep the format they were written in next to the
+// HTML rendered from it. Posts written before formats existed stay plain.
+
+type post0011 struct {
+	gorm.Model
+	Content      string   `gorm:"size:4096"`
+	Format       string   `gorm:"size:16;not null;default:'plain'"`
+	ContentHTML  string   `gorm:"type:text"`
+	Author       user0002 `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE"`
+	AuthorID     uint     `gorm:"not null;index"`
+	DiscussionID uint     `gorm:"not null;index"`
+}
+
+func (post0011) TableName() string { return "posts" }
+
+// post0010 is post0002 with the constraint discussions declare on posts
+// spelled out, so that rebuilding posts on its own keeps it.
+type post0010 struct {
+	gorm.Model
+	Content      string         `gorm:"size:4096"`
+	Author       user0002       `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE"`
+	AuthorID     uint           `gorm:"not null;index"`
+	Discussion   discussion0002 `gorm:"foreignKey:DiscussionID;constraint:fk_discussions_posts,OnDelete:CASCADE"`
+	DiscussionID uint           `gorm:"not null;index"`
+}
+
+func (post0010) TableName() string { return "posts" }
+
+// renderPlain0011 is the plain text rendering as it was when the existing
+// posts were backfilled.
+func renderPlain0011(content string) string {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br />\n") + "</p>\n")
+		}
+	}
+
+	return b.String()
+}
+
+var postFormats = database.Migration{
+	ID: "0011_post_formats",
+	Up: func(tx *gorm.DB) error {
+		for _, column := range []string{"Format", "ContentHTML"} {
+			if err := tx.Migrator().AddColumn(&post0011{}, column); err != nil {
+				return err
+			}
+		}
+
+		var posts []post0011
+		return tx.Unscoped().Select("id", "content").FindInBatches(&posts, 100, func(_ *gorm.DB, _ int) error {
+			for _, post := range posts {
+				err := tx.Unscoped().Model(&post0011{}).
+					Where("id = ?", post.ID).
+					UpdateColumn("content_html", renderPlain0011(post.Content)).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "sqlite" {
+			return rebuildSQLiteTables(tx, []constrainedTable{{&post0010{}, nil}})
+		}
+
+		for _, column := range []string{"ContentHTML", "Format"} {
+			if err := tx.Migrator().DropColumn(&post0011{}, column); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
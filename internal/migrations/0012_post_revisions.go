@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the revisions kept for every version of a Post. Existing posts
+// get one revision holding their current content.
+
+type postRevision0012 struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Post      post0011  `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	PostID    uint      `gorm:"not null;index"`
+	Author    *user0002 `gorm:"foreignKey:AuthorID;constraint:OnDelete:SET NULL"`
+	AuthorID  *uint     `gorm:"index"`
+	Reason    string    `gorm:"size:256"`
+	Content   string    `gorm:"size:4096"`
+	Format    string    `gorm:"size:16;not null"`
+	Hidden    bool      `gorm:"not null;default:false"`
+}
+
+func (postRevision0012) TableName() string { return "post_revisions" }
+
+var postRevisions = database.Migration{
+	ID: "0012_post_revisions",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&postRevision0012{}); err != nil {
+			return err
+		}
+
+		var posts []post0011
+		return tx.Unscoped().Select("id", "updated_at", "content", "format", "author_id").FindInBatches(&posts, 100, func(_ *gorm.DB, _ int) error {
+			revisions := make([]postRevision0012, len(posts))
+			for i, post := range posts {
+				authorID := post.AuthorID
+				revisions[i] = postRevision0012{
+					CreatedAt: post.UpdatedAt,
+					PostID:    post.ID,
+					AuthorID:  &authorID,
+					Content:   post.Content,
+					Format:    post.Format,
+				}
+			}
+
+			return tx.Omit("Post", "Author").Create(&revisions).Error
+		}).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&postRevision0012{})
+	},
+}
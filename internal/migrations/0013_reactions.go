@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the reactions Users leave on Posts, at most one of each type per
+// User and Post.
+
+type reaction0013 struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Post      post0011 `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	PostID    uint     `gorm:"not null;uniqueIndex:idx_reactions_post_user_type"`
+	User      user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID    uint     `gorm:"not null;uniqueIndex:idx_reactions_post_user_type;index"`
+	Type      string   `gorm:"not null;size:32;uniqueIndex:idx_reactions_post_user_type"`
+}
+
+func (reaction0013) TableName() string { return "reactions" }
+
+var reactions = database.Migration{
+	ID: "0013_reactions",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&reaction0013{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&reaction0013{})
+	},
+}
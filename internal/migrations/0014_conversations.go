@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of private Conversations, who takes part in them, their Messages,
+// and the Users who blocked each other.
+
+type conversation0014 struct {
+	ID            uint `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Title         string `gorm:"not null;size:128"`
+	LastMessageID uint   `gorm:"not null;index"`
+}
+
+func (conversation0014) TableName() string { return "conversations" }
+
+type conversationParticipant0014 struct {
+	ConversationID    uint             `gorm:"primaryKey"`
+	Conversation      conversation0014 `gorm:"foreignKey:ConversationID;constraint:OnDelete:CASCADE"`
+	UserID            uint             `gorm:"primaryKey;index"`
+	User              user0002         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	CreatedAt         time.Time
+	LastReadMessageID uint `gorm:"not null"`
+	ClearedMessageID  uint `gorm:"not null"`
+	Muted             bool `gorm:"not null;default:false"`
+}
+
+func (conversationParticipant0014) TableName() string { return "conversation_participants" }
+
+type message0014 struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	Conversation   conversation0014 `gorm:"foreignKey:ConversationID;constraint:OnDelete:CASCADE"`
+	ConversationID uint             `gorm:"not null;index"`
+	Author         *user0002        `gorm:"foreignKey:AuthorID;constraint:OnDelete:SET NULL"`
+	AuthorID       *uint            `gorm:"index"`
+	Content        string           `gorm:"size:4096"`
+	Format         string           `gorm:"size:16;not null"`
+	ContentHTML    string           `gorm:"type:text"`
+}
+
+func (message0014) TableName() string { return "messages" }
+
+type userBlock0014 struct {
+	UserID        uint     `gorm:"primaryKey"`
+	User          user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	BlockedUserID uint     `gorm:"primaryKey;index"`
+	BlockedUser   user0002 `gorm:"foreignKey:BlockedUserID;constraint:OnDelete:CASCADE"`
+	CreatedAt     time.Time
+}
+
+func (userBlock0014) TableName() string { return "user_blocks" }
+
+var conversations = database.Migration{
+	ID: "0014_conversations",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&conversation0014{}, &conversationParticipant0014{}, &message0014{}, &userBlock0014{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&userBlock0014{}, &message0014{}, &conversationParticipant0014{}, &conversation0014{})
+	},
+}
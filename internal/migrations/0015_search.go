@@ -0,0 +1,91 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"log"
+)
+
+// On SQLite, Discussion titles and Post contents are indexed in FTS5 tables
+// whose rowids are the IDs of the indexed rows. Triggers keep them in step
+// on create, edit, soft delete, restore and purge; a later migration that
+// rebuilds discussions or posts drops those triggers and has to add them
+// back. Other databases are searched without an index.
+//
+// FTS5 is only compiled into the SQLite driver with the sqlite_fts5 build tag.
+// Without it the index is not created and SQLite is searched like the other
+// databases; later migrations check for posts_search before touching it.
+
+var searchUp = database.SQL(
+	"CREATE VIRTUAL TABLE discussions_search USING fts5(title, tokenize = 'porter unicode61')",
+	"CREATE VIRTUAL TABLE posts_search USING fts5(content, tokenize = 'porter unicode61')",
+	`CREATE TRIGGER discussions_search_insert AFTER INSERT ON discussions WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO discussions_search (rowid, title) VALUES (new.id, new.title);
+	END`,
+	`CREATE TRIGGER discussions_search_update AFTER UPDATE OF title, deleted_at ON discussions BEGIN
+		DELETE FROM discussions_search WHERE rowid = old.id;
+		INSERT INTO discussions_search (rowid, title) SELECT new.id, new.title WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER discussions_search_delete AFTER DELETE ON discussions BEGIN
+		DELETE FROM discussions_search WHERE rowid = old.id;
+	END`,
+	`CREATE TRIGGER posts_search_insert AFTER INSERT ON posts WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO posts_search (rowid, content) VALUES (new.id, new.content);
+	END`,
+	`CREATE TRIGGER posts_search_update AFTER UPDATE OF content, deleted_at ON posts BEGIN
+		DELETE FROM posts_search WHERE rowid = old.id;
+		INSERT INTO posts_search (rowid, content) SELECT new.id, new.content WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER posts_search_delete AFTER DELETE ON posts BEGIN
+		DELETE FROM posts_search WHERE rowid = old.id;
+	END`,
+	"INSERT INTO discussions_search (rowid, title) SELECT id, title FROM discussions WHERE deleted_at IS NULL",
+	"INSERT INTO posts_search (rowid, content) SELECT id, content FROM posts WHERE deleted_at IS NULL",
+)
+
+var searchDown = database.SQL(
+	"DROP TRIGGER posts_search_delete",
+	"DROP TRIGGER posts_search_update",
+	"DROP TRIGGER posts_search_insert",
+	"DROP TRIGGER discussions_search_delete",
+	"DROP TRIGGER discussions_search_update",
+	"DROP TRIGGER discussions_search_insert",
+	"DROP TABLE posts_search",
+	"DROP TABLE discussions_search",
+)
+
+var search = database.Migration{
+	ID: "0015_search",
+	Up: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() != "sqlite" {
+			return nil
+		}
+
+		enabled, err := fts5Enabled(tx)
+		if err != nil {
+			return err
+		}
+
+		if !enabled {
+			log.Println("[MIGRATIONS]::FTS5_UNAVAILABLE_SEARCH_NOT_INDEXED ⚠️")
+			return nil
+		}
+
+		return searchUp(tx)
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() != "sqlite" || !tx.Migrator().HasTable("posts_search") {
+			return nil
+		}
+
+		return searchDown(tx)
+	},
+}
+
+// fts5Enabled reports whether the SQLite library was compiled with FTS5.
+func fts5Enabled(tx *gorm.DB) (bool, error) {
+	var enabled bool
+	err := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error
+
+	return enabled, err
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of how far Users have read, per Discussion and per Topic.
+
+type discussionRead0016 struct {
+	UserID         uint           `gorm:"primaryKey"`
+	User           user0002       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	DiscussionID   uint           `gorm:"primaryKey;index"`
+	Discussion     discussion0002 `gorm:"foreignKey:DiscussionID;constraint:OnDelete:CASCADE"`
+	LastReadPostID uint           `gorm:"not null"`
+	UpdatedAt      time.Time
+}
+
+func (discussionRead0016) TableName() string { return "discussion_reads" }
+
+type topicRead0016 struct {
+	UserID         uint      `gorm:"primaryKey"`
+	User           user0002  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	TopicID        uint      `gorm:"primaryKey;index"`
+	Topic          topic0003 `gorm:"foreignKey:TopicID;constraint:OnDelete:CASCADE"`
+	LastReadPostID uint      `gorm:"not null"`
+	UpdatedAt      time.Time
+}
+
+func (topicRead0016) TableName() string { return "topic_reads" }
+
+var readState = database.Migration{
+	ID: "0016_read_state",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&discussionRead0016{}, &topicRead0016{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&topicRead0016{}, &discussionRead0016{})
+	},
+}
@@ -0,0 +1,171 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the Discussions and Topics Users subscribe to, the Notifications
+// they receive about new Posts and which types of them they want. Posts can
+// reply to another Post of their Discussion; the reference is cleared when the
+// Post replied to is purged.
+
+type post0017 struct {
+	gorm.Model
+	Content      string    `gorm:"size:4096"`
+	Format       string    `gorm:"size:16;not null;default:'plain'"`
+	ContentHTML  string    `gorm:"type:text"`
+	Author       user0002  `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE"`
+	AuthorID     uint      `gorm:"not null;index"`
+	DiscussionID uint      `gorm:"not null;index"`
+	ReplyTo      *post0017 `gorm:"foreignKey:ReplyToID;constraint:OnDelete:SET NULL"`
+	ReplyToID    *uint     `gorm:"index"`
+}
+
+func (post0017) TableName() string { return "posts" }
+
+// post0016 is post0011 with the constraint discussions declare on posts
+// spelled out, so that rebuilding posts on its own keeps it.
+type post0016 struct {
+	gorm.Model
+	Content      string         `gorm:"size:4096"`
+	Format       string         `gorm:"size:16;not null;default:'plain'"`
+	ContentHTML  string         `gorm:"type:text"`
+	Author       user0002       `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE"`
+	AuthorID     uint           `gorm:"not null;index"`
+	Discussion   discussion0002 `gorm:"foreignKey:DiscussionID;constraint:fk_discussions_posts,OnDelete:CASCADE"`
+	DiscussionID uint           `gorm:"not null;index"`
+}
+
+func (post0016) TableName() string { return "posts" }
+
+type discussionSubscription0017 struct {
+	UserID       uint           `gorm:"primaryKey"`
+	User         user0002       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	DiscussionID uint           `gorm:"primaryKey;index"`
+	Discussion   discussion0002 `gorm:"foreignKey:DiscussionID;constraint:OnDelete:CASCADE"`
+	CreatedAt    time.Time
+}
+
+func (discussionSubscription0017) TableName() string { return "discussion_subscriptions" }
+
+type topicSubscription0017 struct {
+	UserID    uint      `gorm:"primaryKey"`
+	User      user0002  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	TopicID   uint      `gorm:"primaryKey;index"`
+	Topic     topic0003 `gorm:"foreignKey:TopicID;constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time
+}
+
+func (topicSubscription0017) TableName() string { return "topic_subscriptions" }
+
+type notification0017 struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	User         user0002       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID       uint           `gorm:"not null;index"`
+	Type         string         `gorm:"size:16;not null"`
+	Actor        user0002       `gorm:"foreignKey:ActorID;constraint:OnDelete:CASCADE"`
+	ActorID      uint           `gorm:"not null;index"`
+	Discussion   discussion0002 `gorm:"foreignKey:DiscussionID;constraint:OnDelete:CASCADE"`
+	DiscussionID uint           `gorm:"not null;index"`
+	Post         post0011       `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	PostID       uint           `gorm:"not null;index"`
+	ReadAt       *time.Time
+}
+
+func (notification0017) TableName() string { return "notifications" }
+
+type notificationPreference0017 struct {
+	UserID uint     `gorm:"primaryKey"`
+	User   user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Type   string   `gorm:"primaryKey;size:16"`
+	InApp  bool     `gorm:"not null"`
+}
+
+func (notificationPreference0017) TableName() string { return "notification_preferences" }
+
+// SQLite cannot add a constraint to an existing column, but it can add a new
+// column that carries one, as long as it defaults to NULL.
+var replyToUpSQLite = database.SQL(
+	"ALTER TABLE `posts` ADD `reply_to_id` integer REFERENCES `posts`(`id`) ON DELETE SET NULL",
+)
+
+// Rebuilding posts drops the triggers 0015_search keeps posts_search in step
+// with, so they are created again as they were where it created them.
+var postsSearchTriggers0017 = database.SQL(
+	`CREATE TRIGGER posts_search_insert AFTER INSERT ON posts WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO posts_search (rowid, content) VALUES (new.id, new.content);
+	END`,
+	`CREATE TRIGGER posts_search_update AFTER UPDATE OF content, deleted_at ON posts BEGIN
+		DELETE FROM posts_search WHERE rowid = old.id;
+		INSERT INTO posts_search (rowid, content) SELECT new.id, new.content WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER posts_search_delete AFTER DELETE ON posts BEGIN
+		DELETE FROM posts_search WHERE rowid = old.id;
+	END`,
+)
+
+var notifications = database.Migration{
+	ID: "0017_notifications",
+	Up: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "sqlite" {
+			if err := replyToUpSQLite(tx); err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Migrator().AddColumn(&post0017{}, "ReplyToID"); err != nil {
+				return err
+			}
+
+			if err := tx.Migrator().CreateConstraint(&post0017{}, "ReplyTo"); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Migrator().CreateIndex(&post0017{}, "ReplyToID"); err != nil {
+			return err
+		}
+
+		return tx.Migrator().CreateTable(
+			&discussionSubscription0017{},
+			&topicSubscription0017{},
+			&notification0017{},
+			&notificationPreference0017{},
+		)
+	},
+	Down: func(tx *gorm.DB) error {
+		err := tx.Migrator().DropTable(
+			&discussionSubscription0017{},
+			&topicSubscription0017{},
+			&notification0017{},
+			&notificationPreference0017{},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().DropIndex(&post0017{}, "ReplyToID"); err != nil {
+			return err
+		}
+
+		if tx.Dialector.Name() == "sqlite" {
+			if err := rebuildSQLiteTables(tx, []constrainedTable{{&post0016{}, nil}}); err != nil {
+				return err
+			}
+
+			if !tx.Migrator().HasTable("posts_search") {
+				return nil
+			}
+
+			return postsSearchTriggers0017(tx)
+		}
+
+		if err := tx.Migrator().DropConstraint(&post0017{}, "fk_posts_reply_to"); err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropColumn(&post0017{}, "ReplyToID")
+	},
+}
@@ -0,0 +1,114 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of Notifications mailed to their Users, right away or in hourly or
+// daily digests, through an outbox that retries failed deliveries. Users who
+// already stored a preference get the delivery a missing one defaults to.
+
+type notification0018 struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	User         user0002       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID       uint           `gorm:"not null;index"`
+	Type         string         `gorm:"size:16;not null"`
+	Actor        user0002       `gorm:"foreignKey:ActorID;constraint:OnDelete:CASCADE"`
+	ActorID      uint           `gorm:"not null;index"`
+	Discussion   discussion0002 `gorm:"foreignKey:DiscussionID;constraint:OnDelete:CASCADE"`
+	DiscussionID uint           `gorm:"not null;index"`
+	Post         post0011       `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	PostID       uint           `gorm:"not null;index"`
+	ReadAt       *time.Time
+	EmailDueAt   *time.Time `gorm:"index"`
+}
+
+func (notification0018) TableName() string { return "notifications" }
+
+type notificationPreference0018 struct {
+	UserID uint     `gorm:"primaryKey"`
+	User   user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Type   string   `gorm:"primaryKey;size:16"`
+	InApp  bool     `gorm:"not null"`
+	Email  string   `gorm:"size:16;not null;default:'off'"`
+}
+
+func (notificationPreference0018) TableName() string { return "notification_preferences" }
+
+type outboundEmail0018 struct {
+	ID            uint `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	User          user0002   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	UserID        uint       `gorm:"not null;index"`
+	Recipient     string     `gorm:"size:128;not null"`
+	Subject       string     `gorm:"size:256;not null"`
+	Text          string     `gorm:"type:text"`
+	HTML          string     `gorm:"type:text"`
+	Unsubscribe   string     `gorm:"size:512"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt *time.Time `gorm:"index"`
+	LastError     string     `gorm:"size:512"`
+	SentAt        *time.Time
+	FailedAt      *time.Time
+}
+
+func (outboundEmail0018) TableName() string { return "outbound_emails" }
+
+var emailDelivery = database.Migration{
+	ID: "0018_email_delivery",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&notificationPreference0018{}, "Email"); err != nil {
+			return err
+		}
+
+		err := tx.Model(&notificationPreference0018{}).
+			Where("type = ?", "post").
+			UpdateColumn("email", "daily").Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&notificationPreference0018{}).
+			Where("type <> ?", "post").
+			UpdateColumn("email", "immediate").Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().AddColumn(&notification0018{}, "EmailDueAt"); err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().CreateIndex(&notification0018{}, "EmailDueAt"); err != nil {
+			return err
+		}
+
+		return tx.Migrator().CreateTable(&outboundEmail0018{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&outboundEmail0018{}); err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().DropIndex(&notification0018{}, "EmailDueAt"); err != nil {
+			return err
+		}
+
+		if tx.Dialector.Name() == "sqlite" {
+			return rebuildSQLiteTables(tx, []constrainedTable{
+				{&notification0017{}, nil},
+				{&notificationPreference0017{}, nil},
+			})
+		}
+
+		if err := tx.Migrator().DropColumn(&notification0018{}, "EmailDueAt"); err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropColumn(&notificationPreference0018{}, "Email")
+	},
+}
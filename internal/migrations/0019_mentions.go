@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Snapshot of the Users each Post mentions.
+
+type mention0019 struct {
+	PostID    uint     `gorm:"primaryKey"`
+	Post      post0011 `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE"`
+	UserID    uint     `gorm:"primaryKey;index"`
+	User      user0002 `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time
+}
+
+func (mention0019) TableName() string { return "mentions" }
+
+var mentions = database.Migration{
+	ID: "0019_mentions",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&mention0019{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&mention0019{})
+	},
+}
@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+type constrainedTable struct {
+	model       interface{}
+	constraints []string
+}
+
+// replaceConstraints brings the foreign keys of each table in line with its
+// model. Constraints are listed by name so that ones the model no longer
+// defines are dropped as well.
+func replaceConstraints(tx *gorm.DB, tables []constrainedTable) error {
+	if tx.Dialector.Name() == "sqlite" {
+		return rebuildSQLiteTables(tx, tables)
+	}
+
+	for _, table := range tables {
+		for _, name := range table.constraints {
+			if !tx.Migrator().HasConstraint(table.model, name) {
+				continue
+			}
+
+			if err := tx.Migrator().DropConstraint(table.model, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, table := range tables {
+		if err := tx.AutoMigrate(table.model); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuildSQLiteTables recreates each table from its model and copies every row
+// across, because SQLite cannot add or change a constraint in place. It relies
+// on the migration runner having switched foreign key enforcement off.
+func rebuildSQLiteTables(tx *gorm.DB, tables []constrainedTable) error {
+	statements := make([]*gorm.Statement, len(tables))
+	for i, table := range tables {
+		statements[i] = &gorm.Statement{DB: tx}
+		if err := statements[i].Parse(table.model); err != nil {
+			return err
+		}
+	}
+
+	for i, table := range tables {
+		schema := statements[i].Schema
+		rebuilt := schema.Table + "__rebuild"
+
+		for name := range schema.ParseIndexes() {
+			if err := tx.Exec("DROP INDEX IF EXISTS ?", clause.Table{Name: name}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Table(rebuilt).Migrator().CreateTable(table.model); err != nil {
+			return err
+		}
+
+		columns := make([]string, len(schema.DBNames))
+		for j, name := range schema.DBNames {
+			columns[j] = statements[i].Quote(name)
+		}
+
+		copyRows := fmt.Sprintf(
+			"INSERT INTO %s (%s) SELECT %s FROM %s",
+			statements[i].Quote(rebuilt), strings.Join(columns, ","), strings.Join(columns, ","), statements[i].Quote(schema.Table),
+		)
+
+		if err := tx.Exec(copyRows).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DROP TABLE ?", clause.Table{Name: schema.Table}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().RenameTable(rebuilt, schema.Table); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import "github.com/golangbb/golangbb/v2/internal/database"
+
+// All returns every migration in the order it must be applied. Append new
+// migrations to the end; never edit or reorder one that has been released.
+func All() []database.Migration {
+	return []database.Migration{
+		initialSchema,
+		foreignKeys,
+		topicPositions,
+		permissions,
+		emailVerification,
+		passwordResets,
+		twoFactor,
+		apiTokens,
+		identities,
+		loginThrottling,
+		postFormats,
+		postRevisions,
+		reactions,
+		conversations,
+		search,
+		readState,
+		notifications,
+		emailDelivery,
+		mentions,
+	}
+}
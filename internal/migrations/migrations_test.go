@@ -0,0 +1,472 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var tableDefinition = regexp.MustCompile(",(UNIQUE INDEX|INDEX|CONSTRAINT) ")
+
+var _ = Describe("migrations", func() {
+	When("All is executed", func() {
+		It("should return migrations with unique IDs in ascending order", func() {
+			migrations := All()
+			Expect(migrations).ShouldNot(BeEmpty())
+
+			for i := 1; i < len(migrations); i++ {
+				Expect(migrations[i].ID > migrations[i-1].ID).Should(BeTrue())
+			}
+		})
+	})
+
+	Context("0001_initial_schema", func() {
+		// gorm emits a table's indexes and foreign keys in map order, so only
+		// the part of each statement before them is compared.
+		expectSchema := func(dialector func(db *sql.DB) gorm.Dialector, statements []string) {
+			db, mock, err := sqlmock.New()
+			Expect(err).ShouldNot(HaveOccurred())
+			defer db.Close()
+
+			gormDB, err := database.Connect(dialector(db), gorm.Config{})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			mock.MatchExpectationsInOrder(false)
+			for _, statement := range statements {
+				migrationSql := regexp.QuoteMeta(tableDefinition.Split(statement, 2)[0])
+				mock.ExpectExec(migrationSql).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			err = initialSchema.Up(gormDB)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = mock.ExpectationsWereMet()
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+
+		When("applied to an empty SQLite database", func() {
+			statements := []string{
+				"CREATE TABLE `users` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`user_name` text,`display_name` text NOT NULL,`password` text NOT NULL,PRIMARY KEY (`id`))",
+				"CREATE UNIQUE INDEX `idx_users_user_name` ON `users`(`user_name`)",
+				"CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`)",
+				"CREATE TABLE `emails` (`email` text,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`user_id` integer,PRIMARY KEY (`email`),CONSTRAINT `fk_users_emails` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`))",
+				"CREATE INDEX `idx_emails_deleted_at` ON `emails`(`deleted_at`)",
+				"CREATE TABLE `groups` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text NOT NULL,`author_id` integer,PRIMARY KEY (`id`),CONSTRAINT `fk_groups_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`))",
+				"CREATE INDEX `idx_groups_deleted_at` ON `groups`(`deleted_at`)",
+				"CREATE TABLE `users_groups` (`user_id` integer,`group_id` integer,PRIMARY KEY (`user_id`,`group_id`),CONSTRAINT `fk_users_groups_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_users_groups_group` FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`))",
+				"CREATE TABLE `sessions` (`id` text,`created_at` datetime,`updated_at` datetime,`expires_at` datetime NOT NULL,`user_agent` text,`ip_address` text,`user_id` integer NOT NULL,PRIMARY KEY (`id`),CONSTRAINT `fk_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`))",
+				"CREATE INDEX `idx_sessions_user_id` ON `sessions`(`user_id`)",
+				"CREATE INDEX `idx_sessions_expires_at` ON `sessions`(`expires_at`)",
+				"CREATE TABLE `topics` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`title` text,`parent_id` integer,`author_id` integer,PRIMARY KEY (`id`),CONSTRAINT `fk_topics_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`))",
+				"CREATE UNIQUE INDEX `idx_topics_title` ON `topics`(`title`)",
+				"CREATE INDEX `idx_topics_deleted_at` ON `topics`(`deleted_at`)",
+				"CREATE TABLE `discussions` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`title` text NOT NULL,`author_id` integer NOT NULL,`topic_id` integer NOT NULL,PRIMARY KEY (`id`),CONSTRAINT `fk_discussions_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_discussions_topic` FOREIGN KEY (`topic_id`) REFERENCES `topics`(`id`))",
+				"CREATE INDEX `idx_discussions_deleted_at` ON `discussions`(`deleted_at`)",
+				"CREATE TABLE `posts` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`content` text,`author_id` integer NOT NULL,`discussion_id` integer NOT NULL,PRIMARY KEY (`id`),CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_discussions_posts` FOREIGN KEY (`discussion_id`) REFERENCES `discussions`(`id`))",
+				"CREATE INDEX `idx_posts_deleted_at` ON `posts`(`deleted_at`)",
+			}
+			It("should create the schema previously created by AutoMigrate", func() {
+				expectSchema(func(db *sql.DB) gorm.Dialector {
+					return sqlite.Dialector{DriverName: "sqlite", Conn: db}
+				}, statements)
+			})
+		})
+
+		When("applied to an empty PostgreSQL database", func() {
+			statements := []string{
+				`CREATE TABLE "users" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_name" text,"display_name" text NOT NULL,"password" varchar(255) NOT NULL,PRIMARY KEY ("id"))`,
+				`CREATE UNIQUE INDEX "idx_users_user_name" ON "users" ("user_name")`,
+				`CREATE INDEX "idx_users_deleted_at" ON "users" ("deleted_at")`,
+				`CREATE TABLE "emails" ("email" varchar(128),"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint,PRIMARY KEY ("email"),CONSTRAINT "fk_users_emails" FOREIGN KEY ("user_id") REFERENCES "users"("id"))`,
+				`CREATE INDEX "idx_emails_deleted_at" ON "emails" ("deleted_at")`,
+				`CREATE TABLE "groups" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" varchar(64) NOT NULL,"author_id" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_groups_author" FOREIGN KEY ("author_id") REFERENCES "users"("id"))`,
+				`CREATE INDEX "idx_groups_deleted_at" ON "groups" ("deleted_at")`,
+				`CREATE TABLE "users_groups" ("user_id" bigint,"group_id" bigint,PRIMARY KEY ("user_id","group_id"),CONSTRAINT "fk_users_groups_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),CONSTRAINT "fk_users_groups_group" FOREIGN KEY ("group_id") REFERENCES "groups"("id"))`,
+				`CREATE TABLE "sessions" ("id" varchar(64),"created_at" timestamptz,"updated_at" timestamptz,"expires_at" timestamptz NOT NULL,"user_agent" varchar(255),"ip_address" varchar(64),"user_id" bigint NOT NULL,PRIMARY KEY ("id"),CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"))`,
+				`CREATE INDEX "idx_sessions_user_id" ON "sessions" ("user_id")`,
+				`CREATE INDEX "idx_sessions_expires_at" ON "sessions" ("expires_at")`,
+				`CREATE TABLE "topics" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"title" text,"parent_id" bigint,"author_id" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_topics_author" FOREIGN KEY ("author_id") REFERENCES "users"("id"))`,
+				`CREATE UNIQUE INDEX "idx_topics_title" ON "topics" ("title")`,
+				`CREATE INDEX "idx_topics_deleted_at" ON "topics" ("deleted_at")`,
+				`CREATE TABLE "discussions" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"title" text NOT NULL,"author_id" bigint NOT NULL,"topic_id" bigint NOT NULL,PRIMARY KEY ("id"),CONSTRAINT "fk_discussions_author" FOREIGN KEY ("author_id") REFERENCES "users"("id"),CONSTRAINT "fk_discussions_topic" FOREIGN KEY ("topic_id") REFERENCES "topics"("id"))`,
+				`CREATE INDEX "idx_discussions_deleted_at" ON "discussions" ("deleted_at")`,
+				`CREATE TABLE "posts" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"content" varchar(4096),"author_id" bigint NOT NULL,"discussion_id" bigint NOT NULL,PRIMARY KEY ("id"),CONSTRAINT "fk_posts_author" FOREIGN KEY ("author_id") REFERENCES "users"("id"),CONSTRAINT "fk_discussions_posts" FOREIGN KEY ("discussion_id") REFERENCES "discussions"("id"))`,
+				`CREATE INDEX "idx_posts_deleted_at" ON "posts" ("deleted_at")`,
+			}
+			It("should create the same schema with PostgreSQL types", func() {
+				expectSchema(func(db *sql.DB) gorm.Dialector {
+					return postgres.New(postgres.Config{Conn: db})
+				}, statements)
+			})
+		})
+
+		When("applied to an empty MySQL database", func() {
+			statements := []string{
+				"CREATE TABLE `users` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`user_name` varchar(191),`display_name` varchar(191) NOT NULL,`password` varchar(255) NOT NULL,PRIMARY KEY (`id`),UNIQUE INDEX idx_users_user_name (`user_name`),INDEX idx_users_deleted_at (`deleted_at`))",
+				"CREATE TABLE `emails` (`email` varchar(128),`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`user_id` bigint unsigned,PRIMARY KEY (`email`),INDEX idx_emails_deleted_at (`deleted_at`),CONSTRAINT `fk_users_emails` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`))",
+				"CREATE TABLE `groups` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`name` varchar(64) NOT NULL,`author_id` bigint unsigned,PRIMARY KEY (`id`),INDEX idx_groups_deleted_at (`deleted_at`),CONSTRAINT `fk_groups_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`))",
+				"CREATE TABLE `users_groups` (`user_id` bigint unsigned,`group_id` bigint unsigned,PRIMARY KEY (`user_id`,`group_id`),CONSTRAINT `fk_users_groups_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_users_groups_group` FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`))",
+				"CREATE TABLE `sessions` (`id` varchar(64),`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`expires_at` datetime(3) NOT NULL,`user_agent` varchar(255),`ip_address` varchar(64),`user_id` bigint unsigned NOT NULL,PRIMARY KEY (`id`),INDEX idx_sessions_expires_at (`expires_at`),INDEX idx_sessions_user_id (`user_id`),CONSTRAINT `fk_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`))",
+				"CREATE TABLE `topics` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`title` varchar(191),`parent_id` bigint unsigned,`author_id` bigint unsigned,PRIMARY KEY (`id`),INDEX idx_topics_deleted_at (`deleted_at`),UNIQUE INDEX idx_topics_title (`title`),CONSTRAINT `fk_topics_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`))",
+				"CREATE TABLE `discussions` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`title` varchar(191) NOT NULL,`author_id` bigint unsigned NOT NULL,`topic_id` bigint unsigned NOT NULL,PRIMARY KEY (`id`),INDEX idx_discussions_deleted_at (`deleted_at`),CONSTRAINT `fk_discussions_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_discussions_topic` FOREIGN KEY (`topic_id`) REFERENCES `topics`(`id`))",
+				"CREATE TABLE `posts` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`content` varchar(4096),`author_id` bigint unsigned NOT NULL,`discussion_id` bigint unsigned NOT NULL,PRIMARY KEY (`id`),INDEX idx_posts_deleted_at (`deleted_at`),CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_discussions_posts` FOREIGN KEY (`discussion_id`) REFERENCES `discussions`(`id`))",
+			}
+			It("should create the same schema with MySQL types and indexable string sizes", func() {
+				expectSchema(func(db *sql.DB) gorm.Dialector {
+					return mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true, DefaultStringSize: 191})
+				}, statements)
+			})
+		})
+	})
+
+	Context("0002_foreign_keys", func() {
+		When("applied to a SQLite database", func() {
+			It("should rebuild each table with its constraints and keep its rows", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(sqlite.Dialector{
+					DriverName: "sqlite",
+					Conn:       db,
+				}, gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				columns := "`id`,`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`"
+				mock.MatchExpectationsInOrder(false)
+				for _, index := range []string{"idx_posts_deleted_at", "idx_posts_author_id", "idx_posts_discussion_id"} {
+					mock.ExpectExec(regexp.QuoteMeta("DROP INDEX IF EXISTS `" + index + "`")).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `posts__rebuild` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`content` text,`author_id` integer NOT NULL,`discussion_id` integer NOT NULL,PRIMARY KEY (`id`),CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`) ON DELETE CASCADE)")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				for _, index := range []string{"idx_posts_deleted_at", "idx_posts_author_id", "idx_posts_discussion_id"} {
+					mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX `" + index + "` ON `posts__rebuild`")).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts__rebuild` (" + columns + ") SELECT " + columns + " FROM `posts`")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DROP TABLE `posts`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `posts__rebuild` RENAME TO `posts`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err = replaceConstraints(gormDB, []constrainedTable{{&post0002{}, []string{"fk_posts_author"}}})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("0003_topic_positions", func() {
+		When("applied to a SQLite database", func() {
+			It("should add a position column that defaults to the first place", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(sqlite.Dialector{
+					DriverName: "sqlite",
+					Conn:       db,
+				}, gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `topics` ADD `position` integer NOT NULL DEFAULT 0")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err = topicPositions.Up(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("reverted on a PostgreSQL database", func() {
+			It("should drop the position column", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(postgres.New(postgres.Config{Conn: db}), gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "topics" DROP COLUMN "position"`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err = topicPositions.Down(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("0015_search", func() {
+		When("applied to a SQLite database", func() {
+			It("should index the existing Discussions and Posts in FTS5 tables", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(sqlite.Dialector{
+					DriverName: "sqlite",
+					Conn:       db,
+				}, gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT sqlite_compileoption_used('ENABLE_FTS5')")).
+					WillReturnRows(sqlmock.NewRows([]string{"enabled"}).AddRow(1))
+				mock.ExpectExec(regexp.QuoteMeta("CREATE VIRTUAL TABLE discussions_search USING fts5")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("CREATE VIRTUAL TABLE posts_search USING fts5")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				for _, trigger := range []string{"discussions_search_insert", "discussions_search_update", "discussions_search_delete", "posts_search_insert", "posts_search_update", "posts_search_delete"} {
+					mock.ExpectExec(regexp.QuoteMeta("CREATE TRIGGER " + trigger + " ")).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO discussions_search (rowid, title) SELECT id, title FROM discussions WHERE deleted_at IS NULL")).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO posts_search (rowid, content) SELECT id, content FROM posts WHERE deleted_at IS NULL")).
+					WillReturnResult(sqlmock.NewResult(0, 7))
+
+				err = search.Up(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("applied to a SQLite database without FTS5", func() {
+			It("should leave the schema alone", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(sqlite.Dialector{
+					DriverName: "sqlite",
+					Conn:       db,
+				}, gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT sqlite_compileoption_used('ENABLE_FTS5')")).
+					WillReturnRows(sqlmock.NewRows([]string{"enabled"}).AddRow(0))
+
+				err = search.Up(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("applied to a SQLite database file", func() {
+			It("should index Posts only where FTS5 is compiled in and roll back", func() {
+				path, err := ioutil.TempDir("", "migrations")
+				Expect(err).ShouldNot(HaveOccurred())
+				defer os.RemoveAll(path)
+
+				dialector, err := database.Dialector("sqlite://" + filepath.Join(path, "golangbb.db"))
+				Expect(err).ShouldNot(HaveOccurred())
+				gormDB, err := database.Connect(dialector, gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+				defer func() { database.DBConnection = nil }()
+
+				Expect(database.Migrate(All())).Should(Succeed())
+
+				enabled, err := fts5Enabled(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(gormDB.Migrator().HasTable("posts_search")).Should(Equal(enabled))
+
+				ctx := context.Background()
+				user := models.User{UserName: "jon", Password: "ghost"}
+				Expect(models.CreateUserContext(ctx, gormDB, &user)).Should(Succeed())
+				topic := models.Topic{Title: "The North", AuthorID: user.ID}
+				Expect(models.CreateTopicContext(ctx, gormDB, &topic)).Should(Succeed())
+				discussion := models.Discussion{Title: "The Wall", AuthorID: user.ID, TopicID: topic.ID, Posts: []models.Post{{Content: "Winter is coming"}}}
+				Expect(models.CreateDiscussionContext(ctx, gormDB, &discussion)).Should(Succeed())
+
+				if enabled {
+					var ids []uint
+					err = gormDB.Raw("SELECT rowid FROM posts_search WHERE posts_search MATCH 'winter'").Scan(&ids).Error
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(ids).Should(Equal([]uint{discussion.Posts[0].ID}))
+				}
+
+				for range All() {
+					Expect(database.Rollback(All())).Should(Succeed())
+				}
+				Expect(gormDB.Migrator().HasTable("posts_search")).Should(BeFalse())
+				Expect(gormDB.Migrator().HasTable("posts")).Should(BeFalse())
+			})
+		})
+
+		When("applied to a PostgreSQL database", func() {
+			It("should leave the schema alone", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(postgres.New(postgres.Config{Conn: db}), gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				Expect(search.Up(gormDB)).Should(Succeed())
+				Expect(search.Down(gormDB)).Should(Succeed())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+	Context("0017_notifications", func() {
+		When("applied to a SQLite database", func() {
+			It("should add a reply column that is cleared with the Post it references", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(sqlite.Dialector{
+					DriverName: "sqlite",
+					Conn:       db,
+				}, gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `posts` ADD `reply_to_id` integer REFERENCES `posts`(`id`) ON DELETE SET NULL")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX `idx_posts_reply_to_id` ON `posts`(`reply_to_id`)")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				for _, table := range []string{"discussion_subscriptions", "topic_subscriptions", "notifications", "notification_preferences"} {
+					mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `" + table + "`")).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+
+				// The indexes of each table are created in map order.
+				mock.MatchExpectationsInOrder(false)
+				for _, index := range []string{"idx_discussion_subscriptions_discussion_id", "idx_topic_subscriptions_topic_id", "idx_notifications_user_id", "idx_notifications_actor_id", "idx_notifications_discussion_id", "idx_notifications_post_id"} {
+					mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX `" + index + "`")).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+
+				err = notifications.Up(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("reverted on a PostgreSQL database", func() {
+			It("should drop the new tables and the reply column", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(postgres.New(postgres.Config{Conn: db}), gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				for _, table := range []string{"notification_preferences", "notifications", "topic_subscriptions", "discussion_subscriptions"} {
+					mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS "` + table + `" CASCADE`)).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectExec(regexp.QuoteMeta(`DROP INDEX "idx_posts_reply_to_id"`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "posts" DROP CONSTRAINT "fk_posts_reply_to"`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "posts" DROP COLUMN "reply_to_id"`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err = notifications.Down(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("0018_email_delivery", func() {
+		When("applied to a SQLite database", func() {
+			It("should give stored preferences the default delivery and create the outbox", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(sqlite.Dialector{
+					DriverName: "sqlite",
+					Conn:       db,
+				}, gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `notification_preferences` ADD `email` text NOT NULL DEFAULT \"off\"")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `notification_preferences` SET `email`=? WHERE type = ?")).
+					WithArgs("daily", "post").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `notification_preferences` SET `email`=? WHERE type <> ?")).
+					WithArgs("immediate", "post").
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `notifications` ADD `email_due_at` datetime")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX `idx_notifications_email_due_at` ON `notifications`(`email_due_at`)")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `outbound_emails`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				// The indexes of the table are created in map order.
+				mock.MatchExpectationsInOrder(false)
+				for _, index := range []string{"idx_outbound_emails_user_id", "idx_outbound_emails_next_attempt_at"} {
+					mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX `" + index + "`")).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+
+				err = emailDelivery.Up(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("reverted on a PostgreSQL database", func() {
+			It("should drop the outbox and the new columns", func() {
+				db, mock, err := sqlmock.New()
+				Expect(err).ShouldNot(HaveOccurred())
+				defer db.Close()
+
+				gormDB, err := database.Connect(postgres.New(postgres.Config{Conn: db}), gorm.Config{})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS "outbound_emails" CASCADE`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(`DROP INDEX "idx_notifications_email_due_at"`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "notifications" DROP COLUMN "email_due_at"`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "notification_preferences" DROP COLUMN "email"`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err = emailDelivery.Down(gormDB)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+})
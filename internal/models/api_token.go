@@ -0,0 +1,209 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix marks the tokens golangbb issues, so that secret scanners can
+// recognise one that was committed by mistake.
+const APITokenPrefix = "gbb_"
+
+// apiTokenTouchInterval limits how often LastUsedAt is written for a token in
+// constant use.
+const apiTokenTouchInterval = time.Minute
+
+// APIToken lets scripts act as a User without their password. Scopes is a
+// space separated list of permission actions which caps what the token may do
+// on top of the permissions of the User. Only the digest of the token is
+// stored.
+type APIToken struct {
+	ID         uint `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	Name       string    `gorm:"not null;size:64"`
+	Digest     string    `gorm:"not null;size:64;uniqueIndex"`
+	Scopes     string    `gorm:"not null;size:255"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	LastUsedAt *time.Time
+	User       User `gorm:"foreignKey:UserID"`
+	UserID     uint `gorm:"not null;index"`
+}
+
+// ScopeList returns the actions the token is limited to.
+func (t *APIToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// CreateAPIToken stores the token and returns its secret, which cannot be
+// recovered afterwards.
+func CreateAPIToken(token *APIToken) (string, error) {
+	return CreateAPITokenContext(context.Background(), database.DBConnection, token)
+}
+
+func CreateAPITokenContext(ctx context.Context, db *gorm.DB, token *APIToken) (string, error) {
+	db = db.WithContext(ctx)
+
+	if err := validateAPIToken(token); err != nil {
+		return "", err
+	}
+
+	secret, err := tokens.Generate(tokens.DefaultLength)
+	if err != nil {
+		log.Println("[CREATE_API_TOKEN]::GENERATE_TOKEN_ERROR 💥")
+		return "", err
+	}
+	secret = APITokenPrefix + secret
+	token.Digest = tokens.Hash(secret)
+
+	if err := db.Omit("User").Create(token).Error; err != nil {
+		log.Println("[CREATE_API_TOKEN]::DB_INSERT_API_TOKEN_ERROR 💥")
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func validateAPIToken(token *APIToken) error {
+	if token.Name == "" {
+		return ErrEmptyName
+	}
+
+	if token.UserID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if token.ExpiresAt.IsZero() {
+		return ErrEmptyExpiresAt
+	}
+
+	scopes := token.ScopeList()
+	if len(scopes) == 0 {
+		return ErrEmptyScopes
+	}
+
+	for _, scope := range scopes {
+		if !validAction(scope) {
+			return ErrUnknownAction
+		}
+	}
+
+	token.Scopes = strings.Join(scopes, " ")
+	return nil
+}
+
+// AuthenticateAPIToken returns the unexpired token with the secret, together
+// with its User, and records that it was used.
+func AuthenticateAPIToken(secret string) (*APIToken, error) {
+	return AuthenticateAPITokenContext(context.Background(), database.DBConnection, secret)
+}
+
+func AuthenticateAPITokenContext(ctx context.Context, db *gorm.DB, secret string) (*APIToken, error) {
+	db = db.WithContext(ctx)
+
+	if !strings.HasPrefix(secret, APITokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	now := time.Now()
+	token := &APIToken{}
+	err := db.
+		Preload("User").
+		Where("digest = ? AND expires_at > ?", tokens.Hash(secret), now).
+		Take(token).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	if err != nil {
+		log.Println("[AUTHENTICATE_API_TOKEN]::DB_SELECT_API_TOKEN_ERROR 💥")
+		return nil, err
+	}
+
+	// The User is soft deleted when preloading leaves it empty.
+	if token.User.ID == 0 {
+		return nil, ErrInvalidAPIToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+		if err := db.Model(&APIToken{}).Where("id = ?", token.ID).UpdateColumn("last_used_at", now).Error; err != nil {
+			log.Println("[AUTHENTICATE_API_TOKEN]::DB_UPDATE_LAST_USED_AT_WARNING ⚠️")
+		} else {
+			token.LastUsedAt = &now
+		}
+	}
+
+	return token, nil
+}
+
+// ListAPITokens returns the tokens of a User, newest first.
+func ListAPITokens(userID uint) ([]APIToken, error) {
+	return ListAPITokensContext(context.Background(), database.DBConnection, userID)
+}
+
+func ListAPITokensContext(ctx context.Context, db *gorm.DB, userID uint) ([]APIToken, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	var apiTokens []APIToken
+	if err := db.Where("user_id = ?", userID).Order("id DESC").Find(&apiTokens).Error; err != nil {
+		log.Println("[LIST_API_TOKENS]::DB_SELECT_API_TOKENS_ERROR 💥")
+		return nil, err
+	}
+
+	return apiTokens, nil
+}
+
+// RevokeAPIToken deletes a token of the User. Tokens of other Users are
+// reported as not found.
+func RevokeAPIToken(userID, id uint) error {
+	return RevokeAPITokenContext(context.Background(), database.DBConnection, userID, id)
+}
+
+func RevokeAPITokenContext(ctx context.Context, db *gorm.DB, userID, id uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Where("id = ? AND user_id = ?", id, userID).Delete(&APIToken{})
+	if result.Error != nil {
+		log.Println("[REVOKE_API_TOKEN]::DB_DELETE_API_TOKEN_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func DeleteExpiredAPITokens() error {
+	return DeleteExpiredAPITokensContext(context.Background(), database.DBConnection)
+}
+
+func DeleteExpiredAPITokensContext(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&APIToken{}).Error; err != nil {
+		log.Println("[DELETE_EXPIRED_API_TOKENS]::DB_DELETE_API_TOKENS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var _ = Describe("APIToken", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("CreateAPIToken", func() {
+		When("the token is valid", func() {
+			It("should store the digest and return the prefixed secret", func() {
+				token := &APIToken{Name: "announcer", Scopes: " view  start_discussion ", UserID: 4, ExpiresAt: time.Now().Add(time.Hour)}
+
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `api_tokens` (`created_at`,`name`,`digest`,`scopes`,`expires_at`,`last_used_at`,`user_id`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), "announcer", sqlmock.AnyArg(), "view start_discussion", sqlmock.AnyArg(), nil, 4).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+
+				secret, err := CreateAPIToken(token)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(strings.HasPrefix(secret, APITokenPrefix)).Should(BeTrue())
+				Expect(token.Digest).Should(Equal(tokens.Hash(secret)))
+				Expect(token.ScopeList()).Should(Equal([]string{ActionView, ActionStartDiscussion}))
+			})
+		})
+
+		When("a scope is not a permission action", func() {
+			It("should return ErrUnknownAction without executing any sql", func() {
+				_, err := CreateAPIToken(&APIToken{Name: "announcer", Scopes: "view fly", UserID: 4, ExpiresAt: time.Now().Add(time.Hour)})
+				Expect(err).Should(Equal(ErrUnknownAction))
+			})
+		})
+
+		When("the token has no scopes", func() {
+			It("should return ErrEmptyScopes without executing any sql", func() {
+				_, err := CreateAPIToken(&APIToken{Name: "announcer", UserID: 4, ExpiresAt: time.Now().Add(time.Hour)})
+				Expect(err).Should(Equal(ErrEmptyScopes))
+			})
+		})
+	})
+
+	Context("AuthenticateAPIToken", func() {
+		secret := APITokenPrefix + "secret"
+
+		expectToken := func(lastUsedAt interface{}) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `api_tokens` WHERE digest = ? AND expires_at > ? LIMIT 1")).
+				WithArgs(tokens.Hash(secret), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "scopes", "last_used_at", "user_id"}).AddRow(7, "announcer", "view", lastUsedAt, 4))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL")).
+				WithArgs(4).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(4, "MotherOfDragons"))
+		}
+
+		When("the token has not been used for a while", func() {
+			It("should return it with its User and record the use", func() {
+				expectToken(nil)
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `api_tokens` SET `last_used_at`=? WHERE id = ?")).
+					WithArgs(sqlmock.AnyArg(), 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				token, err := AuthenticateAPIToken(secret)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(token.User.UserName).Should(Equal("MotherOfDragons"))
+				Expect(token.LastUsedAt).ShouldNot(BeNil())
+			})
+		})
+
+		When("the token was used a moment ago", func() {
+			It("should not write the timestamp again", func() {
+				expectToken(time.Now())
+
+				_, err := AuthenticateAPIToken(secret)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("the token is unknown or has expired", func() {
+			It("should return ErrInvalidAPIToken", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `api_tokens` WHERE digest = ? AND expires_at > ? LIMIT 1")).
+					WithArgs(tokens.Hash(secret), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				_, err := AuthenticateAPIToken(secret)
+				Expect(err).Should(Equal(ErrInvalidAPIToken))
+			})
+		})
+
+		When("the token does not carry the prefix", func() {
+			It("should return ErrInvalidAPIToken without executing any sql", func() {
+				_, err := AuthenticateAPIToken("secret")
+				Expect(err).Should(Equal(ErrInvalidAPIToken))
+			})
+		})
+	})
+
+	Context("RevokeAPIToken", func() {
+		It("should only delete tokens of the User", func() {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `api_tokens` WHERE id = ? AND user_id = ?")).
+				WithArgs(7, 5).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+
+			Expect(RevokeAPIToken(5, 7)).Should(Equal(gorm.ErrRecordNotFound))
+		})
+	})
+
+	Context("DeleteExpiredAPITokens", func() {
+		It("should delete every expired token", func() {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `api_tokens` WHERE expires_at <= ?")).
+				WithArgs(sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+
+			Expect(DeleteExpiredAPITokens()).Should(Succeed())
+		})
+	})
+})
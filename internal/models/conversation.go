@@ -0,0 +1,378 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+	"unicode/utf8"
+)
+
+// Conversation is a private exchange of Messages between its participants.
+// It is never part of a Topic and none of the public APIs reach it.
+type Conversation struct {
+	ID            uint `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Title         string `gorm:"not null;size:128"`
+	LastMessageID uint   `gorm:"not null;index"`
+	Participants  []ConversationParticipant
+	Messages      []Message
+}
+
+// ConversationParticipant is what a User of a Conversation has read, whether
+// they muted it, and up to which Message they deleted it for themselves.
+type ConversationParticipant struct {
+	ConversationID    uint         `gorm:"primaryKey"`
+	Conversation      Conversation `gorm:"foreignKey:ConversationID"`
+	UserID            uint         `gorm:"primaryKey;index"`
+	User              User         `gorm:"foreignKey:UserID"`
+	CreatedAt         time.Time
+	LastReadMessageID uint `gorm:"not null"`
+	ClearedMessageID  uint `gorm:"not null"`
+	Muted             bool `gorm:"not null;default:false"`
+}
+
+// CreateConversation starts a Conversation with its single Message, whose
+// author joins the listed Participants.
+func CreateConversation(conversation *Conversation) error {
+	return CreateConversationContext(context.Background(), database.DBConnection, conversation)
+}
+
+func CreateConversationContext(ctx context.Context, db *gorm.DB, conversation *Conversation) error {
+	db = db.WithContext(ctx)
+
+	if conversation.Title == "" {
+		return ErrEmptyTitle
+	}
+
+	if len(conversation.Messages) != 1 {
+		return ErrConversationWithoutMessage
+	}
+
+	message := &conversation.Messages[0]
+	if message.AuthorID == nil || *message.AuthorID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if message.Content == "" {
+		return ErrEmptyContent
+	}
+
+	if utf8.RuneCountInString(message.Content) > MaxContentLength {
+		return ErrContentTooLong
+	}
+
+	authorID := *message.AuthorID
+	var recipientIDs []uint
+	seen := map[uint]bool{authorID: true}
+	for _, participant := range conversation.Participants {
+		if participant.UserID == 0 {
+			return ErrEmptyUserID
+		}
+
+		if !seen[participant.UserID] {
+			seen[participant.UserID] = true
+			recipientIDs = append(recipientIDs, participant.UserID)
+		}
+	}
+
+	if len(recipientIDs) == 0 {
+		return ErrNoRecipients
+	}
+
+	if err := renderMessage(message); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		blocked, err := blockedBetween(tx, authorID, recipientIDs)
+		if err != nil {
+			return err
+		}
+
+		if blocked {
+			return ErrUserBlocked
+		}
+
+		if err := tx.Omit("Participants", "Messages").Create(conversation).Error; err != nil {
+			log.Println("[CREATE_CONVERSATION]::DB_INSERT_CONVERSATION_ERROR 💥")
+			return err
+		}
+
+		message.ConversationID = conversation.ID
+		if err := tx.Omit("Conversation", "Author").Create(message).Error; err != nil {
+			log.Println("[CREATE_CONVERSATION]::DB_INSERT_MESSAGE_ERROR 💥")
+			return err
+		}
+
+		conversation.LastMessageID = message.ID
+		if err := tx.Model(&Conversation{}).Where("id = ?", conversation.ID).UpdateColumn("last_message_id", message.ID).Error; err != nil {
+			log.Println("[CREATE_CONVERSATION]::DB_UPDATE_CONVERSATION_ERROR 💥")
+			return err
+		}
+
+		participants := []ConversationParticipant{{ConversationID: conversation.ID, UserID: authorID, LastReadMessageID: message.ID}}
+		for _, userID := range recipientIDs {
+			participants = append(participants, ConversationParticipant{ConversationID: conversation.ID, UserID: userID})
+		}
+
+		if err := tx.Omit("Conversation", "User").Create(&participants).Error; err != nil {
+			log.Println("[CREATE_CONVERSATION]::DB_INSERT_CONVERSATION_PARTICIPANTS_ERROR 💥")
+			return err
+		}
+
+		conversation.Participants = participants
+		return nil
+	})
+}
+
+// GetConversation returns the Conversation with its Participants.
+func GetConversation(id uint) (*Conversation, error) {
+	return GetConversationContext(context.Background(), database.DBConnection, id)
+}
+
+func GetConversationContext(ctx context.Context, db *gorm.DB, id uint) (*Conversation, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	conversation := &Conversation{}
+	if err := db.Preload("Participants").Take(conversation, id).Error; err != nil {
+		log.Println("[GET_CONVERSATION]::DB_SELECT_CONVERSATION_ERROR 💥")
+		return nil, err
+	}
+
+	return conversation, nil
+}
+
+// ListConversations lists the Conversations of a User with the latest
+// Message first, leaving out those they deleted that have had no Message
+// since.
+func ListConversations(userID uint, offset, limit int) ([]ConversationParticipant, error) {
+	return ListConversationsContext(context.Background(), database.DBConnection, userID, offset, limit)
+}
+
+func ListConversationsContext(ctx context.Context, db *gorm.DB, userID uint, offset, limit int) ([]ConversationParticipant, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	var participants []ConversationParticipant
+	err := db.
+		Joins("JOIN conversations ON conversations.id = conversation_participants.conversation_id").
+		Where("conversation_participants.user_id = ? AND conversations.last_message_id > conversation_participants.cleared_message_id", userID).
+		Order("conversations.last_message_id DESC").
+		Offset(offset).
+		Limit(limit).
+		Preload("Conversation").
+		Find(&participants).Error
+
+	if err != nil {
+		log.Println("[LIST_CONVERSATIONS]::DB_SELECT_CONVERSATIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return participants, nil
+}
+
+// AddConversationParticipant lets the participant byUserID bring userID into
+// the Conversation. The new participant starts with everything read. Nobody
+// who blocked, or was blocked by, any of the current participants can join.
+func AddConversationParticipant(conversationID, byUserID, userID uint) error {
+	return AddConversationParticipantContext(context.Background(), database.DBConnection, conversationID, byUserID, userID)
+}
+
+func AddConversationParticipantContext(ctx context.Context, db *gorm.DB, conversationID, byUserID, userID uint) error {
+	db = db.WithContext(ctx)
+
+	if conversationID == 0 {
+		return ErrEmptyConversationID
+	}
+
+	if byUserID == 0 || userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := takeParticipant(tx, conversationID, byUserID); err != nil {
+			return err
+		}
+
+		var participantIDs []uint
+		if err := tx.Model(&ConversationParticipant{}).Where("conversation_id = ?", conversationID).Pluck("user_id", &participantIDs).Error; err != nil {
+			log.Println("[ADD_CONVERSATION_PARTICIPANT]::DB_SELECT_CONVERSATION_PARTICIPANTS_ERROR 💥")
+			return err
+		}
+
+		blocked, err := blockedBetween(tx, userID, participantIDs)
+		if err != nil {
+			return err
+		}
+
+		if blocked {
+			return ErrUserBlocked
+		}
+
+		conversation := &Conversation{}
+		if err := tx.Select("id", "last_message_id").Take(conversation, conversationID).Error; err != nil {
+			log.Println("[ADD_CONVERSATION_PARTICIPANT]::DB_SELECT_CONVERSATION_ERROR 💥")
+			return err
+		}
+
+		participant := &ConversationParticipant{ConversationID: conversationID, UserID: userID, LastReadMessageID: conversation.LastMessageID}
+		if err := tx.Omit("Conversation", "User").Clauses(clause.OnConflict{DoNothing: true}).Create(participant).Error; err != nil {
+			log.Println("[ADD_CONVERSATION_PARTICIPANT]::DB_INSERT_CONVERSATION_PARTICIPANT_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+// MarkConversationRead marks every Message of the Conversation as read by the
+// User.
+func MarkConversationRead(conversationID, userID uint) error {
+	return MarkConversationReadContext(context.Background(), database.DBConnection, conversationID, userID)
+}
+
+func MarkConversationReadContext(ctx context.Context, db *gorm.DB, conversationID, userID uint) error {
+	db = db.WithContext(ctx)
+
+	return updateParticipant(db, conversationID, userID, map[string]interface{}{
+		"last_read_message_id": lastMessageID(db, conversationID),
+	})
+}
+
+func MuteConversation(conversationID, userID uint) error {
+	return MuteConversationContext(context.Background(), database.DBConnection, conversationID, userID)
+}
+
+func MuteConversationContext(ctx context.Context, db *gorm.DB, conversationID, userID uint) error {
+	return updateParticipant(db.WithContext(ctx), conversationID, userID, map[string]interface{}{"muted": true})
+}
+
+func UnmuteConversation(conversationID, userID uint) error {
+	return UnmuteConversationContext(context.Background(), database.DBConnection, conversationID, userID)
+}
+
+func UnmuteConversationContext(ctx context.Context, db *gorm.DB, conversationID, userID uint) error {
+	return updateParticipant(db.WithContext(ctx), conversationID, userID, map[string]interface{}{"muted": false})
+}
+
+// ClearConversation deletes the Conversation for the User alone: its
+// Messages so far are no longer shown to them, and it is left out of their
+// Conversations until somebody writes again.
+func ClearConversation(conversationID, userID uint) error {
+	return ClearConversationContext(context.Background(), database.DBConnection, conversationID, userID)
+}
+
+func ClearConversationContext(ctx context.Context, db *gorm.DB, conversationID, userID uint) error {
+	db = db.WithContext(ctx)
+
+	return updateParticipant(db, conversationID, userID, map[string]interface{}{
+		"last_read_message_id": lastMessageID(db, conversationID),
+		"cleared_message_id":   lastMessageID(db, conversationID),
+	})
+}
+
+// LeaveConversation removes the User from the Conversation, which is deleted
+// once nobody is left in it.
+func LeaveConversation(conversationID, userID uint) error {
+	return LeaveConversationContext(context.Background(), database.DBConnection, conversationID, userID)
+}
+
+func LeaveConversationContext(ctx context.Context, db *gorm.DB, conversationID, userID uint) error {
+	db = db.WithContext(ctx)
+
+	if conversationID == 0 {
+		return ErrEmptyConversationID
+	}
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("conversation_id = ? AND user_id = ?", conversationID, userID).Delete(&ConversationParticipant{})
+		if result.Error != nil {
+			log.Println("[LEAVE_CONVERSATION]::DB_DELETE_CONVERSATION_PARTICIPANT_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNotParticipant
+		}
+
+		var remaining int64
+		if err := tx.Model(&ConversationParticipant{}).Where("conversation_id = ?", conversationID).Count(&remaining).Error; err != nil {
+			log.Println("[LEAVE_CONVERSATION]::DB_SELECT_CONVERSATION_PARTICIPANTS_ERROR 💥")
+			return err
+		}
+
+		if remaining > 0 {
+			return nil
+		}
+
+		if err := tx.Where("conversation_id = ?", conversationID).Delete(&Message{}).Error; err != nil {
+			log.Println("[LEAVE_CONVERSATION]::DB_DELETE_MESSAGES_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Delete(&Conversation{}, conversationID).Error; err != nil {
+			log.Println("[LEAVE_CONVERSATION]::DB_DELETE_CONVERSATION_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+func takeParticipant(db *gorm.DB, conversationID, userID uint) (*ConversationParticipant, error) {
+	participant := &ConversationParticipant{}
+	err := db.Where("conversation_id = ? AND user_id = ?", conversationID, userID).Take(participant).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrNotParticipant
+	}
+
+	if err != nil {
+		log.Println("[TAKE_PARTICIPANT]::DB_SELECT_CONVERSATION_PARTICIPANT_ERROR 💥")
+		return nil, err
+	}
+
+	return participant, nil
+}
+
+func updateParticipant(db *gorm.DB, conversationID, userID uint, values map[string]interface{}) error {
+	if conversationID == 0 {
+		return ErrEmptyConversationID
+	}
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	result := db.Model(&ConversationParticipant{}).Where("conversation_id = ? AND user_id = ?", conversationID, userID).UpdateColumns(values)
+	if result.Error != nil {
+		log.Println("[UPDATE_CONVERSATION_PARTICIPANT]::DB_UPDATE_CONVERSATION_PARTICIPANT_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotParticipant
+	}
+
+	return nil
+}
+
+// lastMessageID selects the latest Message of a Conversation, for use as a
+// subquery.
+func lastMessageID(db *gorm.DB, conversationID uint) *gorm.DB {
+	return db.Model(&Conversation{}).Select("last_message_id").Where("id = ?", conversationID)
+}
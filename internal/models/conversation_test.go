@@ -0,0 +1,264 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Conversation", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	newConversation := func(authorID uint, participantIDs ...uint) *Conversation {
+		conversation := &Conversation{Title: "Winter", Messages: []Message{{AuthorID: &authorID, Content: "is coming"}}}
+		for _, id := range participantIDs {
+			conversation.Participants = append(conversation.Participants, ConversationParticipant{UserID: id})
+		}
+
+		return conversation
+	}
+
+	Context("CreateConversation", func() {
+		It("should create the Conversation with its Message and every participant", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `user_blocks` WHERE (user_id = ? AND blocked_user_id IN (?,?)) OR (user_id IN (?,?) AND blocked_user_id = ?)")).
+				WithArgs(10, 11, 12, 11, 12, 10).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `conversations` (`created_at`,`updated_at`,`title`,`last_message_id`) VALUES (?,?,?,?)")).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "Winter", 0).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `messages` (`created_at`,`conversation_id`,`author_id`,`content`,`format`,`content_html`) VALUES (?,?,?,?,?,?)")).
+				WithArgs(sqlmock.AnyArg(), 1, 10, "is coming", "markdown", "<p>is coming</p>\n").
+				WillReturnResult(sqlmock.NewResult(5, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `conversations` SET `last_message_id`=? WHERE id = ?")).
+				WithArgs(5, 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `conversation_participants` (`conversation_id`,`user_id`,`created_at`,`last_read_message_id`,`cleared_message_id`,`muted`) VALUES (?,?,?,?,?,?),(?,?,?,?,?,?),(?,?,?,?,?,?)")).
+				WithArgs(1, 10, sqlmock.AnyArg(), 5, 0, false, 1, 11, sqlmock.AnyArg(), 0, 0, false, 1, 12, sqlmock.AnyArg(), 0, 0, false).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+			mock.ExpectCommit()
+
+			conversation := newConversation(10, 11, 10, 12, 11)
+			Expect(CreateConversation(conversation)).Should(Succeed())
+			Expect(conversation.LastMessageID).Should(Equal(uint(5)))
+			Expect(conversation.Participants).Should(HaveLen(3))
+		})
+
+		It("should return ErrUserBlocked when the author and a participant blocked one another", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `user_blocks`")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectRollback()
+
+			Expect(CreateConversation(newConversation(10, 11))).Should(Equal(ErrUserBlocked))
+		})
+
+		It("should return ErrNoRecipients without executing any sql", func() {
+			Expect(CreateConversation(newConversation(10, 10))).Should(Equal(ErrNoRecipients))
+		})
+
+		It("should return ErrConversationWithoutMessage without executing any sql", func() {
+			conversation := newConversation(10, 11)
+			conversation.Messages = nil
+			Expect(CreateConversation(conversation)).Should(Equal(ErrConversationWithoutMessage))
+		})
+
+		It("should return ErrEmptyTitle without executing any sql", func() {
+			conversation := newConversation(10, 11)
+			conversation.Title = ""
+			Expect(CreateConversation(conversation)).Should(Equal(ErrEmptyTitle))
+		})
+	})
+
+	Context("GetConversation", func() {
+		It("should return the Conversation with its participants", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversations` WHERE `conversations`.`id` = ? LIMIT 1")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Winter"))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversation_participants` WHERE `conversation_participants`.`conversation_id` = ?")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id"}).AddRow(1, 10).AddRow(1, 11))
+
+			conversation, err := GetConversation(1)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(conversation.Participants).Should(HaveLen(2))
+		})
+	})
+
+	Context("ListConversations", func() {
+		It("should list the Conversations of the User that were not deleted since the last Message", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `conversation_participants`.`conversation_id`,`conversation_participants`.`user_id`,`conversation_participants`.`created_at`,`conversation_participants`.`last_read_message_id`,`conversation_participants`.`cleared_message_id`,`conversation_participants`.`muted` FROM `conversation_participants` JOIN conversations ON conversations.id = conversation_participants.conversation_id WHERE conversation_participants.user_id = ? AND conversations.last_message_id > conversation_participants.cleared_message_id ORDER BY conversations.last_message_id DESC LIMIT 20")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id", "muted"}).AddRow(1, 10, true))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversations` WHERE `conversations`.`id` = ?")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Winter"))
+
+			participants, err := ListConversations(10, 0, 20)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(participants).Should(HaveLen(1))
+			Expect(participants[0].Muted).Should(BeTrue())
+			Expect(participants[0].Conversation.Title).Should(Equal("Winter"))
+		})
+	})
+
+	Context("AddConversationParticipant", func() {
+		It("should add the User with everything read", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversation_participants` WHERE conversation_id = ? AND user_id = ? LIMIT 1")).
+				WithArgs(1, 10).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id"}).AddRow(1, 10))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `user_id` FROM `conversation_participants` WHERE conversation_id = ?")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(10).AddRow(11))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `user_blocks` WHERE (user_id = ? AND blocked_user_id IN (?,?)) OR (user_id IN (?,?) AND blocked_user_id = ?)")).
+				WithArgs(13, 10, 11, 10, 11, 13).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`last_message_id` FROM `conversations` WHERE `conversations`.`id` = ? LIMIT 1")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "last_message_id"}).AddRow(1, 7))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `conversation_participants` (`conversation_id`,`user_id`,`created_at`,`last_read_message_id`,`cleared_message_id`,`muted`) VALUES (?,?,?,?,?,?) ON CONFLICT DO NOTHING")).
+				WithArgs(1, 13, sqlmock.AnyArg(), 7, 0, false).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(AddConversationParticipant(1, 10, 13)).Should(Succeed())
+		})
+
+		It("should return ErrUserBlocked when any participant and the User blocked each other", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversation_participants` WHERE conversation_id = ? AND user_id = ? LIMIT 1")).
+				WithArgs(1, 10).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id"}).AddRow(1, 10))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `user_id` FROM `conversation_participants` WHERE conversation_id = ?")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(10).AddRow(11))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `user_blocks`")).
+				WithArgs(13, 10, 11, 10, 11, 13).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectRollback()
+
+			Expect(AddConversationParticipant(1, 10, 13)).Should(Equal(ErrUserBlocked))
+		})
+
+		It("should return ErrNotParticipant when the adding User does not take part", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversation_participants`")).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id"}))
+			mock.ExpectRollback()
+
+			Expect(AddConversationParticipant(1, 10, 13)).Should(Equal(ErrNotParticipant))
+		})
+	})
+
+	Context("MarkConversationRead", func() {
+		It("should mark the last Message of the Conversation read", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `conversation_participants` SET `last_read_message_id`=(SELECT `last_message_id` FROM `conversations` WHERE id = ?) WHERE conversation_id = ? AND user_id = ?")).
+				WithArgs(1, 1, 10).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(MarkConversationRead(1, 10)).Should(Succeed())
+		})
+
+		It("should return ErrNotParticipant when the User does not take part", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `conversation_participants`")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			Expect(MarkConversationRead(1, 10)).Should(Equal(ErrNotParticipant))
+		})
+	})
+
+	Context("MuteConversation", func() {
+		It("should mute the Conversation for the User", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `conversation_participants` SET `muted`=? WHERE conversation_id = ? AND user_id = ?")).
+				WithArgs(true, 1, 10).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(MuteConversation(1, 10)).Should(Succeed())
+		})
+	})
+
+	Context("ClearConversation", func() {
+		It("should hide the Messages so far from the User", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `conversation_participants` SET `cleared_message_id`=(SELECT `last_message_id` FROM `conversations` WHERE id = ?),`last_read_message_id`=(SELECT `last_message_id` FROM `conversations` WHERE id = ?) WHERE conversation_id = ? AND user_id = ?")).
+				WithArgs(1, 1, 1, 10).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(ClearConversation(1, 10)).Should(Succeed())
+		})
+	})
+
+	Context("LeaveConversation", func() {
+		It("should only remove the User while others remain", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `conversation_participants` WHERE conversation_id = ? AND user_id = ?")).
+				WithArgs(1, 10).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `conversation_participants` WHERE conversation_id = ?")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectCommit()
+
+			Expect(LeaveConversation(1, 10)).Should(Succeed())
+		})
+
+		It("should delete the Conversation when the last User leaves", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `conversation_participants`")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `conversation_participants`")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `messages` WHERE conversation_id = ?")).
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `conversations` WHERE `conversations`.`id` = ?")).
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(LeaveConversation(1, 10)).Should(Succeed())
+		})
+
+		It("should return ErrNotParticipant when the User does not take part", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `conversation_participants`")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectRollback()
+
+			Expect(LeaveConversation(1, 10)).Should(Equal(ErrNotParticipant))
+		})
+	})
+})
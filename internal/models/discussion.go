@@ -1,9 +1,13 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"github.com/golangbb/golangbb/v2/internal/database"
 	"gorm.io/gorm"
 	"log"
+	"time"
+	"unicode/utf8"
 )
 
 type Discussion struct {
@@ -17,6 +21,12 @@ type Discussion struct {
 }
 
 func CreateDiscussion(discussion *Discussion) error {
+	return CreateDiscussionContext(context.Background(), database.DBConnection, discussion)
+}
+
+func CreateDiscussionContext(ctx context.Context, db *gorm.DB, discussion *Discussion) error {
+	db = db.WithContext(ctx)
+
 	if discussion.Title == "" {
 		return ErrEmptyTitle
 	}
@@ -33,7 +43,19 @@ func CreateDiscussion(discussion *Discussion) error {
 		return ErrDiscussionWithoutSinglePost
 	}
 
-	err := database.DBConnection.Transaction(func(tx *gorm.DB) error {
+	if discussion.Posts[0].Content == "" {
+		return ErrEmptyContent
+	}
+
+	if utf8.RuneCountInString(discussion.Posts[0].Content) > MaxContentLength {
+		return ErrContentTooLong
+	}
+
+	if err := renderPost(&discussion.Posts[0]); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Omit("Author", "Topic", "Posts").Create(discussion).Error; err != nil {
 			log.Println("[CREATE_DISCUSSION]::DB_INSERT_DISCUSSION_ERROR 💥")
 			return err
@@ -44,11 +66,34 @@ func CreateDiscussion(discussion *Discussion) error {
 			discussion.Posts[i].AuthorID = discussion.AuthorID
 		}
 
-		if err := tx.Omit("Author", "Discussion").CreateInBatches(&discussion.Posts, 10).Error; err != nil {
+		for i := range discussion.Posts {
+			if err := mentionUsers(tx, &discussion.Posts[i]); err != nil {
+				log.Println("[CREATE_DISCUSSION]::DB_SELECT_MENTIONED_USERS_ERROR 💥")
+				return err
+			}
+		}
+
+		if err := tx.Omit("Author", "Discussion", "Mentions").CreateInBatches(&discussion.Posts, 10).Error; err != nil {
 			log.Println("[CREATE_DISCUSSION]::DB_INSERT_POST_ERROR 💥")
 			return err
 		}
 
+		for i := range discussion.Posts {
+			if err := createPostRevision(tx, &discussion.Posts[i], discussion.AuthorID, ""); err != nil {
+				return err
+			}
+
+			if err := createMentions(tx, &discussion.Posts[i]); err != nil {
+				log.Println("[CREATE_DISCUSSION]::DB_INSERT_MENTIONS_ERROR 💥")
+				return err
+			}
+		}
+
+		if err := subscribeDiscussion(tx, discussion.AuthorID, discussion.ID); err != nil {
+			log.Println("[CREATE_DISCUSSION]::DB_INSERT_DISCUSSION_SUBSCRIPTION_ERROR 💥")
+			return err
+		}
+
 		return nil
 	})
 
@@ -58,3 +103,219 @@ func CreateDiscussion(discussion *Discussion) error {
 
 	return nil
 }
+
+func GetDiscussion(id uint) (*Discussion, error) {
+	return GetDiscussionContext(context.Background(), database.DBConnection, id)
+}
+
+func GetDiscussionContext(ctx context.Context, db *gorm.DB, id uint) (*Discussion, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	discussion := &Discussion{}
+	if err := db.Take(discussion, id).Error; err != nil {
+		log.Println("[GET_DISCUSSION]::DB_SELECT_DISCUSSION_ERROR 💥")
+		return nil, err
+	}
+
+	return discussion, nil
+}
+
+// GetDiscussionTopicID returns the Topic of a Discussion, whether or not the
+// Discussion is deleted.
+func GetDiscussionTopicID(id uint) (uint, error) {
+	return GetDiscussionTopicIDContext(context.Background(), database.DBConnection, id)
+}
+
+func GetDiscussionTopicIDContext(ctx context.Context, db *gorm.DB, id uint) (uint, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return 0, ErrEmptyID
+	}
+
+	var topicIDs []uint
+	if err := db.Unscoped().Model(&Discussion{}).Where("id = ?", id).Pluck("topic_id", &topicIDs).Error; err != nil {
+		log.Println("[GET_DISCUSSION_TOPIC_ID]::DB_SELECT_TOPIC_ID_ERROR 💥")
+		return 0, err
+	}
+
+	if len(topicIDs) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	return topicIDs[0], nil
+}
+
+func ListDiscussions(topicID uint, offset, limit int) ([]Discussion, error) {
+	return ListDiscussionsContext(context.Background(), database.DBConnection, topicID, offset, limit)
+}
+
+func ListDiscussionsContext(ctx context.Context, db *gorm.DB, topicID uint, offset, limit int) ([]Discussion, error) {
+	db = db.WithContext(ctx)
+
+	if topicID == 0 {
+		return nil, ErrEmptyTopicID
+	}
+
+	var discussions []Discussion
+	err := db.
+		Where("topic_id = ?", topicID).
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&discussions).Error
+
+	if err != nil {
+		log.Println("[LIST_DISCUSSIONS]::DB_SELECT_DISCUSSIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return discussions, nil
+}
+
+func UpdateDiscussion(discussion *Discussion) error {
+	return UpdateDiscussionContext(context.Background(), database.DBConnection, discussion)
+}
+
+func UpdateDiscussionContext(ctx context.Context, db *gorm.DB, discussion *Discussion) error {
+	db = db.WithContext(ctx)
+
+	if discussion.ID == 0 {
+		return ErrEmptyID
+	}
+
+	if discussion.Title == "" {
+		return ErrEmptyTitle
+	}
+
+	if discussion.TopicID == 0 {
+		return ErrEmptyTopicID
+	}
+
+	result := db.Model(discussion).Where("deleted_at IS NULL").Select("Title", "TopicID").Updates(discussion)
+	if result.Error != nil {
+		log.Println("[UPDATE_DISCUSSION]::DB_UPDATE_DISCUSSION_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func DeleteDiscussion(id uint) error {
+	return DeleteDiscussionContext(context.Background(), database.DBConnection, id)
+}
+
+func DeleteDiscussionContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	// Posts share the Discussion's deleted_at so RestoreDiscussion can tell
+	// them apart from Posts that were deleted on their own.
+	now := db.NowFunc()
+	return db.Session(&gorm.Session{NowFunc: func() time.Time { return now }}).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("discussion_id = ?", id).Delete(&Post{}).Error; err != nil {
+			log.Println("[DELETE_DISCUSSION]::DB_DELETE_POSTS_ERROR 💥")
+			return err
+		}
+
+		result := tx.Delete(&Discussion{}, id)
+		if result.Error != nil {
+			log.Println("[DELETE_DISCUSSION]::DB_DELETE_DISCUSSION_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+func RestoreDiscussion(id uint) error {
+	return RestoreDiscussionContext(context.Background(), database.DBConnection, id)
+}
+
+func RestoreDiscussionContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		discussion := &Discussion{}
+		if err := tx.Unscoped().Where("deleted_at IS NOT NULL").Take(discussion, id).Error; err != nil {
+			log.Println("[RESTORE_DISCUSSION]::DB_SELECT_DISCUSSION_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Take(&Topic{}, discussion.TopicID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDeletedParent
+			}
+
+			log.Println("[RESTORE_DISCUSSION]::DB_SELECT_TOPIC_ERROR 💥")
+			return err
+		}
+
+		err := tx.Unscoped().
+			Model(&Post{}).
+			Where("discussion_id = ? AND deleted_at = ?", id, discussion.DeletedAt).
+			Update("deleted_at", nil).Error
+
+		if err != nil {
+			log.Println("[RESTORE_DISCUSSION]::DB_RESTORE_POSTS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Unscoped().Model(discussion).Update("deleted_at", nil).Error; err != nil {
+			log.Println("[RESTORE_DISCUSSION]::DB_RESTORE_DISCUSSION_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+func PurgeDiscussion(id uint) error {
+	return PurgeDiscussionContext(context.Background(), database.DBConnection, id)
+}
+
+func PurgeDiscussionContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("discussion_id = ?", id).Delete(&Post{}).Error; err != nil {
+			log.Println("[PURGE_DISCUSSION]::DB_DELETE_POSTS_ERROR 💥")
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&Discussion{}, id)
+		if result.Error != nil {
+			log.Println("[PURGE_DISCUSSION]::DB_DELETE_DISCUSSION_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
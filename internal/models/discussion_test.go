@@ -10,6 +10,7 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"regexp"
+	"time"
 )
 
 var _ = Describe("Discussion", func() {
@@ -57,8 +58,12 @@ var _ = Describe("Discussion", func() {
 					WillReturnResult(sqlmock.NewResult(newDiscussionID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, discussion.AuthorID, newDiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, PostFormatMarkdown, sqlmock.AnyArg(), discussion.AuthorID, newDiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -112,6 +117,24 @@ var _ = Describe("Discussion", func() {
 			})
 		})
 
+		When("inserting a Discussion with a Post without Content", func() {
+			It("should not attempt to insert a new Discussion record and return an error", func() {
+				discussion := &Discussion{
+					AuthorID: 10,
+					Title:    "Marvel vs DC",
+					TopicID:  20,
+					Posts:    []Post{{}},
+				}
+
+				err := CreateDiscussion(discussion)
+				Expect(err).Should(HaveOccurred())
+				Expect(err).Should(Equal(ErrEmptyContent))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
 		When("inserting a Discussion without a Title", func() {
 			It("should not attempt to insert a new Discussion record and return an error", func() {
 				discussion := &Discussion{
@@ -181,8 +204,12 @@ var _ = Describe("Discussion", func() {
 					WillReturnResult(sqlmock.NewResult(newDiscussionID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, discussion.AuthorID, newDiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, PostFormatMarkdown, sqlmock.AnyArg(), discussion.AuthorID, newDiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -242,8 +269,8 @@ var _ = Describe("Discussion", func() {
 					WillReturnResult(sqlmock.NewResult(newDiscussionID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, discussion.AuthorID, newDiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, PostFormatMarkdown, sqlmock.AnyArg(), discussion.AuthorID, newDiscussionID, nil).
 					WillReturnError(errors.New("some db error"))
 				mock.ExpectRollback()
 
@@ -280,8 +307,12 @@ var _ = Describe("Discussion", func() {
 					WillReturnResult(sqlmock.NewResult(newDiscussionID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, discussion.AuthorID, newDiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, PostFormatMarkdown, sqlmock.AnyArg(), discussion.AuthorID, newDiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -316,8 +347,12 @@ var _ = Describe("Discussion", func() {
 					WillReturnResult(sqlmock.NewResult(newDiscussionID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, discussion.AuthorID, newDiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, PostFormatMarkdown, sqlmock.AnyArg(), discussion.AuthorID, newDiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -354,8 +389,12 @@ var _ = Describe("Discussion", func() {
 					WillReturnResult(sqlmock.NewResult(newDiscussionID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, discussion.AuthorID, newDiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, PostFormatMarkdown, sqlmock.AnyArg(), discussion.AuthorID, newDiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -390,8 +429,12 @@ var _ = Describe("Discussion", func() {
 					WillReturnResult(sqlmock.NewResult(newDiscussionID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, discussion.AuthorID, newDiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, discussion.Posts[0].Content, PostFormatMarkdown, sqlmock.AnyArg(), discussion.AuthorID, newDiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -403,4 +446,232 @@ var _ = Describe("Discussion", func() {
 			})
 		})
 	})
+
+	Context("GetDiscussion", func() {
+		When("getting a Discussion that exists", func() {
+			It("should return the Discussion", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions` WHERE `discussions`.`id` = ? AND `discussions`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title", "topic_id"}).AddRow(3, "Marvel vs DC", 20))
+
+				discussion, err := GetDiscussion(3)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(discussion.Title).Should(Equal("Marvel vs DC"))
+				Expect(discussion.TopicID).Should(Equal(uint(20)))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a Discussion without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				discussion, err := GetDiscussion(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+				Expect(discussion).Should(BeNil())
+			})
+		})
+	})
+
+	Context("GetDiscussionTopicID", func() {
+		When("the Discussion exists, even deleted", func() {
+			It("should return its Topic", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT `topic_id` FROM `discussions` WHERE id = ?")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"topic_id"}).AddRow(5))
+
+				topicID, err := GetDiscussionTopicID(3)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(topicID).Should(Equal(uint(5)))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("the Discussion does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT `topic_id` FROM `discussions` WHERE id = ?")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"topic_id"}))
+
+				_, err := GetDiscussionTopicID(3)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("ListDiscussions", func() {
+		When("listing a page of Discussions in a Topic", func() {
+			It("should return the newest Discussions first", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions` WHERE topic_id = ? AND `discussions`.`deleted_at` IS NULL ORDER BY id DESC LIMIT 20 OFFSET 20")).
+					WithArgs(20).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(2, "Marvel vs DC").AddRow(1, "Batman vs Superman"))
+
+				discussions, err := ListDiscussions(20, 20, 20)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(discussions).Should(HaveLen(2))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("listing Discussions without a TopicID", func() {
+			It("should return an error without executing any sql on database", func() {
+				discussions, err := ListDiscussions(0, 0, 20)
+				Expect(err).Should(Equal(ErrEmptyTopicID))
+				Expect(discussions).Should(BeNil())
+			})
+		})
+	})
+
+	Context("UpdateDiscussion", func() {
+		When("updating a Discussion with a Title and TopicID", func() {
+			It("should update the Title and TopicID", func() {
+				discussion := &Discussion{Model: gorm.Model{ID: 3}, Title: "Marvel vs DC", TopicID: 20}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussions` SET `updated_at`=?,`title`=?,`topic_id`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), discussion.Title, discussion.TopicID, discussion.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := UpdateDiscussion(discussion)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating a Discussion without a Title", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateDiscussion(&Discussion{Model: gorm.Model{ID: 3}, TopicID: 20})
+				Expect(err).Should(Equal(ErrEmptyTitle))
+			})
+		})
+
+		When("updating a Discussion without a TopicID", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateDiscussion(&Discussion{Model: gorm.Model{ID: 3}, Title: "Marvel vs DC"})
+				Expect(err).Should(Equal(ErrEmptyTopicID))
+			})
+		})
+	})
+
+	Context("DeleteDiscussion", func() {
+		When("deleting a Discussion", func() {
+			It("should soft delete the Discussion and its Posts", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `deleted_at`=? WHERE discussion_id = ? AND `posts`.`deleted_at` IS NULL")).
+					WithArgs(sqlmock.AnyArg(), 3).
+					WillReturnResult(sqlmock.NewResult(0, 5))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussions` SET `deleted_at`=? WHERE `discussions`.`id` = ? AND `discussions`.`deleted_at` IS NULL")).
+					WithArgs(sqlmock.AnyArg(), 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := DeleteDiscussion(3)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting a Discussion that does not exist", func() {
+			It("should rollback and return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `deleted_at`=?")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussions` SET `deleted_at`=?")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := DeleteDiscussion(3)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("RestoreDiscussion", func() {
+		When("restoring a deleted Discussion in a Topic that is not deleted", func() {
+			It("should restore the Discussion and the Posts deleted with it", func() {
+				deletedAt := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions` WHERE deleted_at IS NOT NULL AND `discussions`.`id` = ? LIMIT 1")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "topic_id", "deleted_at"}).AddRow(5, 2, deletedAt))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`id` = ? AND `topics`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(2).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `deleted_at`=?,`updated_at`=? WHERE discussion_id = ? AND deleted_at = ?")).
+					WithArgs(nil, sqlmock.AnyArg(), 5, deletedAt).
+					WillReturnResult(sqlmock.NewResult(0, 4))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussions` SET `deleted_at`=?,`updated_at`=? WHERE `id` = ?")).
+					WithArgs(nil, sqlmock.AnyArg(), 5).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := RestoreDiscussion(5)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("restoring a Discussion whose Topic is deleted", func() {
+			It("should rollback and return ErrDeletedParent", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "topic_id"}).AddRow(5, 2))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				err := RestoreDiscussion(5)
+				Expect(err).Should(Equal(ErrDeletedParent))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("PurgeDiscussion", func() {
+		When("purging a Discussion", func() {
+			It("should permanently remove the Discussion and all of its Posts", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `posts` WHERE discussion_id = ?")).
+					WithArgs(5).
+					WillReturnResult(sqlmock.NewResult(0, 4))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `discussions` WHERE `discussions`.`id` = ?")).
+					WithArgs(5).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := PurgeDiscussion(5)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("purging a Discussion without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := PurgeDiscussion(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+			})
+		})
+	})
 })
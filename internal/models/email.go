@@ -1,27 +1,44 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"github.com/golangbb/golangbb/v2/internal/database"
 	"gorm.io/gorm"
 	"log"
+	"net/mail"
 	"time"
 )
 
+// Email is an address a User receives mail at. Only Verified addresses can be
+// used to sign in or receive notifications, which go to the Primary one.
 type Email struct {
 	Email     string `gorm:"primaryKey" gorm:"size:128"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Verified  bool           `gorm:"not null;default:false"`
+	Primary   bool           `gorm:"column:is_primary;not null;default:false"`
 	User      User           `gorm:"foreignkey:UserID"`
 	UserID    uint
 }
 
 func CreateEmail(email *Email) error {
+	return CreateEmailContext(context.Background(), database.DBConnection, email)
+}
+
+func CreateEmailContext(ctx context.Context, db *gorm.DB, email *Email) error {
+	db = db.WithContext(ctx)
+
 	if email.UserID == 0 {
 		return ErrEmptyUserID
 	}
 
-	err := database.DBConnection.Transaction(func(tx *gorm.DB) error {
+	if !validAddress(email.Email) {
+		return ErrInvalidEmail
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Omit("User").Create(email).Error; err != nil {
 			log.Println("[CREATE_EMAIL]::DB_INSERT_EMAIL_ERROR 💥")
 			return err
@@ -36,3 +53,166 @@ func CreateEmail(email *Email) error {
 
 	return nil
 }
+
+// validAddress accepts a bare address such as user@example.com, without a
+// display name or angle brackets.
+func validAddress(address string) bool {
+	parsed, err := mail.ParseAddress(address)
+	return err == nil && parsed.Address == address
+}
+
+func GetEmail(address string) (*Email, error) {
+	return GetEmailContext(context.Background(), database.DBConnection, address)
+}
+
+func GetEmailContext(ctx context.Context, db *gorm.DB, address string) (*Email, error) {
+	db = db.WithContext(ctx)
+
+	if address == "" {
+		return nil, ErrEmptyEmail
+	}
+
+	email := &Email{}
+	if err := db.Where("email = ?", address).Take(email).Error; err != nil {
+		log.Println("[GET_EMAIL]::DB_SELECT_EMAIL_ERROR 💥")
+		return nil, err
+	}
+
+	return email, nil
+}
+
+func ListEmails(userID uint) ([]Email, error) {
+	return ListEmailsContext(context.Background(), database.DBConnection, userID)
+}
+
+func ListEmailsContext(ctx context.Context, db *gorm.DB, userID uint) ([]Email, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	var emails []Email
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&emails).Error; err != nil {
+		log.Println("[LIST_EMAILS]::DB_SELECT_EMAILS_ERROR 💥")
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// UpdateEmail moves the address to another User, who has to verify it again.
+// The address itself is the primary key; changing it means deleting the Email
+// and creating a new one.
+func UpdateEmail(email *Email) error {
+	return UpdateEmailContext(context.Background(), database.DBConnection, email)
+}
+
+func UpdateEmailContext(ctx context.Context, db *gorm.DB, email *Email) error {
+	db = db.WithContext(ctx)
+
+	if email.Email == "" {
+		return ErrEmptyEmail
+	}
+
+	if email.UserID == 0 {
+		return ErrEmptyUserID
+	}
+
+	email.Verified, email.Primary = false, false
+	result := db.Model(email).Where("deleted_at IS NULL").Select("UserID", "Verified", "Primary").Updates(email)
+	if result.Error != nil {
+		log.Println("[UPDATE_EMAIL]::DB_UPDATE_EMAIL_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func DeleteEmail(address string) error {
+	return DeleteEmailContext(context.Background(), database.DBConnection, address)
+}
+
+func DeleteEmailContext(ctx context.Context, db *gorm.DB, address string) error {
+	db = db.WithContext(ctx)
+
+	if address == "" {
+		return ErrEmptyEmail
+	}
+
+	result := db.Where("email = ?", address).Delete(&Email{})
+	if result.Error != nil {
+		log.Println("[DELETE_EMAIL]::DB_DELETE_EMAIL_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func RestoreEmail(address string) error {
+	return RestoreEmailContext(context.Background(), database.DBConnection, address)
+}
+
+func RestoreEmailContext(ctx context.Context, db *gorm.DB, address string) error {
+	db = db.WithContext(ctx)
+
+	if address == "" {
+		return ErrEmptyEmail
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		email := &Email{}
+		if err := tx.Unscoped().Where("email = ? AND deleted_at IS NOT NULL", address).Take(email).Error; err != nil {
+			log.Println("[RESTORE_EMAIL]::DB_SELECT_EMAIL_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Take(&User{}, email.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDeletedParent
+			}
+
+			log.Println("[RESTORE_EMAIL]::DB_SELECT_USER_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Unscoped().Model(email).Update("deleted_at", nil).Error; err != nil {
+			log.Println("[RESTORE_EMAIL]::DB_RESTORE_EMAIL_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+func PurgeEmail(address string) error {
+	return PurgeEmailContext(context.Background(), database.DBConnection, address)
+}
+
+func PurgeEmailContext(ctx context.Context, db *gorm.DB, address string) error {
+	db = db.WithContext(ctx)
+
+	if address == "" {
+		return ErrEmptyEmail
+	}
+
+	result := db.Unscoped().Where("email = ?", address).Delete(&Email{})
+	if result.Error != nil {
+		log.Println("[PURGE_EMAIL]::DB_DELETE_EMAIL_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -44,9 +44,9 @@ var _ = Describe("Email", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`user_id`) VALUES (?,?,?,?,?)")
+				sql := regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`verified`,`is_primary`,`user_id`) VALUES (?,?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(email.Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, email.UserID).
+					WithArgs(email.Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, false, false, email.UserID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -73,6 +73,18 @@ var _ = Describe("Email", func() {
 			})
 		})
 
+		When("inserting an Email that is not a bare address", func() {
+			It("should not attempt to insert a new Email record", func() {
+				for _, address := range []string{"ironman", "Tony Stark <ironman@mcu.com>"} {
+					err := CreateEmail(&Email{UserID: 10, Email: address})
+					Expect(err).Should(Equal(ErrInvalidEmail))
+				}
+
+				err := mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
 		When("inserting an Email that errors", func() {
 			It("should rollback transaction and return error", func() {
 				email := &Email{
@@ -81,9 +93,9 @@ var _ = Describe("Email", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`user_id`) VALUES (?,?,?,?,?)")
+				sql := regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`verified`,`is_primary`,`user_id`) VALUES (?,?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(email.Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, email.UserID).
+					WithArgs(email.Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, false, false, email.UserID).
 					WillReturnError(errors.New("some db error"))
 				mock.ExpectRollback()
 
@@ -109,9 +121,9 @@ var _ = Describe("Email", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`user_id`) VALUES (?,?,?,?,?)")
+				sql := regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`verified`,`is_primary`,`user_id`) VALUES (?,?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(email.Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, email.UserID).
+					WithArgs(email.Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, false, false, email.UserID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -123,4 +135,178 @@ var _ = Describe("Email", func() {
 			})
 		})
 	})
+
+	Context("GetEmail", func() {
+		When("the Email exists", func() {
+			It("should return the Email", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `emails` WHERE email = ? AND `emails`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs("dany@targaryen.com").
+					WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}).AddRow("dany@targaryen.com", 4))
+
+				email, err := GetEmail("dany@targaryen.com")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(email.UserID).Should(Equal(uint(4)))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting an Email without an address", func() {
+			It("should return an error without executing any sql on database", func() {
+				email, err := GetEmail("")
+				Expect(err).Should(Equal(ErrEmptyEmail))
+				Expect(email).Should(BeNil())
+			})
+		})
+	})
+
+	Context("ListEmails", func() {
+		When("listing the Emails of a User", func() {
+			It("should return every Email that has not been deleted", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `emails` WHERE user_id = ? AND `emails`.`deleted_at` IS NULL ORDER BY created_at")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}).AddRow("dany@targaryen.com", 4).AddRow("khaleesi@dothraki.com", 4))
+
+				emails, err := ListEmails(4)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(emails).Should(HaveLen(2))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("listing Emails without a UserID", func() {
+			It("should return an error without executing any sql on database", func() {
+				emails, err := ListEmails(0)
+				Expect(err).Should(Equal(ErrEmptyUserID))
+				Expect(emails).Should(BeNil())
+			})
+		})
+	})
+
+	Context("UpdateEmail", func() {
+		When("moving an Email to another User", func() {
+			It("should update the UserID and require verification again", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `emails` SET `updated_at`=?,`verified`=?,`is_primary`=?,`user_id`=? WHERE deleted_at IS NULL AND `email` = ?")).
+					WithArgs(sqlmock.AnyArg(), false, false, 5, "dany@targaryen.com").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := UpdateEmail(&Email{Email: "dany@targaryen.com", UserID: 5})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating an Email without a UserID", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateEmail(&Email{Email: "dany@targaryen.com"})
+				Expect(err).Should(Equal(ErrEmptyUserID))
+			})
+		})
+	})
+
+	Context("DeleteEmail", func() {
+		When("deleting an existing Email", func() {
+			It("should soft delete the Email", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `emails` SET `deleted_at`=? WHERE email = ? AND `emails`.`deleted_at` IS NULL")).
+					WithArgs(sqlmock.AnyArg(), "dany@targaryen.com").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := DeleteEmail("dany@targaryen.com")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting an Email that does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `emails` SET `deleted_at`=?")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				err := DeleteEmail("dany@targaryen.com")
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("RestoreEmail", func() {
+		When("restoring a deleted Email of an existing User", func() {
+			It("should clear DeletedAt", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `emails` WHERE email = ? AND deleted_at IS NOT NULL LIMIT 1")).
+					WithArgs("dany@targaryen.com").
+					WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}).AddRow("dany@targaryen.com", 4))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `emails` SET `deleted_at`=?,`updated_at`=? WHERE `email` = ?")).
+					WithArgs(nil, sqlmock.AnyArg(), "dany@targaryen.com").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := RestoreEmail("dany@targaryen.com")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("restoring a deleted Email of a deleted User", func() {
+			It("should rollback and return ErrDeletedParent", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `emails`")).
+					WillReturnRows(sqlmock.NewRows([]string{"email", "user_id"}).AddRow("dany@targaryen.com", 4))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				err := RestoreEmail("dany@targaryen.com")
+				Expect(err).Should(Equal(ErrDeletedParent))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("PurgeEmail", func() {
+		When("purging an Email", func() {
+			It("should permanently remove the Email", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `emails` WHERE email = ?")).
+					WithArgs("dany@targaryen.com").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := PurgeEmail("dany@targaryen.com")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("purging an Email without an address", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := PurgeEmail("")
+				Expect(err).Should(Equal(ErrEmptyEmail))
+			})
+		})
+	})
 })
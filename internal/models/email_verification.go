@@ -0,0 +1,224 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// TokenSigningKey signs the tokens mailed to Users, so that forged ones are
+// turned away before they reach the database.
+var TokenSigningKey []byte
+
+// EmailVerification is an outstanding request to prove that a User receives
+// mail at an address. Like a Session, only the digest of the token is stored.
+type EmailVerification struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	Email     string    `gorm:"not null;size:128;index"`
+	User      User      `gorm:"foreignKey:UserID"`
+	UserID    uint      `gorm:"not null;index"`
+}
+
+// CreateEmailVerification returns the signed token to mail to the address. The
+// Email must belong to verification.UserID and not have been verified yet.
+func CreateEmailVerification(verification *EmailVerification) (string, error) {
+	return CreateEmailVerificationContext(context.Background(), database.DBConnection, verification)
+}
+
+func CreateEmailVerificationContext(ctx context.Context, db *gorm.DB, verification *EmailVerification) (string, error) {
+	db = db.WithContext(ctx)
+
+	if verification.Email == "" {
+		return "", ErrEmptyEmail
+	}
+
+	if verification.UserID == 0 {
+		return "", ErrEmptyUserID
+	}
+
+	if verification.ExpiresAt.IsZero() {
+		return "", ErrEmptyExpiresAt
+	}
+
+	nonce, err := tokens.Generate(tokens.DefaultLength)
+	if err != nil {
+		log.Println("[CREATE_EMAIL_VERIFICATION]::GENERATE_TOKEN_ERROR 💥")
+		return "", err
+	}
+	verification.ID = tokens.Hash(nonce)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		email := &Email{}
+		if err := tx.Where("email = ? AND user_id = ?", verification.Email, verification.UserID).Take(email).Error; err != nil {
+			log.Println("[CREATE_EMAIL_VERIFICATION]::DB_SELECT_EMAIL_ERROR 💥")
+			return err
+		}
+
+		if email.Verified {
+			return ErrEmailVerified
+		}
+
+		if err := tx.Omit("User").Create(verification).Error; err != nil {
+			log.Println("[CREATE_EMAIL_VERIFICATION]::DB_INSERT_EMAIL_VERIFICATION_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return tokens.Sign(TokenSigningKey, nonce), nil
+}
+
+// VerifyEmail consumes a token from CreateEmailVerification and marks its
+// Email as verified. The first address a User verifies becomes their primary.
+func VerifyEmail(token string) (*Email, error) {
+	return VerifyEmailContext(context.Background(), database.DBConnection, token)
+}
+
+func VerifyEmailContext(ctx context.Context, db *gorm.DB, token string) (*Email, error) {
+	db = db.WithContext(ctx)
+
+	if token == "" {
+		return nil, ErrEmptyToken
+	}
+
+	nonce, err := tokens.Verify(TokenSigningKey, token)
+	if err != nil {
+		log.Println("[VERIFY_EMAIL]::INVALID_SIGNATURE_WARNING ⚠️")
+		return nil, ErrInvalidToken
+	}
+
+	email := &Email{}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		verification := &EmailVerification{}
+		err := tx.Where("id = ? AND expires_at > ?", tokens.Hash(nonce), time.Now()).Take(verification).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+
+		if err != nil {
+			log.Println("[VERIFY_EMAIL]::DB_SELECT_EMAIL_VERIFICATION_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("email = ? AND user_id = ?", verification.Email, verification.UserID).Delete(&EmailVerification{}).Error; err != nil {
+			log.Println("[VERIFY_EMAIL]::DB_DELETE_EMAIL_VERIFICATIONS_ERROR 💥")
+			return err
+		}
+
+		err = tx.Where("email = ? AND user_id = ?", verification.Email, verification.UserID).Take(email).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+
+		if err != nil {
+			log.Println("[VERIFY_EMAIL]::DB_SELECT_EMAIL_ERROR 💥")
+			return err
+		}
+
+		var primaries int64
+		if err := tx.Model(&Email{}).Where("user_id = ? AND is_primary = ?", email.UserID, true).Count(&primaries).Error; err != nil {
+			log.Println("[VERIFY_EMAIL]::DB_COUNT_PRIMARY_EMAILS_ERROR 💥")
+			return err
+		}
+
+		email.Verified = true
+		email.Primary = email.Primary || primaries == 0
+		if err := tx.Model(email).Select("Verified", "Primary").Updates(email).Error; err != nil {
+			log.Println("[VERIFY_EMAIL]::DB_UPDATE_EMAIL_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return email, nil
+}
+
+// SetPrimaryEmail makes a verified address the one a User is notified at.
+func SetPrimaryEmail(address string) error {
+	return SetPrimaryEmailContext(context.Background(), database.DBConnection, address)
+}
+
+func SetPrimaryEmailContext(ctx context.Context, db *gorm.DB, address string) error {
+	db = db.WithContext(ctx)
+
+	if address == "" {
+		return ErrEmptyEmail
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		email := &Email{}
+		if err := tx.Where("email = ?", address).Take(email).Error; err != nil {
+			log.Println("[SET_PRIMARY_EMAIL]::DB_SELECT_EMAIL_ERROR 💥")
+			return err
+		}
+
+		if !email.Verified {
+			return ErrEmailNotVerified
+		}
+
+		if err := tx.Model(&Email{}).Where("user_id = ? AND email <> ?", email.UserID, address).Update("is_primary", false).Error; err != nil {
+			log.Println("[SET_PRIMARY_EMAIL]::DB_UPDATE_EMAILS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Model(email).Update("is_primary", true).Error; err != nil {
+			log.Println("[SET_PRIMARY_EMAIL]::DB_UPDATE_EMAIL_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+// GetPrimaryEmail returns the verified address to notify a User at, or
+// gorm.ErrRecordNotFound when they have not verified any.
+func GetPrimaryEmail(userID uint) (*Email, error) {
+	return GetPrimaryEmailContext(context.Background(), database.DBConnection, userID)
+}
+
+func GetPrimaryEmailContext(ctx context.Context, db *gorm.DB, userID uint) (*Email, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	email := &Email{}
+	if err := db.Where("user_id = ? AND verified = ? AND is_primary = ?", userID, true, true).Take(email).Error; err != nil {
+		log.Println("[GET_PRIMARY_EMAIL]::DB_SELECT_EMAIL_ERROR 💥")
+		return nil, err
+	}
+
+	return email, nil
+}
+
+func DeleteExpiredEmailVerifications() error {
+	return DeleteExpiredEmailVerificationsContext(context.Background(), database.DBConnection)
+}
+
+func DeleteExpiredEmailVerificationsContext(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&EmailVerification{}).Error; err != nil {
+		log.Println("[DELETE_EXPIRED_EMAIL_VERIFICATIONS]::DB_DELETE_EMAIL_VERIFICATIONS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
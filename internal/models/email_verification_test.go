@@ -0,0 +1,199 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("EmailVerification", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		TokenSigningKey = []byte("secret")
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	expectEmail := func(verified bool) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `emails` WHERE (email = ? AND user_id = ?) AND `emails`.`deleted_at` IS NULL LIMIT 1")).
+			WithArgs("dany@targaryen.com", 4).
+			WillReturnRows(sqlmock.NewRows([]string{"email", "user_id", "verified"}).AddRow("dany@targaryen.com", 4, verified))
+	}
+
+	// issue signs a token the way CreateEmailVerification does and returns it
+	// with the ID its EmailVerification is stored under.
+	issue := func() (string, string) {
+		nonce, err := tokens.Generate(tokens.DefaultLength)
+		Expect(err).ShouldNot(HaveOccurred())
+		return tokens.Sign(TokenSigningKey, nonce), tokens.Hash(nonce)
+	}
+
+	Context("CreateEmailVerification", func() {
+		When("the Email belongs to the User and is not verified", func() {
+			It("should store the digest and return a signed token", func() {
+				verification := &EmailVerification{Email: "dany@targaryen.com", UserID: 4, ExpiresAt: time.Now().Add(time.Hour)}
+
+				mock.ExpectBegin()
+				expectEmail(false)
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `email_verifications` (`id`,`created_at`,`expires_at`,`email`,`user_id`) VALUES (?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "dany@targaryen.com", 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				token, err := CreateEmailVerification(verification)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				nonce, err := tokens.Verify(TokenSigningKey, token)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(verification.ID).Should(Equal(tokens.Hash(nonce)))
+			})
+		})
+
+		When("the Email is already verified", func() {
+			It("should return ErrEmailVerified", func() {
+				mock.ExpectBegin()
+				expectEmail(true)
+				mock.ExpectRollback()
+
+				_, err := CreateEmailVerification(&EmailVerification{Email: "dany@targaryen.com", UserID: 4, ExpiresAt: time.Now().Add(time.Hour)})
+				Expect(err).Should(Equal(ErrEmailVerified))
+			})
+		})
+
+		When("the verification has no expiry", func() {
+			It("should return ErrEmptyExpiresAt without executing any sql", func() {
+				_, err := CreateEmailVerification(&EmailVerification{Email: "dany@targaryen.com", UserID: 4})
+				Expect(err).Should(Equal(ErrEmptyExpiresAt))
+			})
+		})
+	})
+
+	Context("VerifyEmail", func() {
+		When("the token is valid", func() {
+			It("should consume it and make the first verified Email primary", func() {
+				token, id := issue()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `email_verifications` WHERE id = ? AND expires_at > ? LIMIT 1")).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email", "user_id"}).AddRow(id, "dany@targaryen.com", 4))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `email_verifications` WHERE email = ? AND user_id = ?")).
+					WithArgs("dany@targaryen.com", 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectEmail(false)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `emails` WHERE (user_id = ? AND is_primary = ?) AND `emails`.`deleted_at` IS NULL")).
+					WithArgs(4, true).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `emails` SET `updated_at`=?,`verified`=?,`is_primary`=? WHERE `email` = ?")).
+					WithArgs(sqlmock.AnyArg(), true, true, "dany@targaryen.com").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				email, err := VerifyEmail(token)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(email.Verified).Should(BeTrue())
+				Expect(email.Primary).Should(BeTrue())
+			})
+		})
+
+		When("the token has been used or has expired", func() {
+			It("should return ErrInvalidToken", func() {
+				token, id := issue()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `email_verifications` WHERE id = ? AND expires_at > ? LIMIT 1")).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				_, err := VerifyEmail(token)
+				Expect(err).Should(Equal(ErrInvalidToken))
+			})
+		})
+
+		When("the token was not signed with TokenSigningKey", func() {
+			It("should return ErrInvalidToken without executing any sql", func() {
+				_, err := VerifyEmail(tokens.Sign([]byte("forged"), "nonce"))
+				Expect(err).Should(Equal(ErrInvalidToken))
+			})
+		})
+	})
+
+	Context("SetPrimaryEmail", func() {
+		When("the Email is verified", func() {
+			It("should make it the only primary Email of its User", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `emails` WHERE email = ? AND `emails`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs("dany@targaryen.com").
+					WillReturnRows(sqlmock.NewRows([]string{"email", "user_id", "verified"}).AddRow("dany@targaryen.com", 4, true))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `emails` SET `is_primary`=?,`updated_at`=? WHERE user_id = ? AND email <> ?")).
+					WithArgs(false, sqlmock.AnyArg(), 4, "dany@targaryen.com").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `emails` SET `is_primary`=?,`updated_at`=? WHERE `email` = ?")).
+					WithArgs(true, sqlmock.AnyArg(), "dany@targaryen.com").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				Expect(SetPrimaryEmail("dany@targaryen.com")).Should(Succeed())
+			})
+		})
+
+		When("the Email is not verified", func() {
+			It("should return ErrEmailNotVerified", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `emails` WHERE email = ?")).
+					WithArgs("dany@targaryen.com").
+					WillReturnRows(sqlmock.NewRows([]string{"email", "user_id", "verified"}).AddRow("dany@targaryen.com", 4, false))
+				mock.ExpectRollback()
+
+				Expect(SetPrimaryEmail("dany@targaryen.com")).Should(Equal(ErrEmailNotVerified))
+			})
+		})
+	})
+
+	Context("GetPrimaryEmail", func() {
+		It("should only return a verified primary Email", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `emails` WHERE (user_id = ? AND verified = ? AND is_primary = ?) AND `emails`.`deleted_at` IS NULL LIMIT 1")).
+				WithArgs(4, true, true).
+				WillReturnRows(sqlmock.NewRows([]string{"email", "user_id", "verified", "is_primary"}).AddRow("dany@targaryen.com", 4, true, true))
+
+			email, err := GetPrimaryEmail(4)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(email.Email).Should(Equal("dany@targaryen.com"))
+		})
+	})
+
+	Context("DeleteExpiredEmailVerifications", func() {
+		It("should delete every expired verification", func() {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `email_verifications` WHERE expires_at <= ?")).
+				WithArgs(sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+
+			Expect(DeleteExpiredEmailVerifications()).Should(Succeed())
+		})
+	})
+})
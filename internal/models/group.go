@@ -1,20 +1,30 @@
 package models
 
 import (
+	"context"
 	"github.com/golangbb/golangbb/v2/internal/database"
 	"gorm.io/gorm"
 	"log"
 )
 
+// Group collects Users for permissions. When RequireTwoFactor is set its
+// members must enrol in two-factor authentication before using the forum.
 type Group struct {
 	gorm.Model
-	Name     string `gorm:"not null" gorm:"size:64"`
-	Users    []User `gorm:"many2many:users_groups;"`
-	Author   User   `gorm:"foreignKey:AuthorID"`
-	AuthorID uint
+	Name             string `gorm:"not null" gorm:"size:64"`
+	Users            []User `gorm:"many2many:users_groups;"`
+	Author           User   `gorm:"foreignKey:AuthorID"`
+	AuthorID         uint
+	RequireTwoFactor bool `gorm:"not null;default:false"`
 }
 
 func CreateGroup(group *Group) error {
+	return CreateGroupContext(context.Background(), database.DBConnection, group)
+}
+
+func CreateGroupContext(ctx context.Context, db *gorm.DB, group *Group) error {
+	db = db.WithContext(ctx)
+
 	if group.Name == "" {
 		return ErrEmptyName
 	}
@@ -23,7 +33,7 @@ func CreateGroup(group *Group) error {
 		return ErrEmptyUserID
 	}
 
-	err := database.DBConnection.Transaction(func(tx *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Omit("Users", "Author").Create(group).Error; err != nil {
 			log.Println("[CREATE_GROUP]::DB_INSERT_GROUP_ERROR 💥")
 			return err
@@ -38,3 +48,206 @@ func CreateGroup(group *Group) error {
 
 	return nil
 }
+
+func GetGroup(id uint) (*Group, error) {
+	return GetGroupContext(context.Background(), database.DBConnection, id)
+}
+
+func GetGroupContext(ctx context.Context, db *gorm.DB, id uint) (*Group, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	group := &Group{}
+	if err := db.Take(group, id).Error; err != nil {
+		log.Println("[GET_GROUP]::DB_SELECT_GROUP_ERROR 💥")
+		return nil, err
+	}
+
+	return group, nil
+}
+
+func ListGroups(offset, limit int) ([]Group, error) {
+	return ListGroupsContext(context.Background(), database.DBConnection, offset, limit)
+}
+
+func ListGroupsContext(ctx context.Context, db *gorm.DB, offset, limit int) ([]Group, error) {
+	db = db.WithContext(ctx)
+
+	var groups []Group
+	err := db.
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&groups).Error
+
+	if err != nil {
+		log.Println("[LIST_GROUPS]::DB_SELECT_GROUPS_ERROR 💥")
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func UpdateGroup(group *Group) error {
+	return UpdateGroupContext(context.Background(), database.DBConnection, group)
+}
+
+func UpdateGroupContext(ctx context.Context, db *gorm.DB, group *Group) error {
+	db = db.WithContext(ctx)
+
+	if group.ID == 0 {
+		return ErrEmptyID
+	}
+
+	if group.Name == "" {
+		return ErrEmptyName
+	}
+
+	result := db.Model(group).Where("deleted_at IS NULL").Select("Name").Updates(group)
+	if result.Error != nil {
+		log.Println("[UPDATE_GROUP]::DB_UPDATE_GROUP_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func SetGroupRequireTwoFactor(id uint, required bool) error {
+	return SetGroupRequireTwoFactorContext(context.Background(), database.DBConnection, id, required)
+}
+
+func SetGroupRequireTwoFactorContext(ctx context.Context, db *gorm.DB, id uint, required bool) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Model(&Group{Model: gorm.Model{ID: id}}).Where("deleted_at IS NULL").Update("require_two_factor", required)
+	if result.Error != nil {
+		log.Println("[SET_GROUP_REQUIRE_TWO_FACTOR]::DB_UPDATE_GROUP_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func DeleteGroup(id uint) error {
+	return DeleteGroupContext(context.Background(), database.DBConnection, id)
+}
+
+func DeleteGroupContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Delete(&Group{}, id)
+	if result.Error != nil {
+		log.Println("[DELETE_GROUP]::DB_DELETE_GROUP_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func RestoreGroup(id uint) error {
+	return RestoreGroupContext(context.Background(), database.DBConnection, id)
+}
+
+func RestoreGroupContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Unscoped().Model(&Group{Model: gorm.Model{ID: id}}).Where("deleted_at IS NOT NULL").Update("deleted_at", nil)
+	if result.Error != nil {
+		log.Println("[RESTORE_GROUP]::DB_RESTORE_GROUP_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func PurgeGroup(id uint) error {
+	return PurgeGroupContext(context.Background(), database.DBConnection, id)
+}
+
+func PurgeGroupContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM users_groups WHERE group_id = ?", id).Error; err != nil {
+			log.Println("[PURGE_GROUP]::DB_DELETE_MEMBERSHIPS_ERROR 💥")
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&Group{}, id)
+		if result.Error != nil {
+			log.Println("[PURGE_GROUP]::DB_DELETE_GROUP_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+func IsGroupMember(userID uint, name string) (bool, error) {
+	return IsGroupMemberContext(context.Background(), database.DBConnection, userID, name)
+}
+
+func IsGroupMemberContext(ctx context.Context, db *gorm.DB, userID uint, name string) (bool, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return false, ErrEmptyUserID
+	}
+
+	if name == "" {
+		return false, ErrEmptyName
+	}
+
+	var count int64
+	memberships := db.Table("users_groups").Select("group_id").Where("user_id = ?", userID)
+	err := db.
+		Model(&Group{}).
+		Where("name = ? AND id IN (?)", name, memberships).
+		Count(&count).Error
+
+	if err != nil {
+		log.Println("[IS_GROUP_MEMBER]::DB_COUNT_MEMBERSHIPS_ERROR 💥")
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -44,9 +44,9 @@ var _ = Describe("Group", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `groups` (`created_at`,`updated_at`,`deleted_at`,`name`,`author_id`) VALUES (?,?,?,?,?)")
+				sql := regexp.QuoteMeta("INSERT INTO `groups` (`created_at`,`updated_at`,`deleted_at`,`name`,`author_id`,`require_two_factor`) VALUES (?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, group.Name, group.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, group.Name, group.AuthorID, false).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -96,9 +96,9 @@ var _ = Describe("Group", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `groups` (`created_at`,`updated_at`,`deleted_at`,`name`,`author_id`) VALUES (?,?,?,?,?)")
+				sql := regexp.QuoteMeta("INSERT INTO `groups` (`created_at`,`updated_at`,`deleted_at`,`name`,`author_id`,`require_two_factor`) VALUES (?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, group.Name, group.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, group.Name, group.AuthorID, false).
 					WillReturnError(errors.New("some db error"))
 				mock.ExpectRollback()
 
@@ -122,9 +122,9 @@ var _ = Describe("Group", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `groups` (`created_at`,`updated_at`,`deleted_at`,`name`,`author_id`) VALUES (?,?,?,?,?)")
+				sql := regexp.QuoteMeta("INSERT INTO `groups` (`created_at`,`updated_at`,`deleted_at`,`name`,`author_id`,`require_two_factor`) VALUES (?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, group.Name, group.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, group.Name, group.AuthorID, false).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -150,9 +150,9 @@ var _ = Describe("Group", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `groups` (`created_at`,`updated_at`,`deleted_at`,`name`,`author_id`) VALUES (?,?,?,?,?)")
+				sql := regexp.QuoteMeta("INSERT INTO `groups` (`created_at`,`updated_at`,`deleted_at`,`name`,`author_id`,`require_two_factor`) VALUES (?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, group.Name, group.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, group.Name, group.AuthorID, false).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -164,4 +164,183 @@ var _ = Describe("Group", func() {
 			})
 		})
 	})
+
+	Context("GetGroup", func() {
+		When("the Group exists", func() {
+			It("should return the Group", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `groups` WHERE `groups`.`id` = ? AND `groups`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(2).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Night's Watch"))
+
+				group, err := GetGroup(2)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(group.Name).Should(Equal("Night's Watch"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a Group without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				group, err := GetGroup(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+				Expect(group).Should(BeNil())
+			})
+		})
+	})
+
+	Context("ListGroups", func() {
+		When("listing Groups", func() {
+			It("should return a page of Groups that have not been deleted", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `groups` WHERE `groups`.`deleted_at` IS NULL ORDER BY id LIMIT 20")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Night's Watch"))
+
+				groups, err := ListGroups(0, 20)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(groups).Should(HaveLen(1))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("UpdateGroup", func() {
+		When("updating a Group with a Name", func() {
+			It("should update the Name", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `groups` SET `updated_at`=?,`name`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), "Kingsguard", 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := UpdateGroup(&Group{Model: gorm.Model{ID: 2}, Name: "Kingsguard"})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating a Group without a Name", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateGroup(&Group{Model: gorm.Model{ID: 2}})
+				Expect(err).Should(Equal(ErrEmptyName))
+			})
+		})
+	})
+
+	Context("DeleteGroup", func() {
+		When("deleting an existing Group", func() {
+			It("should soft delete the Group", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `groups` SET `deleted_at`=? WHERE `groups`.`id` = ? AND `groups`.`deleted_at` IS NULL")).
+					WithArgs(sqlmock.AnyArg(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := DeleteGroup(2)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("RestoreGroup", func() {
+		When("restoring a deleted Group", func() {
+			It("should clear DeletedAt", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `groups` SET `deleted_at`=?,`updated_at`=? WHERE deleted_at IS NOT NULL AND `id` = ?")).
+					WithArgs(nil, sqlmock.AnyArg(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := RestoreGroup(2)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("PurgeGroup", func() {
+		When("purging a Group", func() {
+			It("should remove its memberships and the Group", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users_groups WHERE group_id = ?")).
+					WithArgs(2).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `groups` WHERE `groups`.`id` = ?")).
+					WithArgs(2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := PurgeGroup(2)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("purging a Group that does not exist", func() {
+			It("should rollback and return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users_groups")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `groups`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := PurgeGroup(2)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("IsGroupMember", func() {
+		When("the User belongs to the named Group", func() {
+			It("should return true", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `groups` WHERE (name = ? AND id IN (SELECT group_id FROM `users_groups` WHERE user_id = ?)) AND `groups`.`deleted_at` IS NULL")).
+					WithArgs("moderators", 4).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+				ok, err := IsGroupMember(4, "moderators")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeTrue())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("the User does not belong to the named Group", func() {
+			It("should return false", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `groups`")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+				ok, err := IsGroupMember(4, "moderators")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeFalse())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("checking membership without a Name", func() {
+			It("should return an error without executing any sql on database", func() {
+				ok, err := IsGroupMember(4, "")
+				Expect(err).Should(Equal(ErrEmptyName))
+				Expect(ok).Should(BeFalse())
+			})
+		})
+	})
 })
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// Identity links the subject of an OpenID Connect provider to a User. The
+// issuer is part of the key because subjects are only unique per provider.
+type Identity struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Issuer    string `gorm:"not null;size:255;uniqueIndex:idx_identities_issuer_subject"`
+	Subject   string `gorm:"not null;size:255;uniqueIndex:idx_identities_issuer_subject"`
+	User      User   `gorm:"foreignKey:UserID"`
+	UserID    uint   `gorm:"not null;index"`
+}
+
+func validateIdentity(identity *Identity) error {
+	if identity.Issuer == "" {
+		return ErrEmptyIssuer
+	}
+
+	if identity.Subject == "" {
+		return ErrEmptySubject
+	}
+
+	return nil
+}
+
+// GetIdentityUser returns the User linked to the subject. It returns
+// ErrUserDeleted rather than not found for a deleted User, so that signing in
+// again does not create a second account.
+func GetIdentityUser(issuer, subject string) (*User, error) {
+	return GetIdentityUserContext(context.Background(), database.DBConnection, issuer, subject)
+}
+
+func GetIdentityUserContext(ctx context.Context, db *gorm.DB, issuer, subject string) (*User, error) {
+	db = db.WithContext(ctx)
+
+	if err := validateIdentity(&Identity{Issuer: issuer, Subject: subject}); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{}
+	err := db.Preload("User").Where("issuer = ? AND subject = ?", issuer, subject).Take(identity).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("[GET_IDENTITY_USER]::DB_SELECT_IDENTITY_ERROR 💥")
+		}
+		return nil, err
+	}
+
+	if identity.User.ID == 0 {
+		return nil, ErrUserDeleted
+	}
+
+	return &identity.User, nil
+}
+
+// LinkIdentity links the subject to a signed in User. Linking it again to the
+// same User does nothing.
+func LinkIdentity(identity *Identity) error {
+	return LinkIdentityContext(context.Background(), database.DBConnection, identity)
+}
+
+func LinkIdentityContext(ctx context.Context, db *gorm.DB, identity *Identity) error {
+	db = db.WithContext(ctx)
+
+	if err := validateIdentity(identity); err != nil {
+		return err
+	}
+
+	if identity.UserID == 0 {
+		return ErrEmptyUserID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		existing := &Identity{}
+		err := tx.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Take(existing).Error
+		if err == nil {
+			if existing.UserID != identity.UserID {
+				return ErrIdentityLinked
+			}
+
+			*identity = *existing
+			return nil
+		}
+
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("[LINK_IDENTITY]::DB_SELECT_IDENTITY_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Omit("User").Create(identity).Error; err != nil {
+			log.Println("[LINK_IDENTITY]::DB_INSERT_IDENTITY_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Identity", func() {
+	const issuer = "https://id.example.com"
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	expectIdentity := func(userID uint) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `identities` WHERE issuer = ? AND subject = ? LIMIT 1")).
+			WithArgs(issuer, "ygritte").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "issuer", "subject", "user_id"}).AddRow(3, issuer, "ygritte", userID))
+	}
+
+	Context("GetIdentityUser", func() {
+		It("should return the linked User", func() {
+			expectIdentity(4)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL")).
+				WithArgs(4).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(4, "Ygritte"))
+
+			user, err := GetIdentityUser(issuer, "ygritte")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(user.UserName).Should(Equal("Ygritte"))
+		})
+
+		When("the linked User has been deleted", func() {
+			It("should return ErrUserDeleted", func() {
+				expectIdentity(4)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				_, err := GetIdentityUser(issuer, "ygritte")
+				Expect(err).Should(Equal(ErrUserDeleted))
+			})
+		})
+
+		When("nobody has signed in with the subject", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `identities` WHERE issuer = ? AND subject = ? LIMIT 1")).
+					WithArgs(issuer, "ygritte").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				_, err := GetIdentityUser(issuer, "ygritte")
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+			})
+		})
+	})
+
+	Context("LinkIdentity", func() {
+		It("should link an unknown subject", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `identities` WHERE issuer = ? AND subject = ? LIMIT 1")).
+				WithArgs(issuer, "ygritte").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `identities` (`created_at`,`issuer`,`subject`,`user_id`) VALUES (?,?,?,?)")).
+				WithArgs(sqlmock.AnyArg(), issuer, "ygritte", 4).
+				WillReturnResult(sqlmock.NewResult(3, 1))
+			mock.ExpectCommit()
+
+			Expect(LinkIdentity(&Identity{Issuer: issuer, Subject: "ygritte", UserID: 4})).Should(Succeed())
+		})
+
+		When("the subject is linked to another User", func() {
+			It("should return ErrIdentityLinked", func() {
+				mock.ExpectBegin()
+				expectIdentity(5)
+				mock.ExpectRollback()
+
+				Expect(LinkIdentity(&Identity{Issuer: issuer, Subject: "ygritte", UserID: 4})).Should(Equal(ErrIdentityLinked))
+			})
+		})
+
+		When("the subject is empty", func() {
+			It("should return ErrEmptySubject without executing any sql", func() {
+				Expect(LinkIdentity(&Identity{Issuer: issuer, UserID: 4})).Should(Equal(ErrEmptySubject))
+			})
+		})
+	})
+})
@@ -0,0 +1,363 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	LoginFailureUnknownUser = "unknown_user"
+	LoginFailurePassword    = "password"
+	LoginFailureTwoFactor   = "two_factor"
+)
+
+const maxLoginIdentifierLength = 128
+
+// ThrottlePolicy lets FreeAttempts failures through and then locks for a delay
+// that doubles with every further failure up to MaxDelay. Failures are
+// forgotten once none has happened for Window.
+type ThrottlePolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+// AccountLoginPolicy applies to each User and IPLoginPolicy to each address,
+// which may be shared by many Users behind the same NAT.
+var AccountLoginPolicy = ThrottlePolicy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: 15 * time.Minute, Window: 24 * time.Hour}
+var IPLoginPolicy = ThrottlePolicy{FreeAttempts: 20, BaseDelay: time.Second, MaxDelay: 15 * time.Minute, Window: 24 * time.Hour}
+
+// PasswordResetPolicy applies to the reset requests for each Email address and
+// PasswordResetIPPolicy to those from each IP address.
+var PasswordResetPolicy = ThrottlePolicy{FreeAttempts: 2, BaseDelay: 15 * time.Minute, MaxDelay: 24 * time.Hour, Window: 24 * time.Hour}
+var PasswordResetIPPolicy = ThrottlePolicy{FreeAttempts: 10, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour}
+
+// Delay returns how long to lock after the given number of failures.
+func (p ThrottlePolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay
+}
+
+// LoginThrottle counts the recent failed logins of one User or IP address.
+type LoginThrottle struct {
+	Key           string `gorm:"column:throttle_key;primaryKey;size:64"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time `gorm:"index"`
+}
+
+// FailedLogin is the audit trail of failed logins. UserID is nil when the
+// identifier did not match any User.
+type FailedLogin struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"index"`
+	Identifier string    `gorm:"not null;size:128"`
+	Reason     string    `gorm:"not null;size:32"`
+	IPAddress  string    `gorm:"not null;size:45;index"`
+	User       *User     `gorm:"foreignKey:UserID"`
+	UserID     *uint     `gorm:"index"`
+}
+
+func AccountThrottleKey(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// PasswordResetThrottleKey stands for the address by part of its digest, which
+// keeps the key short whatever the length of the address.
+func PasswordResetThrottleKey(email string) string {
+	return "reset:" + tokens.Hash(strings.ToLower(email))[:32]
+}
+
+func PasswordResetIPThrottleKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+// LoginLockedUntil returns until when logins as the User, or from the IP
+// address, are locked. It returns the zero time when neither is locked. A
+// userID of 0 only checks the address.
+func LoginLockedUntil(userID uint, ip string) (time.Time, error) {
+	return LoginLockedUntilContext(context.Background(), database.DBConnection, userID, ip)
+}
+
+func LoginLockedUntilContext(ctx context.Context, db *gorm.DB, userID uint, ip string) (time.Time, error) {
+	db = db.WithContext(ctx)
+
+	keys := []string{IPThrottleKey(ip)}
+	if userID != 0 {
+		keys = append(keys, AccountThrottleKey(userID))
+	}
+
+	var throttles []LoginThrottle
+	if err := db.Where("throttle_key IN ? AND locked_until > ?", keys, time.Now()).Find(&throttles).Error; err != nil {
+		log.Println("[LOGIN_LOCKED_UNTIL]::DB_SELECT_LOGIN_THROTTLES_ERROR 💥")
+		return time.Time{}, err
+	}
+
+	var until time.Time
+	for _, throttle := range throttles {
+		if throttle.LockedUntil.After(until) {
+			until = *throttle.LockedUntil
+		}
+	}
+
+	return until, nil
+}
+
+// RecordFailedLogin adds the failure to the audit trail and counts it against
+// the IP address and, when known, the User. It returns until when the next
+// attempt is locked, or the zero time when it is not.
+func RecordFailedLogin(failure *FailedLogin) (time.Time, error) {
+	return RecordFailedLoginContext(context.Background(), database.DBConnection, failure)
+}
+
+func RecordFailedLoginContext(ctx context.Context, db *gorm.DB, failure *FailedLogin) (time.Time, error) {
+	db = db.WithContext(ctx)
+
+	if failure.IPAddress == "" {
+		return time.Time{}, ErrEmptyIPAddress
+	}
+
+	if len(failure.Identifier) > maxLoginIdentifierLength {
+		failure.Identifier = failure.Identifier[:maxLoginIdentifierLength]
+	}
+
+	var until time.Time
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User").Create(failure).Error; err != nil {
+			log.Println("[RECORD_FAILED_LOGIN]::DB_INSERT_FAILED_LOGIN_ERROR 💥")
+			return err
+		}
+
+		keys := []string{IPThrottleKey(failure.IPAddress)}
+		policies := []ThrottlePolicy{IPLoginPolicy}
+		if failure.UserID != nil {
+			keys = append(keys, AccountThrottleKey(*failure.UserID))
+			policies = append(policies, AccountLoginPolicy)
+		}
+
+		for i, key := range keys {
+			locked, err := countLoginFailure(tx, key, policies[i], failure.CreatedAt)
+			if err != nil {
+				return err
+			}
+
+			if locked.After(until) {
+				until = locked
+			}
+		}
+
+		return nil
+	})
+
+	return until, err
+}
+
+func countLoginFailure(tx *gorm.DB, key string, policy ThrottlePolicy, now time.Time) (time.Time, error) {
+	// The count is bumped in a single UPDATE so that concurrent failures
+	// cannot read the same count and both write it back plus one.
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&LoginThrottle{Key: key, LastFailureAt: now}).Error
+	if err != nil {
+		log.Println("[RECORD_FAILED_LOGIN]::DB_INSERT_LOGIN_THROTTLE_ERROR 💥")
+		return time.Time{}, err
+	}
+
+	err = tx.Model(&LoginThrottle{}).Where("throttle_key = ?", key).Updates(map[string]interface{}{
+		"failures":        gorm.Expr("CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END", now.Add(-policy.Window)),
+		"last_failure_at": now,
+	}).Error
+	if err != nil {
+		log.Println("[RECORD_FAILED_LOGIN]::DB_UPDATE_LOGIN_THROTTLE_ERROR 💥")
+		return time.Time{}, err
+	}
+
+	throttle := &LoginThrottle{}
+	if err := tx.Where("throttle_key = ?", key).Take(throttle).Error; err != nil {
+		log.Println("[RECORD_FAILED_LOGIN]::DB_SELECT_LOGIN_THROTTLE_ERROR 💥")
+		return time.Time{}, err
+	}
+
+	delay := policy.Delay(throttle.Failures)
+	if delay == 0 {
+		return time.Time{}, nil
+	}
+
+	until := now.Add(delay)
+	if err := tx.Model(&LoginThrottle{}).Where("throttle_key = ?", key).Update("locked_until", until).Error; err != nil {
+		log.Println("[RECORD_FAILED_LOGIN]::DB_UPDATE_LOGIN_THROTTLE_ERROR 💥")
+		return time.Time{}, err
+	}
+
+	return until, nil
+}
+
+// ThrottlePasswordReset counts a request to reset the password of the User
+// with the Email address from the IP address. It returns until when the request
+// has to be refused, or the zero time when it may go ahead. Refused requests
+// are not counted, and unknown addresses are counted like known ones so that
+// the throttle does not tell them apart.
+func ThrottlePasswordReset(email, ip string) (time.Time, error) {
+	return ThrottlePasswordResetContext(context.Background(), database.DBConnection, email, ip)
+}
+
+func ThrottlePasswordResetContext(ctx context.Context, db *gorm.DB, email, ip string) (time.Time, error) {
+	db = db.WithContext(ctx)
+
+	if email == "" {
+		return time.Time{}, ErrEmptyEmail
+	}
+
+	if ip == "" {
+		return time.Time{}, ErrEmptyIPAddress
+	}
+
+	keys := []string{PasswordResetThrottleKey(email), PasswordResetIPThrottleKey(ip)}
+	policies := []ThrottlePolicy{PasswordResetPolicy, PasswordResetIPPolicy}
+
+	var until time.Time
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var throttles []LoginThrottle
+		if err := tx.Where("throttle_key IN ? AND locked_until > ?", keys, now).Find(&throttles).Error; err != nil {
+			log.Println("[THROTTLE_PASSWORD_RESET]::DB_SELECT_LOGIN_THROTTLES_ERROR 💥")
+			return err
+		}
+
+		for _, throttle := range throttles {
+			if throttle.LockedUntil.After(until) {
+				until = *throttle.LockedUntil
+			}
+		}
+
+		if !until.IsZero() {
+			return nil
+		}
+
+		for i, key := range keys {
+			if _, err := countLoginFailure(tx, key, policies[i], now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return until, err
+}
+
+// UnlockUser forgets the failed logins counted against the User, after a
+// successful login or when an administrator lifts a lockout. The audit trail
+// is kept.
+func UnlockUser(userID uint) error {
+	return UnlockUserContext(context.Background(), database.DBConnection, userID)
+}
+
+func UnlockUserContext(ctx context.Context, db *gorm.DB, userID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if err := db.Where("throttle_key = ?", AccountThrottleKey(userID)).Delete(&LoginThrottle{}).Error; err != nil {
+		log.Println("[UNLOCK_USER]::DB_DELETE_LOGIN_THROTTLE_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+// ListFailedLogins returns the audit trail newest first, for one User when
+// userID is not 0 and for one address when ip is not empty.
+func ListFailedLogins(userID uint, ip string, offset, limit int) ([]FailedLogin, error) {
+	return ListFailedLoginsContext(context.Background(), database.DBConnection, userID, ip, offset, limit)
+}
+
+func ListFailedLoginsContext(ctx context.Context, db *gorm.DB, userID uint, ip string, offset, limit int) ([]FailedLogin, error) {
+	db = db.WithContext(ctx)
+
+	query := db.Order("id DESC").Offset(offset).Limit(limit)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if ip != "" {
+		query = query.Where("ip_address = ?", ip)
+	}
+
+	var failures []FailedLogin
+	if err := query.Find(&failures).Error; err != nil {
+		log.Println("[LIST_FAILED_LOGINS]::DB_SELECT_FAILED_LOGINS_ERROR 💥")
+		return nil, err
+	}
+
+	return failures, nil
+}
+
+// DeleteStaleLoginThrottles removes the counters that are neither locked nor
+// within the window of either policy.
+func DeleteStaleLoginThrottles() error {
+	return DeleteStaleLoginThrottlesContext(context.Background(), database.DBConnection)
+}
+
+func DeleteStaleLoginThrottlesContext(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+
+	var window time.Duration
+	for _, policy := range []ThrottlePolicy{AccountLoginPolicy, IPLoginPolicy, PasswordResetPolicy, PasswordResetIPPolicy} {
+		if policy.Window > window {
+			window = policy.Window
+		}
+	}
+
+	now := time.Now()
+	err := db.
+		Where("(locked_until IS NULL OR locked_until <= ?) AND last_failure_at <= ?", now, now.Add(-window)).
+		Delete(&LoginThrottle{}).Error
+
+	if err != nil {
+		log.Println("[DELETE_STALE_LOGIN_THROTTLES]::DB_DELETE_LOGIN_THROTTLES_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+func DeleteFailedLoginsBefore(before time.Time) error {
+	return DeleteFailedLoginsBeforeContext(context.Background(), database.DBConnection, before)
+}
+
+func DeleteFailedLoginsBeforeContext(ctx context.Context, db *gorm.DB, before time.Time) error {
+	db = db.WithContext(ctx)
+
+	if err := db.Where("created_at < ?", before).Delete(&FailedLogin{}).Error; err != nil {
+		log.Println("[DELETE_FAILED_LOGINS_BEFORE]::DB_DELETE_FAILED_LOGINS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// timeNear matches a time.Time argument within a second of the expected one.
+type timeNear struct {
+	time.Time
+}
+
+func (t timeNear) Match(v driver.Value) bool {
+	actual, ok := v.(time.Time)
+	return ok && actual.Sub(t.Time) < time.Second && t.Time.Sub(actual) < time.Second
+}
+
+var _ = Describe("LoginThrottle", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	expectCountLoginFailure := func(key string, failures int) {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `login_throttles` (`throttle_key`,`failures`,`last_failure_at`,`locked_until`) VALUES (?,?,?,?) ON CONFLICT DO NOTHING")).
+			WithArgs(key, 0, sqlmock.AnyArg(), nil).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `login_throttles` SET `failures`=CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,`last_failure_at`=? WHERE throttle_key = ?")).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), key).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_throttles` WHERE throttle_key = ? LIMIT 1")).
+			WithArgs(key).
+			WillReturnRows(sqlmock.NewRows([]string{"throttle_key", "failures"}).AddRow(key, failures))
+	}
+
+	Context("ThrottlePolicy.Delay", func() {
+		policy := ThrottlePolicy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+		It("should let the free attempts through", func() {
+			Expect(policy.Delay(0)).Should(BeZero())
+			Expect(policy.Delay(3)).Should(BeZero())
+		})
+
+		It("should double the delay with every further failure up to MaxDelay", func() {
+			Expect(policy.Delay(4)).Should(Equal(time.Second))
+			Expect(policy.Delay(5)).Should(Equal(2 * time.Second))
+			Expect(policy.Delay(7)).Should(Equal(8 * time.Second))
+			Expect(policy.Delay(8)).Should(Equal(10 * time.Second))
+			Expect(policy.Delay(1000)).Should(Equal(10 * time.Second))
+		})
+	})
+
+	Context("LoginLockedUntil", func() {
+		It("should return the latest lock of the User and the address", func() {
+			soon := time.Now().Add(time.Minute)
+			later := time.Now().Add(time.Hour)
+
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_throttles` WHERE throttle_key IN (?,?) AND locked_until > ?")).
+				WithArgs("ip:10.0.0.1", "user:4", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"throttle_key", "failures", "locked_until"}).
+					AddRow("ip:10.0.0.1", 21, soon).
+					AddRow("user:4", 9, later))
+
+			until, err := LoginLockedUntil(4, "10.0.0.1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(until).Should(BeTemporally("==", later))
+		})
+
+		It("should return the zero time when nothing is locked", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_throttles` WHERE throttle_key IN (?) AND locked_until > ?")).
+				WithArgs("ip:10.0.0.1", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"throttle_key"}))
+
+			until, err := LoginLockedUntil(0, "10.0.0.1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(until.IsZero()).Should(BeTrue())
+		})
+	})
+
+	Context("RecordFailedLogin", func() {
+		When("the identifier matches a User", func() {
+			It("should audit the failure and count it against the address and the User", func() {
+				userID := uint(4)
+				policy := AccountLoginPolicy
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `failed_logins` (`created_at`,`identifier`,`reason`,`ip_address`,`user_id`) VALUES (?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), "JonSnow", LoginFailurePassword, "10.0.0.1", 4).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectCountLoginFailure("ip:10.0.0.1", 1)
+				expectCountLoginFailure("user:4", policy.FreeAttempts+1)
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `login_throttles` SET `locked_until`=? WHERE throttle_key = ?")).
+					WithArgs(sqlmock.AnyArg(), "user:4").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				until, err := RecordFailedLogin(&FailedLogin{Identifier: "JonSnow", Reason: LoginFailurePassword, IPAddress: "10.0.0.1", UserID: &userID})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(until).Should(BeTemporally("~", time.Now().Add(policy.BaseDelay), time.Second))
+			})
+		})
+
+		When("the last failure is older than the window", func() {
+			It("should start counting again", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `failed_logins`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `login_throttles` (`throttle_key`,`failures`,`last_failure_at`,`locked_until`) VALUES (?,?,?,?) ON CONFLICT DO NOTHING")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `login_throttles` SET `failures`=CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,`last_failure_at`=? WHERE throttle_key = ?")).
+					WithArgs(timeNear{time.Now().Add(-IPLoginPolicy.Window)}, sqlmock.AnyArg(), "ip:10.0.0.1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_throttles` WHERE throttle_key = ? LIMIT 1")).
+					WithArgs("ip:10.0.0.1").
+					WillReturnRows(sqlmock.NewRows([]string{"throttle_key", "failures"}).AddRow("ip:10.0.0.1", 1))
+				mock.ExpectCommit()
+
+				until, err := RecordFailedLogin(&FailedLogin{Identifier: "nobody", Reason: LoginFailureUnknownUser, IPAddress: "10.0.0.1"})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(until.IsZero()).Should(BeTrue())
+			})
+		})
+
+		When("the IPAddress is empty", func() {
+			It("should return ErrEmptyIPAddress without executing any sql", func() {
+				_, err := RecordFailedLogin(&FailedLogin{Identifier: "JonSnow", Reason: LoginFailurePassword})
+				Expect(err).Should(Equal(ErrEmptyIPAddress))
+			})
+		})
+	})
+
+	Context("ThrottlePasswordReset", func() {
+		key := PasswordResetThrottleKey("Jon@NightsWatch.org")
+
+		It("should count the request against the address and the IP address", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_throttles` WHERE throttle_key IN (?,?) AND locked_until > ?")).
+				WithArgs(key, "reset-ip:10.0.0.1", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"throttle_key"}))
+			for _, k := range []string{key, "reset-ip:10.0.0.1"} {
+				expectCountLoginFailure(k, 1)
+			}
+			mock.ExpectCommit()
+
+			until, err := ThrottlePasswordReset("jon@nightswatch.org", "10.0.0.1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(until.IsZero()).Should(BeTrue())
+		})
+
+		It("should refuse the request without counting it while either is locked", func() {
+			later := time.Now().Add(time.Hour)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `login_throttles` WHERE throttle_key IN (?,?) AND locked_until > ?")).
+				WithArgs(key, "reset-ip:10.0.0.1", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"throttle_key", "failures", "locked_until"}).AddRow(key, 3, later))
+			mock.ExpectCommit()
+
+			until, err := ThrottlePasswordReset("jon@nightswatch.org", "10.0.0.1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(until).Should(BeTemporally("==", later))
+		})
+
+		It("should keep the key of a long address short", func() {
+			Expect(len(PasswordResetThrottleKey(strings.Repeat("a", 250) + "@example.org"))).Should(BeNumerically("<=", 64))
+		})
+	})
+
+	Context("UnlockUser", func() {
+		It("should forget the failures counted against the User", func() {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `login_throttles` WHERE throttle_key = ?")).
+				WithArgs("user:4").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			Expect(UnlockUser(4)).Should(Succeed())
+		})
+
+		It("should return ErrEmptyUserID without executing any sql", func() {
+			Expect(UnlockUser(0)).Should(Equal(ErrEmptyUserID))
+		})
+	})
+
+	Context("ListFailedLogins", func() {
+		It("should filter by User and address", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `failed_logins` WHERE user_id = ? AND ip_address = ? ORDER BY id DESC LIMIT 10 OFFSET 20")).
+				WithArgs(4, "10.0.0.1").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "identifier"}).AddRow(9, "JonSnow"))
+
+			failures, err := ListFailedLogins(4, "10.0.0.1", 20, 10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(failures).Should(HaveLen(1))
+		})
+	})
+
+	Context("DeleteStaleLoginThrottles", func() {
+		It("should delete the unlocked counters outside of the window", func() {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `login_throttles` WHERE (locked_until IS NULL OR locked_until <= ?) AND last_failure_at <= ?")).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+
+			Expect(DeleteStaleLoginThrottles()).Should(Succeed())
+		})
+	})
+
+	Context("DeleteFailedLoginsBefore", func() {
+		It("should delete the audit trail older than the given time", func() {
+			before := time.Now().Add(-24 * time.Hour)
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `failed_logins` WHERE created_at < ?")).
+				WithArgs(before).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+
+			Expect(DeleteFailedLoginsBefore(before)).Should(Succeed())
+		})
+	})
+})
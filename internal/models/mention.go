@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/mentions"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// Mention records that a Post pings a User by writing @UserName. Mentions in
+// links and code do not count.
+type Mention struct {
+	PostID    uint `gorm:"primaryKey"`
+	Post      Post `gorm:"foreignKey:PostID"`
+	UserID    uint `gorm:"primaryKey;index"`
+	User      User `gorm:"foreignKey:UserID"`
+	CreatedAt time.Time
+}
+
+// LinkMentions links the mentions in contentHTML of the names in userIDs to
+// the profile of their User. Other mentions are left as text.
+func LinkMentions(contentHTML string, userIDs map[string]uint) string {
+	return mentions.Link(contentHTML, func(name string) (string, bool) {
+		id, ok := userIDs[name]
+		return fmt.Sprintf("/api/v1/users/%d", id), ok
+	})
+}
+
+// mentionUsers looks up the Users mentioned in the rendered post, links the
+// mentions to them and sets the Mentions of post, to be stored with it.
+func mentionUsers(tx *gorm.DB, post *Post) error {
+	post.Mentions = nil
+
+	names := mentions.Names(post.ContentHTML)
+	if len(names) == 0 {
+		return nil
+	}
+
+	var users []User
+	if err := tx.Select("id", "user_name").Where("user_name IN ?", names).Find(&users).Error; err != nil {
+		return err
+	}
+
+	userIDs := make(map[string]uint, len(users))
+	for _, user := range users {
+		userIDs[user.UserName] = user.ID
+	}
+
+	post.ContentHTML = LinkMentions(post.ContentHTML, userIDs)
+	for _, name := range names {
+		if id, ok := userIDs[name]; ok {
+			post.Mentions = append(post.Mentions, Mention{PostID: post.ID, UserID: id})
+		}
+	}
+
+	return nil
+}
+
+func createMentions(tx *gorm.DB, post *Post) error {
+	if len(post.Mentions) == 0 {
+		return nil
+	}
+
+	for i := range post.Mentions {
+		post.Mentions[i].PostID = post.ID
+	}
+
+	return tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&post.Mentions).Error
+}
+
+// ListMentions lists the Posts that mention the User, newest first. A nil
+// topicIDs lists the Posts of every Topic, an empty one none.
+func ListMentions(userID uint, topicIDs []uint, offset, limit int) ([]Post, error) {
+	return ListMentionsContext(context.Background(), database.DBConnection, userID, topicIDs, offset, limit)
+}
+
+func ListMentionsContext(ctx context.Context, db *gorm.DB, userID uint, topicIDs []uint, offset, limit int) ([]Post, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	if topicIDs != nil && len(topicIDs) == 0 {
+		return []Post{}, nil
+	}
+
+	query := db.
+		Joins("JOIN mentions ON mentions.post_id = posts.id").
+		Joins("JOIN discussions ON discussions.id = posts.discussion_id AND discussions.deleted_at IS NULL").
+		Where("mentions.user_id = ?", userID)
+
+	if topicIDs != nil {
+		query = query.Where("discussions.topic_id IN ?", topicIDs)
+	}
+
+	var posts []Post
+	if err := query.Order("posts.id DESC").Offset(offset).Limit(limit).Find(&posts).Error; err != nil {
+		log.Println("[LIST_MENTIONS]::DB_SELECT_POSTS_ERROR 💥")
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// DeleteMentions forgets that the Post mentions the Users, which leaves the
+// links in its ContentHTML.
+func DeleteMentions(postID uint, userIDs []uint) error {
+	return DeleteMentionsContext(context.Background(), database.DBConnection, postID, userIDs)
+}
+
+func DeleteMentionsContext(ctx context.Context, db *gorm.DB, postID uint, userIDs []uint) error {
+	db = db.WithContext(ctx)
+
+	if postID == 0 {
+		return ErrEmptyPostID
+	}
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	if err := db.Where("post_id = ? AND user_id IN ?", postID, userIDs).Delete(&Mention{}).Error; err != nil {
+		log.Println("[DELETE_MENTIONS]::DB_DELETE_MENTIONS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
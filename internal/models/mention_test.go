@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Mention", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("CreatePost", func() {
+		It("should link the mentioned Users and record who was mentioned", func() {
+			post := &Post{Content: "Thanks @arya and @nobody, ask @arya", AuthorID: 10, DiscussionID: 20}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_name` FROM `users` WHERE user_name IN (?,?) AND `users`.`deleted_at` IS NULL")).
+				WithArgs("arya", "nobody").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(12, "arya"))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts`")).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, PostFormatMarkdown,
+					`<p>Thanks <a href="/api/v1/users/12" class="mention">@arya</a> and @nobody, ask <a href="/api/v1/users/12" class="mention">@arya</a></p>`+"\n",
+					10, 20, nil).
+				WillReturnResult(sqlmock.NewResult(3, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `mentions` (`post_id`,`user_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
+				WithArgs(3, 12, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+				WillReturnResult(sqlmock.NewResult(4, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions`")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(CreatePost(post)).Should(Succeed())
+			Expect(post.Mentions).Should(Equal([]Mention{{PostID: 3, UserID: 12, CreatedAt: post.Mentions[0].CreatedAt}}))
+		})
+
+		It("should not look up mentions in code", func() {
+			post := &Post{Content: "`@arya`", AuthorID: 10, DiscussionID: 20}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts`")).
+				WillReturnResult(sqlmock.NewResult(3, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+				WillReturnResult(sqlmock.NewResult(4, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions`")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(CreatePost(post)).Should(Succeed())
+			Expect(post.Mentions).Should(BeEmpty())
+		})
+	})
+
+	Context("ListMentions", func() {
+		It("should list the Posts mentioning the User in the Topics, newest first", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `posts`.`id`,`posts`.`created_at`,`posts`.`updated_at`,`posts`.`deleted_at`,`posts`.`content`,`posts`.`format`,`posts`.`content_html`,`posts`.`author_id`,`posts`.`discussion_id`,`posts`.`reply_to_id` FROM `posts` JOIN mentions ON mentions.post_id = posts.id JOIN discussions ON discussions.id = posts.discussion_id AND discussions.deleted_at IS NULL WHERE mentions.user_id = ? AND discussions.topic_id IN (?,?) AND `posts`.`deleted_at` IS NULL ORDER BY posts.id DESC LIMIT 20")).
+				WithArgs(12, 1, 2).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "author_id"}).AddRow(5, 10).AddRow(3, 11))
+
+			posts, err := ListMentions(12, []uint{1, 2}, 0, 20)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(posts).Should(HaveLen(2))
+			Expect(posts[0].ID).Should(BeEquivalentTo(5))
+		})
+
+		It("should return no Posts without executing any sql for no Topics", func() {
+			Expect(ListMentions(12, []uint{}, 0, 20)).Should(BeEmpty())
+		})
+
+		It("should return ErrEmptyUserID without executing any sql", func() {
+			_, err := ListMentions(0, nil, 0, 20)
+			Expect(err).Should(Equal(ErrEmptyUserID))
+		})
+	})
+
+	Context("DeleteMentions", func() {
+		It("should delete the Mentions of the Users by the Post", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `mentions` WHERE post_id = ? AND user_id IN (?,?)")).
+				WithArgs(5, 12, 13).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectCommit()
+
+			Expect(DeleteMentions(5, []uint{12, 13})).Should(Succeed())
+		})
+
+		It("should do nothing without executing any sql for no Users", func() {
+			Expect(DeleteMentions(5, nil)).Should(Succeed())
+		})
+
+		It("should return ErrEmptyPostID without executing any sql", func() {
+			Expect(DeleteMentions(0, []uint{12})).Should(Equal(ErrEmptyPostID))
+		})
+	})
+})
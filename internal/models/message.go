@@ -0,0 +1,203 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"log"
+	"time"
+	"unicode/utf8"
+)
+
+// Message is written by one participant of a Conversation to the others. It
+// keeps its Conversation when its Author is purged.
+type Message struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	Conversation   Conversation `gorm:"foreignKey:ConversationID"`
+	ConversationID uint         `gorm:"not null;index"`
+	Author         *User        `gorm:"foreignKey:AuthorID"`
+	AuthorID       *uint        `gorm:"index"`
+	Content        string       `gorm:"size:4096"`
+	Format         string       `gorm:"size:16;not null"`
+	ContentHTML    string       `gorm:"type:text"`
+}
+
+type conversationCount struct {
+	ConversationID uint
+	Count          int64
+}
+
+func renderMessage(message *Message) error {
+	if message.Format == "" {
+		message.Format = PostFormatMarkdown
+	}
+
+	rendered, err := RenderContent(message.Format, message.Content)
+	if err != nil {
+		return err
+	}
+
+	message.ContentHTML = rendered
+	return nil
+}
+
+// SendMessage adds message to its Conversation, which its Author must take
+// part in, and marks it read for them.
+func SendMessage(message *Message) error {
+	return SendMessageContext(context.Background(), database.DBConnection, message)
+}
+
+func SendMessageContext(ctx context.Context, db *gorm.DB, message *Message) error {
+	db = db.WithContext(ctx)
+
+	if message.ConversationID == 0 {
+		return ErrEmptyConversationID
+	}
+
+	if message.AuthorID == nil || *message.AuthorID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if message.Content == "" {
+		return ErrEmptyContent
+	}
+
+	if utf8.RuneCountInString(message.Content) > MaxContentLength {
+		return ErrContentTooLong
+	}
+
+	if err := renderMessage(message); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := takeParticipant(tx, message.ConversationID, *message.AuthorID); err != nil {
+			return err
+		}
+
+		if err := tx.Omit("Conversation", "Author").Create(message).Error; err != nil {
+			log.Println("[SEND_MESSAGE]::DB_INSERT_MESSAGE_ERROR 💥")
+			return err
+		}
+
+		err := tx.Model(&Conversation{}).
+			Where("id = ?", message.ConversationID).
+			Updates(map[string]interface{}{"last_message_id": message.ID, "updated_at": message.CreatedAt}).Error
+		if err != nil {
+			log.Println("[SEND_MESSAGE]::DB_UPDATE_CONVERSATION_ERROR 💥")
+			return err
+		}
+
+		return updateParticipant(tx, message.ConversationID, *message.AuthorID, map[string]interface{}{"last_read_message_id": message.ID})
+	})
+}
+
+// ListMessages lists the Messages of a Conversation its participant userID
+// sees, oldest first: those since they last deleted it, from Users they have
+// not blocked.
+func ListMessages(conversationID, userID uint, offset, limit int) ([]Message, error) {
+	return ListMessagesContext(context.Background(), database.DBConnection, conversationID, userID, offset, limit)
+}
+
+func ListMessagesContext(ctx context.Context, db *gorm.DB, conversationID, userID uint, offset, limit int) ([]Message, error) {
+	db = db.WithContext(ctx)
+
+	if conversationID == 0 {
+		return nil, ErrEmptyConversationID
+	}
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	participant, err := takeParticipant(db, conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	err = db.
+		Where("conversation_id = ? AND id > ?", conversationID, participant.ClearedMessageID).
+		Where("author_id IS NULL OR author_id NOT IN (?)", blockedBy(db, userID)).
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&messages).Error
+
+	if err != nil {
+		log.Println("[LIST_MESSAGES]::DB_SELECT_MESSAGES_ERROR 💥")
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// CountUnreadMessages returns how many Messages the User has not read in each
+// of the Conversations. Conversations without unread Messages are left out.
+func CountUnreadMessages(userID uint, conversationIDs []uint) (map[uint]int64, error) {
+	return CountUnreadMessagesContext(context.Background(), database.DBConnection, userID, conversationIDs)
+}
+
+func CountUnreadMessagesContext(ctx context.Context, db *gorm.DB, userID uint, conversationIDs []uint) (map[uint]int64, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	counts := map[uint]int64{}
+	if len(conversationIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []conversationCount
+	err := unreadMessages(db, userID).
+		Select("messages.conversation_id, COUNT(*) AS count").
+		Where("messages.conversation_id IN ?", conversationIDs).
+		Group("messages.conversation_id").
+		Scan(&rows).Error
+
+	if err != nil {
+		log.Println("[COUNT_UNREAD_MESSAGES]::DB_SELECT_MESSAGE_COUNTS_ERROR 💥")
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.ConversationID] = row.Count
+	}
+
+	return counts, nil
+}
+
+// CountAllUnreadMessages returns how many Messages the User has not read in
+// the Conversations they have not muted.
+func CountAllUnreadMessages(userID uint) (int64, error) {
+	return CountAllUnreadMessagesContext(context.Background(), database.DBConnection, userID)
+}
+
+func CountAllUnreadMessagesContext(ctx context.Context, db *gorm.DB, userID uint) (int64, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return 0, ErrEmptyUserID
+	}
+
+	var count int64
+	if err := unreadMessages(db, userID).Where("conversation_participants.muted = ?", false).Count(&count).Error; err != nil {
+		log.Println("[COUNT_ALL_UNREAD_MESSAGES]::DB_SELECT_MESSAGE_COUNT_ERROR 💥")
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// unreadMessages selects the Messages the User has neither read, written,
+// deleted, nor hidden by blocking their Author.
+func unreadMessages(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Model(&Message{}).
+		Joins("JOIN conversation_participants ON conversation_participants.conversation_id = messages.conversation_id AND conversation_participants.user_id = ?", userID).
+		Where("messages.id > conversation_participants.last_read_message_id AND messages.id > conversation_participants.cleared_message_id").
+		Where("messages.author_id IS NULL OR messages.author_id NOT IN (?)", blockedBy(db, userID)).
+		Where("messages.author_id IS NULL OR messages.author_id <> ?", userID)
+}
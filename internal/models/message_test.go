@@ -0,0 +1,114 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Message", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("SendMessage", func() {
+		It("should add the Message and mark it read for its author", func() {
+			authorID := uint(10)
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversation_participants` WHERE conversation_id = ? AND user_id = ? LIMIT 1")).
+				WithArgs(1, 10).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id"}).AddRow(1, 10))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `messages` (`created_at`,`conversation_id`,`author_id`,`content`,`format`,`content_html`) VALUES (?,?,?,?,?,?)")).
+				WithArgs(sqlmock.AnyArg(), 1, 10, "hodor", "plain", "<p>hodor</p>\n").
+				WillReturnResult(sqlmock.NewResult(8, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `conversations` SET `last_message_id`=?,`updated_at`=? WHERE id = ?")).
+				WithArgs(8, sqlmock.AnyArg(), 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `conversation_participants` SET `last_read_message_id`=? WHERE conversation_id = ? AND user_id = ?")).
+				WithArgs(8, 1, 10).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			message := &Message{ConversationID: 1, AuthorID: &authorID, Content: "hodor", Format: PostFormatPlain}
+			Expect(SendMessage(message)).Should(Succeed())
+			Expect(message.ID).Should(Equal(uint(8)))
+		})
+
+		It("should return ErrNotParticipant when the author does not take part", func() {
+			authorID := uint(10)
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversation_participants`")).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id"}))
+			mock.ExpectRollback()
+
+			Expect(SendMessage(&Message{ConversationID: 1, AuthorID: &authorID, Content: "hodor"})).Should(Equal(ErrNotParticipant))
+		})
+
+		It("should return ErrEmptyConversationID without executing any sql", func() {
+			authorID := uint(10)
+			Expect(SendMessage(&Message{AuthorID: &authorID, Content: "hodor"})).Should(Equal(ErrEmptyConversationID))
+		})
+	})
+
+	Context("ListMessages", func() {
+		It("should list the Messages since the User deleted the Conversation, leaving out blocked Users", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `conversation_participants` WHERE conversation_id = ? AND user_id = ? LIMIT 1")).
+				WithArgs(1, 10).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "user_id", "cleared_message_id"}).AddRow(1, 10, 4))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `messages` WHERE (conversation_id = ? AND id > ?) AND (author_id IS NULL OR author_id NOT IN (SELECT `blocked_user_id` FROM `user_blocks` WHERE user_id = ?)) ORDER BY id LIMIT 20")).
+				WithArgs(1, 4, 10).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "content"}).AddRow(5, 1, "hodor"))
+
+			messages, err := ListMessages(1, 10, 0, 20)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(messages).Should(HaveLen(1))
+		})
+	})
+
+	Context("CountUnreadMessages", func() {
+		It("should count the unread Messages of each Conversation", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT messages.conversation_id, COUNT(*) AS count FROM `messages` JOIN conversation_participants ON conversation_participants.conversation_id = messages.conversation_id AND conversation_participants.user_id = ? WHERE (messages.id > conversation_participants.last_read_message_id AND messages.id > conversation_participants.cleared_message_id) AND (messages.author_id IS NULL OR messages.author_id NOT IN (SELECT `blocked_user_id` FROM `user_blocks` WHERE user_id = ?)) AND (messages.author_id IS NULL OR messages.author_id <> ?) AND messages.conversation_id IN (?,?) GROUP BY `messages`.`conversation_id`")).
+				WithArgs(10, 10, 10, 1, 2).
+				WillReturnRows(sqlmock.NewRows([]string{"conversation_id", "count"}).AddRow(2, 3))
+
+			counts, err := CountUnreadMessages(10, []uint{1, 2})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(counts).Should(Equal(map[uint]int64{2: 3}))
+		})
+	})
+
+	Context("CountAllUnreadMessages", func() {
+		It("should count the unread Messages of the Conversations that are not muted", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `messages` JOIN conversation_participants")).
+				WithArgs(10, 10, 10, false).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+			count, err := CountAllUnreadMessages(10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).Should(Equal(int64(4)))
+		})
+	})
+})
@@ -2,18 +2,61 @@ package models
 
 import "errors"
 
+var ErrEmptyID = errors.New("empty ID not allowed")
 var ErrEmptyUserID = errors.New("empty UserID/AuthorID not allowed")
 var ErrEmptyUserName = errors.New("empty UserName not allowed")
+var ErrEmptyDisplayName = errors.New("empty DisplayName not allowed")
+var ErrEmptyEmail = errors.New("empty Email not allowed")
 var ErrEmptyPassword = errors.New("empty Password not allowed")
 var ErrEmptyName = errors.New("empty Name not allowed")
 var ErrEmptyTitle = errors.New("empty Title not allowed")
 var ErrEmptyContent = errors.New("empty Content not allowed")
+var ErrContentTooLong = errors.New("Content is too long")
 var ErrEmptyDiscussionID = errors.New("empty DiscussionID not allowed")
 var ErrEmptyTopicID = errors.New("empty TopicID not allowed")
 var ErrDiscussionWithoutSinglePost = errors.New("a Discussion must be created with a single Post")
+var ErrTopicNotEmpty = errors.New("a Topic with sub-Topics or Discussions cannot be deleted")
+var ErrDeletedParent = errors.New("cannot restore a record whose parent is deleted")
+var ErrUserHasOwnership = errors.New("a User who authored Topics or Groups cannot be purged")
+var ErrEmptyExpiresAt = errors.New("empty ExpiresAt not allowed")
+var ErrEmptyToken = errors.New("empty token not allowed")
+var ErrInvalidSession = errors.New("session does not exist or has expired")
+var ErrTopicCycle = errors.New("a Topic cannot be moved under itself or one of its sub-Topics")
+var ErrTopicTooDeep = errors.New("Topics cannot be nested that deeply")
+var ErrUnknownAction = errors.New("unknown permission action")
+var ErrInvalidEmail = errors.New("invalid Email address")
+var ErrInvalidToken = errors.New("token is invalid, used or expired")
+var ErrEmailVerified = errors.New("Email is already verified")
+var ErrEmailNotVerified = errors.New("Email is not verified")
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+var ErrTwoFactorRequired = errors.New("two-factor authentication is required for a Group of the User")
+var ErrInvalidTwoFactorCode = errors.New("two-factor code is invalid or was already used")
+var ErrEmptyScopes = errors.New("empty Scopes not allowed")
+var ErrInvalidAPIToken = errors.New("API token is invalid or has expired")
+var ErrEmptyIssuer = errors.New("empty Issuer not allowed")
+var ErrEmptySubject = errors.New("empty Subject not allowed")
+var ErrIdentityLinked = errors.New("the Identity is already linked to another User")
+var ErrUserDeleted = errors.New("the User has been deleted")
+var ErrEmptyIPAddress = errors.New("empty IPAddress not allowed")
+var ErrUnknownFormat = errors.New("unknown Post Format")
+var ErrReasonTooLong = errors.New("Reason is too long")
+var ErrEmptyPostID = errors.New("empty PostID not allowed")
+var ErrUnknownReaction = errors.New("unknown reaction type")
+var ErrEmptyConversationID = errors.New("empty ConversationID not allowed")
+var ErrConversationWithoutMessage = errors.New("a Conversation must be created with a single Message")
+var ErrNoRecipients = errors.New("a Conversation needs a participant other than its author")
+var ErrNotParticipant = errors.New("the User does not take part in the Conversation")
+var ErrUserBlocked = errors.New("one of the Users has blocked the other")
+var ErrBlockSelf = errors.New("Users cannot block themselves")
+var ErrEmptyQuery = errors.New("empty search Query not allowed")
+var ErrUnknownNotificationType = errors.New("unknown Notification type")
+var ErrReplyOutsideDiscussion = errors.New("a Post can only reply to a Post of the same Discussion")
+var ErrUnknownEmailDelivery = errors.New("unknown email delivery")
+var ErrLatestRevision = errors.New("the latest PostRevision is the Post's Content and cannot be hidden")
 
 func Models() []interface{} {
 	return []interface{}{
-		&Discussion{}, &Email{}, &Group{}, &Post{}, &Topic{}, &User{},
+		&APIToken{}, &Conversation{}, &ConversationParticipant{}, &Discussion{}, &DiscussionRead{}, &DiscussionSubscription{}, &Email{}, &EmailVerification{}, &FailedLogin{}, &Group{}, &Identity{}, &LoginThrottle{}, &Mention{}, &Message{}, &Notification{}, &NotificationPreference{}, &OutboundEmail{}, &PasswordReset{}, &Permission{}, &Post{}, &PostRevision{}, &Reaction{}, &RecoveryCode{}, &Session{}, &Topic{}, &TopicRead{}, &TopicSubscription{}, &TwoFactor{}, &User{}, &UserBlock{},
 	}
 }
@@ -0,0 +1,534 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// NotificationTypePost is a new Post in a watched Discussion or Topic.
+	NotificationTypePost = "post"
+	// NotificationTypeReply is a Post replying to one of the User's Posts.
+	NotificationTypeReply = "reply"
+	// NotificationTypeQuote is a reply that quotes the Post it replies to.
+	NotificationTypeQuote = "quote"
+	// NotificationTypeMention is a Post that mentions the User by name.
+	NotificationTypeMention = "mention"
+)
+
+// NotificationTypes lists every type of Notification, from the least to the
+// most specific. A Post that concerns a User in several ways notifies them
+// once, with the most specific type.
+var NotificationTypes = []string{NotificationTypePost, NotificationTypeReply, NotificationTypeQuote, NotificationTypeMention}
+
+const (
+	// EmailDeliveryOff never mails Notifications of the type.
+	EmailDeliveryOff = "off"
+	// EmailDeliveryImmediate mails them as soon as the outbox is next polled.
+	EmailDeliveryImmediate = "immediate"
+	// EmailDeliveryHourly collects them in a digest sent at the top of the hour.
+	EmailDeliveryHourly = "hourly"
+	// EmailDeliveryDaily collects them in a digest sent at midnight UTC.
+	EmailDeliveryDaily = "daily"
+)
+
+var EmailDeliveries = []string{EmailDeliveryOff, EmailDeliveryImmediate, EmailDeliveryHourly, EmailDeliveryDaily}
+
+// Notification tells a User in their inbox that Actor wrote a Post which
+// concerns them. It goes away with the Post. EmailDueAt is when it should be
+// mailed to them, and is cleared once it has been queued in the outbox.
+type Notification struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	User         User       `gorm:"foreignKey:UserID"`
+	UserID       uint       `gorm:"not null;index"`
+	Type         string     `gorm:"size:16;not null"`
+	Actor        User       `gorm:"foreignKey:ActorID"`
+	ActorID      uint       `gorm:"not null;index"`
+	Discussion   Discussion `gorm:"foreignKey:DiscussionID"`
+	DiscussionID uint       `gorm:"not null;index"`
+	Post         Post       `gorm:"foreignKey:PostID"`
+	PostID       uint       `gorm:"not null;index"`
+	ReadAt       *time.Time
+	EmailDueAt   *time.Time `gorm:"index"`
+}
+
+// NotificationPreference records whether a User wants Notifications of a
+// type in their inbox, and how those are mailed to them. Without one, every
+// type is delivered and DefaultEmailDelivery applies.
+type NotificationPreference struct {
+	UserID uint   `gorm:"primaryKey"`
+	User   User   `gorm:"foreignKey:UserID"`
+	Type   string `gorm:"primaryKey;size:16"`
+	InApp  bool   `gorm:"not null"`
+	Email  string `gorm:"size:16;not null;default:'off'"`
+}
+
+type notificationKey struct {
+	UserID uint
+	Type   string
+}
+
+func IsNotificationType(notificationType string) bool {
+	for _, t := range NotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsEmailDelivery(delivery string) bool {
+	for _, d := range EmailDeliveries {
+		if d == delivery {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DefaultEmailDelivery mails what concerns the User directly right away, and
+// new Posts of what they watch in a daily digest.
+func DefaultEmailDelivery(notificationType string) string {
+	if notificationType == NotificationTypePost {
+		return EmailDeliveryDaily
+	}
+
+	return EmailDeliveryImmediate
+}
+
+// EmailDueAt returns when a Notification created at now is due to be mailed
+// with the delivery, or nil if it is not mailed at all.
+func EmailDueAt(delivery string, now time.Time) *time.Time {
+	var due time.Time
+	switch delivery {
+	case EmailDeliveryImmediate:
+		due = now
+	case EmailDeliveryHourly:
+		due = now.Truncate(time.Hour).Add(time.Hour)
+	case EmailDeliveryDaily:
+		now = now.UTC()
+		due = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	default:
+		return nil
+	}
+
+	return &due
+}
+
+// Notify stores the Notifications whose Users have not turned their type off
+// and returns those it stored, due to be mailed as their Users prefer.
+func Notify(notifications []Notification) ([]Notification, error) {
+	return NotifyContext(context.Background(), database.DBConnection, notifications)
+}
+
+func NotifyContext(ctx context.Context, db *gorm.DB, notifications []Notification) ([]Notification, error) {
+	db = db.WithContext(ctx)
+
+	userIDs := make([]uint, len(notifications))
+	for i, notification := range notifications {
+		if notification.UserID == 0 || notification.ActorID == 0 {
+			return nil, ErrEmptyUserID
+		}
+
+		if notification.PostID == 0 {
+			return nil, ErrEmptyPostID
+		}
+
+		if notification.DiscussionID == 0 {
+			return nil, ErrEmptyDiscussionID
+		}
+
+		if !IsNotificationType(notification.Type) {
+			return nil, ErrUnknownNotificationType
+		}
+
+		userIDs[i] = notification.UserID
+	}
+
+	if len(notifications) == 0 {
+		return notifications, nil
+	}
+
+	var stored []NotificationPreference
+	if err := db.Where("user_id IN ?", userIDs).Find(&stored).Error; err != nil {
+		log.Println("[NOTIFY]::DB_SELECT_NOTIFICATION_PREFERENCES_ERROR 💥")
+		return nil, err
+	}
+
+	preferences := map[notificationKey]NotificationPreference{}
+	for _, preference := range stored {
+		preferences[notificationKey{UserID: preference.UserID, Type: preference.Type}] = preference
+	}
+
+	now := time.Now()
+	wanted := []Notification{}
+	for _, notification := range notifications {
+		preference, ok := preferences[notificationKey{UserID: notification.UserID, Type: notification.Type}]
+		if !ok {
+			preference = defaultNotificationPreference(notification.UserID, notification.Type)
+		}
+
+		if preference.InApp {
+			notification.EmailDueAt = EmailDueAt(preference.Email, now)
+			wanted = append(wanted, notification)
+		}
+	}
+
+	if len(wanted) == 0 {
+		return wanted, nil
+	}
+
+	if err := db.Omit(clause.Associations).CreateInBatches(&wanted, 100).Error; err != nil {
+		log.Println("[NOTIFY]::DB_INSERT_NOTIFICATIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return wanted, nil
+}
+
+// ListNotifications lists the User's Notifications, newest first, or only
+// those they have not read.
+func ListNotifications(userID uint, unreadOnly bool, offset, limit int) ([]Notification, error) {
+	return ListNotificationsContext(context.Background(), database.DBConnection, userID, unreadOnly, offset, limit)
+}
+
+func ListNotificationsContext(ctx context.Context, db *gorm.DB, userID uint, unreadOnly bool, offset, limit int) ([]Notification, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	query := db.Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []Notification
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&notifications).Error; err != nil {
+		log.Println("[LIST_NOTIFICATIONS]::DB_SELECT_NOTIFICATIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func CountUnreadNotifications(userID uint) (int64, error) {
+	return CountUnreadNotificationsContext(context.Background(), database.DBConnection, userID)
+}
+
+func CountUnreadNotificationsContext(ctx context.Context, db *gorm.DB, userID uint) (int64, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return 0, ErrEmptyUserID
+	}
+
+	var count int64
+	if err := db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error; err != nil {
+		log.Println("[COUNT_UNREAD_NOTIFICATIONS]::DB_COUNT_NOTIFICATIONS_ERROR 💥")
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// SetNotificationRead marks one of the User's Notifications read or unread.
+// Marking it read again keeps the time it was first read.
+func SetNotificationRead(id, userID uint, read bool) error {
+	return SetNotificationReadContext(context.Background(), database.DBConnection, id, userID, read)
+}
+
+func SetNotificationReadContext(ctx context.Context, db *gorm.DB, id, userID uint, read bool) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	var readAt interface{}
+	if read {
+		readAt = gorm.Expr("COALESCE(read_at, ?)", time.Now())
+	}
+
+	result := db.Model(&Notification{}).Where("id = ? AND user_id = ?", id, userID).Update("read_at", readAt)
+	if result.Error != nil {
+		log.Println("[SET_NOTIFICATION_READ]::DB_UPDATE_NOTIFICATION_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func MarkAllNotificationsRead(userID uint) error {
+	return MarkAllNotificationsReadContext(context.Background(), database.DBConnection, userID)
+}
+
+func MarkAllNotificationsReadContext(ctx context.Context, db *gorm.DB, userID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	err := db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Update("read_at", time.Now()).Error
+	if err != nil {
+		log.Println("[MARK_ALL_NOTIFICATIONS_READ]::DB_UPDATE_NOTIFICATIONS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+// ListNotificationPreferences returns the User's preference for every type of
+// Notification, including the types they never changed.
+func ListNotificationPreferences(userID uint) ([]NotificationPreference, error) {
+	return ListNotificationPreferencesContext(context.Background(), database.DBConnection, userID)
+}
+
+func ListNotificationPreferencesContext(ctx context.Context, db *gorm.DB, userID uint) ([]NotificationPreference, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	var stored []NotificationPreference
+	if err := db.Where("user_id = ?", userID).Find(&stored).Error; err != nil {
+		log.Println("[LIST_NOTIFICATION_PREFERENCES]::DB_SELECT_NOTIFICATION_PREFERENCES_ERROR 💥")
+		return nil, err
+	}
+
+	return CompleteNotificationPreferences(userID, stored), nil
+}
+
+// ListDueNotifications lists the Notifications due to be mailed by now, with
+// their Actor, Discussion and Post, grouped by User.
+func ListDueNotifications(now time.Time, limit int) ([]Notification, error) {
+	return ListDueNotificationsContext(context.Background(), database.DBConnection, now, limit)
+}
+
+func ListDueNotificationsContext(ctx context.Context, db *gorm.DB, now time.Time, limit int) ([]Notification, error) {
+	db = db.WithContext(ctx)
+
+	var notifications []Notification
+	err := db.Preload("Actor").Preload("Discussion").Preload("Post").
+		Where("email_due_at <= ?", now).
+		Order("user_id").Order("id").
+		Limit(limit).
+		Find(&notifications).Error
+
+	if err != nil {
+		log.Println("[LIST_DUE_NOTIFICATIONS]::DB_SELECT_NOTIFICATIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// ClearNotificationEmails stops the Notifications from being mailed, for
+// those whose User has nowhere to mail them to or already read them.
+func ClearNotificationEmails(ids []uint) error {
+	return ClearNotificationEmailsContext(context.Background(), database.DBConnection, ids)
+}
+
+func ClearNotificationEmailsContext(ctx context.Context, db *gorm.DB, ids []uint) error {
+	db = db.WithContext(ctx)
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := db.Model(&Notification{}).Where("id IN ?", ids).Update("email_due_at", nil).Error; err != nil {
+		log.Println("[CLEAR_NOTIFICATION_EMAILS]::DB_UPDATE_NOTIFICATIONS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+// SetNotificationPreference creates or replaces the User's preference for a
+// type of Notification.
+func SetNotificationPreference(preference *NotificationPreference) error {
+	return SetNotificationPreferenceContext(context.Background(), database.DBConnection, preference)
+}
+
+func SetNotificationPreferenceContext(ctx context.Context, db *gorm.DB, preference *NotificationPreference) error {
+	db = db.WithContext(ctx)
+
+	if preference.UserID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if !IsNotificationType(preference.Type) {
+		return ErrUnknownNotificationType
+	}
+
+	if !IsEmailDelivery(preference.Email) {
+		return ErrUnknownEmailDelivery
+	}
+
+	err := db.Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"in_app", "email"}),
+		}).
+		Create(preference).Error
+
+	if err != nil {
+		log.Println("[SET_NOTIFICATION_PREFERENCE]::DB_UPSERT_NOTIFICATION_PREFERENCE_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+// CompleteNotificationPreferences adds the default preference for each type
+// missing from stored and orders them as NotificationTypes.
+func CompleteNotificationPreferences(userID uint, stored []NotificationPreference) []NotificationPreference {
+	byType := map[string]NotificationPreference{}
+	for _, preference := range stored {
+		byType[preference.Type] = preference
+	}
+
+	preferences := make([]NotificationPreference, len(NotificationTypes))
+	for i, notificationType := range NotificationTypes {
+		preference, ok := byType[notificationType]
+		if !ok {
+			preference = defaultNotificationPreference(userID, notificationType)
+		}
+
+		preferences[i] = preference
+	}
+
+	return preferences
+}
+
+func defaultNotificationPreference(userID uint, notificationType string) NotificationPreference {
+	return NotificationPreference{
+		UserID: userID,
+		Type:   notificationType,
+		InApp:  true,
+		Email:  DefaultEmailDelivery(notificationType),
+	}
+}
+
+// unsubscribePrefix keeps an unsubscribe token from passing for any other
+// token signed with TokenSigningKey.
+const unsubscribePrefix = "unsubscribe:"
+
+// UnsubscribeToken returns the token of the one-click link that stops mailing
+// the User Notifications of the type, or of every type when it is empty. It
+// does not expire, so that links in old emails keep working.
+func UnsubscribeToken(userID uint, notificationType string) string {
+	return tokens.Sign(TokenSigningKey, fmt.Sprintf("%s%d:%s", unsubscribePrefix, userID, notificationType))
+}
+
+// ParseUnsubscribeToken returns the User and type of Notification a token
+// from UnsubscribeToken was made for.
+func ParseUnsubscribeToken(token string) (uint, string, error) {
+	if token == "" {
+		return 0, "", ErrEmptyToken
+	}
+
+	payload, err := tokens.Verify(TokenSigningKey, token)
+	if err != nil || !strings.HasPrefix(payload, unsubscribePrefix) {
+		return 0, "", ErrInvalidToken
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(payload, unsubscribePrefix), ":", 2)
+	userID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || userID == 0 || len(parts) != 2 {
+		return 0, "", ErrInvalidToken
+	}
+
+	if parts[1] != "" && !IsNotificationType(parts[1]) {
+		return 0, "", ErrInvalidToken
+	}
+
+	return uint(userID), parts[1], nil
+}
+
+// DisableNotificationEmails stops mailing the User Notifications of the type,
+// or of every type when it is empty, and drops those already due. Whether they
+// get them in their inbox is left as it was.
+func DisableNotificationEmails(userID uint, notificationType string) error {
+	return DisableNotificationEmailsContext(context.Background(), database.DBConnection, userID, notificationType)
+}
+
+func DisableNotificationEmailsContext(ctx context.Context, db *gorm.DB, userID uint, notificationType string) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	notificationTypes := NotificationTypes
+	if notificationType != "" {
+		if !IsNotificationType(notificationType) {
+			return ErrUnknownNotificationType
+		}
+
+		notificationTypes = []string{notificationType}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var stored []NotificationPreference
+		if err := tx.Where("user_id = ? AND type IN ?", userID, notificationTypes).Find(&stored).Error; err != nil {
+			log.Println("[DISABLE_NOTIFICATION_EMAILS]::DB_SELECT_NOTIFICATION_PREFERENCES_ERROR 💥")
+			return err
+		}
+
+		preferences := []NotificationPreference{}
+		for _, preference := range CompleteNotificationPreferences(userID, stored) {
+			for _, t := range notificationTypes {
+				if preference.Type == t {
+					preference.Email = EmailDeliveryOff
+					preferences = append(preferences, preference)
+				}
+			}
+		}
+
+		err := tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+				DoUpdates: clause.AssignmentColumns([]string{"email"}),
+			}).
+			Create(&preferences).Error
+
+		if err != nil {
+			log.Println("[DISABLE_NOTIFICATION_EMAILS]::DB_UPSERT_NOTIFICATION_PREFERENCES_ERROR 💥")
+			return err
+		}
+
+		err = tx.Model(&Notification{}).
+			Where("user_id = ? AND type IN ? AND email_due_at IS NOT NULL", userID, notificationTypes).
+			Update("email_due_at", nil).Error
+
+		if err != nil {
+			log.Println("[DISABLE_NOTIFICATION_EMAILS]::DB_UPDATE_NOTIFICATIONS_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("Notification", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("Notify", func() {
+		It("should skip the Users who turned the type off", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `notification_preferences` WHERE user_id IN (?,?)")).
+				WithArgs(10, 11).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "in_app", "email"}).AddRow(11, NotificationTypePost, false, EmailDeliveryDaily))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `notifications` (`created_at`,`user_id`,`type`,`actor_id`,`discussion_id`,`post_id`,`read_at`,`email_due_at`) VALUES (?,?,?,?,?,?,?,?)")).
+				WithArgs(sqlmock.AnyArg(), 10, NotificationTypeReply, 3, 4, 5, nil, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			notifications, err := Notify([]Notification{
+				{UserID: 10, Type: NotificationTypeReply, ActorID: 3, DiscussionID: 4, PostID: 5},
+				{UserID: 11, Type: NotificationTypePost, ActorID: 3, DiscussionID: 4, PostID: 5},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(notifications).Should(HaveLen(1))
+			Expect(notifications[0].UserID).Should(Equal(uint(10)))
+			Expect(notifications[0].EmailDueAt).ShouldNot(BeNil())
+		})
+
+		It("should not mail the Notifications of a type the User gets no email for", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `notification_preferences` WHERE user_id IN (?)")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "in_app", "email"}).AddRow(10, NotificationTypeReply, true, EmailDeliveryOff))
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `notifications`")).
+				WithArgs(sqlmock.AnyArg(), 10, NotificationTypeReply, 3, 4, 5, nil, nil).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			notifications, err := Notify([]Notification{{UserID: 10, Type: NotificationTypeReply, ActorID: 3, DiscussionID: 4, PostID: 5}})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(notifications[0].EmailDueAt).Should(BeNil())
+		})
+
+		It("should not insert anything when every User turned the type off", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `notification_preferences`")).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "in_app"}).AddRow(10, NotificationTypePost, false))
+
+			notifications, err := Notify([]Notification{{UserID: 10, Type: NotificationTypePost, ActorID: 3, DiscussionID: 4, PostID: 5}})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(notifications).Should(BeEmpty())
+		})
+
+		It("should return ErrUnknownNotificationType without executing any sql", func() {
+			_, err := Notify([]Notification{{UserID: 10, Type: "shout", ActorID: 3, DiscussionID: 4, PostID: 5}})
+			Expect(err).Should(Equal(ErrUnknownNotificationType))
+		})
+
+		It("should return ErrEmptyPostID without executing any sql", func() {
+			_, err := Notify([]Notification{{UserID: 10, Type: NotificationTypePost, ActorID: 3, DiscussionID: 4}})
+			Expect(err).Should(Equal(ErrEmptyPostID))
+		})
+	})
+
+	Context("ListNotifications", func() {
+		It("should list only the unread Notifications, newest first", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `notifications` WHERE user_id = ? AND read_at IS NULL ORDER BY id DESC LIMIT 20")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type"}).AddRow(2, 10, NotificationTypeQuote).AddRow(1, 10, NotificationTypePost))
+
+			notifications, err := ListNotifications(10, true, 0, 20)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(notifications).Should(HaveLen(2))
+			Expect(notifications[0].Type).Should(Equal(NotificationTypeQuote))
+		})
+	})
+
+	Context("CountUnreadNotifications", func() {
+		It("should count the Notifications not read yet", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `notifications` WHERE user_id = ? AND read_at IS NULL")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+			Expect(CountUnreadNotifications(10)).Should(Equal(int64(4)))
+		})
+	})
+
+	Context("SetNotificationRead", func() {
+		It("should keep the time the Notification was first read", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `notifications` SET `read_at`=COALESCE(read_at, ?) WHERE id = ? AND user_id = ?")).
+				WithArgs(sqlmock.AnyArg(), 2, 10).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(SetNotificationRead(2, 10, true)).Should(Succeed())
+		})
+
+		It("should mark the Notification unread", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `notifications` SET `read_at`=? WHERE id = ? AND user_id = ?")).
+				WithArgs(nil, 2, 10).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(SetNotificationRead(2, 10, false)).Should(Succeed())
+		})
+
+		It("should return gorm.ErrRecordNotFound for the Notification of another User", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `notifications`")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			Expect(SetNotificationRead(2, 11, true)).Should(Equal(gorm.ErrRecordNotFound))
+		})
+	})
+
+	Context("MarkAllNotificationsRead", func() {
+		It("should mark every unread Notification of the User read", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `notifications` SET `read_at`=? WHERE user_id = ? AND read_at IS NULL")).
+				WithArgs(sqlmock.AnyArg(), 10).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+			mock.ExpectCommit()
+
+			Expect(MarkAllNotificationsRead(10)).Should(Succeed())
+		})
+	})
+
+	Context("ListNotificationPreferences", func() {
+		It("should fill in the types the User never changed", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `notification_preferences` WHERE user_id = ?")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "in_app", "email"}).AddRow(10, NotificationTypePost, false, EmailDeliveryOff))
+
+			preferences, err := ListNotificationPreferences(10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(preferences).Should(Equal([]NotificationPreference{
+				{UserID: 10, Type: NotificationTypePost, InApp: false, Email: EmailDeliveryOff},
+				{UserID: 10, Type: NotificationTypeReply, InApp: true, Email: EmailDeliveryImmediate},
+				{UserID: 10, Type: NotificationTypeQuote, InApp: true, Email: EmailDeliveryImmediate},
+				{UserID: 10, Type: NotificationTypeMention, InApp: true, Email: EmailDeliveryImmediate},
+			}))
+		})
+	})
+
+	Context("SetNotificationPreference", func() {
+		It("should create or replace the preference", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `notification_preferences` (`user_id`,`type`,`in_app`,`email`) VALUES (?,?,?,?) ON CONFLICT (`user_id`,`type`) DO UPDATE SET `in_app`=`excluded`.`in_app`,`email`=`excluded`.`email`")).
+				WithArgs(10, NotificationTypeReply, false, EmailDeliveryHourly).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(SetNotificationPreference(&NotificationPreference{UserID: 10, Type: NotificationTypeReply, Email: EmailDeliveryHourly})).Should(Succeed())
+		})
+
+		It("should return ErrUnknownNotificationType without executing any sql", func() {
+			err := SetNotificationPreference(&NotificationPreference{UserID: 10, Type: "shout", Email: EmailDeliveryOff})
+			Expect(err).Should(Equal(ErrUnknownNotificationType))
+		})
+
+		It("should return ErrUnknownEmailDelivery without executing any sql", func() {
+			err := SetNotificationPreference(&NotificationPreference{UserID: 10, Type: NotificationTypeReply, Email: "weekly"})
+			Expect(err).Should(Equal(ErrUnknownEmailDelivery))
+		})
+	})
+
+	Context("EmailDueAt", func() {
+		now := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+
+		It("should be due right away, at the top of the hour or at midnight UTC", func() {
+			Expect(*EmailDueAt(EmailDeliveryImmediate, now)).Should(Equal(now))
+			Expect(*EmailDueAt(EmailDeliveryHourly, now)).Should(Equal(time.Date(2021, 3, 14, 16, 0, 0, 0, time.UTC)))
+			Expect(*EmailDueAt(EmailDeliveryDaily, now)).Should(Equal(time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC)))
+			Expect(EmailDueAt(EmailDeliveryOff, now)).Should(BeNil())
+		})
+	})
+
+	Context("ListDueNotifications", func() {
+		It("should list the Notifications due by now, by User", func() {
+			now := time.Now()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `notifications` WHERE email_due_at <= ? ORDER BY user_id,id LIMIT 100")).
+				WithArgs(now).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "actor_id", "discussion_id", "post_id"}).AddRow(1, 10, 3, 4, 5))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`id` = ?")).
+				WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(3, "JonSnow"))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions` WHERE `discussions`.`id` = ?")).
+				WithArgs(4).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(4, "The Wall"))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts` WHERE `posts`.`id` = ?")).
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "content"}).AddRow(5, "Winter is coming"))
+
+			notifications, err := ListDueNotifications(now, 100)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(notifications).Should(HaveLen(1))
+			Expect(notifications[0].Actor.UserName).Should(Equal("JonSnow"))
+			Expect(notifications[0].Discussion.Title).Should(Equal("The Wall"))
+			Expect(notifications[0].Post.Content).Should(Equal("Winter is coming"))
+		})
+	})
+
+	Context("UnsubscribeToken", func() {
+		It("should round-trip the User and type", func() {
+			userID, notificationType, err := ParseUnsubscribeToken(UnsubscribeToken(10, NotificationTypePost))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(userID).Should(Equal(uint(10)))
+			Expect(notificationType).Should(Equal(NotificationTypePost))
+
+			_, notificationType, err = ParseUnsubscribeToken(UnsubscribeToken(10, ""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(notificationType).Should(BeEmpty())
+		})
+
+		It("should turn away tokens signed for anything else", func() {
+			_, _, err := ParseUnsubscribeToken(tokens.Sign(TokenSigningKey, "10:post"))
+			Expect(err).Should(Equal(ErrInvalidToken))
+
+			_, _, err = ParseUnsubscribeToken(UnsubscribeToken(10, NotificationTypePost) + "x")
+			Expect(err).Should(Equal(ErrInvalidToken))
+		})
+	})
+
+	Context("DisableNotificationEmails", func() {
+		It("should turn email off for every type and drop the Notifications due", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `notification_preferences` WHERE user_id = ? AND type IN (?,?,?,?)")).
+				WithArgs(10, NotificationTypePost, NotificationTypeReply, NotificationTypeQuote, NotificationTypeMention).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "in_app", "email"}).AddRow(10, NotificationTypePost, false, EmailDeliveryDaily))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `notification_preferences` (`user_id`,`type`,`in_app`,`email`) VALUES (?,?,?,?),(?,?,?,?),(?,?,?,?),(?,?,?,?) ON CONFLICT (`user_id`,`type`) DO UPDATE SET `email`=`excluded`.`email`")).
+				WithArgs(
+					10, NotificationTypePost, false, EmailDeliveryOff,
+					10, NotificationTypeReply, true, EmailDeliveryOff,
+					10, NotificationTypeQuote, true, EmailDeliveryOff,
+					10, NotificationTypeMention, true, EmailDeliveryOff,
+				).
+				WillReturnResult(sqlmock.NewResult(0, 4))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `notifications` SET `email_due_at`=? WHERE user_id = ? AND type IN (?,?,?,?) AND email_due_at IS NOT NULL")).
+				WithArgs(nil, 10, NotificationTypePost, NotificationTypeReply, NotificationTypeQuote, NotificationTypeMention).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectCommit()
+
+			Expect(DisableNotificationEmails(10, "")).Should(Succeed())
+		})
+
+		It("should return ErrUnknownNotificationType without executing any sql", func() {
+			Expect(DisableNotificationEmails(10, "shout")).Should(Equal(ErrUnknownNotificationType))
+		})
+	})
+})
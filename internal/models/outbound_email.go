@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// OutboundEmail is a message waiting in the outbox, or the record of one that
+// was sent or given up on. NextAttemptAt is when it should be tried next, and
+// is cleared once either happened.
+type OutboundEmail struct {
+	ID            uint `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	User          User       `gorm:"foreignKey:UserID"`
+	UserID        uint       `gorm:"not null;index"`
+	Recipient     string     `gorm:"size:128;not null"`
+	Subject       string     `gorm:"size:256;not null"`
+	Text          string     `gorm:"type:text"`
+	HTML          string     `gorm:"type:text"`
+	Unsubscribe   string     `gorm:"size:512"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt *time.Time `gorm:"index"`
+	LastError     string     `gorm:"size:512"`
+	SentAt        *time.Time
+	FailedAt      *time.Time
+}
+
+// QueueOutboundEmail stores the email in the outbox, due right away, and
+// clears the due time of the Notifications it tells about in the same
+// transaction so that they are only ever mailed once.
+func QueueOutboundEmail(email *OutboundEmail, notificationIDs []uint) error {
+	return QueueOutboundEmailContext(context.Background(), database.DBConnection, email, notificationIDs)
+}
+
+func QueueOutboundEmailContext(ctx context.Context, db *gorm.DB, email *OutboundEmail, notificationIDs []uint) error {
+	db = db.WithContext(ctx)
+
+	if email.UserID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if !validAddress(email.Recipient) {
+		return ErrInvalidEmail
+	}
+
+	if email.Subject == "" {
+		return ErrEmptySubject
+	}
+
+	if email.NextAttemptAt == nil {
+		now := time.Now()
+		email.NextAttemptAt = &now
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User").Create(email).Error; err != nil {
+			log.Println("[QUEUE_OUTBOUND_EMAIL]::DB_INSERT_OUTBOUND_EMAIL_ERROR 💥")
+			return err
+		}
+
+		if len(notificationIDs) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&Notification{}).Where("id IN ?", notificationIDs).Update("email_due_at", nil).Error; err != nil {
+			log.Println("[QUEUE_OUTBOUND_EMAIL]::DB_UPDATE_NOTIFICATIONS_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+// ListDueOutboundEmails lists the emails due to be tried by now, oldest first.
+func ListDueOutboundEmails(now time.Time, limit int) ([]OutboundEmail, error) {
+	return ListDueOutboundEmailsContext(context.Background(), database.DBConnection, now, limit)
+}
+
+func ListDueOutboundEmailsContext(ctx context.Context, db *gorm.DB, now time.Time, limit int) ([]OutboundEmail, error) {
+	db = db.WithContext(ctx)
+
+	var emails []OutboundEmail
+	if err := db.Where("next_attempt_at <= ?", now).Order("next_attempt_at").Order("id").Limit(limit).Find(&emails).Error; err != nil {
+		log.Println("[LIST_DUE_OUTBOUND_EMAILS]::DB_SELECT_OUTBOUND_EMAILS_ERROR 💥")
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+func MarkOutboundEmailSent(id uint) error {
+	return MarkOutboundEmailSentContext(context.Background(), database.DBConnection, id)
+}
+
+func MarkOutboundEmailSentContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Model(&OutboundEmail{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": nil,
+		"sent_at":         time.Now(),
+	})
+
+	if result.Error != nil {
+		log.Println("[MARK_OUTBOUND_EMAIL_SENT]::DB_UPDATE_OUTBOUND_EMAIL_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RecordOutboundEmailFailure counts a failed attempt to send the email, which
+// is tried again at retryAt, or given up on when retryAt is nil.
+func RecordOutboundEmailFailure(id uint, reason string, retryAt *time.Time) error {
+	return RecordOutboundEmailFailureContext(context.Background(), database.DBConnection, id, reason, retryAt)
+}
+
+func RecordOutboundEmailFailureContext(ctx context.Context, db *gorm.DB, id uint, reason string, retryAt *time.Time) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	if len(reason) > 512 {
+		reason = reason[:512]
+	}
+
+	updates := map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      reason,
+		"next_attempt_at": retryAt,
+	}
+
+	if retryAt == nil {
+		updates["failed_at"] = time.Now()
+	}
+
+	result := db.Model(&OutboundEmail{}).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		log.Println("[RECORD_OUTBOUND_EMAIL_FAILURE]::DB_UPDATE_OUTBOUND_EMAIL_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
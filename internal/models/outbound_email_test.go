@@ -0,0 +1,122 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("OutboundEmail", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("QueueOutboundEmail", func() {
+		It("should queue the email and stop mailing its Notifications", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbound_emails` (`created_at`,`updated_at`,`user_id`,`recipient`,`subject`,`text`,`html`,`unsubscribe`,`attempts`,`next_attempt_at`,`last_error`,`sent_at`,`failed_at`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)")).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 10, "jon@example.com", "New replies", "Text", "<p>HTML</p>", "", 0, sqlmock.AnyArg(), "", nil, nil).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `notifications` SET `email_due_at`=? WHERE id IN (?,?)")).
+				WithArgs(nil, 3, 4).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectCommit()
+
+			email := &OutboundEmail{UserID: 10, Recipient: "jon@example.com", Subject: "New replies", Text: "Text", HTML: "<p>HTML</p>"}
+			Expect(QueueOutboundEmail(email, []uint{3, 4})).Should(Succeed())
+			Expect(email.ID).Should(Equal(uint(1)))
+			Expect(email.NextAttemptAt).ShouldNot(BeNil())
+		})
+
+		It("should return ErrInvalidEmail without executing any sql", func() {
+			err := QueueOutboundEmail(&OutboundEmail{UserID: 10, Recipient: "Jon <jon@example.com>", Subject: "New replies"}, nil)
+			Expect(err).Should(Equal(ErrInvalidEmail))
+		})
+
+		It("should return ErrEmptySubject without executing any sql", func() {
+			err := QueueOutboundEmail(&OutboundEmail{UserID: 10, Recipient: "jon@example.com"}, nil)
+			Expect(err).Should(Equal(ErrEmptySubject))
+		})
+	})
+
+	Context("ListDueOutboundEmails", func() {
+		It("should list the emails due by now, oldest first", func() {
+			now := time.Now()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `outbound_emails` WHERE next_attempt_at <= ? ORDER BY next_attempt_at,id LIMIT 50")).
+				WithArgs(now).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "recipient"}).AddRow(1, "jon@example.com"))
+
+			emails, err := ListDueOutboundEmails(now, 50)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emails).Should(HaveLen(1))
+		})
+	})
+
+	Context("MarkOutboundEmailSent", func() {
+		It("should count the attempt and take the email out of the queue", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbound_emails` SET `attempts`=attempts + 1,`next_attempt_at`=?,`sent_at`=?,`updated_at`=? WHERE id = ?")).
+				WithArgs(nil, sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(MarkOutboundEmailSent(1)).Should(Succeed())
+		})
+
+		It("should return gorm.ErrRecordNotFound for an unknown email", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbound_emails`")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			Expect(MarkOutboundEmailSent(2)).Should(Equal(gorm.ErrRecordNotFound))
+		})
+	})
+
+	Context("RecordOutboundEmailFailure", func() {
+		It("should schedule the next attempt", func() {
+			retryAt := time.Now().Add(time.Minute)
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbound_emails` SET `attempts`=attempts + 1,`last_error`=?,`next_attempt_at`=?,`updated_at`=? WHERE id = ?")).
+				WithArgs("connection refused", retryAt, sqlmock.AnyArg(), 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(RecordOutboundEmailFailure(1, "connection refused", &retryAt)).Should(Succeed())
+		})
+
+		It("should give up on the email without a next attempt", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbound_emails` SET `attempts`=attempts + 1,`failed_at`=?,`last_error`=?,`next_attempt_at`=?,`updated_at`=? WHERE id = ?")).
+				WithArgs(sqlmock.AnyArg(), "mailbox unavailable", nil, sqlmock.AnyArg(), 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(RecordOutboundEmailFailure(1, "mailbox unavailable", nil)).Should(Succeed())
+		})
+	})
+})
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// PasswordReset is an outstanding request to choose a new password, mailed to
+// one of the verified addresses of a User. Only the digest of the token is
+// stored.
+type PasswordReset struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	User      User      `gorm:"foreignKey:UserID"`
+	UserID    uint      `gorm:"not null;index"`
+}
+
+// CreatePasswordReset returns the signed token to mail to the User.
+func CreatePasswordReset(reset *PasswordReset) (string, error) {
+	return CreatePasswordResetContext(context.Background(), database.DBConnection, reset)
+}
+
+func CreatePasswordResetContext(ctx context.Context, db *gorm.DB, reset *PasswordReset) (string, error) {
+	db = db.WithContext(ctx)
+
+	if reset.UserID == 0 {
+		return "", ErrEmptyUserID
+	}
+
+	if reset.ExpiresAt.IsZero() {
+		return "", ErrEmptyExpiresAt
+	}
+
+	nonce, err := tokens.Generate(tokens.DefaultLength)
+	if err != nil {
+		log.Println("[CREATE_PASSWORD_RESET]::GENERATE_TOKEN_ERROR 💥")
+		return "", err
+	}
+	reset.ID = tokens.Hash(nonce)
+
+	if err := db.Omit("User").Create(reset).Error; err != nil {
+		log.Println("[CREATE_PASSWORD_RESET]::DB_INSERT_PASSWORD_RESET_ERROR 💥")
+		return "", err
+	}
+
+	return tokens.Sign(TokenSigningKey, nonce), nil
+}
+
+// ResetPassword consumes a token from CreatePasswordReset, sets the password
+// of its User and signs them out everywhere, revoking their API tokens. Every
+// other reset outstanding for the User is withdrawn as well.
+func ResetPassword(token, password string) error {
+	return ResetPasswordContext(context.Background(), database.DBConnection, token, password)
+}
+
+func ResetPasswordContext(ctx context.Context, db *gorm.DB, token, password string) error {
+	db = db.WithContext(ctx)
+
+	if token == "" {
+		return ErrEmptyToken
+	}
+
+	if password == "" {
+		return ErrEmptyPassword
+	}
+
+	nonce, err := tokens.Verify(TokenSigningKey, token)
+	if err != nil {
+		log.Println("[RESET_PASSWORD]::INVALID_SIGNATURE_WARNING ⚠️")
+		return ErrInvalidToken
+	}
+
+	hash, err := PasswordHasher.Hash(password)
+	if err != nil {
+		log.Println("[RESET_PASSWORD]::HASH_PASSWORD_ERROR 💥")
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		reset := &PasswordReset{}
+		err := tx.Where("id = ? AND expires_at > ?", tokens.Hash(nonce), time.Now()).Take(reset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+
+		if err != nil {
+			log.Println("[RESET_PASSWORD]::DB_SELECT_PASSWORD_RESET_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", reset.UserID).Delete(&PasswordReset{}).Error; err != nil {
+			log.Println("[RESET_PASSWORD]::DB_DELETE_PASSWORD_RESETS_ERROR 💥")
+			return err
+		}
+
+		result := tx.Model(&User{Model: gorm.Model{ID: reset.UserID}}).Where("deleted_at IS NULL").Update("password", hash)
+		if result.Error != nil {
+			log.Println("[RESET_PASSWORD]::DB_UPDATE_PASSWORD_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrInvalidToken
+		}
+
+		if err := tx.Where("user_id = ?", reset.UserID).Delete(&Session{}).Error; err != nil {
+			log.Println("[RESET_PASSWORD]::DB_DELETE_SESSIONS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", reset.UserID).Delete(&APIToken{}).Error; err != nil {
+			log.Println("[RESET_PASSWORD]::DB_DELETE_API_TOKENS_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+func DeleteExpiredPasswordResets() error {
+	return DeleteExpiredPasswordResetsContext(context.Background(), database.DBConnection)
+}
+
+func DeleteExpiredPasswordResetsContext(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&PasswordReset{}).Error; err != nil {
+		log.Println("[DELETE_EXPIRED_PASSWORD_RESETS]::DB_DELETE_PASSWORD_RESETS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("PasswordReset", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		TokenSigningKey = []byte("secret")
+		PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	// issue signs a token the way CreatePasswordReset does and returns it with
+	// the ID its PasswordReset is stored under.
+	issue := func() (string, string) {
+		nonce, err := tokens.Generate(tokens.DefaultLength)
+		Expect(err).ShouldNot(HaveOccurred())
+		return tokens.Sign(TokenSigningKey, nonce), tokens.Hash(nonce)
+	}
+
+	Context("CreatePasswordReset", func() {
+		It("should store the digest and return a signed token", func() {
+			reset := &PasswordReset{UserID: 4, ExpiresAt: time.Now().Add(time.Hour)}
+
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `password_resets` (`id`,`created_at`,`expires_at`,`user_id`) VALUES (?,?,?,?)")).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 4).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			token, err := CreatePasswordReset(reset)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			nonce, err := tokens.Verify(TokenSigningKey, token)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(reset.ID).Should(Equal(tokens.Hash(nonce)))
+		})
+
+		When("the reset has no User", func() {
+			It("should return ErrEmptyUserID without executing any sql", func() {
+				_, err := CreatePasswordReset(&PasswordReset{ExpiresAt: time.Now().Add(time.Hour)})
+				Expect(err).Should(Equal(ErrEmptyUserID))
+			})
+		})
+	})
+
+	Context("ResetPassword", func() {
+		When("the token is valid", func() {
+			It("should set the password, withdraw every reset, sign the User out and revoke their API tokens", func() {
+				token, id := issue()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `password_resets` WHERE id = ? AND expires_at > ? LIMIT 1")).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(id, 4))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `password_resets` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `password`=?,`updated_at`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `api_tokens` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				Expect(ResetPassword(token, "dracarys")).Should(Succeed())
+			})
+		})
+
+		When("the token has been used or has expired", func() {
+			It("should return ErrInvalidToken", func() {
+				token, id := issue()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `password_resets` WHERE id = ? AND expires_at > ? LIMIT 1")).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				Expect(ResetPassword(token, "dracarys")).Should(Equal(ErrInvalidToken))
+			})
+		})
+
+		When("the token was not signed with TokenSigningKey", func() {
+			It("should return ErrInvalidToken without executing any sql", func() {
+				Expect(ResetPassword(tokens.Sign([]byte("forged"), "nonce"), "dracarys")).Should(Equal(ErrInvalidToken))
+			})
+		})
+
+		When("the password is empty", func() {
+			It("should return ErrEmptyPassword without executing any sql", func() {
+				token, _ := issue()
+				Expect(ResetPassword(token, "")).Should(Equal(ErrEmptyPassword))
+			})
+		})
+	})
+
+	Context("DeleteExpiredPasswordResets", func() {
+		It("should delete every expired reset", func() {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `password_resets` WHERE expires_at <= ?")).
+				WithArgs(sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+
+			Expect(DeleteExpiredPasswordResets()).Should(Succeed())
+		})
+	})
+})
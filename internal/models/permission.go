@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const (
+	ActionView            = "view"
+	ActionStartDiscussion = "start_discussion"
+	ActionReply           = "reply"
+	ActionModerate        = "moderate"
+	ActionAdminister      = "administer"
+)
+
+var Actions = []string{ActionView, ActionStartDiscussion, ActionReply, ActionModerate, ActionAdminister}
+
+// Permission allows or denies a Group an action on a Topic and everything
+// below it. A nil GroupID applies to everybody, signed in or not, and a nil
+// TopicID applies to the whole forum.
+type Permission struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	GroupID   *uint  `gorm:"index"`
+	Group     *Group `gorm:"constraint:OnDelete:CASCADE"`
+	TopicID   *uint  `gorm:"index"`
+	Topic     *Topic `gorm:"constraint:OnDelete:CASCADE"`
+	Action    string `gorm:"not null;size:32"`
+	Deny      bool   `gorm:"not null;default:false"`
+}
+
+func validAction(action string) bool {
+	for _, known := range Actions {
+		if action == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scopeTo narrows db to rows whose column equals id, with a nil id matching NULL.
+func scopeTo(db *gorm.DB, column string, id *uint) *gorm.DB {
+	if id == nil {
+		return db.Where(column + " IS NULL")
+	}
+
+	return db.Where(column+" = ?", *id)
+}
+
+// SetPermission creates the rule for the permission's group, topic and action,
+// or replaces the Deny flag of the one that already exists.
+func SetPermission(permission *Permission) error {
+	return SetPermissionContext(context.Background(), database.DBConnection, permission)
+}
+
+func SetPermissionContext(ctx context.Context, db *gorm.DB, permission *Permission) error {
+	db = db.WithContext(ctx)
+
+	if !validAction(permission.Action) {
+		return ErrUnknownAction
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		existing := &Permission{}
+		query := scopeTo(scopeTo(tx, "group_id", permission.GroupID), "topic_id", permission.TopicID)
+		err := query.Where("action = ?", permission.Action).Take(existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("[SET_PERMISSION]::DB_SELECT_PERMISSION_ERROR 💥")
+			return err
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := tx.Omit("Group", "Topic").Create(permission).Error; err != nil {
+				log.Println("[SET_PERMISSION]::DB_INSERT_PERMISSION_ERROR 💥")
+				return err
+			}
+
+			return nil
+		}
+
+		if err := tx.Model(existing).Update("deny", permission.Deny).Error; err != nil {
+			log.Println("[SET_PERMISSION]::DB_UPDATE_PERMISSION_ERROR 💥")
+			return err
+		}
+
+		permission.ID = existing.ID
+		permission.CreatedAt = existing.CreatedAt
+		permission.UpdatedAt = existing.UpdatedAt
+		return nil
+	})
+}
+
+func GetPermission(id uint) (*Permission, error) {
+	return GetPermissionContext(context.Background(), database.DBConnection, id)
+}
+
+func GetPermissionContext(ctx context.Context, db *gorm.DB, id uint) (*Permission, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	permission := &Permission{}
+	if err := db.Take(permission, id).Error; err != nil {
+		log.Println("[GET_PERMISSION]::DB_SELECT_PERMISSION_ERROR 💥")
+		return nil, err
+	}
+
+	return permission, nil
+}
+
+func ListPermissions() ([]Permission, error) {
+	return ListPermissionsContext(context.Background(), database.DBConnection)
+}
+
+func ListPermissionsContext(ctx context.Context, db *gorm.DB) ([]Permission, error) {
+	db = db.WithContext(ctx)
+
+	var permissions []Permission
+	if err := db.Order("id").Find(&permissions).Error; err != nil {
+		log.Println("[LIST_PERMISSIONS]::DB_SELECT_PERMISSIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// ListUserPermissions returns the rules that apply to a User: those for
+// everybody and those for the Groups they belong to. A userID of 0 stands for
+// a guest, who only gets the rules for everybody.
+func ListUserPermissions(userID uint) ([]Permission, error) {
+	return ListUserPermissionsContext(context.Background(), database.DBConnection, userID)
+}
+
+func ListUserPermissionsContext(ctx context.Context, db *gorm.DB, userID uint) ([]Permission, error) {
+	db = db.WithContext(ctx)
+
+	query := db.Where("group_id IS NULL")
+	if userID != 0 {
+		memberships := db.Table("users_groups").Select("group_id").Where("user_id = ?", userID)
+		groups := db.Model(&Group{}).Select("id").Where("id IN (?)", memberships)
+		query = db.Where("group_id IS NULL OR group_id IN (?)", groups)
+	}
+
+	var permissions []Permission
+	if err := query.Order("id").Find(&permissions).Error; err != nil {
+		log.Println("[LIST_USER_PERMISSIONS]::DB_SELECT_PERMISSIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func DeletePermission(id uint) error {
+	return DeletePermissionContext(context.Background(), database.DBConnection, id)
+}
+
+func DeletePermissionContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Delete(&Permission{}, id)
+	if result.Error != nil {
+		log.Println("[DELETE_PERMISSION]::DB_DELETE_PERMISSION_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
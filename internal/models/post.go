@@ -1,25 +1,91 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/markdown"
+	"github.com/golangbb/golangbb/v2/pkg/sanitize"
 	"gorm.io/gorm"
+	"html"
 	"log"
+	"strings"
+	"unicode/utf8"
 )
 
+const (
+	PostFormatMarkdown = "markdown"
+	PostFormatPlain    = "plain"
+)
+
+// MaxContentLength is the size, in characters, of the content columns of
+// Posts, their revisions and Messages.
+const MaxContentLength = 4096
+
+// Post is written in a Discussion, optionally in reply to an earlier Post of
+// it. ReplyToID is cleared when that Post is purged. Mentions are set when the
+// Post is created or updated.
 type Post struct {
 	gorm.Model
-	Content      string     `gorm:"size:4096" gorm:"not null"`
+	Content      string     `gorm:"size:4096;not null"`
+	Format       string     `gorm:"size:16;not null"`
+	ContentHTML  string     `gorm:"type:text"`
 	Author       User       `gorm:"foreignKey:AuthorID"`
 	AuthorID     uint       `gorm:"not null"`
 	Discussion   Discussion `gorm:"foreignKey:DiscussionID"`
 	DiscussionID uint       `gorm:"not null"`
+	ReplyToID    *uint      `gorm:"index"`
+	Mentions     []Mention  `gorm:"foreignKey:PostID"`
+}
+
+// RenderContent turns content written in format into the HTML shown to
+// readers. Markdown is sanitised, since it may carry raw HTML.
+func RenderContent(format, content string) (string, error) {
+	switch format {
+	case PostFormatMarkdown:
+		return sanitize.HTML(markdown.Render(content)), nil
+	case PostFormatPlain:
+		var b strings.Builder
+		for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+			if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+				b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br />\n") + "</p>\n")
+			}
+		}
+		return b.String(), nil
+	}
+
+	return "", ErrUnknownFormat
+}
+
+func renderPost(post *Post) error {
+	if post.Format == "" {
+		post.Format = PostFormatMarkdown
+	}
+
+	rendered, err := RenderContent(post.Format, post.Content)
+	if err != nil {
+		return err
+	}
+
+	post.ContentHTML = rendered
+	return nil
 }
 
 func CreatePost(post *Post) error {
+	return CreatePostContext(context.Background(), database.DBConnection, post)
+}
+
+func CreatePostContext(ctx context.Context, db *gorm.DB, post *Post) error {
+	db = db.WithContext(ctx)
+
 	if post.Content == "" {
 		return ErrEmptyContent
 	}
 
+	if utf8.RuneCountInString(post.Content) > MaxContentLength {
+		return ErrContentTooLong
+	}
+
 	if post.AuthorID == 0 {
 		return ErrEmptyUserID
 	}
@@ -28,12 +94,47 @@ func CreatePost(post *Post) error {
 		return ErrEmptyDiscussionID
 	}
 
-	err := database.DBConnection.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Omit("Author", "Discussion").Create(post).Error; err != nil {
+	if err := renderPost(post); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if post.ReplyToID != nil {
+			var count int64
+			if err := tx.Model(&Post{}).Where("id = ? AND discussion_id = ?", *post.ReplyToID, post.DiscussionID).Count(&count).Error; err != nil {
+				log.Println("[CREATE_POST]::DB_COUNT_REPLIED_POST_ERROR 💥")
+				return err
+			}
+
+			if count == 0 {
+				return ErrReplyOutsideDiscussion
+			}
+		}
+
+		if err := mentionUsers(tx, post); err != nil {
+			log.Println("[CREATE_POST]::DB_SELECT_MENTIONED_USERS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Omit("Author", "Discussion", "Mentions").Create(post).Error; err != nil {
 			log.Println("[CREATE_POST]::DB_INSERT_POST_ERROR 💥")
 			return err
 		}
 
+		if err := createMentions(tx, post); err != nil {
+			log.Println("[CREATE_POST]::DB_INSERT_MENTIONS_ERROR 💥")
+			return err
+		}
+
+		if err := createPostRevision(tx, post, post.AuthorID, ""); err != nil {
+			return err
+		}
+
+		if err := subscribeDiscussion(tx, post.AuthorID, post.DiscussionID); err != nil {
+			log.Println("[CREATE_POST]::DB_INSERT_DISCUSSION_SUBSCRIPTION_ERROR 💥")
+			return err
+		}
+
 		return nil
 	})
 
@@ -43,3 +144,229 @@ func CreatePost(post *Post) error {
 
 	return nil
 }
+
+func GetPost(id uint) (*Post, error) {
+	return GetPostContext(context.Background(), database.DBConnection, id)
+}
+
+func GetPostContext(ctx context.Context, db *gorm.DB, id uint) (*Post, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	post := &Post{}
+	if err := db.Take(post, id).Error; err != nil {
+		log.Println("[GET_POST]::DB_SELECT_POST_ERROR 💥")
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// GetPostTopicID returns the Topic a Post was made in, whether or not the Post
+// or its Discussion are deleted, which is what moderating them is decided on.
+func GetPostTopicID(id uint) (uint, error) {
+	return GetPostTopicIDContext(context.Background(), database.DBConnection, id)
+}
+
+func GetPostTopicIDContext(ctx context.Context, db *gorm.DB, id uint) (uint, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return 0, ErrEmptyID
+	}
+
+	var topicIDs []uint
+	err := db.Unscoped().
+		Model(&Post{}).
+		Joins("JOIN discussions ON discussions.id = posts.discussion_id").
+		Where("posts.id = ?", id).
+		Pluck("discussions.topic_id", &topicIDs).Error
+
+	if err != nil {
+		log.Println("[GET_POST_TOPIC_ID]::DB_SELECT_TOPIC_ID_ERROR 💥")
+		return 0, err
+	}
+
+	if len(topicIDs) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	return topicIDs[0], nil
+}
+
+func ListPosts(discussionID uint, offset, limit int) ([]Post, error) {
+	return ListPostsContext(context.Background(), database.DBConnection, discussionID, offset, limit)
+}
+
+func ListPostsContext(ctx context.Context, db *gorm.DB, discussionID uint, offset, limit int) ([]Post, error) {
+	db = db.WithContext(ctx)
+
+	if discussionID == 0 {
+		return nil, ErrEmptyDiscussionID
+	}
+
+	var posts []Post
+	err := db.
+		Where("discussion_id = ?", discussionID).
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&posts).Error
+
+	if err != nil {
+		log.Println("[LIST_POSTS]::DB_SELECT_POSTS_ERROR 💥")
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// UpdatePost saves the edit of the User editorID as a new PostRevision,
+// giving reason for it.
+func UpdatePost(post *Post, editorID uint, reason string) error {
+	return UpdatePostContext(context.Background(), database.DBConnection, post, editorID, reason)
+}
+
+func UpdatePostContext(ctx context.Context, db *gorm.DB, post *Post, editorID uint, reason string) error {
+	db = db.WithContext(ctx)
+
+	if post.ID == 0 {
+		return ErrEmptyID
+	}
+
+	if post.Content == "" {
+		return ErrEmptyContent
+	}
+
+	if utf8.RuneCountInString(post.Content) > MaxContentLength {
+		return ErrContentTooLong
+	}
+
+	if editorID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if len(reason) > MaxRevisionReasonLength {
+		return ErrReasonTooLong
+	}
+
+	if err := renderPost(post); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := mentionUsers(tx, post); err != nil {
+			log.Println("[UPDATE_POST]::DB_SELECT_MENTIONED_USERS_ERROR 💥")
+			return err
+		}
+
+		result := tx.Model(post).Where("deleted_at IS NULL").Select("Content", "Format", "ContentHTML").Updates(post)
+		if result.Error != nil {
+			log.Println("[UPDATE_POST]::DB_UPDATE_POST_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Where("post_id = ?", post.ID).Delete(&Mention{}).Error; err != nil {
+			log.Println("[UPDATE_POST]::DB_DELETE_MENTIONS_ERROR 💥")
+			return err
+		}
+
+		if err := createMentions(tx, post); err != nil {
+			log.Println("[UPDATE_POST]::DB_INSERT_MENTIONS_ERROR 💥")
+			return err
+		}
+
+		return createPostRevision(tx, post, editorID, reason)
+	})
+}
+
+func DeletePost(id uint) error {
+	return DeletePostContext(context.Background(), database.DBConnection, id)
+}
+
+func DeletePostContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Delete(&Post{}, id)
+	if result.Error != nil {
+		log.Println("[DELETE_POST]::DB_DELETE_POST_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func RestorePost(id uint) error {
+	return RestorePostContext(context.Background(), database.DBConnection, id)
+}
+
+func RestorePostContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		post := &Post{}
+		if err := tx.Unscoped().Where("deleted_at IS NOT NULL").Take(post, id).Error; err != nil {
+			log.Println("[RESTORE_POST]::DB_SELECT_POST_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Take(&Discussion{}, post.DiscussionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDeletedParent
+			}
+
+			log.Println("[RESTORE_POST]::DB_SELECT_DISCUSSION_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Unscoped().Model(post).Update("deleted_at", nil).Error; err != nil {
+			log.Println("[RESTORE_POST]::DB_RESTORE_POST_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+func PurgePost(id uint) error {
+	return PurgePostContext(context.Background(), database.DBConnection, id)
+}
+
+func PurgePostContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Unscoped().Delete(&Post{}, id)
+	if result.Error != nil {
+		log.Println("[PURGE_POST]::DB_DELETE_POST_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
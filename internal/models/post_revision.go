@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const MaxRevisionReasonLength = 256
+
+// PostRevision is an immutable copy of a Post's Content as it was written or
+// edited. Every Post has one for each version, the latest matching the Post.
+type PostRevision struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Post      Post   `gorm:"foreignKey:PostID"`
+	PostID    uint   `gorm:"not null;index"`
+	Author    *User  `gorm:"foreignKey:AuthorID"`
+	AuthorID  *uint  `gorm:"index"`
+	Reason    string `gorm:"size:256"`
+	Content   string `gorm:"size:4096"`
+	Format    string `gorm:"size:16;not null"`
+	Hidden    bool   `gorm:"not null;default:false"`
+}
+
+func createPostRevision(tx *gorm.DB, post *Post, authorID uint, reason string) error {
+	revision := &PostRevision{
+		PostID:   post.ID,
+		AuthorID: &authorID,
+		Reason:   reason,
+		Content:  post.Content,
+		Format:   post.Format,
+	}
+
+	if err := tx.Omit("Post", "Author").Create(revision).Error; err != nil {
+		log.Println("[CREATE_POST_REVISION]::DB_INSERT_POST_REVISION_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+func GetPostRevision(id uint) (*PostRevision, error) {
+	return GetPostRevisionContext(context.Background(), database.DBConnection, id)
+}
+
+func GetPostRevisionContext(ctx context.Context, db *gorm.DB, id uint) (*PostRevision, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	revision := &PostRevision{}
+	if err := db.Take(revision, id).Error; err != nil {
+		log.Println("[GET_POST_REVISION]::DB_SELECT_POST_REVISION_ERROR 💥")
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+func ListPostRevisions(postID uint, offset, limit int) ([]PostRevision, error) {
+	return ListPostRevisionsContext(context.Background(), database.DBConnection, postID, offset, limit)
+}
+
+func ListPostRevisionsContext(ctx context.Context, db *gorm.DB, postID uint, offset, limit int) ([]PostRevision, error) {
+	db = db.WithContext(ctx)
+
+	if postID == 0 {
+		return nil, ErrEmptyID
+	}
+
+	var revisions []PostRevision
+	err := db.
+		Where("post_id = ?", postID).
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&revisions).Error
+
+	if err != nil {
+		log.Println("[LIST_POST_REVISIONS]::DB_SELECT_POST_REVISIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func HidePostRevision(id uint) error {
+	return HidePostRevisionContext(context.Background(), database.DBConnection, id)
+}
+
+// HidePostRevisionContext hides an earlier version of a Post. The latest
+// PostRevision is what the Post shows, so hiding it returns ErrLatestRevision.
+func HidePostRevisionContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		revision := &PostRevision{}
+		if err := tx.Select("id", "post_id").Take(revision, id).Error; err != nil {
+			log.Println("[HIDE_POST_REVISION]::DB_SELECT_POST_REVISION_ERROR 💥")
+			return err
+		}
+
+		var newer int64
+		if err := tx.Model(&PostRevision{}).Where("post_id = ? AND id > ?", revision.PostID, id).Count(&newer).Error; err != nil {
+			log.Println("[HIDE_POST_REVISION]::DB_COUNT_POST_REVISIONS_ERROR 💥")
+			return err
+		}
+
+		if newer == 0 {
+			return ErrLatestRevision
+		}
+
+		return setPostRevisionHidden(tx, id, true)
+	})
+}
+
+func UnhidePostRevision(id uint) error {
+	return UnhidePostRevisionContext(context.Background(), database.DBConnection, id)
+}
+
+func UnhidePostRevisionContext(ctx context.Context, db *gorm.DB, id uint) error {
+	return setPostRevisionHidden(db.WithContext(ctx), id, false)
+}
+
+func setPostRevisionHidden(db *gorm.DB, id uint, hidden bool) error {
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Model(&PostRevision{}).Where("id = ?", id).Update("hidden", hidden)
+	if result.Error != nil {
+		log.Println("[SET_POST_REVISION_HIDDEN]::DB_UPDATE_POST_REVISION_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("PostRevision", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("GetPostRevision", func() {
+		It("should return the PostRevision", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `post_revisions` WHERE `post_revisions`.`id` = ? LIMIT 1")).
+				WithArgs(4).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "post_id", "content"}).AddRow(4, 3, "edited"))
+
+			revision, err := GetPostRevision(4)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(revision.PostID).Should(Equal(uint(3)))
+			Expect(revision.Content).Should(Equal("edited"))
+		})
+
+		It("should return ErrEmptyID without executing any sql", func() {
+			_, err := GetPostRevision(0)
+			Expect(err).Should(Equal(ErrEmptyID))
+		})
+	})
+
+	Context("ListPostRevisions", func() {
+		It("should list the PostRevisions of a Post oldest first", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `post_revisions` WHERE post_id = ? ORDER BY id LIMIT 10 OFFSET 20")).
+				WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "post_id"}).AddRow(1, 3).AddRow(4, 3))
+
+			revisions, err := ListPostRevisions(3, 20, 10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(revisions).Should(HaveLen(2))
+		})
+
+		It("should return ErrEmptyID without executing any sql", func() {
+			_, err := ListPostRevisions(0, 0, 10)
+			Expect(err).Should(Equal(ErrEmptyID))
+		})
+	})
+
+	Context("HidePostRevision", func() {
+		expectRevisionQuery := func(newer int) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`post_id` FROM `post_revisions` WHERE `post_revisions`.`id` = ? LIMIT 1")).
+				WithArgs(4).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "post_id"}).AddRow(4, 3))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `post_revisions` WHERE post_id = ? AND id > ?")).
+				WithArgs(3, 4).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(newer))
+		}
+
+		It("should hide the PostRevision", func() {
+			mock.ExpectBegin()
+			expectRevisionQuery(1)
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `post_revisions` SET `hidden`=? WHERE id = ?")).
+				WithArgs(true, 4).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(HidePostRevision(4)).Should(Succeed())
+		})
+
+		It("should return ErrLatestRevision for the version the Post shows", func() {
+			mock.ExpectBegin()
+			expectRevisionQuery(0)
+			mock.ExpectRollback()
+
+			Expect(HidePostRevision(4)).Should(Equal(ErrLatestRevision))
+		})
+
+		It("should return gorm.ErrRecordNotFound when the PostRevision does not exist", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`post_id` FROM `post_revisions`")).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "post_id"}))
+			mock.ExpectRollback()
+
+			Expect(HidePostRevision(4)).Should(Equal(gorm.ErrRecordNotFound))
+		})
+
+		It("should return ErrEmptyID without executing any sql", func() {
+			Expect(HidePostRevision(0)).Should(Equal(ErrEmptyID))
+		})
+	})
+
+	Context("UnhidePostRevision", func() {
+		It("should show the PostRevision again", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `post_revisions` SET `hidden`=? WHERE id = ?")).
+				WithArgs(false, 4).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(UnhidePostRevision(4)).Should(Succeed())
+		})
+
+		It("should return ErrEmptyID without executing any sql", func() {
+			Expect(UnhidePostRevision(0)).Should(Equal(ErrEmptyID))
+		})
+	})
+})
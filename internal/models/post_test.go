@@ -10,6 +10,7 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"regexp"
+	"strings"
 )
 
 var _ = Describe("Post", func() {
@@ -37,7 +38,7 @@ var _ = Describe("Post", func() {
 
 	Context("CreatePost", func() {
 		When("inserting a Post", func() {
-			It("should insert a new Post record with an Author an a Discussion", func() {
+			It("should insert a new Post record with an Author an a Discussion, and its first PostRevision", func() {
 				post := &Post{
 					AuthorID:     10,
 					DiscussionID: 5,
@@ -45,8 +46,13 @@ var _ = Describe("Post", func() {
 				}
 
 				mock.ExpectBegin()
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, post.AuthorID, post.DiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, PostFormatMarkdown, "<p>Marvel rules, DC drools</p>\n", post.AuthorID, post.DiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions` (`created_at`,`post_id`,`author_id`,`reason`,`content`,`format`,`hidden`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), 7, post.AuthorID, "", post.Content, PostFormatMarkdown, false).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -115,8 +121,8 @@ var _ = Describe("Post", func() {
 				}
 
 				mock.ExpectBegin()
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, post.AuthorID, post.DiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, PostFormatMarkdown, sqlmock.AnyArg(), post.AuthorID, post.DiscussionID, nil).
 					WillReturnError(errors.New("some db error"))
 				mock.ExpectRollback()
 
@@ -141,8 +147,12 @@ var _ = Describe("Post", func() {
 				}
 
 				mock.ExpectBegin()
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, post.AuthorID, post.DiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, PostFormatMarkdown, sqlmock.AnyArg(), post.AuthorID, post.DiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -167,8 +177,12 @@ var _ = Describe("Post", func() {
 				}
 
 				mock.ExpectBegin()
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`author_id`,`discussion_id`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, post.AuthorID, post.DiscussionID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `posts` (`created_at`,`updated_at`,`deleted_at`,`content`,`format`,`content_html`,`author_id`,`discussion_id`,`reply_to_id`) VALUES (?,?,?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, post.Content, PostFormatMarkdown, sqlmock.AnyArg(), post.AuthorID, post.DiscussionID, nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions`")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -180,4 +194,280 @@ var _ = Describe("Post", func() {
 			})
 		})
 	})
+
+	Context("GetPost", func() {
+		When("getting a Post that exists", func() {
+			It("should return the Post", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts` WHERE `posts`.`id` = ? AND `posts`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "content"}).AddRow(3, "some content"))
+
+				post, err := GetPost(3)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(post.Content).Should(Equal("some content"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a Post without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				post, err := GetPost(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+				Expect(post).Should(BeNil())
+			})
+		})
+	})
+
+	Context("GetPostTopicID", func() {
+		When("the Post exists, even deleted", func() {
+			It("should return the Topic of its Discussion", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT `discussions`.`topic_id` FROM `posts` JOIN discussions ON discussions.id = posts.discussion_id WHERE posts.id = ?")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"topic_id"}).AddRow(5))
+
+				topicID, err := GetPostTopicID(3)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(topicID).Should(Equal(uint(5)))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("the Post does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT `discussions`.`topic_id` FROM `posts`")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"topic_id"}))
+
+				_, err := GetPostTopicID(3)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("ListPosts", func() {
+		When("listing a page of Posts in a Discussion", func() {
+			It("should return the oldest Posts first", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts` WHERE discussion_id = ? AND `posts`.`deleted_at` IS NULL ORDER BY id LIMIT 20")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "content"}).AddRow(1, "first").AddRow(2, "second"))
+
+				posts, err := ListPosts(3, 0, 20)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(posts).Should(HaveLen(2))
+				Expect(posts[0].Content).Should(Equal("first"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("listing Posts without a DiscussionID", func() {
+			It("should return an error without executing any sql on database", func() {
+				posts, err := ListPosts(0, 0, 20)
+				Expect(err).Should(Equal(ErrEmptyDiscussionID))
+				Expect(posts).Should(BeNil())
+			})
+		})
+	})
+
+	Context("RenderContent", func() {
+		It("should render Markdown to sanitised HTML", func() {
+			rendered, err := RenderContent(PostFormatMarkdown, "**Winter** <script>alert(1)</script>[is](javascript:alert(1)) coming")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(rendered).Should(Equal("<p><strong>Winter</strong> <a rel=\"nofollow ugc\">is</a> coming</p>\n"))
+		})
+
+		It("should escape plain text and keep its line breaks", func() {
+			rendered, err := RenderContent(PostFormatPlain, "a <b>\nb\n\n\nc")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(rendered).Should(Equal("<p>a &lt;b&gt;<br />\nb</p>\n<p>c</p>\n"))
+		})
+
+		It("should return ErrUnknownFormat for other Formats", func() {
+			_, err := RenderContent("bbcode", "[b]x[/b]")
+			Expect(err).Should(Equal(ErrUnknownFormat))
+		})
+	})
+
+	Context("UpdatePost", func() {
+		When("updating a Post with Content", func() {
+			It("should update only the Content and its rendering, and save a PostRevision", func() {
+				post := &Post{Model: gorm.Model{ID: 3}, Content: "*edited* content", AuthorID: 10, DiscussionID: 20}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `updated_at`=?,`content`=?,`format`=?,`content_html`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), post.Content, PostFormatMarkdown, "<p><em>edited</em> content</p>\n", post.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `mentions` WHERE post_id = ?")).
+					WithArgs(post.ID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `post_revisions` (`created_at`,`post_id`,`author_id`,`reason`,`content`,`format`,`hidden`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), post.ID, 11, "typo", post.Content, PostFormatMarkdown, false).
+					WillReturnResult(sqlmock.NewResult(4, 1))
+				mock.ExpectCommit()
+
+				err := UpdatePost(post, 11, "typo")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating a Post with an unknown Format", func() {
+			It("should return ErrUnknownFormat without executing any sql on database", func() {
+				err := UpdatePost(&Post{Model: gorm.Model{ID: 3}, Content: "edited content", Format: "bbcode"}, 11, "")
+				Expect(err).Should(Equal(ErrUnknownFormat))
+			})
+		})
+
+		When("updating a Post without an editor", func() {
+			It("should return ErrEmptyUserID without executing any sql on database", func() {
+				err := UpdatePost(&Post{Model: gorm.Model{ID: 3}, Content: "edited content"}, 0, "")
+				Expect(err).Should(Equal(ErrEmptyUserID))
+			})
+		})
+
+		When("updating a Post with too long a Reason", func() {
+			It("should return ErrReasonTooLong without executing any sql on database", func() {
+				err := UpdatePost(&Post{Model: gorm.Model{ID: 3}, Content: "edited content"}, 11, strings.Repeat("x", MaxRevisionReasonLength+1))
+				Expect(err).Should(Equal(ErrReasonTooLong))
+			})
+		})
+
+		When("updating a Post with too long a Content", func() {
+			It("should return ErrContentTooLong without executing any sql on database", func() {
+				err := UpdatePost(&Post{Model: gorm.Model{ID: 3}, Content: strings.Repeat("é", MaxContentLength+1)}, 11, "")
+				Expect(err).Should(Equal(ErrContentTooLong))
+			})
+		})
+
+		When("updating a Post without Content", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdatePost(&Post{Model: gorm.Model{ID: 3}}, 11, "")
+				Expect(err).Should(Equal(ErrEmptyContent))
+			})
+		})
+
+		When("updating a Post that does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := UpdatePost(&Post{Model: gorm.Model{ID: 3}, Content: "edited content"}, 11, "")
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("DeletePost", func() {
+		When("deleting a Post", func() {
+			It("should soft delete the Post", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `deleted_at`=? WHERE `posts`.`id` = ? AND `posts`.`deleted_at` IS NULL")).
+					WithArgs(sqlmock.AnyArg(), 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := DeletePost(3)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting a Post without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := DeletePost(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+			})
+		})
+	})
+
+	Context("RestorePost", func() {
+		When("restoring a deleted Post in a Discussion that is not deleted", func() {
+			It("should clear DeletedAt", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts` WHERE deleted_at IS NOT NULL AND `posts`.`id` = ? LIMIT 1")).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "discussion_id"}).AddRow(7, 5))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions` WHERE `discussions`.`id` = ? AND `discussions`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `posts` SET `deleted_at`=?,`updated_at`=? WHERE `id` = ?")).
+					WithArgs(nil, sqlmock.AnyArg(), 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := RestorePost(7)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("restoring a Post whose Discussion is deleted", func() {
+			It("should rollback and return ErrDeletedParent", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "discussion_id"}).AddRow(7, 5))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussions`")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				err := RestorePost(7)
+				Expect(err).Should(Equal(ErrDeletedParent))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("PurgePost", func() {
+		When("purging a Post", func() {
+			It("should permanently remove the Post", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `posts` WHERE `posts`.`id` = ?")).
+					WithArgs(7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := PurgePost(7)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("purging a Post that does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `posts`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				err := PurgePost(7)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
 })
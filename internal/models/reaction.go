@@ -0,0 +1,196 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// ReactionTypes are the reactions Users may leave on Posts.
+var ReactionTypes = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+// Reaction is one User reacting to a Post with one of the ReactionTypes. A
+// User may leave each type of reaction on a Post once.
+type Reaction struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Post      Post   `gorm:"foreignKey:PostID"`
+	PostID    uint   `gorm:"not null;uniqueIndex:idx_reactions_post_user_type"`
+	User      User   `gorm:"foreignKey:UserID"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_reactions_post_user_type;index"`
+	Type      string `gorm:"not null;size:32;uniqueIndex:idx_reactions_post_user_type"`
+}
+
+type reactionCount struct {
+	PostID uint
+	Type   string
+	Count  int64
+}
+
+func IsReactionType(reactionType string) bool {
+	for _, t := range ReactionTypes {
+		if t == reactionType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddReaction leaves reaction on its Post. Reacting again the same way
+// changes nothing.
+func AddReaction(reaction *Reaction) error {
+	return AddReactionContext(context.Background(), database.DBConnection, reaction)
+}
+
+func AddReactionContext(ctx context.Context, db *gorm.DB, reaction *Reaction) error {
+	db = db.WithContext(ctx)
+
+	if reaction.PostID == 0 {
+		return ErrEmptyPostID
+	}
+
+	if reaction.UserID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if !IsReactionType(reaction.Type) {
+		return ErrUnknownReaction
+	}
+
+	err := db.Omit("Post", "User").Clauses(clause.OnConflict{DoNothing: true}).Create(reaction).Error
+	if err != nil {
+		log.Println("[ADD_REACTION]::DB_INSERT_REACTION_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+func RemoveReaction(postID, userID uint, reactionType string) error {
+	return RemoveReactionContext(context.Background(), database.DBConnection, postID, userID, reactionType)
+}
+
+func RemoveReactionContext(ctx context.Context, db *gorm.DB, postID, userID uint, reactionType string) error {
+	db = db.WithContext(ctx)
+
+	if postID == 0 {
+		return ErrEmptyPostID
+	}
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	result := db.Where("post_id = ? AND user_id = ? AND type = ?", postID, userID, reactionType).Delete(&Reaction{})
+	if result.Error != nil {
+		log.Println("[REMOVE_REACTION]::DB_DELETE_REACTION_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ListReactions lists who reacted to a Post, oldest first. An empty
+// reactionType lists every type.
+func ListReactions(postID uint, reactionType string, offset, limit int) ([]Reaction, error) {
+	return ListReactionsContext(context.Background(), database.DBConnection, postID, reactionType, offset, limit)
+}
+
+func ListReactionsContext(ctx context.Context, db *gorm.DB, postID uint, reactionType string, offset, limit int) ([]Reaction, error) {
+	db = db.WithContext(ctx)
+
+	if postID == 0 {
+		return nil, ErrEmptyPostID
+	}
+
+	query := db.Where("post_id = ?", postID)
+	if reactionType != "" {
+		query = query.Where("type = ?", reactionType)
+	}
+
+	var reactions []Reaction
+	if err := query.Order("id").Offset(offset).Limit(limit).Find(&reactions).Error; err != nil {
+		log.Println("[LIST_REACTIONS]::DB_SELECT_REACTIONS_ERROR 💥")
+		return nil, err
+	}
+
+	return reactions, nil
+}
+
+// CountPostReactions returns how often each type of reaction was left on each
+// of the Posts. Posts without reactions are left out.
+func CountPostReactions(postIDs []uint) (map[uint]map[string]int64, error) {
+	return CountPostReactionsContext(context.Background(), database.DBConnection, postIDs)
+}
+
+func CountPostReactionsContext(ctx context.Context, db *gorm.DB, postIDs []uint) (map[uint]map[string]int64, error) {
+	db = db.WithContext(ctx)
+
+	counts := map[uint]map[string]int64{}
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []reactionCount
+	err := db.Model(&Reaction{}).
+		Select("post_id, type, COUNT(*) AS count").
+		Where("post_id IN ?", postIDs).
+		Group("post_id, type").
+		Scan(&rows).Error
+
+	if err != nil {
+		log.Println("[COUNT_POST_REACTIONS]::DB_SELECT_REACTION_COUNTS_ERROR 💥")
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if counts[row.PostID] == nil {
+			counts[row.PostID] = map[string]int64{}
+		}
+		counts[row.PostID][row.Type] = row.Count
+	}
+
+	return counts, nil
+}
+
+// CountUserReactions returns how often each type of reaction was left on the
+// Posts a User wrote that have not been deleted.
+func CountUserReactions(userID uint) (map[string]int64, error) {
+	return CountUserReactionsContext(context.Background(), database.DBConnection, userID)
+}
+
+func CountUserReactionsContext(ctx context.Context, db *gorm.DB, userID uint) (map[string]int64, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	var rows []reactionCount
+	err := db.Model(&Reaction{}).
+		Select("reactions.type, COUNT(*) AS count").
+		Joins("JOIN posts ON posts.id = reactions.post_id").
+		Where("posts.author_id = ? AND posts.deleted_at IS NULL", userID).
+		Group("reactions.type").
+		Scan(&rows).Error
+
+	if err != nil {
+		log.Println("[COUNT_USER_REACTIONS]::DB_SELECT_REACTION_COUNTS_ERROR 💥")
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	for _, row := range rows {
+		counts[row.Type] = row.Count
+	}
+
+	return counts, nil
+}
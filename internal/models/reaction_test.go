@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Reaction", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("AddReaction", func() {
+		It("should insert the Reaction unless the User already reacted that way", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `reactions` (`created_at`,`post_id`,`user_id`,`type`) VALUES (?,?,?,?) ON CONFLICT DO NOTHING")).
+				WithArgs(sqlmock.AnyArg(), 3, 10, "like").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			Expect(AddReaction(&Reaction{PostID: 3, UserID: 10, Type: "like"})).Should(Succeed())
+		})
+
+		It("should return ErrUnknownReaction for types that are not configured", func() {
+			Expect(AddReaction(&Reaction{PostID: 3, UserID: 10, Type: "meh"})).Should(Equal(ErrUnknownReaction))
+		})
+
+		It("should return ErrEmptyPostID without executing any sql", func() {
+			Expect(AddReaction(&Reaction{UserID: 10, Type: "like"})).Should(Equal(ErrEmptyPostID))
+		})
+	})
+
+	Context("RemoveReaction", func() {
+		It("should delete the Reaction", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `reactions` WHERE post_id = ? AND user_id = ? AND type = ?")).
+				WithArgs(3, 10, "like").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(RemoveReaction(3, 10, "like")).Should(Succeed())
+		})
+
+		It("should return gorm.ErrRecordNotFound when there was no such Reaction", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `reactions`")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			Expect(RemoveReaction(3, 10, "like")).Should(Equal(gorm.ErrRecordNotFound))
+		})
+	})
+
+	Context("ListReactions", func() {
+		It("should list the Reactions of one type to a Post", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `reactions` WHERE post_id = ? AND type = ? ORDER BY id LIMIT 20")).
+				WithArgs(3, "like").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "post_id", "user_id", "type"}).AddRow(1, 3, 10, "like"))
+
+			reactions, err := ListReactions(3, "like", 0, 20)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(reactions).Should(HaveLen(1))
+			Expect(reactions[0].UserID).Should(Equal(uint(10)))
+		})
+	})
+
+	Context("CountPostReactions", func() {
+		It("should count each type of reaction per Post", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT post_id, type, COUNT(*) AS count FROM `reactions` WHERE post_id IN (?,?) GROUP BY post_id, type")).
+				WithArgs(3, 4).
+				WillReturnRows(sqlmock.NewRows([]string{"post_id", "type", "count"}).AddRow(3, "like", 2).AddRow(3, "sad", 1))
+
+			counts, err := CountPostReactions([]uint{3, 4})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(counts).Should(Equal(map[uint]map[string]int64{3: {"like": 2, "sad": 1}}))
+		})
+
+		It("should not query for no Posts", func() {
+			counts, err := CountPostReactions(nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(counts).Should(BeEmpty())
+		})
+	})
+
+	Context("CountUserReactions", func() {
+		It("should count the reactions to the Posts of the User", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT reactions.type, COUNT(*) AS count FROM `reactions` JOIN posts ON posts.id = reactions.post_id WHERE posts.author_id = ? AND posts.deleted_at IS NULL GROUP BY `reactions`.`type`")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"type", "count"}).AddRow("like", 5))
+
+			counts, err := CountUserReactions(10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(counts).Should(Equal(map[string]int64{"like": 5}))
+		})
+	})
+})
@@ -0,0 +1,297 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// DiscussionRead remembers the last Post of a Discussion a User has read. It
+// is only written when the User reads further than before, and dropped once a
+// TopicRead covers it, so that there is at most one per User and Discussion.
+type DiscussionRead struct {
+	UserID         uint       `gorm:"primaryKey"`
+	User           User       `gorm:"foreignKey:UserID"`
+	DiscussionID   uint       `gorm:"primaryKey;index"`
+	Discussion     Discussion `gorm:"foreignKey:DiscussionID"`
+	LastReadPostID uint       `gorm:"not null"`
+	UpdatedAt      time.Time
+}
+
+// TopicRead marks every Post of a Topic up to LastReadPostID as read for a
+// User, which is how a Topic or the whole forum is marked read.
+type TopicRead struct {
+	UserID         uint  `gorm:"primaryKey"`
+	User           User  `gorm:"foreignKey:UserID"`
+	TopicID        uint  `gorm:"primaryKey;index"`
+	Topic          Topic `gorm:"foreignKey:TopicID"`
+	LastReadPostID uint  `gorm:"not null"`
+	UpdatedAt      time.Time
+}
+
+type topicCount struct {
+	TopicID uint
+	Count   int64
+}
+
+type discussionCount struct {
+	DiscussionID uint
+	Count        int64
+}
+
+// MarkDiscussionRead marks the Posts of a Discussion up to postID as read by
+// the User, or all of them when postID is 0. Reading less far than before
+// changes nothing.
+func MarkDiscussionRead(userID, discussionID, postID uint) error {
+	return MarkDiscussionReadContext(context.Background(), database.DBConnection, userID, discussionID, postID)
+}
+
+func MarkDiscussionReadContext(ctx context.Context, db *gorm.DB, userID, discussionID, postID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if discussionID == 0 {
+		return ErrEmptyDiscussionID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if postID == 0 {
+			err := tx.Model(&Post{}).Where("discussion_id = ?", discussionID).Select("COALESCE(MAX(id), 0)").Scan(&postID).Error
+			if err != nil {
+				log.Println("[MARK_DISCUSSION_READ]::DB_SELECT_LAST_POST_ERROR 💥")
+				return err
+			}
+
+			if postID == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+
+		read := &DiscussionRead{UserID: userID, DiscussionID: discussionID, LastReadPostID: postID}
+		if err := advanceRead(tx, read, postID); err != nil {
+			log.Println("[MARK_DISCUSSION_READ]::DB_UPSERT_DISCUSSION_READ_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+// MarkTopicRead marks every Post in the Discussions of a Topic as read by the
+// User. Posts in its sub-Topics are left as they are.
+func MarkTopicRead(userID, topicID uint) error {
+	return MarkTopicReadContext(context.Background(), database.DBConnection, userID, topicID)
+}
+
+func MarkTopicReadContext(ctx context.Context, db *gorm.DB, userID, topicID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if topicID == 0 {
+		return ErrEmptyTopicID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		return markTopicsRead(tx, userID, []uint{topicID})
+	})
+}
+
+// MarkAllRead marks every Post on the forum as read by the User.
+func MarkAllRead(userID uint) error {
+	return MarkAllReadContext(context.Background(), database.DBConnection, userID)
+}
+
+func MarkAllReadContext(ctx context.Context, db *gorm.DB, userID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var topicIDs []uint
+		if err := tx.Model(&Topic{}).Order("id").Pluck("id", &topicIDs).Error; err != nil {
+			log.Println("[MARK_ALL_READ]::DB_SELECT_TOPICS_ERROR 💥")
+			return err
+		}
+
+		return markTopicsRead(tx, userID, topicIDs)
+	})
+}
+
+// CountUnreadPostsByTopic returns how many Posts the User has not read in each
+// of the Topics. Topics without unread Posts are left out.
+func CountUnreadPostsByTopic(userID uint, topicIDs []uint) (map[uint]int64, error) {
+	return CountUnreadPostsByTopicContext(context.Background(), database.DBConnection, userID, topicIDs)
+}
+
+func CountUnreadPostsByTopicContext(ctx context.Context, db *gorm.DB, userID uint, topicIDs []uint) (map[uint]int64, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	counts := map[uint]int64{}
+	if len(topicIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []topicCount
+	err := unreadPosts(db, userID).
+		Select("discussions.topic_id, COUNT(*) AS count").
+		Where("discussions.topic_id IN ?", topicIDs).
+		Group("discussions.topic_id").
+		Scan(&rows).Error
+
+	if err != nil {
+		log.Println("[COUNT_UNREAD_POSTS_BY_TOPIC]::DB_SELECT_POST_COUNTS_ERROR 💥")
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.TopicID] = row.Count
+	}
+
+	return counts, nil
+}
+
+// CountUnreadPostsByDiscussion returns how many Posts the User has not read
+// in each of the Discussions. Discussions without unread Posts are left out.
+func CountUnreadPostsByDiscussion(userID uint, discussionIDs []uint) (map[uint]int64, error) {
+	return CountUnreadPostsByDiscussionContext(context.Background(), database.DBConnection, userID, discussionIDs)
+}
+
+func CountUnreadPostsByDiscussionContext(ctx context.Context, db *gorm.DB, userID uint, discussionIDs []uint) (map[uint]int64, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	counts := map[uint]int64{}
+	if len(discussionIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []discussionCount
+	err := unreadPosts(db, userID).
+		Select("posts.discussion_id, COUNT(*) AS count").
+		Where("posts.discussion_id IN ?", discussionIDs).
+		Group("posts.discussion_id").
+		Scan(&rows).Error
+
+	if err != nil {
+		log.Println("[COUNT_UNREAD_POSTS_BY_DISCUSSION]::DB_SELECT_POST_COUNTS_ERROR 💥")
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.DiscussionID] = row.Count
+	}
+
+	return counts, nil
+}
+
+// FirstUnreadPost returns the first Post of a Discussion the User has not
+// read, or its last Post when they have read them all, together with the
+// number of Posts before it for finding its page.
+func FirstUnreadPost(userID, discussionID uint) (*Post, int64, error) {
+	return FirstUnreadPostContext(context.Background(), database.DBConnection, userID, discussionID)
+}
+
+func FirstUnreadPostContext(ctx context.Context, db *gorm.DB, userID, discussionID uint) (*Post, int64, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, 0, ErrEmptyUserID
+	}
+
+	if discussionID == 0 {
+		return nil, 0, ErrEmptyDiscussionID
+	}
+
+	post := &Post{}
+	err := unreadPosts(db, userID).Where("posts.discussion_id = ?", discussionID).Order("posts.id").Take(post).Error
+	if err == gorm.ErrRecordNotFound {
+		err = db.Where("discussion_id = ?", discussionID).Order("id DESC").Take(post).Error
+	}
+
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			log.Println("[FIRST_UNREAD_POST]::DB_SELECT_POST_ERROR 💥")
+		}
+		return nil, 0, err
+	}
+
+	var offset int64
+	if err := db.Model(&Post{}).Where("discussion_id = ? AND id < ?", discussionID, post.ID).Count(&offset).Error; err != nil {
+		log.Println("[FIRST_UNREAD_POST]::DB_COUNT_POSTS_ERROR 💥")
+		return nil, 0, err
+	}
+
+	return post, offset, nil
+}
+
+// markTopicsRead moves the TopicRead of each Topic up to the latest Post and
+// drops the DiscussionReads it now covers.
+func markTopicsRead(tx *gorm.DB, userID uint, topicIDs []uint) error {
+	var last uint
+	if err := tx.Unscoped().Model(&Post{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error; err != nil {
+		log.Println("[MARK_TOPICS_READ]::DB_SELECT_LAST_POST_ERROR 💥")
+		return err
+	}
+
+	if last == 0 || len(topicIDs) == 0 {
+		return nil
+	}
+
+	for _, topicID := range topicIDs {
+		read := &TopicRead{UserID: userID, TopicID: topicID, LastReadPostID: last}
+		if err := advanceRead(tx, read, last); err != nil {
+			log.Println("[MARK_TOPICS_READ]::DB_UPSERT_TOPIC_READ_ERROR 💥")
+			return err
+		}
+	}
+
+	discussions := tx.Unscoped().Model(&Discussion{}).Select("id").Where("topic_id IN ?", topicIDs)
+	err := tx.Where("user_id = ? AND last_read_post_id <= ? AND discussion_id IN (?)", userID, last, discussions).
+		Delete(&DiscussionRead{}).Error
+
+	if err != nil {
+		log.Println("[MARK_TOPICS_READ]::DB_DELETE_DISCUSSION_READS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+// advanceRead moves an existing read mark forward to postID, or creates it
+// when there is none yet. A mark that is already further along is left alone.
+func advanceRead(tx *gorm.DB, read interface{}, postID uint) error {
+	result := tx.Model(read).Where("last_read_post_id < ?", postID).Update("last_read_post_id", postID)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+
+	return tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(read).Error
+}
+
+// unreadPosts selects the Posts the User has neither read nor written.
+func unreadPosts(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Model(&Post{}).
+		Joins("JOIN discussions ON discussions.id = posts.discussion_id AND discussions.deleted_at IS NULL").
+		Joins("LEFT JOIN discussion_reads ON discussion_reads.discussion_id = posts.discussion_id AND discussion_reads.user_id = ?", userID).
+		Joins("LEFT JOIN topic_reads ON topic_reads.topic_id = discussions.topic_id AND topic_reads.user_id = ?", userID).
+		Where("posts.id > COALESCE(discussion_reads.last_read_post_id, 0) AND posts.id > COALESCE(topic_reads.last_read_post_id, 0)").
+		Where("posts.author_id <> ?", userID)
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("ReadState", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("MarkDiscussionRead", func() {
+		It("should move the read mark forward", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussion_reads` SET `last_read_post_id`=?,`updated_at`=? WHERE last_read_post_id < ? AND `user_id` = ? AND `discussion_id` = ?")).
+				WithArgs(7, sqlmock.AnyArg(), 7, 10, 3).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(MarkDiscussionRead(10, 3, 7)).Should(Succeed())
+		})
+
+		It("should create the read mark when there is none yet", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussion_reads`")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_reads` (`user_id`,`discussion_id`,`last_read_post_id`,`updated_at`) VALUES (?,?,?,?) ON CONFLICT DO NOTHING")).
+				WithArgs(10, 3, 7, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(MarkDiscussionRead(10, 3, 7)).Should(Succeed())
+		})
+
+		It("should mark up to the last Post when no Post is given", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(id), 0) FROM `posts` WHERE discussion_id = ? AND `posts`.`deleted_at` IS NULL")).
+				WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(9))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `discussion_reads`")).
+				WithArgs(9, sqlmock.AnyArg(), 9, 10, 3).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(MarkDiscussionRead(10, 3, 0)).Should(Succeed())
+		})
+
+		It("should return gorm.ErrRecordNotFound when the Discussion has no Posts", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(id), 0) FROM `posts`")).
+				WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(0))
+			mock.ExpectRollback()
+
+			Expect(MarkDiscussionRead(10, 3, 0)).Should(Equal(gorm.ErrRecordNotFound))
+		})
+
+		It("should return ErrEmptyUserID without executing any sql", func() {
+			Expect(MarkDiscussionRead(0, 3, 7)).Should(Equal(ErrEmptyUserID))
+		})
+	})
+
+	Context("MarkTopicRead", func() {
+		It("should mark the Topic read up to the latest Post and drop the Discussion marks it covers", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(id), 0) FROM `posts`")).
+				WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(20))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `topic_reads` SET `last_read_post_id`=?,`updated_at`=? WHERE last_read_post_id < ? AND `user_id` = ? AND `topic_id` = ?")).
+				WithArgs(20, sqlmock.AnyArg(), 20, 10, 2).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `discussion_reads` WHERE user_id = ? AND last_read_post_id <= ? AND discussion_id IN (SELECT `id` FROM `discussions` WHERE topic_id IN (?))")).
+				WithArgs(10, 20, 2).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectCommit()
+
+			Expect(MarkTopicRead(10, 2)).Should(Succeed())
+		})
+
+		It("should return ErrEmptyTopicID without executing any sql", func() {
+			Expect(MarkTopicRead(10, 0)).Should(Equal(ErrEmptyTopicID))
+		})
+	})
+
+	Context("MarkAllRead", func() {
+		It("should mark every Topic read", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `topics`")).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(id), 0) FROM `posts`")).
+				WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(20))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `topic_reads`")).
+				WithArgs(20, sqlmock.AnyArg(), 20, 10, 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `topic_reads`")).
+				WithArgs(20, sqlmock.AnyArg(), 20, 10, 2).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `discussion_reads`")).
+				WithArgs(10, 20, 1, 2).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			Expect(MarkAllRead(10)).Should(Succeed())
+		})
+	})
+
+	Context("CountUnreadPostsByTopic", func() {
+		It("should count the unread Posts of each Topic", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT discussions.topic_id, COUNT(*) AS count FROM `posts` JOIN discussions ON discussions.id = posts.discussion_id AND discussions.deleted_at IS NULL LEFT JOIN discussion_reads ON discussion_reads.discussion_id = posts.discussion_id AND discussion_reads.user_id = ? LEFT JOIN topic_reads ON topic_reads.topic_id = discussions.topic_id AND topic_reads.user_id = ? WHERE (posts.id > COALESCE(discussion_reads.last_read_post_id, 0) AND posts.id > COALESCE(topic_reads.last_read_post_id, 0)) AND (posts.author_id <> ?) AND discussions.topic_id IN (?,?) AND `posts`.`deleted_at` IS NULL GROUP BY `discussions`.`topic_id`")).
+				WithArgs(10, 10, 10, 1, 2).
+				WillReturnRows(sqlmock.NewRows([]string{"topic_id", "count"}).AddRow(2, 5))
+
+			counts, err := CountUnreadPostsByTopic(10, []uint{1, 2})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(counts).Should(Equal(map[uint]int64{2: 5}))
+		})
+
+		It("should not execute any sql without Topics", func() {
+			counts, err := CountUnreadPostsByTopic(10, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(counts).Should(BeEmpty())
+		})
+	})
+
+	Context("CountUnreadPostsByDiscussion", func() {
+		It("should count the unread Posts of each Discussion", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT posts.discussion_id, COUNT(*) AS count FROM `posts`")).
+				WithArgs(10, 10, 10, 3).
+				WillReturnRows(sqlmock.NewRows([]string{"discussion_id", "count"}).AddRow(3, 2))
+
+			counts, err := CountUnreadPostsByDiscussion(10, []uint{3})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(counts).Should(Equal(map[uint]int64{3: 2}))
+		})
+	})
+
+	Context("FirstUnreadPost", func() {
+		It("should return the first unread Post and how many Posts come before it", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `posts`.`id`")).
+				WithArgs(10, 10, 10, 3).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "discussion_id"}).AddRow(8, 3))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `posts` WHERE (discussion_id = ? AND id < ?) AND `posts`.`deleted_at` IS NULL")).
+				WithArgs(3, 8).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+			post, offset, err := FirstUnreadPost(10, 3)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(post.ID).Should(Equal(uint(8)))
+			Expect(offset).Should(Equal(int64(4)))
+		})
+
+		It("should fall back to the last Post when everything is read", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `posts`.`id`")).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `posts` WHERE discussion_id = ? AND `posts`.`deleted_at` IS NULL ORDER BY id DESC LIMIT 1")).
+				WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "discussion_id"}).AddRow(9, 3))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `posts`")).
+				WithArgs(3, 9).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+			post, offset, err := FirstUnreadPost(10, 3)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(post.ID).Should(Equal(uint(9)))
+			Expect(offset).Should(Equal(int64(5)))
+		})
+	})
+})
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// Session is a server-side login. Only the SHA-256 digest of the token handed
+// to the client is stored, so a leaked sessions table cannot be replayed.
+type Session struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UserAgent string    `gorm:"size:255"`
+	IPAddress string    `gorm:"size:64"`
+	User      User      `gorm:"foreignKey:UserID"`
+	UserID    uint      `gorm:"not null;index"`
+}
+
+func CreateSession(session *Session) (string, error) {
+	return CreateSessionContext(context.Background(), database.DBConnection, session)
+}
+
+func CreateSessionContext(ctx context.Context, db *gorm.DB, session *Session) (string, error) {
+	db = db.WithContext(ctx)
+
+	if session.UserID == 0 {
+		return "", ErrEmptyUserID
+	}
+
+	if session.ExpiresAt.IsZero() {
+		return "", ErrEmptyExpiresAt
+	}
+
+	token, err := tokens.Generate(tokens.DefaultLength)
+	if err != nil {
+		log.Println("[CREATE_SESSION]::GENERATE_TOKEN_ERROR 💥")
+		return "", err
+	}
+	session.ID = tokens.Hash(token)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User").Create(session).Error; err != nil {
+			log.Println("[CREATE_SESSION]::DB_INSERT_SESSION_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func GetSession(token string) (*Session, error) {
+	return GetSessionContext(context.Background(), database.DBConnection, token)
+}
+
+func GetSessionContext(ctx context.Context, db *gorm.DB, token string) (*Session, error) {
+	db = db.WithContext(ctx)
+
+	if token == "" {
+		return nil, ErrEmptyToken
+	}
+
+	session := &Session{}
+	err := db.
+		Preload("User").
+		Where("id = ? AND expires_at > ?", tokens.Hash(token), time.Now()).
+		Take(session).Error
+
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrInvalidSession
+	}
+
+	if err != nil {
+		log.Println("[GET_SESSION]::DB_SELECT_SESSION_ERROR 💥")
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func DeleteSession(token string) error {
+	return DeleteSessionContext(context.Background(), database.DBConnection, token)
+}
+
+func DeleteSessionContext(ctx context.Context, db *gorm.DB, token string) error {
+	db = db.WithContext(ctx)
+
+	if token == "" {
+		return ErrEmptyToken
+	}
+
+	if err := db.Where("id = ?", tokens.Hash(token)).Delete(&Session{}).Error; err != nil {
+		log.Println("[DELETE_SESSION]::DB_DELETE_SESSION_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+func DeleteUserSessions(userID uint) error {
+	return DeleteUserSessionsContext(context.Background(), database.DBConnection, userID)
+}
+
+func DeleteUserSessionsContext(ctx context.Context, db *gorm.DB, userID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if err := db.Where("user_id = ?", userID).Delete(&Session{}).Error; err != nil {
+		log.Println("[DELETE_USER_SESSIONS]::DB_DELETE_SESSIONS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+func DeleteExpiredSessions() error {
+	return DeleteExpiredSessionsContext(context.Background(), database.DBConnection)
+}
+
+func DeleteExpiredSessionsContext(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&Session{}).Error; err != nil {
+		log.Println("[DELETE_EXPIRED_SESSIONS]::DB_DELETE_SESSIONS_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("Session", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		gormDB, err := database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(gormDB).ShouldNot(BeNil())
+		Expect(gormDB.DB()).Should(BeIdenticalTo(db))
+	})
+	AfterEach(func() {
+		db.Close()
+	})
+
+	Context("CreateSession", func() {
+		When("inserting a Session with a UserID and ExpiresAt", func() {
+			It("should store the hash of the token and return the token", func() {
+				session := &Session{
+					UserID:    10,
+					ExpiresAt: time.Now().Add(time.Hour),
+					UserAgent: "ginkgo",
+					IPAddress: "127.0.0.1",
+				}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `sessions` (`id`,`created_at`,`updated_at`,`expires_at`,`user_agent`,`ip_address`,`user_id`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), session.ExpiresAt, session.UserAgent, session.IPAddress, session.UserID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				token, err := CreateSession(session)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(token).ShouldNot(BeEmpty())
+				Expect(session.ID).Should(Equal(tokens.Hash(token)))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("inserting a Session without a UserID", func() {
+			It("should return an error without executing any sql on database", func() {
+				token, err := CreateSession(&Session{ExpiresAt: time.Now().Add(time.Hour)})
+				Expect(err).Should(Equal(ErrEmptyUserID))
+				Expect(token).Should(BeEmpty())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("inserting a Session without an ExpiresAt", func() {
+			It("should return an error without executing any sql on database", func() {
+				token, err := CreateSession(&Session{UserID: 10})
+				Expect(err).Should(Equal(ErrEmptyExpiresAt))
+				Expect(token).Should(BeEmpty())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("inserting a Session that errors", func() {
+			It("should rollback the transaction and not return a token", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `sessions`")).
+					WillReturnError(errors.New("some db error"))
+				mock.ExpectRollback()
+
+				token, err := CreateSession(&Session{UserID: 10, ExpiresAt: time.Now().Add(time.Hour)})
+				Expect(err).Should(HaveOccurred())
+				Expect(token).Should(BeEmpty())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("GetSession", func() {
+		When("getting a Session that exists and has not expired", func() {
+			It("should return the Session with its User", func() {
+				token := "some token"
+
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `sessions` WHERE id = ? AND expires_at > ? LIMIT 1")).
+					WithArgs(tokens.Hash(token), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(tokens.Hash(token), 10))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL")).
+					WithArgs(10).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(10, "MotherOfDragons"))
+
+				session, err := GetSession(token)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(session.UserID).Should(Equal(uint(10)))
+				Expect(session.User.UserName).Should(Equal("MotherOfDragons"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a Session that does not exist or has expired", func() {
+			It("should return ErrInvalidSession", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `sessions` WHERE id = ? AND expires_at > ? LIMIT 1")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}))
+
+				session, err := GetSession("some token")
+				Expect(err).Should(Equal(ErrInvalidSession))
+				Expect(session).Should(BeNil())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a Session with an empty token", func() {
+			It("should return an error without executing any sql on database", func() {
+				session, err := GetSession("")
+				Expect(err).Should(Equal(ErrEmptyToken))
+				Expect(session).Should(BeNil())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("DeleteSession", func() {
+		When("deleting a Session by token", func() {
+			It("should delete the Session matching the hash of the token", func() {
+				token := "some token"
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE id = ?")).
+					WithArgs(tokens.Hash(token)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := DeleteSession(token)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting a Session with an empty token", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := DeleteSession("")
+				Expect(err).Should(Equal(ErrEmptyToken))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("DeleteUserSessions", func() {
+		When("deleting every Session for a User", func() {
+			It("should delete all Sessions with the UserID", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE user_id = ?")).
+					WithArgs(10).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+
+				err := DeleteUserSessions(10)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting every Session without a UserID", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := DeleteUserSessions(0)
+				Expect(err).Should(Equal(ErrEmptyUserID))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting every Session for a User errors", func() {
+			It("should return the error", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE user_id = ?")).
+					WillReturnError(errors.New("some db error"))
+				mock.ExpectRollback()
+
+				err := DeleteUserSessions(10)
+				Expect(err).Should(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("DeleteExpiredSessions", func() {
+		When("deleting expired Sessions", func() {
+			It("should delete every Session whose ExpiresAt has passed", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE expires_at <= ?")).
+					WithArgs(sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+
+				err := DeleteExpiredSessions()
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// DiscussionSubscription has its User notified of every new Post in a
+// Discussion. Users are subscribed to the Discussions they start or reply to.
+type DiscussionSubscription struct {
+	UserID       uint       `gorm:"primaryKey"`
+	User         User       `gorm:"foreignKey:UserID"`
+	DiscussionID uint       `gorm:"primaryKey;index"`
+	Discussion   Discussion `gorm:"foreignKey:DiscussionID"`
+	CreatedAt    time.Time
+}
+
+// TopicSubscription has its User notified of every new Discussion and Post in
+// a Topic. Its sub-Topics are not included.
+type TopicSubscription struct {
+	UserID    uint  `gorm:"primaryKey"`
+	User      User  `gorm:"foreignKey:UserID"`
+	TopicID   uint  `gorm:"primaryKey;index"`
+	Topic     Topic `gorm:"foreignKey:TopicID"`
+	CreatedAt time.Time
+}
+
+func SubscribeDiscussion(userID, discussionID uint) error {
+	return SubscribeDiscussionContext(context.Background(), database.DBConnection, userID, discussionID)
+}
+
+func SubscribeDiscussionContext(ctx context.Context, db *gorm.DB, userID, discussionID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if discussionID == 0 {
+		return ErrEmptyDiscussionID
+	}
+
+	if err := subscribeDiscussion(db, userID, discussionID); err != nil {
+		log.Println("[SUBSCRIBE_DISCUSSION]::DB_INSERT_DISCUSSION_SUBSCRIPTION_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+func UnsubscribeDiscussion(userID, discussionID uint) error {
+	return UnsubscribeDiscussionContext(context.Background(), database.DBConnection, userID, discussionID)
+}
+
+func UnsubscribeDiscussionContext(ctx context.Context, db *gorm.DB, userID, discussionID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if discussionID == 0 {
+		return ErrEmptyDiscussionID
+	}
+
+	result := db.Where("user_id = ? AND discussion_id = ?", userID, discussionID).Delete(&DiscussionSubscription{})
+	if result.Error != nil {
+		log.Println("[UNSUBSCRIBE_DISCUSSION]::DB_DELETE_DISCUSSION_SUBSCRIPTION_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func SubscribeTopic(userID, topicID uint) error {
+	return SubscribeTopicContext(context.Background(), database.DBConnection, userID, topicID)
+}
+
+func SubscribeTopicContext(ctx context.Context, db *gorm.DB, userID, topicID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if topicID == 0 {
+		return ErrEmptyTopicID
+	}
+
+	subscription := &TopicSubscription{UserID: userID, TopicID: topicID}
+	if err := db.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(subscription).Error; err != nil {
+		log.Println("[SUBSCRIBE_TOPIC]::DB_INSERT_TOPIC_SUBSCRIPTION_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+func UnsubscribeTopic(userID, topicID uint) error {
+	return UnsubscribeTopicContext(context.Background(), database.DBConnection, userID, topicID)
+}
+
+func UnsubscribeTopicContext(ctx context.Context, db *gorm.DB, userID, topicID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if topicID == 0 {
+		return ErrEmptyTopicID
+	}
+
+	result := db.Where("user_id = ? AND topic_id = ?", userID, topicID).Delete(&TopicSubscription{})
+	if result.Error != nil {
+		log.Println("[UNSUBSCRIBE_TOPIC]::DB_DELETE_TOPIC_SUBSCRIPTION_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ListSubscriptions returns the Discussions and Topics the User watches,
+// oldest subscription first.
+func ListSubscriptions(userID uint) ([]DiscussionSubscription, []TopicSubscription, error) {
+	return ListSubscriptionsContext(context.Background(), database.DBConnection, userID)
+}
+
+func ListSubscriptionsContext(ctx context.Context, db *gorm.DB, userID uint) ([]DiscussionSubscription, []TopicSubscription, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, nil, ErrEmptyUserID
+	}
+
+	var discussions []DiscussionSubscription
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&discussions).Error; err != nil {
+		log.Println("[LIST_SUBSCRIPTIONS]::DB_SELECT_DISCUSSION_SUBSCRIPTIONS_ERROR 💥")
+		return nil, nil, err
+	}
+
+	var topics []TopicSubscription
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&topics).Error; err != nil {
+		log.Println("[LIST_SUBSCRIPTIONS]::DB_SELECT_TOPIC_SUBSCRIPTIONS_ERROR 💥")
+		return nil, nil, err
+	}
+
+	return discussions, topics, nil
+}
+
+// ListSubscribers returns the IDs of the Users who watch a Discussion, either
+// directly or through its Topic.
+func ListSubscribers(discussionID, topicID uint) ([]uint, error) {
+	return ListSubscribersContext(context.Background(), database.DBConnection, discussionID, topicID)
+}
+
+func ListSubscribersContext(ctx context.Context, db *gorm.DB, discussionID, topicID uint) ([]uint, error) {
+	db = db.WithContext(ctx)
+
+	if discussionID == 0 {
+		return nil, ErrEmptyDiscussionID
+	}
+
+	if topicID == 0 {
+		return nil, ErrEmptyTopicID
+	}
+
+	var userIDs []uint
+	err := db.Raw(
+		"SELECT user_id FROM discussion_subscriptions WHERE discussion_id = ? UNION SELECT user_id FROM topic_subscriptions WHERE topic_id = ?",
+		discussionID, topicID,
+	).Scan(&userIDs).Error
+
+	if err != nil {
+		log.Println("[LIST_SUBSCRIBERS]::DB_SELECT_SUBSCRIBERS_ERROR 💥")
+		return nil, err
+	}
+
+	return userIDs, nil
+}
+
+func subscribeDiscussion(tx *gorm.DB, userID, discussionID uint) error {
+	subscription := &DiscussionSubscription{UserID: userID, DiscussionID: discussionID}
+	return tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(subscription).Error
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Subscription", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("SubscribeDiscussion", func() {
+		It("should subscribe the User, once", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `discussion_subscriptions` (`user_id`,`discussion_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
+				WithArgs(10, 3, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(SubscribeDiscussion(10, 3)).Should(Succeed())
+		})
+
+		It("should return ErrEmptyDiscussionID without executing any sql", func() {
+			Expect(SubscribeDiscussion(10, 0)).Should(Equal(ErrEmptyDiscussionID))
+		})
+	})
+
+	Context("UnsubscribeDiscussion", func() {
+		It("should return gorm.ErrRecordNotFound when the User was not subscribed", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `discussion_subscriptions` WHERE user_id = ? AND discussion_id = ?")).
+				WithArgs(10, 3).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			Expect(UnsubscribeDiscussion(10, 3)).Should(Equal(gorm.ErrRecordNotFound))
+		})
+	})
+
+	Context("SubscribeTopic", func() {
+		It("should subscribe the User, once", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `topic_subscriptions` (`user_id`,`topic_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
+				WithArgs(10, 2, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(SubscribeTopic(10, 2)).Should(Succeed())
+		})
+	})
+
+	Context("UnsubscribeTopic", func() {
+		It("should unsubscribe the User", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `topic_subscriptions` WHERE user_id = ? AND topic_id = ?")).
+				WithArgs(10, 2).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(UnsubscribeTopic(10, 2)).Should(Succeed())
+		})
+	})
+
+	Context("ListSubscriptions", func() {
+		It("should list the Discussions and Topics the User subscribed to", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `discussion_subscriptions` WHERE user_id = ? ORDER BY created_at")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "discussion_id"}).AddRow(10, 3).AddRow(10, 4))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topic_subscriptions` WHERE user_id = ? ORDER BY created_at")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "topic_id"}).AddRow(10, 2))
+
+			discussions, topics, err := ListSubscriptions(10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(discussions).Should(HaveLen(2))
+			Expect(topics).Should(HaveLen(1))
+		})
+	})
+
+	Context("ListSubscribers", func() {
+		It("should list the Users subscribed to the Discussion or its Topic", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id FROM discussion_subscriptions WHERE discussion_id = ? UNION SELECT user_id FROM topic_subscriptions WHERE topic_id = ?")).
+				WithArgs(3, 2).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(10).AddRow(11))
+
+			Expect(ListSubscribers(3, 2)).Should(Equal([]uint{10, 11}))
+		})
+
+		It("should return ErrEmptyTopicID without executing any sql", func() {
+			_, err := ListSubscribers(3, 0)
+			Expect(err).Should(Equal(ErrEmptyTopicID))
+		})
+	})
+})
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"github.com/golangbb/golangbb/v2/internal/database"
 	"gorm.io/gorm"
 	"log"
@@ -9,13 +11,21 @@ import (
 type Topic struct {
 	gorm.Model
 	Title    string `gorm:"uniqueIndex" gorm:"not null" gorm:"size:96"`
-	ParentID *uint  `gorm:"TYPE:integer REFERENCES topics"`
+	ParentID *uint  `gorm:"index"`
 	Parent   *Topic
-	Author   User `gorm:"foreignKey:AuthorID"`
+	Children []Topic `gorm:"foreignKey:ParentID"`
+	Position int     `gorm:"not null;default:0"`
+	Author   User    `gorm:"foreignKey:AuthorID"`
 	AuthorID uint
 }
 
 func CreateTopic(topic *Topic) error {
+	return CreateTopicContext(context.Background(), database.DBConnection, topic)
+}
+
+func CreateTopicContext(ctx context.Context, db *gorm.DB, topic *Topic) error {
+	db = db.WithContext(ctx)
+
 	if topic.Title == "" {
 		return ErrEmptyTitle
 	}
@@ -24,8 +34,25 @@ func CreateTopic(topic *Topic) error {
 		return ErrEmptyUserID
 	}
 
-	err := database.DBConnection.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Omit("Parent", "Author").Create(topic).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		index, err := loadTopicIndex(tx)
+		if err != nil {
+			log.Println("[CREATE_TOPIC]::DB_SELECT_TOPICS_ERROR 💥")
+			return err
+		}
+
+		if topic.ParentID != nil {
+			if _, ok := index.byID[*topic.ParentID]; !ok {
+				return gorm.ErrRecordNotFound
+			}
+
+			if index.depth(*topic.ParentID)+1 > MaxTopicDepth {
+				return ErrTopicTooDeep
+			}
+		}
+
+		topic.Position = index.nextPosition(topic.ParentID)
+		if err := tx.Omit("Parent", "Children", "Author").Create(topic).Error; err != nil {
 			log.Println("[CREATE_TOPIC]::DB_INSERT_TOPIC_ERROR 💥")
 			return err
 		}
@@ -39,3 +66,193 @@ func CreateTopic(topic *Topic) error {
 
 	return nil
 }
+
+func GetTopic(id uint) (*Topic, error) {
+	return GetTopicContext(context.Background(), database.DBConnection, id)
+}
+
+func GetTopicContext(ctx context.Context, db *gorm.DB, id uint) (*Topic, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	topic := &Topic{}
+	if err := db.Take(topic, id).Error; err != nil {
+		log.Println("[GET_TOPIC]::DB_SELECT_TOPIC_ERROR 💥")
+		return nil, err
+	}
+
+	return topic, nil
+}
+
+func ListTopics() ([]Topic, error) {
+	return ListTopicsContext(context.Background(), database.DBConnection)
+}
+
+func ListTopicsContext(ctx context.Context, db *gorm.DB) ([]Topic, error) {
+	db = db.WithContext(ctx)
+
+	var topics []Topic
+	if err := db.Order("id").Find(&topics).Error; err != nil {
+		log.Println("[LIST_TOPICS]::DB_SELECT_TOPICS_ERROR 💥")
+		return nil, err
+	}
+
+	return topics, nil
+}
+
+// UpdateTopic renames a Topic. Its place in the tree is changed with MoveTopic
+// so that cycles and the depth limit are always checked.
+func UpdateTopic(topic *Topic) error {
+	return UpdateTopicContext(context.Background(), database.DBConnection, topic)
+}
+
+func UpdateTopicContext(ctx context.Context, db *gorm.DB, topic *Topic) error {
+	db = db.WithContext(ctx)
+
+	if topic.ID == 0 {
+		return ErrEmptyID
+	}
+
+	if topic.Title == "" {
+		return ErrEmptyTitle
+	}
+
+	result := db.Model(topic).Where("deleted_at IS NULL").Select("Title").Updates(topic)
+	if result.Error != nil {
+		log.Println("[UPDATE_TOPIC]::DB_UPDATE_TOPIC_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func DeleteTopic(id uint) error {
+	return DeleteTopicContext(context.Background(), database.DBConnection, id)
+}
+
+func DeleteTopicContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&Topic{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			log.Println("[DELETE_TOPIC]::DB_COUNT_CHILD_TOPICS_ERROR 💥")
+			return err
+		}
+
+		var discussions int64
+		if err := tx.Model(&Discussion{}).Where("topic_id = ?", id).Count(&discussions).Error; err != nil {
+			log.Println("[DELETE_TOPIC]::DB_COUNT_DISCUSSIONS_ERROR 💥")
+			return err
+		}
+
+		if children > 0 || discussions > 0 {
+			return ErrTopicNotEmpty
+		}
+
+		result := tx.Delete(&Topic{}, id)
+		if result.Error != nil {
+			log.Println("[DELETE_TOPIC]::DB_DELETE_TOPIC_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+func RestoreTopic(id uint) error {
+	return RestoreTopicContext(context.Background(), database.DBConnection, id)
+}
+
+func RestoreTopicContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		topic := &Topic{}
+		if err := tx.Unscoped().Where("deleted_at IS NOT NULL").Take(topic, id).Error; err != nil {
+			log.Println("[RESTORE_TOPIC]::DB_SELECT_TOPIC_ERROR 💥")
+			return err
+		}
+
+		if topic.ParentID != nil {
+			if err := tx.Take(&Topic{}, *topic.ParentID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrDeletedParent
+				}
+
+				log.Println("[RESTORE_TOPIC]::DB_SELECT_PARENT_ERROR 💥")
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Model(topic).Update("deleted_at", nil).Error; err != nil {
+			log.Println("[RESTORE_TOPIC]::DB_RESTORE_TOPIC_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
+
+// PurgeTopic permanently removes an empty Topic. Soft deleted sub-Topics and
+// Discussions still count, they have to be purged first.
+func PurgeTopic(id uint) error {
+	return PurgeTopicContext(context.Background(), database.DBConnection, id)
+}
+
+func PurgeTopicContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Unscoped().Model(&Topic{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			log.Println("[PURGE_TOPIC]::DB_COUNT_CHILD_TOPICS_ERROR 💥")
+			return err
+		}
+
+		var discussions int64
+		if err := tx.Unscoped().Model(&Discussion{}).Where("topic_id = ?", id).Count(&discussions).Error; err != nil {
+			log.Println("[PURGE_TOPIC]::DB_COUNT_DISCUSSIONS_ERROR 💥")
+			return err
+		}
+
+		if children > 0 || discussions > 0 {
+			return ErrTopicNotEmpty
+		}
+
+		result := tx.Unscoped().Delete(&Topic{}, id)
+		if result.Error != nil {
+			log.Println("[PURGE_TOPIC]::DB_DELETE_TOPIC_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
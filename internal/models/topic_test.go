@@ -44,9 +44,11 @@ var _ = Describe("Topic", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`author_id`) VALUES (?,?,?,?,?,?)")
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY position,id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`position`,`author_id`) VALUES (?,?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, nil, topic.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, nil, 0, topic.AuthorID).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -68,9 +70,11 @@ var _ = Describe("Topic", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`author_id`) VALUES (?,?,?,?,?,?)")
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY position,id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "parent_id", "position"}).AddRow(20, nil, 0).AddRow(21, 20, 0))
+				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`position`,`author_id`) VALUES (?,?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, topic.ParentID, topic.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, topic.ParentID, 1, topic.AuthorID).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -120,9 +124,11 @@ var _ = Describe("Topic", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`author_id`) VALUES (?,?,?,?,?,?)")
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY position,id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`position`,`author_id`) VALUES (?,?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, nil, topic.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, nil, 0, topic.AuthorID).
 					WillReturnError(errors.New("some db error"))
 				mock.ExpectRollback()
 
@@ -146,9 +152,11 @@ var _ = Describe("Topic", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`author_id`) VALUES (?,?,?,?,?,?)")
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY position,id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`position`,`author_id`) VALUES (?,?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, nil, topic.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, nil, 0, topic.AuthorID).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -171,9 +179,11 @@ var _ = Describe("Topic", func() {
 				}
 
 				mock.ExpectBegin()
-				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`author_id`) VALUES (?,?,?,?,?,?)")
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY position,id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				sql := regexp.QuoteMeta("INSERT INTO `topics` (`created_at`,`updated_at`,`deleted_at`,`title`,`parent_id`,`position`,`author_id`) VALUES (?,?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, nil, topic.AuthorID).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, topic.Title, nil, 0, topic.AuthorID).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -185,4 +195,278 @@ var _ = Describe("Topic", func() {
 			})
 		})
 	})
+
+	Context("GetTopic", func() {
+		When("getting a Topic that exists", func() {
+			It("should return the Topic", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`id` = ? AND `topics`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(3, "Marvel"))
+
+				topic, err := GetTopic(3)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(topic.Title).Should(Equal("Marvel"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a Topic that does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`id` = ? AND `topics`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title"}))
+
+				topic, err := GetTopic(3)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+				Expect(topic).Should(BeNil())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a Topic without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				topic, err := GetTopic(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+				Expect(topic).Should(BeNil())
+			})
+		})
+	})
+
+	Context("ListTopics", func() {
+		When("listing Topics", func() {
+			It("should return every Topic that has not been deleted", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY id")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Marvel").AddRow(2, "DC"))
+
+				topics, err := ListTopics()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(topics).Should(HaveLen(2))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("UpdateTopic", func() {
+		When("updating a Topic with a Title", func() {
+			It("should update the Title but not the ParentID", func() {
+				parentID := uint(1)
+				topic := &Topic{Model: gorm.Model{ID: 3}, Title: "Marvel", ParentID: &parentID}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `updated_at`=?,`title`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), topic.Title, topic.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := UpdateTopic(topic)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating a Topic that does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				err := UpdateTopic(&Topic{Model: gorm.Model{ID: 3}, Title: "Marvel"})
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating a Topic without a Title", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateTopic(&Topic{Model: gorm.Model{ID: 3}})
+				Expect(err).Should(Equal(ErrEmptyTitle))
+			})
+		})
+
+		When("updating a Topic without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateTopic(&Topic{Title: "Marvel"})
+				Expect(err).Should(Equal(ErrEmptyID))
+			})
+		})
+	})
+
+	Context("DeleteTopic", func() {
+		When("deleting a Topic with no sub-Topics or Discussions", func() {
+			It("should soft delete the Topic", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics` WHERE parent_id = ? AND `topics`.`deleted_at` IS NULL")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `discussions` WHERE topic_id = ? AND `discussions`.`deleted_at` IS NULL")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `deleted_at`=? WHERE `topics`.`id` = ? AND `topics`.`deleted_at` IS NULL")).
+					WithArgs(sqlmock.AnyArg(), 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := DeleteTopic(3)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting a Topic that still has Discussions", func() {
+			It("should rollback and return ErrTopicNotEmpty", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics` WHERE parent_id = ? AND `topics`.`deleted_at` IS NULL")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `discussions` WHERE topic_id = ? AND `discussions`.`deleted_at` IS NULL")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectRollback()
+
+				err := DeleteTopic(3)
+				Expect(err).Should(Equal(ErrTopicNotEmpty))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting a Topic that does not exist", func() {
+			It("should rollback and return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics`")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `discussions`")).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `deleted_at`=?")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := DeleteTopic(3)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting a Topic without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := DeleteTopic(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+			})
+		})
+	})
+
+	Context("RestoreTopic", func() {
+		When("restoring a deleted Topic whose parent is not deleted", func() {
+			It("should clear DeletedAt", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE deleted_at IS NOT NULL AND `topics`.`id` = ? LIMIT 1")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title", "parent_id"}).AddRow(3, "Marvel", 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`id` = ? AND `topics`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Comics"))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `deleted_at`=?,`updated_at`=? WHERE `id` = ?")).
+					WithArgs(nil, sqlmock.AnyArg(), 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := RestoreTopic(3)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("restoring a Topic whose parent is deleted", func() {
+			It("should rollback and return ErrDeletedParent", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE deleted_at IS NOT NULL")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title", "parent_id"}).AddRow(3, "Marvel", 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`id` = ?")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				err := RestoreTopic(3)
+				Expect(err).Should(Equal(ErrDeletedParent))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("restoring a Topic that is not deleted", func() {
+			It("should rollback and return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE deleted_at IS NOT NULL")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				err := RestoreTopic(3)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("PurgeTopic", func() {
+		When("purging a Topic with no sub-Topics or Discussions, deleted or not", func() {
+			It("should permanently remove the Topic", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics` WHERE parent_id = ?")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `discussions` WHERE topic_id = ?")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `topics` WHERE `topics`.`id` = ?")).
+					WithArgs(3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := PurgeTopic(3)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("purging a Topic that still has a deleted sub-Topic", func() {
+			It("should rollback and return ErrTopicNotEmpty", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics` WHERE parent_id = ?")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `discussions` WHERE topic_id = ?")).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectRollback()
+
+				err := PurgeTopic(3)
+				Expect(err).Should(Equal(ErrTopicNotEmpty))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
 })
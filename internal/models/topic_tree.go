@@ -0,0 +1,276 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"log"
+)
+
+// MaxTopicDepth is the number of levels a Topic tree may have, counting the
+// root Topics as the first.
+var MaxTopicDepth = 8
+
+// topicIndex holds every Topic that has not been deleted, keyed by ID and by
+// parent, with root Topics under parent 0. The whole tree is loaded in a single
+// query; a forum has at most a few hundred Topics, so walking it in memory is
+// cheaper than one query per level.
+type topicIndex struct {
+	byID     map[uint]*Topic
+	children map[uint][]*Topic
+}
+
+func loadTopicIndex(db *gorm.DB) (*topicIndex, error) {
+	var topics []Topic
+	if err := db.Order("position").Order("id").Find(&topics).Error; err != nil {
+		return nil, err
+	}
+
+	index := &topicIndex{byID: map[uint]*Topic{}, children: map[uint][]*Topic{}}
+	for i := range topics {
+		topic := &topics[i]
+		index.byID[topic.ID] = topic
+		index.children[parentKey(topic.ParentID)] = append(index.children[parentKey(topic.ParentID)], topic)
+	}
+
+	return index, nil
+}
+
+func parentKey(parentID *uint) uint {
+	if parentID == nil {
+		return 0
+	}
+
+	return *parentID
+}
+
+// ancestors returns the chain of parents of id, root first. It stops at a
+// missing parent or a cycle rather than looping.
+func (index *topicIndex) ancestors(id uint) []Topic {
+	var chain []Topic
+	seen := map[uint]bool{id: true}
+
+	topic := index.byID[id]
+	for topic != nil && topic.ParentID != nil && !seen[*topic.ParentID] {
+		seen[*topic.ParentID] = true
+		topic = index.byID[*topic.ParentID]
+		if topic != nil {
+			chain = append([]Topic{*topic}, chain...)
+		}
+	}
+
+	return chain
+}
+
+func (index *topicIndex) depth(id uint) int {
+	return len(index.ancestors(id)) + 1
+}
+
+// height counts the levels of the subtree rooted at id, itself included.
+func (index *topicIndex) height(id uint) int {
+	return index.heightOf(id, map[uint]bool{})
+}
+
+func (index *topicIndex) heightOf(id uint, seen map[uint]bool) int {
+	seen[id] = true
+
+	height := 0
+	for _, child := range index.children[id] {
+		if seen[child.ID] {
+			continue
+		}
+
+		if h := index.heightOf(child.ID, seen); h > height {
+			height = h
+		}
+	}
+
+	return height + 1
+}
+
+// subtree copies the Topics below parent into a tree, following Children.
+// A Topic is only visited once, so rows that form a cycle cannot recurse
+// forever.
+func (index *topicIndex) subtree(parent uint) []Topic {
+	return index.subtreeOf(parent, map[uint]bool{parent: true})
+}
+
+func (index *topicIndex) subtreeOf(parent uint, seen map[uint]bool) []Topic {
+	var tree []Topic
+	for _, child := range index.children[parent] {
+		if seen[child.ID] {
+			continue
+		}
+
+		seen[child.ID] = true
+		topic := *child
+		topic.Children = index.subtreeOf(child.ID, seen)
+		tree = append(tree, topic)
+	}
+
+	return tree
+}
+
+func (index *topicIndex) nextPosition(parentID *uint) int {
+	siblings := index.children[parentKey(parentID)]
+	if len(siblings) == 0 {
+		return 0
+	}
+
+	return siblings[len(siblings)-1].Position + 1
+}
+
+// GetTopicTree returns the root Topics in order, each with its sub-Topics in
+// Children.
+func GetTopicTree() ([]Topic, error) {
+	return GetTopicTreeContext(context.Background(), database.DBConnection)
+}
+
+func GetTopicTreeContext(ctx context.Context, db *gorm.DB) ([]Topic, error) {
+	db = db.WithContext(ctx)
+
+	index, err := loadTopicIndex(db)
+	if err != nil {
+		log.Println("[GET_TOPIC_TREE]::DB_SELECT_TOPICS_ERROR 💥")
+		return nil, err
+	}
+
+	return index.subtree(0), nil
+}
+
+// GetTopicAncestors returns the parents of a Topic from the root down, which
+// is the order breadcrumbs are rendered in.
+func GetTopicAncestors(id uint) ([]Topic, error) {
+	return GetTopicAncestorsContext(context.Background(), database.DBConnection, id)
+}
+
+func GetTopicAncestorsContext(ctx context.Context, db *gorm.DB, id uint) ([]Topic, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	index, err := loadTopicIndex(db)
+	if err != nil {
+		log.Println("[GET_TOPIC_ANCESTORS]::DB_SELECT_TOPICS_ERROR 💥")
+		return nil, err
+	}
+
+	if _, ok := index.byID[id]; !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return index.ancestors(id), nil
+}
+
+// GetTopicDescendants returns the sub-Topics of a Topic as a tree.
+func GetTopicDescendants(id uint) ([]Topic, error) {
+	return GetTopicDescendantsContext(context.Background(), database.DBConnection, id)
+}
+
+func GetTopicDescendantsContext(ctx context.Context, db *gorm.DB, id uint) ([]Topic, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	index, err := loadTopicIndex(db)
+	if err != nil {
+		log.Println("[GET_TOPIC_DESCENDANTS]::DB_SELECT_TOPICS_ERROR 💥")
+		return nil, err
+	}
+
+	if _, ok := index.byID[id]; !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return index.subtree(id), nil
+}
+
+// MoveTopic places a Topic under parentID, or at the root when parentID is
+// nil, at the given position among its new siblings. Positions out of range
+// are clamped, and siblings are renumbered to keep their order contiguous.
+func MoveTopic(id uint, parentID *uint, position int) error {
+	return MoveTopicContext(context.Background(), database.DBConnection, id, parentID, position)
+}
+
+func MoveTopicContext(ctx context.Context, db *gorm.DB, id uint, parentID *uint, position int) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		index, err := loadTopicIndex(tx)
+		if err != nil {
+			log.Println("[MOVE_TOPIC]::DB_SELECT_TOPICS_ERROR 💥")
+			return err
+		}
+
+		topic, ok := index.byID[id]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+
+		depth := 0
+		if parentID != nil {
+			if _, ok := index.byID[*parentID]; !ok {
+				return gorm.ErrRecordNotFound
+			}
+
+			if *parentID == id {
+				return ErrTopicCycle
+			}
+
+			for _, ancestor := range index.ancestors(*parentID) {
+				if ancestor.ID == id {
+					return ErrTopicCycle
+				}
+			}
+
+			depth = index.depth(*parentID)
+		}
+
+		if depth+index.height(id) > MaxTopicDepth {
+			return ErrTopicTooDeep
+		}
+
+		var siblings []*Topic
+		for _, sibling := range index.children[parentKey(parentID)] {
+			if sibling.ID != id {
+				siblings = append(siblings, sibling)
+			}
+		}
+
+		if position < 0 {
+			position = 0
+		}
+
+		if position > len(siblings) {
+			position = len(siblings)
+		}
+
+		siblings = append(siblings[:position], append([]*Topic{topic}, siblings[position:]...)...)
+		for i, sibling := range siblings {
+			if sibling.ID == id || sibling.Position == i {
+				continue
+			}
+
+			if err := tx.Model(&Topic{}).Where("id = ?", sibling.ID).Update("position", i).Error; err != nil {
+				log.Println("[MOVE_TOPIC]::DB_UPDATE_SIBLING_POSITION_ERROR 💥")
+				return err
+			}
+		}
+
+		moved := map[string]interface{}{"parent_id": parentID, "position": position}
+		if err := tx.Model(&Topic{}).Where("id = ?", id).Updates(moved).Error; err != nil {
+			log.Println("[MOVE_TOPIC]::DB_UPDATE_TOPIC_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("TopicTree", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	selectTopics := regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`deleted_at` IS NULL ORDER BY position,id")
+
+	// A forum with two roots; 1 > 3 > 5 and 1 > 4, 2 has no sub-Topics.
+	forum := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "title", "parent_id", "position"}).
+			AddRow(1, "Comics", nil, 0).
+			AddRow(3, "Marvel", 1, 0).
+			AddRow(5, "X-Men", 3, 0).
+			AddRow(2, "Films", nil, 1).
+			AddRow(4, "DC", 1, 1)
+	}
+
+	titles := func(topics []Topic) []string {
+		var result []string
+		for _, topic := range topics {
+			result = append(result, topic.Title)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("GetTopicTree", func() {
+		It("should nest every Topic under its parent in position order with a single query", func() {
+			mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+
+			tree, err := GetTopicTree()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(titles(tree)).Should(Equal([]string{"Comics", "Films"}))
+			Expect(titles(tree[0].Children)).Should(Equal([]string{"Marvel", "DC"}))
+			Expect(titles(tree[0].Children[0].Children)).Should(Equal([]string{"X-Men"}))
+			Expect(tree[1].Children).Should(BeEmpty())
+		})
+
+		It("should not recurse forever over rows that form a cycle", func() {
+			mock.ExpectQuery(selectTopics).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title", "parent_id"}).AddRow(1, "Comics", nil).AddRow(2, "Loop", 3).AddRow(3, "Back", 2))
+
+			tree, err := GetTopicTree()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(titles(tree)).Should(Equal([]string{"Comics"}))
+		})
+	})
+
+	Context("GetTopicAncestors", func() {
+		When("the Topic exists", func() {
+			It("should return its parents from the root down", func() {
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+
+				ancestors, err := GetTopicAncestors(5)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(titles(ancestors)).Should(Equal([]string{"Comics", "Marvel"}))
+			})
+		})
+
+		When("the Topic does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+
+				_, err := GetTopicAncestors(9)
+				Expect(err).Should(MatchError(gorm.ErrRecordNotFound))
+			})
+		})
+
+		When("no ID is given", func() {
+			It("should return an error without executing any sql on database", func() {
+				_, err := GetTopicAncestors(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+			})
+		})
+	})
+
+	Context("GetTopicDescendants", func() {
+		It("should return the sub-Topics as a tree", func() {
+			mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+
+			descendants, err := GetTopicDescendants(1)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(titles(descendants)).Should(Equal([]string{"Marvel", "DC"}))
+			Expect(titles(descendants[0].Children)).Should(Equal([]string{"X-Men"}))
+		})
+	})
+
+	Context("MoveTopic", func() {
+		When("moving a Topic to the front of another parent", func() {
+			It("should shift the siblings it lands before and update the Topic", func() {
+				parentID := uint(1)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `position`=?,`updated_at`=? WHERE id = ?")).
+					WithArgs(1, sqlmock.AnyArg(), 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `position`=?,`updated_at`=? WHERE id = ?")).
+					WithArgs(2, sqlmock.AnyArg(), 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `parent_id`=?,`position`=?,`updated_at`=? WHERE id = ?")).
+					WithArgs(parentID, 0, sqlmock.AnyArg(), 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := MoveTopic(2, &parentID, 0)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("moving a Topic to the root past the last position", func() {
+			It("should clamp the position to the end", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `topics` SET `parent_id`=?,`position`=?,`updated_at`=? WHERE id = ?")).
+					WithArgs(nil, 2, sqlmock.AnyArg(), 5).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := MoveTopic(5, nil, 99)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("moving a Topic under one of its own sub-Topics", func() {
+			It("should rollback and return ErrTopicCycle", func() {
+				parentID := uint(5)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+				mock.ExpectRollback()
+
+				err := MoveTopic(1, &parentID, 0)
+				Expect(err).Should(Equal(ErrTopicCycle))
+			})
+		})
+
+		When("moving a Topic under itself", func() {
+			It("should rollback and return ErrTopicCycle", func() {
+				parentID := uint(3)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+				mock.ExpectRollback()
+
+				err := MoveTopic(3, &parentID, 0)
+				Expect(err).Should(Equal(ErrTopicCycle))
+			})
+		})
+
+		When("the move would nest the subtree too deeply", func() {
+			It("should rollback and return ErrTopicTooDeep", func() {
+				maxTopicDepth := MaxTopicDepth
+				MaxTopicDepth = 3
+				defer func() { MaxTopicDepth = maxTopicDepth }()
+				parentID := uint(5)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+				mock.ExpectRollback()
+
+				err := MoveTopic(4, &parentID, 0)
+				Expect(err).Should(Equal(ErrTopicTooDeep))
+			})
+		})
+
+		When("the new parent does not exist", func() {
+			It("should rollback and return gorm.ErrRecordNotFound", func() {
+				parentID := uint(9)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+				mock.ExpectRollback()
+
+				err := MoveTopic(4, &parentID, 0)
+				Expect(err).Should(MatchError(gorm.ErrRecordNotFound))
+			})
+		})
+
+		When("no ID is given", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := MoveTopic(0, nil, 0)
+				Expect(err).Should(Equal(ErrEmptyID))
+			})
+		})
+	})
+
+	Context("CreateTopic", func() {
+		When("the parent is already at the maximum depth", func() {
+			It("should rollback and return ErrTopicTooDeep", func() {
+				maxTopicDepth := MaxTopicDepth
+				MaxTopicDepth = 3
+				defer func() { MaxTopicDepth = maxTopicDepth }()
+				parentID := uint(5)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+				mock.ExpectRollback()
+
+				err := CreateTopic(&Topic{Title: "Wolverine", AuthorID: 10, ParentID: &parentID})
+				Expect(err).Should(Equal(ErrTopicTooDeep))
+			})
+		})
+
+		When("the parent does not exist", func() {
+			It("should rollback and return gorm.ErrRecordNotFound", func() {
+				parentID := uint(9)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectTopics).WillReturnRows(forum())
+				mock.ExpectRollback()
+
+				err := CreateTopic(&Topic{Title: "Wolverine", AuthorID: 10, ParentID: &parentID})
+				Expect(err).Should(MatchError(gorm.ErrRecordNotFound))
+			})
+		})
+	})
+})
@@ -0,0 +1,384 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"github.com/golangbb/golangbb/v2/pkg/totp"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+const RecoveryCodeCount = 10
+
+// TwoFactorSkew is how many 30 second steps a code may be off by, to allow
+// for the clock of the authenticator drifting.
+const TwoFactorSkew = 1
+
+// TwoFactor is the TOTP enrolment of a User. It only protects logins once the
+// User has confirmed it with a code, which proves their authenticator works.
+// LastStep is the step of the last code accepted, so that none is used twice.
+type TwoFactor struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	User      User   `gorm:"foreignKey:UserID"`
+	Secret    string `gorm:"not null;size:64"`
+	Confirmed bool   `gorm:"not null;default:false"`
+	LastStep  int64  `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RecoveryCode lets a User who lost their authenticator sign in once. Only its
+// digest is stored.
+type RecoveryCode struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Code      string `gorm:"not null;size:64;index"`
+	User      User   `gorm:"foreignKey:UserID"`
+	UserID    uint   `gorm:"not null;index"`
+}
+
+// HashRecoveryCode returns the digest a recovery code is stored under. Case,
+// spaces and dashes are ignored so that codes can be typed as they are shown.
+func HashRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return tokens.Hash(code)
+}
+
+// GenerateRecoveryCodes returns RecoveryCodeCount codes formatted for display
+// together with the RecoveryCodes to store for them.
+func GenerateRecoveryCodes(userID uint) ([]string, []RecoveryCode, error) {
+	codes := make([]string, RecoveryCodeCount)
+	stored := make([]RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := base32.StdEncoding.EncodeToString(b)
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		stored[i] = RecoveryCode{Code: HashRecoveryCode(code), UserID: userID}
+	}
+
+	return codes, stored, nil
+}
+
+func GetTwoFactor(userID uint) (*TwoFactor, error) {
+	return GetTwoFactorContext(context.Background(), database.DBConnection, userID)
+}
+
+func GetTwoFactorContext(ctx context.Context, db *gorm.DB, userID uint) (*TwoFactor, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	twoFactor := &TwoFactor{}
+	if err := db.Where("user_id = ?", userID).Take(twoFactor).Error; err != nil {
+		log.Println("[GET_TWO_FACTOR]::DB_SELECT_TWO_FACTOR_ERROR 💥")
+		return nil, err
+	}
+
+	return twoFactor, nil
+}
+
+// EnrolTwoFactor gives the User a new secret to add to their authenticator.
+// An enrolment that was never confirmed is replaced.
+func EnrolTwoFactor(userID uint) (*TwoFactor, error) {
+	return EnrolTwoFactorContext(context.Background(), database.DBConnection, userID)
+}
+
+func EnrolTwoFactorContext(ctx context.Context, db *gorm.DB, userID uint) (*TwoFactor, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Println("[ENROL_TWO_FACTOR]::GENERATE_SECRET_ERROR 💥")
+		return nil, err
+	}
+
+	twoFactor := &TwoFactor{UserID: userID, Secret: secret}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		existing := &TwoFactor{}
+		err := tx.Where("user_id = ?", userID).Take(existing).Error
+		if err == nil && existing.Confirmed {
+			return ErrTwoFactorEnabled
+		}
+
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("[ENROL_TWO_FACTOR]::DB_SELECT_TWO_FACTOR_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&TwoFactor{}).Error; err != nil {
+			log.Println("[ENROL_TWO_FACTOR]::DB_DELETE_TWO_FACTOR_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Omit("User").Create(twoFactor).Error; err != nil {
+			log.Println("[ENROL_TWO_FACTOR]::DB_INSERT_TWO_FACTOR_ERROR 💥")
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return twoFactor, nil
+}
+
+// ConfirmTwoFactor turns an enrolment on once code shows the authenticator
+// produces the right codes, and returns the recovery codes to show the User.
+func ConfirmTwoFactor(userID uint, code string) ([]string, error) {
+	return ConfirmTwoFactorContext(context.Background(), database.DBConnection, userID, code)
+}
+
+func ConfirmTwoFactorContext(ctx context.Context, db *gorm.DB, userID uint, code string) ([]string, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	codes, recoveryCodes, err := GenerateRecoveryCodes(userID)
+	if err != nil {
+		log.Println("[CONFIRM_TWO_FACTOR]::GENERATE_RECOVERY_CODES_ERROR 💥")
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		twoFactor := &TwoFactor{}
+		err := tx.Where("user_id = ?", userID).Take(twoFactor).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTwoFactorNotEnabled
+		}
+
+		if err != nil {
+			log.Println("[CONFIRM_TWO_FACTOR]::DB_SELECT_TWO_FACTOR_ERROR 💥")
+			return err
+		}
+
+		if twoFactor.Confirmed {
+			return ErrTwoFactorEnabled
+		}
+
+		step, ok, err := totp.Validate(twoFactor.Secret, code, time.Now(), TwoFactorSkew)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+
+		if err := tx.Model(twoFactor).Updates(map[string]interface{}{"confirmed": true, "last_step": step}).Error; err != nil {
+			log.Println("[CONFIRM_TWO_FACTOR]::DB_UPDATE_TWO_FACTOR_ERROR 💥")
+			return err
+		}
+
+		return replaceRecoveryCodes(tx, userID, recoveryCodes)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyTwoFactor checks a code from the authenticator of the User, or one of
+// their recovery codes, which is used up.
+func VerifyTwoFactor(userID uint, code string) error {
+	return VerifyTwoFactorContext(context.Background(), database.DBConnection, userID, code)
+}
+
+func VerifyTwoFactorContext(ctx context.Context, db *gorm.DB, userID uint, code string) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	twoFactor := &TwoFactor{}
+	err := db.Where("user_id = ? AND confirmed = ?", userID, true).Take(twoFactor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err != nil {
+		log.Println("[VERIFY_TWO_FACTOR]::DB_SELECT_TWO_FACTOR_ERROR 💥")
+		return err
+	}
+
+	step, ok, err := totp.Validate(twoFactor.Secret, code, time.Now(), TwoFactorSkew)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		// Only move LastStep forward, so that two requests racing with the
+		// same code cannot both succeed.
+		result := db.Model(&TwoFactor{}).Where("user_id = ? AND last_step < ?", userID, step).Update("last_step", step)
+		if result.Error != nil {
+			log.Println("[VERIFY_TWO_FACTOR]::DB_UPDATE_TWO_FACTOR_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			log.Println("[VERIFY_TWO_FACTOR]::REPLAYED_CODE_WARNING ⚠️")
+			return ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	result := db.Where("user_id = ? AND code = ?", userID, HashRecoveryCode(code)).Delete(&RecoveryCode{})
+	if result.Error != nil {
+		log.Println("[VERIFY_TWO_FACTOR]::DB_DELETE_RECOVERY_CODE_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the User.
+func RegenerateRecoveryCodes(userID uint) ([]string, error) {
+	return RegenerateRecoveryCodesContext(context.Background(), database.DBConnection, userID)
+}
+
+func RegenerateRecoveryCodesContext(ctx context.Context, db *gorm.DB, userID uint) ([]string, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	codes, recoveryCodes, err := GenerateRecoveryCodes(userID)
+	if err != nil {
+		log.Println("[REGENERATE_RECOVERY_CODES]::GENERATE_RECOVERY_CODES_ERROR 💥")
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var enabled int64
+		if err := tx.Model(&TwoFactor{}).Where("user_id = ? AND confirmed = ?", userID, true).Count(&enabled).Error; err != nil {
+			log.Println("[REGENERATE_RECOVERY_CODES]::DB_COUNT_TWO_FACTOR_ERROR 💥")
+			return err
+		}
+
+		if enabled == 0 {
+			return ErrTwoFactorNotEnabled
+		}
+
+		return replaceRecoveryCodes(tx, userID, recoveryCodes)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, recoveryCodes []RecoveryCode) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		log.Println("[REPLACE_RECOVERY_CODES]::DB_DELETE_RECOVERY_CODES_ERROR 💥")
+		return err
+	}
+
+	if err := tx.Omit("User").Create(&recoveryCodes).Error; err != nil {
+		log.Println("[REPLACE_RECOVERY_CODES]::DB_INSERT_RECOVERY_CODES_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+// DisableTwoFactor removes the enrolment and recovery codes of the User. It
+// fails with ErrTwoFactorRequired while one of their Groups requires it.
+func DisableTwoFactor(userID uint) error {
+	return DisableTwoFactorContext(context.Background(), database.DBConnection, userID)
+}
+
+func DisableTwoFactorContext(ctx context.Context, db *gorm.DB, userID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return ErrEmptyUserID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		required, err := IsTwoFactorRequiredContext(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if required {
+			return ErrTwoFactorRequired
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			log.Println("[DISABLE_TWO_FACTOR]::DB_DELETE_RECOVERY_CODES_ERROR 💥")
+			return err
+		}
+
+		result := tx.Where("user_id = ?", userID).Delete(&TwoFactor{})
+		if result.Error != nil {
+			log.Println("[DISABLE_TWO_FACTOR]::DB_DELETE_TWO_FACTOR_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorNotEnabled
+		}
+
+		return nil
+	})
+}
+
+// IsTwoFactorRequired reports whether the User belongs to a Group whose
+// members must use two-factor authentication.
+func IsTwoFactorRequired(userID uint) (bool, error) {
+	return IsTwoFactorRequiredContext(context.Background(), database.DBConnection, userID)
+}
+
+func IsTwoFactorRequiredContext(ctx context.Context, db *gorm.DB, userID uint) (bool, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return false, ErrEmptyUserID
+	}
+
+	var count int64
+	memberships := db.Table("users_groups").Select("group_id").Where("user_id = ?", userID)
+	err := db.
+		Model(&Group{}).
+		Where("require_two_factor = ? AND id IN (?)", true, memberships).
+		Count(&count).Error
+
+	if err != nil {
+		log.Println("[IS_TWO_FACTOR_REQUIRED]::DB_COUNT_GROUPS_ERROR 💥")
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/totp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("TwoFactor", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+	var secret string
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		secret, err = totp.GenerateSecret()
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	currentCode := func() string {
+		code, err := totp.Code(secret, totp.Step(time.Now()))
+		Expect(err).ShouldNot(HaveOccurred())
+		return code
+	}
+
+	expectTwoFactor := func(confirmed bool, lastStep int64) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `two_factors` WHERE user_id = ? LIMIT 1")).
+			WithArgs(4).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "confirmed", "last_step"}).AddRow(4, secret, confirmed, lastStep))
+	}
+
+	Context("EnrolTwoFactor", func() {
+		When("the User has not enrolled", func() {
+			It("should store a new secret", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `two_factors` WHERE user_id = ? LIMIT 1")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `two_factors` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `two_factors` (`user_id`,`secret`,`confirmed`,`last_step`,`created_at`,`updated_at`) VALUES (?,?,?,?,?,?)")).
+					WithArgs(4, sqlmock.AnyArg(), false, 0, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(4, 1))
+				mock.ExpectCommit()
+
+				twoFactor, err := EnrolTwoFactor(4)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(twoFactor.Secret).ShouldNot(BeEmpty())
+				Expect(twoFactor.Confirmed).Should(BeFalse())
+			})
+		})
+
+		When("the User has already confirmed an enrolment", func() {
+			It("should return ErrTwoFactorEnabled", func() {
+				mock.ExpectBegin()
+				expectTwoFactor(true, 0)
+				mock.ExpectRollback()
+
+				_, err := EnrolTwoFactor(4)
+				Expect(err).Should(Equal(ErrTwoFactorEnabled))
+			})
+		})
+	})
+
+	Context("ConfirmTwoFactor", func() {
+		When("the code is right", func() {
+			It("should enable two-factor authentication and return recovery codes", func() {
+				mock.ExpectBegin()
+				expectTwoFactor(false, 0)
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `two_factors` SET `confirmed`=?,`last_step`=?,`updated_at`=? WHERE `user_id` = ?")).
+					WithArgs(true, totp.Step(time.Now()), sqlmock.AnyArg(), 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `recovery_codes` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `recovery_codes` (`created_at`,`code`,`user_id`) VALUES")).
+					WillReturnResult(sqlmock.NewResult(1, RecoveryCodeCount))
+				mock.ExpectCommit()
+
+				codes, err := ConfirmTwoFactor(4, currentCode())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(codes).Should(HaveLen(RecoveryCodeCount))
+			})
+		})
+
+		When("the code is wrong", func() {
+			It("should return ErrInvalidTwoFactorCode", func() {
+				mock.ExpectBegin()
+				expectTwoFactor(false, 0)
+				mock.ExpectRollback()
+
+				_, err := ConfirmTwoFactor(4, "000000x")
+				Expect(err).Should(Equal(ErrInvalidTwoFactorCode))
+			})
+		})
+	})
+
+	Context("VerifyTwoFactor", func() {
+		expectConfirmed := func(lastStep int64) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `two_factors` WHERE user_id = ? AND confirmed = ? LIMIT 1")).
+				WithArgs(4, true).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "confirmed", "last_step"}).AddRow(4, secret, true, lastStep))
+		}
+
+		When("the code comes from the authenticator", func() {
+			It("should accept it once", func() {
+				expectConfirmed(0)
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `two_factors` SET `last_step`=?,`updated_at`=? WHERE user_id = ? AND last_step < ?")).
+					WithArgs(totp.Step(time.Now()), sqlmock.AnyArg(), 4, totp.Step(time.Now())).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				Expect(VerifyTwoFactor(4, currentCode())).Should(Succeed())
+
+				expectConfirmed(totp.Step(time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `two_factors` SET `last_step`=?,`updated_at`=? WHERE user_id = ? AND last_step < ?")).
+					WithArgs(totp.Step(time.Now()), sqlmock.AnyArg(), 4, totp.Step(time.Now())).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				Expect(VerifyTwoFactor(4, currentCode())).Should(Equal(ErrInvalidTwoFactorCode))
+			})
+		})
+
+		When("the code is a recovery code", func() {
+			It("should use it up", func() {
+				expectConfirmed(0)
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `recovery_codes` WHERE user_id = ? AND code = ?")).
+					WithArgs(4, HashRecoveryCode("ABCDEFGHIJKLMNOP")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				Expect(VerifyTwoFactor(4, "abcd-efgh-ijkl-mnop")).Should(Succeed())
+			})
+		})
+
+		When("the User has not enabled two-factor authentication", func() {
+			It("should return ErrTwoFactorNotEnabled", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `two_factors` WHERE user_id = ? AND confirmed = ? LIMIT 1")).
+					WithArgs(4, true).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+				Expect(VerifyTwoFactor(4, "123456")).Should(Equal(ErrTwoFactorNotEnabled))
+			})
+		})
+	})
+
+	Context("DisableTwoFactor", func() {
+		expectRequired := func(count int) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `groups` WHERE (require_two_factor = ? AND id IN (SELECT group_id FROM `users_groups` WHERE user_id = ?)) AND `groups`.`deleted_at` IS NULL")).
+				WithArgs(true, 4).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+		}
+
+		It("should remove the enrolment and recovery codes", func() {
+			mock.ExpectBegin()
+			expectRequired(0)
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `recovery_codes` WHERE user_id = ?")).
+				WithArgs(4).
+				WillReturnResult(sqlmock.NewResult(0, 10))
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `two_factors` WHERE user_id = ?")).
+				WithArgs(4).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(DisableTwoFactor(4)).Should(Succeed())
+		})
+
+		When("a Group of the User requires two-factor authentication", func() {
+			It("should return ErrTwoFactorRequired", func() {
+				mock.ExpectBegin()
+				expectRequired(1)
+				mock.ExpectRollback()
+
+				Expect(DisableTwoFactor(4)).Should(Equal(ErrTwoFactorRequired))
+			})
+		})
+	})
+})
@@ -1,21 +1,42 @@
 package models
 
 import (
+	"context"
 	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
 	"gorm.io/gorm"
 	"log"
+	"sync"
 )
 
+var PasswordHasher passwords.Hasher = passwords.NewArgon2id()
+
+// dummyPassword caches the hash VerifyDummyPassword checks against, for as long
+// as PasswordHasher stays the same.
+var dummyPassword struct {
+	sync.Mutex
+	hasher passwords.Hasher
+	hash   string
+}
+
 type User struct {
 	gorm.Model
 	UserName    string `gorm:"uniqueIndex" gorm:"size:32"`
 	DisplayName string `gorm:"not null" gorm:"size:32"`
-	Password    string `gorm:"not null" gorm:"size:64"`
+	Password    string `gorm:"not null" gorm:"size:255"`
 	Emails      []Email
+	Identities  []Identity
 	Groups      []Group `gorm:"many2many:users_groups;"`
 }
 
 func CreateUser(user *User) error {
+	return CreateUserContext(context.Background(), database.DBConnection, user)
+}
+
+func CreateUserContext(ctx context.Context, db *gorm.DB, user *User) error {
+	db = db.WithContext(ctx)
+
 	if user.UserName == "" {
 		log.Println("[CREATE_USER]::EMPTY_USER_NAME_ERROR 💥")
 		return ErrEmptyUserName
@@ -31,23 +52,45 @@ func CreateUser(user *User) error {
 		user.DisplayName = user.UserName
 	}
 
-	err := database.DBConnection.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Omit("Emails", "Groups").Create(user).Error; err != nil {
-			log.Println("[CREATE_USER]::DB_INSERT_USER_ERROR 💥")
+	for i := range user.Identities {
+		if err := validateIdentity(&user.Identities[i]); err != nil {
 			return err
 		}
+	}
 
-		if len(user.Emails) == 0 {
-			return nil
+	hash, err := PasswordHasher.Hash(user.Password)
+	if err != nil {
+		log.Println("[CREATE_USER]::HASH_PASSWORD_ERROR 💥")
+		return err
+	}
+	user.Password = hash
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Emails", "Identities", "Groups").Create(user).Error; err != nil {
+			log.Println("[CREATE_USER]::DB_INSERT_USER_ERROR 💥")
+			return err
 		}
 
-		for i, _ := range user.Emails {
-			user.Emails[i].UserID = user.ID
+		if len(user.Emails) > 0 {
+			for i, _ := range user.Emails {
+				user.Emails[i].UserID = user.ID
+			}
+
+			if err := tx.Omit("User").CreateInBatches(&user.Emails, 10).Error; err != nil {
+				log.Println("[CREATE_USER]::DB_INSERT_EMAIL_ERROR 💥")
+				return err
+			}
 		}
 
-		if err := tx.Omit("User").CreateInBatches(&user.Emails, 10).Error; err != nil {
-			log.Println("[CREATE_USER]::DB_INSERT_EMAIL_ERROR 💥")
-			return err
+		if len(user.Identities) > 0 {
+			for i := range user.Identities {
+				user.Identities[i].UserID = user.ID
+			}
+
+			if err := tx.Omit("User").Create(&user.Identities).Error; err != nil {
+				log.Println("[CREATE_USER]::DB_INSERT_IDENTITY_ERROR 💥")
+				return err
+			}
 		}
 
 		return nil
@@ -59,3 +102,395 @@ func CreateUser(user *User) error {
 
 	return nil
 }
+
+func GetUserByUserName(userName string) (*User, error) {
+	return GetUserByUserNameContext(context.Background(), database.DBConnection, userName)
+}
+
+func GetUserByUserNameContext(ctx context.Context, db *gorm.DB, userName string) (*User, error) {
+	db = db.WithContext(ctx)
+
+	if userName == "" {
+		return nil, ErrEmptyUserName
+	}
+
+	user := &User{}
+	if err := db.Where("user_name = ?", userName).Take(user).Error; err != nil {
+		log.Println("[GET_USER_BY_USER_NAME]::DB_SELECT_USER_ERROR 💥")
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// VerifyDummyPassword checks password against the hash of a password nobody
+// has, made with the current PasswordHasher. Logins naming an unknown User go
+// through it so that they take as long as those with a wrong password.
+func VerifyDummyPassword(password string) error {
+	dummyPassword.Lock()
+	if dummyPassword.hasher != PasswordHasher {
+		nonce, err := tokens.Generate(tokens.DefaultLength)
+		if err != nil {
+			dummyPassword.Unlock()
+			log.Println("[VERIFY_DUMMY_PASSWORD]::GENERATE_PASSWORD_ERROR 💥")
+			return err
+		}
+
+		hash, err := PasswordHasher.Hash(nonce)
+		if err != nil {
+			dummyPassword.Unlock()
+			log.Println("[VERIFY_DUMMY_PASSWORD]::HASH_PASSWORD_ERROR 💥")
+			return err
+		}
+
+		dummyPassword.hasher, dummyPassword.hash = PasswordHasher, hash
+	}
+	hash := dummyPassword.hash
+	dummyPassword.Unlock()
+
+	if _, err := passwords.Verify(password, hash); err != nil {
+		log.Println("[VERIFY_DUMMY_PASSWORD]::VERIFY_HASH_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+// VerifyPassword checks password against the stored hash. When the hash was
+// produced with different parameters from the current PasswordHasher it is
+// transparently replaced; a failed rehash never fails an otherwise valid login.
+func VerifyPassword(user *User, password string) (bool, error) {
+	return VerifyPasswordContext(context.Background(), database.DBConnection, user, password)
+}
+
+func VerifyPasswordContext(ctx context.Context, db *gorm.DB, user *User, password string) (bool, error) {
+	db = db.WithContext(ctx)
+
+	if password == "" {
+		return false, ErrEmptyPassword
+	}
+
+	ok, err := passwords.Verify(password, user.Password)
+	if err != nil {
+		log.Println("[VERIFY_PASSWORD]::VERIFY_HASH_ERROR 💥")
+		return false, err
+	}
+
+	if !ok || !PasswordHasher.NeedsRehash(user.Password) {
+		return ok, nil
+	}
+
+	hash, err := PasswordHasher.Hash(password)
+	if err != nil {
+		log.Println("[VERIFY_PASSWORD]::REHASH_PASSWORD_WARNING ⚠️")
+		return true, nil
+	}
+
+	if err := db.Model(&User{Model: gorm.Model{ID: user.ID}}).Update("password", hash).Error; err != nil {
+		log.Println("[VERIFY_PASSWORD]::DB_UPDATE_PASSWORD_WARNING ⚠️")
+		return true, nil
+	}
+
+	user.Password = hash
+	return true, nil
+}
+
+func GetUser(id uint) (*User, error) {
+	return GetUserContext(context.Background(), database.DBConnection, id)
+}
+
+func GetUserContext(ctx context.Context, db *gorm.DB, id uint) (*User, error) {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return nil, ErrEmptyID
+	}
+
+	user := &User{}
+	if err := db.Take(user, id).Error; err != nil {
+		log.Println("[GET_USER]::DB_SELECT_USER_ERROR 💥")
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func ListUsers(offset, limit int) ([]User, error) {
+	return ListUsersContext(context.Background(), database.DBConnection, offset, limit)
+}
+
+func ListUsersContext(ctx context.Context, db *gorm.DB, offset, limit int) ([]User, error) {
+	db = db.WithContext(ctx)
+
+	var users []User
+	err := db.
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&users).Error
+
+	if err != nil {
+		log.Println("[LIST_USERS]::DB_SELECT_USERS_ERROR 💥")
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListUsersWithGroups returns the Users of ids that were not deleted, with the
+// Groups they belong to, in one go for checking what each of them may do.
+func ListUsersWithGroups(ids []uint) ([]User, error) {
+	return ListUsersWithGroupsContext(context.Background(), database.DBConnection, ids)
+}
+
+func ListUsersWithGroupsContext(ctx context.Context, db *gorm.DB, ids []uint) ([]User, error) {
+	db = db.WithContext(ctx)
+
+	if len(ids) == 0 {
+		return []User{}, nil
+	}
+
+	var users []User
+	if err := db.Preload("Groups").Where("id IN ?", ids).Order("id").Find(&users).Error; err != nil {
+		log.Println("[LIST_USERS_WITH_GROUPS]::DB_SELECT_USERS_ERROR 💥")
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func UpdateUser(user *User) error {
+	return UpdateUserContext(context.Background(), database.DBConnection, user)
+}
+
+func UpdateUserContext(ctx context.Context, db *gorm.DB, user *User) error {
+	db = db.WithContext(ctx)
+
+	if user.ID == 0 {
+		return ErrEmptyID
+	}
+
+	if user.UserName == "" {
+		return ErrEmptyUserName
+	}
+
+	if user.DisplayName == "" {
+		return ErrEmptyDisplayName
+	}
+
+	result := db.Model(user).Where("deleted_at IS NULL").Select("UserName", "DisplayName").Updates(user)
+	if result.Error != nil {
+		log.Println("[UPDATE_USER]::DB_UPDATE_USER_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func UpdateUserPassword(id uint, password string) error {
+	return UpdateUserPasswordContext(context.Background(), database.DBConnection, id, password)
+}
+
+func UpdateUserPasswordContext(ctx context.Context, db *gorm.DB, id uint, password string) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	if password == "" {
+		return ErrEmptyPassword
+	}
+
+	hash, err := PasswordHasher.Hash(password)
+	if err != nil {
+		log.Println("[UPDATE_USER_PASSWORD]::HASH_PASSWORD_ERROR 💥")
+		return err
+	}
+
+	result := db.Model(&User{Model: gorm.Model{ID: id}}).Where("deleted_at IS NULL").Update("password", hash)
+	if result.Error != nil {
+		log.Println("[UPDATE_USER_PASSWORD]::DB_UPDATE_PASSWORD_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteUser soft deletes the User and signs them out everywhere. Emails and
+// group memberships are kept so that RestoreUser brings the account back whole.
+func DeleteUser(id uint) error {
+	return DeleteUserContext(context.Background(), database.DBConnection, id)
+}
+
+func DeleteUserContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&Session{}).Error; err != nil {
+			log.Println("[DELETE_USER]::DB_DELETE_SESSIONS_ERROR 💥")
+			return err
+		}
+
+		result := tx.Delete(&User{}, id)
+		if result.Error != nil {
+			log.Println("[DELETE_USER]::DB_DELETE_USER_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+func RestoreUser(id uint) error {
+	return RestoreUserContext(context.Background(), database.DBConnection, id)
+}
+
+func RestoreUserContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	result := db.Unscoped().Model(&User{Model: gorm.Model{ID: id}}).Where("deleted_at IS NOT NULL").Update("deleted_at", nil)
+	if result.Error != nil {
+		log.Println("[RESTORE_USER]::DB_RESTORE_USER_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeUser permanently removes the User together with their Emails, pending
+// verifications and password resets, two-factor enrolment, Sessions, API
+// tokens, linked Identities, failed logins, group memberships, Posts and the
+// Discussions they started. Topics and Groups are shared structure, so a User
+// who authored any must have them reassigned or purged first.
+func PurgeUser(id uint) error {
+	return PurgeUserContext(context.Background(), database.DBConnection, id)
+}
+
+func PurgeUserContext(ctx context.Context, db *gorm.DB, id uint) error {
+	db = db.WithContext(ctx)
+
+	if id == 0 {
+		return ErrEmptyID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var topics int64
+		if err := tx.Unscoped().Model(&Topic{}).Where("author_id = ?", id).Count(&topics).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_COUNT_TOPICS_ERROR 💥")
+			return err
+		}
+
+		var groups int64
+		if err := tx.Unscoped().Model(&Group{}).Where("author_id = ?", id).Count(&groups).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_COUNT_GROUPS_ERROR 💥")
+			return err
+		}
+
+		if topics > 0 || groups > 0 {
+			return ErrUserHasOwnership
+		}
+
+		discussions := tx.Unscoped().Model(&Discussion{}).Select("id").Where("author_id = ?", id)
+		if err := tx.Unscoped().Where("author_id = ? OR discussion_id IN (?)", id, discussions).Delete(&Post{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_POSTS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Unscoped().Where("author_id = ?", id).Delete(&Discussion{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_DISCUSSIONS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&Session{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_SESSIONS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&EmailVerification{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_EMAIL_VERIFICATIONS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&PasswordReset{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_PASSWORD_RESETS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_RECOVERY_CODES_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&TwoFactor{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_TWO_FACTOR_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&APIToken{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_API_TOKENS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&Identity{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_IDENTITIES_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&FailedLogin{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_FAILED_LOGINS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Where("throttle_key = ?", AccountThrottleKey(id)).Delete(&LoginThrottle{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_LOGIN_THROTTLE_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Unscoped().Where("user_id = ?", id).Delete(&Email{}).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_EMAILS_ERROR 💥")
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM users_groups WHERE user_id = ?", id).Error; err != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_MEMBERSHIPS_ERROR 💥")
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&User{}, id)
+		if result.Error != nil {
+			log.Println("[PURGE_USER]::DB_DELETE_USER_ERROR 💥")
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
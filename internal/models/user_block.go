@@ -0,0 +1,109 @@
+package models
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// UserBlock stops BlockedUser from starting Conversations with User or adding
+// them to one, and hides the Messages BlockedUser sends from User.
+type UserBlock struct {
+	UserID        uint `gorm:"primaryKey"`
+	User          User `gorm:"foreignKey:UserID"`
+	BlockedUserID uint `gorm:"primaryKey;index"`
+	BlockedUser   User `gorm:"foreignKey:BlockedUserID"`
+	CreatedAt     time.Time
+}
+
+func BlockUser(userID, blockedUserID uint) error {
+	return BlockUserContext(context.Background(), database.DBConnection, userID, blockedUserID)
+}
+
+func BlockUserContext(ctx context.Context, db *gorm.DB, userID, blockedUserID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 || blockedUserID == 0 {
+		return ErrEmptyUserID
+	}
+
+	if userID == blockedUserID {
+		return ErrBlockSelf
+	}
+
+	block := &UserBlock{UserID: userID, BlockedUserID: blockedUserID}
+	if err := db.Omit("User", "BlockedUser").Clauses(clause.OnConflict{DoNothing: true}).Create(block).Error; err != nil {
+		log.Println("[BLOCK_USER]::DB_INSERT_USER_BLOCK_ERROR 💥")
+		return err
+	}
+
+	return nil
+}
+
+func UnblockUser(userID, blockedUserID uint) error {
+	return UnblockUserContext(context.Background(), database.DBConnection, userID, blockedUserID)
+}
+
+func UnblockUserContext(ctx context.Context, db *gorm.DB, userID, blockedUserID uint) error {
+	db = db.WithContext(ctx)
+
+	if userID == 0 || blockedUserID == 0 {
+		return ErrEmptyUserID
+	}
+
+	result := db.Where("user_id = ? AND blocked_user_id = ?", userID, blockedUserID).Delete(&UserBlock{})
+	if result.Error != nil {
+		log.Println("[UNBLOCK_USER]::DB_DELETE_USER_BLOCK_ERROR 💥")
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func ListBlockedUsers(userID uint) ([]UserBlock, error) {
+	return ListBlockedUsersContext(context.Background(), database.DBConnection, userID)
+}
+
+func ListBlockedUsersContext(ctx context.Context, db *gorm.DB, userID uint) ([]UserBlock, error) {
+	db = db.WithContext(ctx)
+
+	if userID == 0 {
+		return nil, ErrEmptyUserID
+	}
+
+	var blocks []UserBlock
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&blocks).Error; err != nil {
+		log.Println("[LIST_BLOCKED_USERS]::DB_SELECT_USER_BLOCKS_ERROR 💥")
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// blockedBetween tells whether userID blocked any of otherIDs or was blocked
+// by one of them.
+func blockedBetween(db *gorm.DB, userID uint, otherIDs []uint) (bool, error) {
+	var count int64
+	err := db.Model(&UserBlock{}).
+		Where("(user_id = ? AND blocked_user_id IN ?) OR (user_id IN ? AND blocked_user_id = ?)", userID, otherIDs, otherIDs, userID).
+		Count(&count).Error
+
+	if err != nil {
+		log.Println("[BLOCKED_BETWEEN]::DB_SELECT_USER_BLOCKS_ERROR 💥")
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// blockedBy selects the IDs of the Users userID blocked, for use as a subquery.
+func blockedBy(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Model(&UserBlock{}).Select("blocked_user_id").Where("user_id = ?", userID)
+}
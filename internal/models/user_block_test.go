@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("UserBlock", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		_, err = database.Connect(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	Context("BlockUser", func() {
+		It("should block the User unless they already are", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `user_blocks` (`user_id`,`blocked_user_id`,`created_at`) VALUES (?,?,?) ON CONFLICT DO NOTHING")).
+				WithArgs(10, 11, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(BlockUser(10, 11)).Should(Succeed())
+		})
+
+		It("should return ErrBlockSelf without executing any sql", func() {
+			Expect(BlockUser(10, 10)).Should(Equal(ErrBlockSelf))
+		})
+	})
+
+	Context("UnblockUser", func() {
+		It("should remove the block", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `user_blocks` WHERE user_id = ? AND blocked_user_id = ?")).
+				WithArgs(10, 11).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			Expect(UnblockUser(10, 11)).Should(Succeed())
+		})
+
+		It("should return gorm.ErrRecordNotFound when the User was not blocked", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `user_blocks`")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			Expect(UnblockUser(10, 11)).Should(Equal(gorm.ErrRecordNotFound))
+		})
+	})
+
+	Context("ListBlockedUsers", func() {
+		It("should list who the User blocked", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `user_blocks` WHERE user_id = ? ORDER BY created_at")).
+				WithArgs(10).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "blocked_user_id"}).AddRow(10, 11))
+
+			blocks, err := ListBlockedUsers(10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(blocks).Should(HaveLen(1))
+			Expect(blocks[0].BlockedUserID).Should(Equal(uint(11)))
+		})
+	})
+})
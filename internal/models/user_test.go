@@ -2,9 +2,11 @@ package models
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/pkg/passwords"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"gorm.io/driver/sqlite"
@@ -12,11 +14,36 @@ import (
 	"regexp"
 )
 
+type hashOf string
+
+// countingHasher counts the hashes it makes, to tell when they are reused.
+type countingHasher struct {
+	passwords.Hasher
+	hashes int
+}
+
+func (h *countingHasher) Hash(password string) (string, error) {
+	h.hashes++
+	return h.Hasher.Hash(password)
+}
+
+func (password hashOf) Match(value driver.Value) bool {
+	hash, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	matched, err := passwords.Verify(string(password), hash)
+	return err == nil && matched
+}
+
 var _ = Describe("User", func() {
 	var mock sqlmock.Sqlmock
 	var db *sql.DB
 
 	BeforeEach(func() {
+		PasswordHasher = &passwords.Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
 		sqlDb, sqlMock, err := sqlmock.New()
 		Expect(err).ShouldNot(HaveOccurred())
 
@@ -47,7 +74,7 @@ var _ = Describe("User", func() {
 				mock.ExpectBegin()
 				sql := regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`user_name`,`display_name`,`password`) VALUES (?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, user.Password).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, hashOf(user.Password)).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -75,7 +102,7 @@ var _ = Describe("User", func() {
 				mock.ExpectBegin()
 				sql := regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`user_name`,`display_name`,`password`) VALUES (?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, user.Password).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, hashOf(user.Password)).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -87,6 +114,38 @@ var _ = Describe("User", func() {
 			})
 		})
 
+		When("inserting a User with Identities", func() {
+			It("should link them to the new User", func() {
+				user := &User{
+					UserName:   "Ygritte",
+					Password:   "password",
+					Identities: []Identity{{Issuer: "https://id.example.com", Subject: "ygritte"}},
+				}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`user_name`,`display_name`,`password`) VALUES (?,?,?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "Ygritte", "Ygritte", hashOf(user.Password)).
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `identities` (`created_at`,`issuer`,`subject`,`user_id`) VALUES (?,?,?,?)")).
+					WithArgs(sqlmock.AnyArg(), "https://id.example.com", "ygritte", 7).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				Expect(CreateUser(user)).Should(Succeed())
+				Expect(user.Identities[0].UserID).Should(BeEquivalentTo(7))
+			})
+
+			It("should return ErrEmptySubject for an Identity without Subject", func() {
+				user := &User{
+					UserName:   "Ygritte",
+					Password:   "password",
+					Identities: []Identity{{Issuer: "https://id.example.com"}},
+				}
+
+				Expect(CreateUser(user)).Should(Equal(ErrEmptySubject))
+			})
+		})
+
 		When("inserting a User without UserName", func() {
 			It("should return an error without executing any sql on database", func() {
 				user := &User{
@@ -113,7 +172,7 @@ var _ = Describe("User", func() {
 				mock.ExpectBegin()
 				sql := regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`user_name`,`display_name`,`password`) VALUES (?,?,?,?,?,?)")
 				mock.ExpectExec(sql).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.UserName, user.Password).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.UserName, hashOf(user.Password)).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
@@ -151,7 +210,7 @@ var _ = Describe("User", func() {
 
 				mock.ExpectBegin()
 				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`user_name`,`display_name`,`password`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, user.Password).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, hashOf(user.Password)).
 					WillReturnError(errors.New("some db error"))
 				mock.ExpectRollback()
 
@@ -180,12 +239,12 @@ var _ = Describe("User", func() {
 
 				mock.ExpectBegin()
 				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`user_name`,`display_name`,`password`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, user.Password).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, hashOf(user.Password)).
 					WillReturnResult(sqlmock.NewResult(newUserID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`user_id`) VALUES (?,?,?,?,?)")).
-					WithArgs(user.Emails[0].Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, newUserID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`verified`,`is_primary`,`user_id`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(user.Emails[0].Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, false, false, newUserID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -217,12 +276,12 @@ var _ = Describe("User", func() {
 
 				mock.ExpectBegin()
 				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`user_name`,`display_name`,`password`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, user.Password).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, hashOf(user.Password)).
 					WillReturnResult(sqlmock.NewResult(newUserID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`user_id`) VALUES (?,?,?,?,?),(?,?,?,?,?)")).
-					WithArgs(user.Emails[0].Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, newUserID, user.Emails[1].Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, newUserID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`verified`,`is_primary`,`user_id`) VALUES (?,?,?,?,?,?,?),(?,?,?,?,?,?,?)")).
+					WithArgs(user.Emails[0].Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, false, false, newUserID, user.Emails[1].Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, false, false, newUserID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 				mock.ExpectCommit()
 
@@ -250,12 +309,12 @@ var _ = Describe("User", func() {
 
 				mock.ExpectBegin()
 				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`user_name`,`display_name`,`password`) VALUES (?,?,?,?,?,?)")).
-					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, user.Password).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, user.UserName, user.DisplayName, hashOf(user.Password)).
 					WillReturnResult(sqlmock.NewResult(newUserID, 1))
 				mock.ExpectExec("SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
-				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`user_id`) VALUES (?,?,?,?,?)")).
-					WithArgs(user.Emails[0].Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, newUserID).
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `emails` (`email`,`created_at`,`updated_at`,`deleted_at`,`verified`,`is_primary`,`user_id`) VALUES (?,?,?,?,?,?,?)")).
+					WithArgs(user.Emails[0].Email, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, false, false, newUserID).
 					WillReturnError(errors.New("some db insert error"))
 				mock.ExpectExec("ROLLBACK TO SAVEPOINT .").
 					WillReturnResult(sqlmock.NewResult(0, 0))
@@ -269,4 +328,464 @@ var _ = Describe("User", func() {
 			})
 		})
 	})
+	Context("GetUserByUserName", func() {
+		When("getting a User that exists", func() {
+			It("should return the User", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE user_name = ? AND `users`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs("MotherOfDragons").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(1, "MotherOfDragons"))
+
+				user, err := GetUserByUserName("MotherOfDragons")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(user.ID).Should(Equal(uint(1)))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a User that does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE user_name = ? AND `users`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs("MotherOfDragons").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}))
+
+				user, err := GetUserByUserName("MotherOfDragons")
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+				Expect(user).Should(BeNil())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a User without a UserName", func() {
+			It("should return an error without executing any sql on database", func() {
+				user, err := GetUserByUserName("")
+				Expect(err).Should(Equal(ErrEmptyUserName))
+				Expect(user).Should(BeNil())
+			})
+		})
+	})
+
+	Context("VerifyDummyPassword", func() {
+		It("should verify against one hash for each PasswordHasher without touching the database", func() {
+			original := PasswordHasher
+			defer func() { PasswordHasher = original }()
+
+			hasher := &countingHasher{Hasher: &passwords.Bcrypt{Cost: 4}}
+			PasswordHasher = hasher
+			Expect(VerifyDummyPassword("password")).Should(Succeed())
+			Expect(VerifyDummyPassword("another password")).Should(Succeed())
+			Expect(hasher.hashes).Should(Equal(1))
+
+			other := &countingHasher{Hasher: &passwords.Bcrypt{Cost: 4}}
+			PasswordHasher = other
+			Expect(VerifyDummyPassword("password")).Should(Succeed())
+			Expect(other.hashes).Should(Equal(1))
+
+			err := mock.ExpectationsWereMet()
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("VerifyPassword", func() {
+		When("verifying the correct password against a hash with current parameters", func() {
+			It("should return true without touching the database", func() {
+				hash, err := PasswordHasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				user := &User{Model: gorm.Model{ID: 1}, Password: hash}
+
+				ok, err := VerifyPassword(user, "password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeTrue())
+				Expect(user.Password).Should(Equal(hash))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("verifying an incorrect password", func() {
+			It("should return false without touching the database", func() {
+				hash, err := (&passwords.Bcrypt{Cost: 4}).Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				user := &User{Model: gorm.Model{ID: 1}, Password: hash}
+
+				ok, err := VerifyPassword(user, "not the password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeFalse())
+				Expect(user.Password).Should(Equal(hash))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("verifying an empty password", func() {
+			It("should return an error", func() {
+				ok, err := VerifyPassword(&User{}, "")
+				Expect(err).Should(Equal(ErrEmptyPassword))
+				Expect(ok).Should(BeFalse())
+			})
+		})
+
+		When("verifying against a stored value that is not a hash", func() {
+			It("should return an error", func() {
+				ok, err := VerifyPassword(&User{Password: "password"}, "password")
+				Expect(err).Should(Equal(passwords.ErrInvalidHash))
+				Expect(ok).Should(BeFalse())
+			})
+		})
+
+		When("verifying the correct password against a hash with outdated parameters", func() {
+			It("should return true and store a rehashed password", func() {
+				hash, err := (&passwords.Bcrypt{Cost: 4}).Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				user := &User{Model: gorm.Model{ID: 1}, Password: hash}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `password`=?,`updated_at`=? WHERE `id` = ?")).
+					WithArgs(hashOf("password"), sqlmock.AnyArg(), user.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				ok, err := VerifyPassword(user, "password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeTrue())
+				Expect(user.Password).Should(HavePrefix("$argon2id$"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("storing the rehashed password fails", func() {
+			It("should still return true and keep the original hash", func() {
+				hash, err := (&passwords.Bcrypt{Cost: 4}).Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				user := &User{Model: gorm.Model{ID: 1}, Password: hash}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `password`=?,`updated_at`=? WHERE `id` = ?")).
+					WillReturnError(errors.New("some db error"))
+				mock.ExpectRollback()
+
+				ok, err := VerifyPassword(user, "password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeTrue())
+				Expect(user.Password).Should(Equal(hash))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("GetUser", func() {
+		When("the User exists", func() {
+			It("should return the User", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL LIMIT 1")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(4, "MotherOfDragons"))
+
+				user, err := GetUser(4)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(user.UserName).Should(Equal("MotherOfDragons"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("getting a User without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				user, err := GetUser(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+				Expect(user).Should(BeNil())
+			})
+		})
+	})
+
+	Context("ListUsers", func() {
+		When("listing Users", func() {
+			It("should return a page of Users that have not been deleted", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`deleted_at` IS NULL ORDER BY id LIMIT 2 OFFSET 4")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(5, "Khaleesi").AddRow(6, "Stormborn"))
+
+				users, err := ListUsers(4, 2)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(users).Should(HaveLen(2))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("ListUsersWithGroups", func() {
+		When("listing Users by ID", func() {
+			It("should return those that have not been deleted with their Groups", func() {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE id IN (?,?,?) AND `users`.`deleted_at` IS NULL ORDER BY id")).
+					WithArgs(5, 6, 7).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow(5, "Khaleesi").AddRow(6, "Stormborn"))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users_groups` WHERE `users_groups`.`user_id` IN (?,?)")).
+					WithArgs(5, 6).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "group_id"}).AddRow(6, 2))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `groups` WHERE `groups`.`id` = ? AND `groups`.`deleted_at` IS NULL")).
+					WithArgs(2).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Targaryens"))
+
+				users, err := ListUsersWithGroups([]uint{5, 6, 7})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(users).Should(HaveLen(2))
+				Expect(users[0].Groups).Should(BeEmpty())
+				Expect(users[1].Groups).Should(HaveLen(1))
+				Expect(users[1].Groups[0].Name).Should(Equal("Targaryens"))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("listing no Users", func() {
+			It("should return none without executing any sql on database", func() {
+				users, err := ListUsersWithGroups(nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(users).Should(BeEmpty())
+			})
+		})
+	})
+
+	Context("UpdateUser", func() {
+		When("updating a User with a UserName and DisplayName", func() {
+			It("should update both names", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `updated_at`=?,`user_name`=?,`display_name`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(sqlmock.AnyArg(), "Khaleesi", "Breaker Of Chains", 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := UpdateUser(&User{Model: gorm.Model{ID: 4}, UserName: "Khaleesi", DisplayName: "Breaker Of Chains"})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating a User that does not exist", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				err := UpdateUser(&User{Model: gorm.Model{ID: 4}, UserName: "Khaleesi", DisplayName: "Khaleesi"})
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating a User without a DisplayName", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateUser(&User{Model: gorm.Model{ID: 4}, UserName: "Khaleesi"})
+				Expect(err).Should(Equal(ErrEmptyDisplayName))
+			})
+		})
+
+		When("updating a User without a UserName", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateUser(&User{Model: gorm.Model{ID: 4}, DisplayName: "Khaleesi"})
+				Expect(err).Should(Equal(ErrEmptyUserName))
+			})
+		})
+	})
+
+	Context("UpdateUserPassword", func() {
+		When("updating the Password of an existing User", func() {
+			It("should store a hash of the new Password", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `password`=?,`updated_at`=? WHERE deleted_at IS NULL AND `id` = ?")).
+					WithArgs(hashOf("dracarys"), sqlmock.AnyArg(), 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := UpdateUserPassword(4, "dracarys")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("updating the Password without a Password", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := UpdateUserPassword(4, "")
+				Expect(err).Should(Equal(ErrEmptyPassword))
+			})
+		})
+	})
+
+	Context("DeleteUser", func() {
+		When("deleting an existing User", func() {
+			It("should delete their Sessions and soft delete the User", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `deleted_at`=? WHERE `users`.`id` = ? AND `users`.`deleted_at` IS NULL")).
+					WithArgs(sqlmock.AnyArg(), 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := DeleteUser(4)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("deleting a User that does not exist", func() {
+			It("should rollback and return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `deleted_at`=?")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := DeleteUser(4)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("RestoreUser", func() {
+		When("restoring a deleted User", func() {
+			It("should clear DeletedAt", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `deleted_at`=?,`updated_at`=? WHERE deleted_at IS NOT NULL AND `id` = ?")).
+					WithArgs(nil, sqlmock.AnyArg(), 4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := RestoreUser(4)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("restoring a User that is not deleted", func() {
+			It("should return gorm.ErrRecordNotFound", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE `users`")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				err := RestoreUser(4)
+				Expect(err).Should(Equal(gorm.ErrRecordNotFound))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("PurgeUser", func() {
+		When("purging a User who authored no Topics or Groups", func() {
+			It("should permanently remove the User and everything they own", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics` WHERE author_id = ?")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `groups` WHERE author_id = ?")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `posts` WHERE author_id = ? OR discussion_id IN (SELECT `id` FROM `discussions` WHERE author_id = ?)")).
+					WithArgs(4, 4).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `discussions` WHERE author_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `sessions` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `email_verifications` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `password_resets` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `recovery_codes` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `two_factors` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `api_tokens` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `identities` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `failed_logins` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `login_throttles` WHERE throttle_key = ?")).
+					WithArgs("user:4").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `emails` WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users_groups WHERE user_id = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `users` WHERE `users`.`id` = ?")).
+					WithArgs(4).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := PurgeUser(4)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("purging a User who authored a Topic", func() {
+			It("should rollback and return ErrUserHasOwnership", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `topics` WHERE author_id = ?")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(1) FROM `groups` WHERE author_id = ?")).
+					WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectRollback()
+
+				err := PurgeUser(4)
+				Expect(err).Should(Equal(ErrUserHasOwnership))
+
+				err = mock.ExpectationsWereMet()
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("purging a User without an ID", func() {
+			It("should return an error without executing any sql on database", func() {
+				err := PurgeUser(0)
+				Expect(err).Should(Equal(ErrEmptyID))
+			})
+		})
+	})
 })
@@ -0,0 +1,57 @@
+package search
+
+import (
+	"github.com/golangbb/golangbb/v2/pkg/fulltext"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// The FTS5 auxiliary functions place these around the matches they
+// highlight, to be turned into <mark> once the text is escaped.
+const (
+	fts5MarkOpen  = "\x02"
+	fts5MarkClose = "\x03"
+)
+
+// FTS5 searches the discussions_search and posts_search FTS5 tables,
+// which triggers keep in step with the discussions and posts tables. Results
+// are ranked by BM25. Databases migrated without FTS5 have no such tables and
+// are searched by Like.
+type FTS5 struct{}
+
+func (FTS5) Indexed(db *gorm.DB) bool {
+	return db.Migrator().HasTable("posts_search")
+}
+
+func (FTS5) Search(db *gorm.DB, query Query) ([]Result, error) {
+	match := fts5Match(query.Terms)
+
+	discussions := filters(db.Table("discussions_search").Joins("JOIN discussions ON discussions.id = discussions_search.rowid"), "discussions", query).
+		Select(columns(KindDiscussion, "highlight(discussions_search, 0, ?, ?)", "-bm25(discussions_search)"), fts5MarkOpen, fts5MarkClose).
+		Where("discussions_search MATCH ?", match)
+	posts := filters(db.Table("posts_search").Joins("JOIN posts ON posts.id = posts_search.rowid").Joins("JOIN discussions ON discussions.id = posts.discussion_id"), "posts", query).
+		Select(columns(KindPost, "snippet(posts_search, 0, ?, ?, ?, 24)", "-bm25(posts_search)"), fts5MarkOpen, fts5MarkClose, "…").
+		Where("posts_search MATCH ?", match)
+
+	results, err := union(db, discussions, posts, "relevance DESC, created_at DESC", query)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Snippet = fulltext.Mark(results[i].Snippet, fts5MarkOpen, fts5MarkClose)
+	}
+
+	return results, nil
+}
+
+// fts5Match quotes every term as an FTS5 string, so that the query syntax of
+// user input is never interpreted and all terms have to match.
+func fts5Match(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	return strings.Join(quoted, " ")
+}
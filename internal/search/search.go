@@ -0,0 +1,199 @@
+// Package search finds the Discussions and Posts matching a Query, through
+// the full-text index of the database where it has one.
+package search
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/pkg/fulltext"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	KindDiscussion = "discussion"
+	KindPost       = "post"
+)
+
+// SnippetWidth is roughly how many characters of a Post a search result
+// quotes around its matches.
+const SnippetWidth = 160
+
+// Query finds the Discussions whose Title and the Posts whose Content
+// contain every one of its Terms, each a word or a phrase.
+type Query struct {
+	Terms    []string
+	AuthorID uint
+	// TopicIDs restricts the search to Discussions in these Topics. A nil
+	// slice searches every Topic, an empty one none.
+	TopicIDs []uint
+	Since    time.Time
+	Until    time.Time
+	Offset   int
+	Limit    int
+}
+
+// Result is a Discussion or a Post that matched a Query. Its Snippet is HTML
+// with the matches wrapped in <mark>, and results with a higher Relevance
+// match better.
+type Result struct {
+	Kind         string
+	ID           uint
+	DiscussionID uint
+	TopicID      uint
+	AuthorID     uint
+	Title        string
+	Snippet      string
+	Relevance    float64
+	CreatedAt    time.Time
+}
+
+// Backend runs a Query on a database. Backends are looked up in Backends by
+// the name of the database dialect, and keep whatever index they search up to
+// date themselves.
+type Backend interface {
+	Search(db *gorm.DB, query Query) ([]Result, error)
+}
+
+// Indexed is implemented by backends whose index only some databases have,
+// such as one the migrations create when the driver supports it.
+type Indexed interface {
+	Indexed(db *gorm.DB) bool
+}
+
+// Backends maps database dialects to the backend searching them. Those
+// without one are searched by Like.
+var Backends = map[string]Backend{
+	"sqlite": FTS5{},
+}
+
+// BackendFor picks the backend searching db, falling back to Like when the
+// dialect has none or db lacks its index. It inspects the schema, so
+// long-lived callers pick once, after migrating, and keep the backend.
+func BackendFor(db *gorm.DB) Backend {
+	backend, ok := Backends[db.Dialector.Name()]
+	if !ok {
+		return Like{}
+	}
+
+	if indexed, ok := backend.(Indexed); ok && !indexed.Indexed(db) {
+		return Like{}
+	}
+
+	return backend
+}
+
+// Find returns the Discussions and Posts matching query, best matches
+// first. Deleted ones are never found.
+func Find(query Query) ([]Result, error) {
+	return FindContext(context.Background(), database.DBConnection, nil, query)
+}
+
+// FindContext runs query with backend, or with the one BackendFor picks
+// when backend is nil.
+func FindContext(ctx context.Context, db *gorm.DB, backend Backend, query Query) ([]Result, error) {
+	db = db.WithContext(ctx)
+
+	if len(query.Terms) == 0 {
+		return nil, models.ErrEmptyQuery
+	}
+
+	if query.TopicIDs != nil && len(query.TopicIDs) == 0 {
+		return []Result{}, nil
+	}
+
+	if backend == nil {
+		backend = BackendFor(db)
+	}
+
+	results, err := backend.Search(db, query)
+	if err != nil {
+		log.Println("[SEARCH]::DB_SELECT_SEARCH_RESULTS_ERROR 💥")
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// columns selects a Result from discussions, and from posts when
+// it is joined in, with the text to quote from in the snippet column.
+func columns(kind, snippet, relevance string) string {
+	if kind == KindDiscussion {
+		return "'" + kind + "' AS kind, discussions.id AS id, discussions.id AS discussion_id, discussions.topic_id, discussions.author_id, discussions.title, " +
+			snippet + " AS snippet, " + relevance + " AS relevance, discussions.created_at"
+	}
+
+	return "'" + kind + "' AS kind, posts.id AS id, posts.discussion_id, discussions.topic_id, posts.author_id, discussions.title, " +
+		snippet + " AS snippet, " + relevance + " AS relevance, posts.created_at"
+}
+
+// filters narrows the rows of table, discussions or posts, down to those
+// matching the filters of query.
+func filters(tx *gorm.DB, table string, query Query) *gorm.DB {
+	tx = tx.Where(table + ".deleted_at IS NULL")
+	if table != "discussions" {
+		tx = tx.Where("discussions.deleted_at IS NULL")
+	}
+
+	if query.AuthorID != 0 {
+		tx = tx.Where(table+".author_id = ?", query.AuthorID)
+	}
+
+	if query.TopicIDs != nil {
+		tx = tx.Where("discussions.topic_id IN ?", query.TopicIDs)
+	}
+
+	if !query.Since.IsZero() {
+		tx = tx.Where(table+".created_at >= ?", query.Since)
+	}
+
+	if !query.Until.IsZero() {
+		tx = tx.Where(table+".created_at < ?", query.Until)
+	}
+
+	return tx
+}
+
+// union pages through the matching Discussions and Posts together.
+func union(db *gorm.DB, discussions, posts *gorm.DB, order string, query Query) ([]Result, error) {
+	results := []Result{}
+	err := db.Raw(
+		"SELECT * FROM (?) AS discussion_results UNION ALL SELECT * FROM (?) AS post_results ORDER BY "+order+" LIMIT ? OFFSET ?",
+		discussions, posts, query.Limit, query.Offset,
+	).Scan(&results).Error
+
+	return results, err
+}
+
+// Like matches terms with LIKE and needs no index, which makes it
+// slow on large forums. It ranks the newest matches first.
+type Like struct{}
+
+func (Like) Search(db *gorm.DB, query Query) ([]Result, error) {
+	discussions := filters(db.Table("discussions"), "discussions", query).
+		Select(columns(KindDiscussion, "discussions.title", "0"))
+	posts := filters(db.Table("posts").Joins("JOIN discussions ON discussions.id = posts.discussion_id"), "posts", query).
+		Select(columns(KindPost, "posts.content", "0"))
+
+	for _, term := range query.Terms {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(term)) + "%"
+		discussions = discussions.Where("LOWER(discussions.title) LIKE ? ESCAPE '!'", pattern)
+		posts = posts.Where("LOWER(posts.content) LIKE ? ESCAPE '!'", pattern)
+	}
+
+	results, err := union(db, discussions, posts, "created_at DESC, kind, id DESC", query)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Snippet = fulltext.Snippet(results[i].Snippet, query.Terms, SnippetWidth)
+	}
+
+	return results, nil
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
@@ -0,0 +1,150 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("Search", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+
+	columns := []string{"kind", "id", "discussion_id", "topic_id", "author_id", "title", "snippet", "relevance", "created_at"}
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	When("searching a SQLite database", func() {
+		BeforeEach(func() {
+			_, err := database.Connect(sqlite.Dialector{
+				DriverName: "sqlite",
+				Conn:       db,
+			}, gorm.Config{})
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should rank the FTS5 matches of every term and mark them in the snippets", func() {
+			since := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+			discussions := "SELECT * FROM (SELECT 'discussion' AS kind, discussions.id AS id, discussions.id AS discussion_id, discussions.topic_id, discussions.author_id, discussions.title, highlight(discussions_search, 0, ?, ?) AS snippet, -bm25(discussions_search) AS relevance, discussions.created_at FROM `discussions_search` JOIN discussions ON discussions.id = discussions_search.rowid WHERE discussions.deleted_at IS NULL AND (discussions.author_id = ?) AND discussions.topic_id IN (?,?) AND discussions.created_at >= ? AND discussions_search MATCH ?) AS discussion_results UNION ALL "
+			posts := "SELECT * FROM (SELECT 'post' AS kind, posts.id AS id, posts.discussion_id, discussions.topic_id, posts.author_id, discussions.title, snippet(posts_search, 0, ?, ?, ?, 24) AS snippet, -bm25(posts_search) AS relevance, posts.created_at FROM `posts_search` JOIN posts ON posts.id = posts_search.rowid JOIN discussions ON discussions.id = posts.discussion_id WHERE posts.deleted_at IS NULL AND discussions.deleted_at IS NULL AND (posts.author_id = ?) AND discussions.topic_id IN (?,?) AND posts.created_at >= ? AND posts_search MATCH ?) AS post_results "
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?")).
+				WithArgs("posts_search").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery(regexp.QuoteMeta(discussions+posts+"ORDER BY relevance DESC, created_at DESC LIMIT ? OFFSET ?")).
+				WithArgs(
+					"\x02", "\x03", 10, 1, 2, since, `"winter" "is ""coming"""`,
+					"\x02", "\x03", "…", 10, 1, 2, since, `"winter" "is ""coming"""`,
+					20, 40,
+				).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("post", 7, 3, 1, 10, "The North", "<b>\x02Winter\x03</b> is", 1.5, since))
+
+			results, err := Find(Query{
+				Terms:    []string{"winter", `is "coming"`},
+				AuthorID: 10,
+				TopicIDs: []uint{1, 2},
+				Since:    since,
+				Offset:   40,
+				Limit:    20,
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(results).Should(Equal([]Result{{
+				Kind:         KindPost,
+				ID:           7,
+				DiscussionID: 3,
+				TopicID:      1,
+				AuthorID:     10,
+				Title:        "The North",
+				Snippet:      "&lt;b&gt;<mark>Winter</mark>&lt;/b&gt; is",
+				Relevance:    1.5,
+				CreatedAt:    since,
+			}}))
+		})
+
+		It("should match with LIKE when the database was migrated without FTS5", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?")).
+				WithArgs("posts_search").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM `discussions` WHERE discussions.deleted_at IS NULL AND LOWER(discussions.title) LIKE ? ESCAPE '!'")).
+				WithArgs("%winter%", "%winter%", 20, 0).
+				WillReturnRows(sqlmock.NewRows(columns))
+
+			results, err := Find(Query{Terms: []string{"Winter"}, Limit: 20})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(results).Should(BeEmpty())
+		})
+
+		It("should pick FTS5 when the database has its tables, and Like when it does not", func() {
+			for _, count := range []int{1, 0} {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?")).
+					WithArgs("posts_search").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+			}
+
+			Expect(BackendFor(database.DBConnection)).Should(Equal(FTS5{}))
+			Expect(BackendFor(database.DBConnection)).Should(Equal(Like{}))
+		})
+
+		It("should search with the backend it is given without inspecting the schema", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("FROM `discussions_search` JOIN discussions")).
+				WillReturnRows(sqlmock.NewRows(columns))
+
+			results, err := FindContext(context.Background(), database.DBConnection, FTS5{}, Query{Terms: []string{"winter"}, Limit: 20})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(results).Should(BeEmpty())
+		})
+
+		It("should return models.ErrEmptyQuery without executing any sql", func() {
+			_, err := Find(Query{Limit: 20})
+			Expect(err).Should(Equal(models.ErrEmptyQuery))
+		})
+
+		It("should find nothing without executing any sql when no Topic may be searched", func() {
+			results, err := Find(Query{Terms: []string{"winter"}, TopicIDs: []uint{}, Limit: 20})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(results).Should(BeEmpty())
+		})
+	})
+
+	When("searching a database without a search backend", func() {
+		BeforeEach(func() {
+			_, err := database.Connect(postgres.New(postgres.Config{Conn: db}), gorm.Config{})
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should match every term with LIKE and quote the text around the matches", func() {
+			until := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+			discussions := `SELECT * FROM (SELECT 'discussion' AS kind, discussions.id AS id, discussions.id AS discussion_id, discussions.topic_id, discussions.author_id, discussions.title, discussions.title AS snippet, 0 AS relevance, discussions.created_at FROM "discussions" WHERE discussions.deleted_at IS NULL AND discussions.created_at < $1 AND LOWER(discussions.title) LIKE $2 ESCAPE '!') AS discussion_results UNION ALL `
+			posts := `SELECT * FROM (SELECT 'post' AS kind, posts.id AS id, posts.discussion_id, discussions.topic_id, posts.author_id, discussions.title, posts.content AS snippet, 0 AS relevance, posts.created_at FROM "posts" JOIN discussions ON discussions.id = posts.discussion_id WHERE posts.deleted_at IS NULL AND discussions.deleted_at IS NULL AND posts.created_at < $3 AND LOWER(posts.content) LIKE $4 ESCAPE '!') AS post_results `
+			mock.ExpectQuery(regexp.QuoteMeta(discussions+posts+"ORDER BY created_at DESC, kind, id DESC LIMIT $5 OFFSET $6")).
+				WithArgs(until, "%100!% stark%", until, "%100!% stark%", 20, 0).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("discussion", 3, 3, 1, 10, "100% Stark", "100% Stark", 0, until))
+
+			results, err := Find(Query{Terms: []string{"100% Stark"}, Until: until, Limit: 20})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(results).Should(HaveLen(1))
+			Expect(results[0].Snippet).Should(Equal("<mark>100% Stark</mark>"))
+		})
+	})
+})
@@ -0,0 +1,764 @@
+package store
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/search"
+	"gorm.io/gorm"
+	"time"
+)
+
+type gormStore struct {
+	db     *gorm.DB
+	search search.Backend
+}
+
+var _ Store = gormStore{}
+
+// New returns a Store backed by db. Every repository call runs with the
+// context it is given, so requests can be cancelled and traced. The search
+// backend is picked here, so db has to be migrated first.
+func New(db *gorm.DB) Store {
+	return gormStore{db: db, search: search.BackendFor(db)}
+}
+
+func (s gormStore) Users() UserRepository {
+	return userRepository{db: s.db}
+}
+
+func (s gormStore) Emails() EmailRepository {
+	return emailRepository{db: s.db}
+}
+
+func (s gormStore) Groups() GroupRepository {
+	return groupRepository{db: s.db}
+}
+
+func (s gormStore) Sessions() SessionRepository {
+	return sessionRepository{db: s.db}
+}
+
+func (s gormStore) Topics() TopicRepository {
+	return topicRepository{db: s.db}
+}
+
+func (s gormStore) Discussions() DiscussionRepository {
+	return discussionRepository{db: s.db}
+}
+
+func (s gormStore) Posts() PostRepository {
+	return postRepository{db: s.db}
+}
+
+func (s gormStore) Permissions() PermissionRepository {
+	return permissionRepository{db: s.db}
+}
+
+func (s gormStore) TwoFactor() TwoFactorRepository {
+	return twoFactorRepository{db: s.db}
+}
+
+func (s gormStore) APITokens() APITokenRepository {
+	return apiTokenRepository{db: s.db}
+}
+
+func (s gormStore) Identities() IdentityRepository {
+	return identityRepository{db: s.db}
+}
+
+func (s gormStore) LoginAttempts() LoginAttemptRepository {
+	return loginAttemptRepository{db: s.db}
+}
+
+func (s gormStore) Reactions() ReactionRepository {
+	return reactionRepository{db: s.db}
+}
+
+func (s gormStore) Conversations() ConversationRepository {
+	return conversationRepository{db: s.db}
+}
+
+func (s gormStore) Blocks() BlockRepository {
+	return blockRepository{db: s.db}
+}
+
+func (s gormStore) Search() SearchRepository {
+	return searchRepository{db: s.db, backend: s.search}
+}
+
+func (s gormStore) ReadStates() ReadStateRepository {
+	return readStateRepository{db: s.db}
+}
+
+func (s gormStore) Subscriptions() SubscriptionRepository {
+	return subscriptionRepository{db: s.db}
+}
+
+func (s gormStore) Notifications() NotificationRepository {
+	return notificationRepository{db: s.db}
+}
+
+func (s gormStore) Outbox() OutboxRepository {
+	return outboxRepository{db: s.db}
+}
+
+type userRepository struct {
+	db *gorm.DB
+}
+
+func (r userRepository) Create(ctx context.Context, user *models.User) error {
+	return models.CreateUserContext(ctx, r.db, user)
+}
+
+func (r userRepository) Get(ctx context.Context, id uint) (*models.User, error) {
+	return models.GetUserContext(ctx, r.db, id)
+}
+
+func (r userRepository) GetByUserName(ctx context.Context, userName string) (*models.User, error) {
+	return models.GetUserByUserNameContext(ctx, r.db, userName)
+}
+
+func (r userRepository) List(ctx context.Context, offset, limit int) ([]models.User, error) {
+	return models.ListUsersContext(ctx, r.db, offset, limit)
+}
+
+func (r userRepository) ListWithGroups(ctx context.Context, ids []uint) ([]models.User, error) {
+	return models.ListUsersWithGroupsContext(ctx, r.db, ids)
+}
+
+func (r userRepository) Update(ctx context.Context, user *models.User) error {
+	return models.UpdateUserContext(ctx, r.db, user)
+}
+
+func (r userRepository) UpdatePassword(ctx context.Context, id uint, password string) error {
+	return models.UpdateUserPasswordContext(ctx, r.db, id, password)
+}
+
+func (r userRepository) VerifyPassword(ctx context.Context, user *models.User, password string) (bool, error) {
+	return models.VerifyPasswordContext(ctx, r.db, user, password)
+}
+
+func (r userRepository) Delete(ctx context.Context, id uint) error {
+	return models.DeleteUserContext(ctx, r.db, id)
+}
+
+func (r userRepository) Restore(ctx context.Context, id uint) error {
+	return models.RestoreUserContext(ctx, r.db, id)
+}
+
+func (r userRepository) Purge(ctx context.Context, id uint) error {
+	return models.PurgeUserContext(ctx, r.db, id)
+}
+
+func (r userRepository) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) (string, error) {
+	return models.CreatePasswordResetContext(ctx, r.db, reset)
+}
+
+func (r userRepository) ResetPassword(ctx context.Context, token, password string) error {
+	return models.ResetPasswordContext(ctx, r.db, token, password)
+}
+
+func (r userRepository) DeleteExpiredPasswordResets(ctx context.Context) error {
+	return models.DeleteExpiredPasswordResetsContext(ctx, r.db)
+}
+
+type emailRepository struct {
+	db *gorm.DB
+}
+
+func (r emailRepository) Create(ctx context.Context, email *models.Email) error {
+	return models.CreateEmailContext(ctx, r.db, email)
+}
+
+func (r emailRepository) Get(ctx context.Context, address string) (*models.Email, error) {
+	return models.GetEmailContext(ctx, r.db, address)
+}
+
+func (r emailRepository) List(ctx context.Context, userID uint) ([]models.Email, error) {
+	return models.ListEmailsContext(ctx, r.db, userID)
+}
+
+func (r emailRepository) Update(ctx context.Context, email *models.Email) error {
+	return models.UpdateEmailContext(ctx, r.db, email)
+}
+
+func (r emailRepository) Delete(ctx context.Context, address string) error {
+	return models.DeleteEmailContext(ctx, r.db, address)
+}
+
+func (r emailRepository) Restore(ctx context.Context, address string) error {
+	return models.RestoreEmailContext(ctx, r.db, address)
+}
+
+func (r emailRepository) Purge(ctx context.Context, address string) error {
+	return models.PurgeEmailContext(ctx, r.db, address)
+}
+
+func (r emailRepository) CreateVerification(ctx context.Context, verification *models.EmailVerification) (string, error) {
+	return models.CreateEmailVerificationContext(ctx, r.db, verification)
+}
+
+func (r emailRepository) Verify(ctx context.Context, token string) (*models.Email, error) {
+	return models.VerifyEmailContext(ctx, r.db, token)
+}
+
+func (r emailRepository) SetPrimary(ctx context.Context, address string) error {
+	return models.SetPrimaryEmailContext(ctx, r.db, address)
+}
+
+func (r emailRepository) GetPrimary(ctx context.Context, userID uint) (*models.Email, error) {
+	return models.GetPrimaryEmailContext(ctx, r.db, userID)
+}
+
+func (r emailRepository) DeleteExpiredVerifications(ctx context.Context) error {
+	return models.DeleteExpiredEmailVerificationsContext(ctx, r.db)
+}
+
+type groupRepository struct {
+	db *gorm.DB
+}
+
+func (r groupRepository) Create(ctx context.Context, group *models.Group) error {
+	return models.CreateGroupContext(ctx, r.db, group)
+}
+
+func (r groupRepository) Get(ctx context.Context, id uint) (*models.Group, error) {
+	return models.GetGroupContext(ctx, r.db, id)
+}
+
+func (r groupRepository) List(ctx context.Context, offset, limit int) ([]models.Group, error) {
+	return models.ListGroupsContext(ctx, r.db, offset, limit)
+}
+
+func (r groupRepository) Update(ctx context.Context, group *models.Group) error {
+	return models.UpdateGroupContext(ctx, r.db, group)
+}
+
+func (r groupRepository) Delete(ctx context.Context, id uint) error {
+	return models.DeleteGroupContext(ctx, r.db, id)
+}
+
+func (r groupRepository) Restore(ctx context.Context, id uint) error {
+	return models.RestoreGroupContext(ctx, r.db, id)
+}
+
+func (r groupRepository) Purge(ctx context.Context, id uint) error {
+	return models.PurgeGroupContext(ctx, r.db, id)
+}
+
+func (r groupRepository) IsMember(ctx context.Context, userID uint, name string) (bool, error) {
+	return models.IsGroupMemberContext(ctx, r.db, userID, name)
+}
+
+func (r groupRepository) SetRequireTwoFactor(ctx context.Context, id uint, required bool) error {
+	return models.SetGroupRequireTwoFactorContext(ctx, r.db, id, required)
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func (r sessionRepository) Create(ctx context.Context, session *models.Session) (string, error) {
+	return models.CreateSessionContext(ctx, r.db, session)
+}
+
+func (r sessionRepository) Get(ctx context.Context, token string) (*models.Session, error) {
+	return models.GetSessionContext(ctx, r.db, token)
+}
+
+func (r sessionRepository) Delete(ctx context.Context, token string) error {
+	return models.DeleteSessionContext(ctx, r.db, token)
+}
+
+func (r sessionRepository) DeleteForUser(ctx context.Context, userID uint) error {
+	return models.DeleteUserSessionsContext(ctx, r.db, userID)
+}
+
+func (r sessionRepository) DeleteExpired(ctx context.Context) error {
+	return models.DeleteExpiredSessionsContext(ctx, r.db)
+}
+
+type topicRepository struct {
+	db *gorm.DB
+}
+
+func (r topicRepository) Create(ctx context.Context, topic *models.Topic) error {
+	return models.CreateTopicContext(ctx, r.db, topic)
+}
+
+func (r topicRepository) Get(ctx context.Context, id uint) (*models.Topic, error) {
+	return models.GetTopicContext(ctx, r.db, id)
+}
+
+func (r topicRepository) List(ctx context.Context) ([]models.Topic, error) {
+	return models.ListTopicsContext(ctx, r.db)
+}
+
+func (r topicRepository) Tree(ctx context.Context) ([]models.Topic, error) {
+	return models.GetTopicTreeContext(ctx, r.db)
+}
+
+func (r topicRepository) Ancestors(ctx context.Context, id uint) ([]models.Topic, error) {
+	return models.GetTopicAncestorsContext(ctx, r.db, id)
+}
+
+func (r topicRepository) Descendants(ctx context.Context, id uint) ([]models.Topic, error) {
+	return models.GetTopicDescendantsContext(ctx, r.db, id)
+}
+
+func (r topicRepository) Update(ctx context.Context, topic *models.Topic) error {
+	return models.UpdateTopicContext(ctx, r.db, topic)
+}
+
+func (r topicRepository) Move(ctx context.Context, id uint, parentID *uint, position int) error {
+	return models.MoveTopicContext(ctx, r.db, id, parentID, position)
+}
+
+func (r topicRepository) Delete(ctx context.Context, id uint) error {
+	return models.DeleteTopicContext(ctx, r.db, id)
+}
+
+func (r topicRepository) Restore(ctx context.Context, id uint) error {
+	return models.RestoreTopicContext(ctx, r.db, id)
+}
+
+func (r topicRepository) Purge(ctx context.Context, id uint) error {
+	return models.PurgeTopicContext(ctx, r.db, id)
+}
+
+type discussionRepository struct {
+	db *gorm.DB
+}
+
+func (r discussionRepository) Create(ctx context.Context, discussion *models.Discussion) error {
+	return models.CreateDiscussionContext(ctx, r.db, discussion)
+}
+
+func (r discussionRepository) Get(ctx context.Context, id uint) (*models.Discussion, error) {
+	return models.GetDiscussionContext(ctx, r.db, id)
+}
+
+func (r discussionRepository) TopicID(ctx context.Context, id uint) (uint, error) {
+	return models.GetDiscussionTopicIDContext(ctx, r.db, id)
+}
+
+func (r discussionRepository) List(ctx context.Context, topicID uint, offset, limit int) ([]models.Discussion, error) {
+	return models.ListDiscussionsContext(ctx, r.db, topicID, offset, limit)
+}
+
+func (r discussionRepository) Update(ctx context.Context, discussion *models.Discussion) error {
+	return models.UpdateDiscussionContext(ctx, r.db, discussion)
+}
+
+func (r discussionRepository) Delete(ctx context.Context, id uint) error {
+	return models.DeleteDiscussionContext(ctx, r.db, id)
+}
+
+func (r discussionRepository) Restore(ctx context.Context, id uint) error {
+	return models.RestoreDiscussionContext(ctx, r.db, id)
+}
+
+func (r discussionRepository) Purge(ctx context.Context, id uint) error {
+	return models.PurgeDiscussionContext(ctx, r.db, id)
+}
+
+type postRepository struct {
+	db *gorm.DB
+}
+
+func (r postRepository) Create(ctx context.Context, post *models.Post) error {
+	return models.CreatePostContext(ctx, r.db, post)
+}
+
+func (r postRepository) Get(ctx context.Context, id uint) (*models.Post, error) {
+	return models.GetPostContext(ctx, r.db, id)
+}
+
+func (r postRepository) TopicID(ctx context.Context, id uint) (uint, error) {
+	return models.GetPostTopicIDContext(ctx, r.db, id)
+}
+
+func (r postRepository) List(ctx context.Context, discussionID uint, offset, limit int) ([]models.Post, error) {
+	return models.ListPostsContext(ctx, r.db, discussionID, offset, limit)
+}
+
+func (r postRepository) Update(ctx context.Context, post *models.Post, editorID uint, reason string) error {
+	return models.UpdatePostContext(ctx, r.db, post, editorID, reason)
+}
+
+func (r postRepository) Delete(ctx context.Context, id uint) error {
+	return models.DeletePostContext(ctx, r.db, id)
+}
+
+func (r postRepository) Restore(ctx context.Context, id uint) error {
+	return models.RestorePostContext(ctx, r.db, id)
+}
+
+func (r postRepository) Purge(ctx context.Context, id uint) error {
+	return models.PurgePostContext(ctx, r.db, id)
+}
+
+func (r postRepository) GetRevision(ctx context.Context, id uint) (*models.PostRevision, error) {
+	return models.GetPostRevisionContext(ctx, r.db, id)
+}
+
+func (r postRepository) ListRevisions(ctx context.Context, postID uint, offset, limit int) ([]models.PostRevision, error) {
+	return models.ListPostRevisionsContext(ctx, r.db, postID, offset, limit)
+}
+
+func (r postRepository) HideRevision(ctx context.Context, id uint) error {
+	return models.HidePostRevisionContext(ctx, r.db, id)
+}
+
+func (r postRepository) UnhideRevision(ctx context.Context, id uint) error {
+	return models.UnhidePostRevisionContext(ctx, r.db, id)
+}
+
+func (r postRepository) ListMentions(ctx context.Context, userID uint, topicIDs []uint, offset, limit int) ([]models.Post, error) {
+	return models.ListMentionsContext(ctx, r.db, userID, topicIDs, offset, limit)
+}
+
+func (r postRepository) DeleteMentions(ctx context.Context, postID uint, userIDs []uint) error {
+	return models.DeleteMentionsContext(ctx, r.db, postID, userIDs)
+}
+
+type permissionRepository struct {
+	db *gorm.DB
+}
+
+func (r permissionRepository) Set(ctx context.Context, permission *models.Permission) error {
+	return models.SetPermissionContext(ctx, r.db, permission)
+}
+
+func (r permissionRepository) Get(ctx context.Context, id uint) (*models.Permission, error) {
+	return models.GetPermissionContext(ctx, r.db, id)
+}
+
+func (r permissionRepository) List(ctx context.Context) ([]models.Permission, error) {
+	return models.ListPermissionsContext(ctx, r.db)
+}
+
+func (r permissionRepository) ListForUser(ctx context.Context, userID uint) ([]models.Permission, error) {
+	return models.ListUserPermissionsContext(ctx, r.db, userID)
+}
+
+func (r permissionRepository) Delete(ctx context.Context, id uint) error {
+	return models.DeletePermissionContext(ctx, r.db, id)
+}
+
+type twoFactorRepository struct {
+	db *gorm.DB
+}
+
+func (r twoFactorRepository) Get(ctx context.Context, userID uint) (*models.TwoFactor, error) {
+	return models.GetTwoFactorContext(ctx, r.db, userID)
+}
+
+func (r twoFactorRepository) Enrol(ctx context.Context, userID uint) (*models.TwoFactor, error) {
+	return models.EnrolTwoFactorContext(ctx, r.db, userID)
+}
+
+func (r twoFactorRepository) Confirm(ctx context.Context, userID uint, code string) ([]string, error) {
+	return models.ConfirmTwoFactorContext(ctx, r.db, userID, code)
+}
+
+func (r twoFactorRepository) Verify(ctx context.Context, userID uint, code string) error {
+	return models.VerifyTwoFactorContext(ctx, r.db, userID, code)
+}
+
+func (r twoFactorRepository) RegenerateRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	return models.RegenerateRecoveryCodesContext(ctx, r.db, userID)
+}
+
+func (r twoFactorRepository) Disable(ctx context.Context, userID uint) error {
+	return models.DisableTwoFactorContext(ctx, r.db, userID)
+}
+
+func (r twoFactorRepository) IsRequired(ctx context.Context, userID uint) (bool, error) {
+	return models.IsTwoFactorRequiredContext(ctx, r.db, userID)
+}
+
+type apiTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r apiTokenRepository) Create(ctx context.Context, token *models.APIToken) (string, error) {
+	return models.CreateAPITokenContext(ctx, r.db, token)
+}
+
+func (r apiTokenRepository) Authenticate(ctx context.Context, secret string) (*models.APIToken, error) {
+	return models.AuthenticateAPITokenContext(ctx, r.db, secret)
+}
+
+func (r apiTokenRepository) List(ctx context.Context, userID uint) ([]models.APIToken, error) {
+	return models.ListAPITokensContext(ctx, r.db, userID)
+}
+
+func (r apiTokenRepository) Revoke(ctx context.Context, userID, id uint) error {
+	return models.RevokeAPITokenContext(ctx, r.db, userID, id)
+}
+
+func (r apiTokenRepository) DeleteExpired(ctx context.Context) error {
+	return models.DeleteExpiredAPITokensContext(ctx, r.db)
+}
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func (r identityRepository) GetUser(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return models.GetIdentityUserContext(ctx, r.db, issuer, subject)
+}
+
+func (r identityRepository) Link(ctx context.Context, identity *models.Identity) error {
+	return models.LinkIdentityContext(ctx, r.db, identity)
+}
+
+type loginAttemptRepository struct {
+	db *gorm.DB
+}
+
+func (r loginAttemptRepository) LockedUntil(ctx context.Context, userID uint, ip string) (time.Time, error) {
+	return models.LoginLockedUntilContext(ctx, r.db, userID, ip)
+}
+
+func (r loginAttemptRepository) RecordFailure(ctx context.Context, failure *models.FailedLogin) (time.Time, error) {
+	return models.RecordFailedLoginContext(ctx, r.db, failure)
+}
+
+func (r loginAttemptRepository) Unlock(ctx context.Context, userID uint) error {
+	return models.UnlockUserContext(ctx, r.db, userID)
+}
+
+func (r loginAttemptRepository) ThrottlePasswordReset(ctx context.Context, email, ip string) (time.Time, error) {
+	return models.ThrottlePasswordResetContext(ctx, r.db, email, ip)
+}
+
+func (r loginAttemptRepository) ListFailures(ctx context.Context, userID uint, ip string, offset, limit int) ([]models.FailedLogin, error) {
+	return models.ListFailedLoginsContext(ctx, r.db, userID, ip, offset, limit)
+}
+
+type reactionRepository struct {
+	db *gorm.DB
+}
+
+func (r reactionRepository) Add(ctx context.Context, reaction *models.Reaction) error {
+	return models.AddReactionContext(ctx, r.db, reaction)
+}
+
+func (r reactionRepository) Remove(ctx context.Context, postID, userID uint, reactionType string) error {
+	return models.RemoveReactionContext(ctx, r.db, postID, userID, reactionType)
+}
+
+func (r reactionRepository) List(ctx context.Context, postID uint, reactionType string, offset, limit int) ([]models.Reaction, error) {
+	return models.ListReactionsContext(ctx, r.db, postID, reactionType, offset, limit)
+}
+
+func (r reactionRepository) CountForPosts(ctx context.Context, postIDs []uint) (map[uint]map[string]int64, error) {
+	return models.CountPostReactionsContext(ctx, r.db, postIDs)
+}
+
+func (r reactionRepository) CountForUser(ctx context.Context, userID uint) (map[string]int64, error) {
+	return models.CountUserReactionsContext(ctx, r.db, userID)
+}
+
+type conversationRepository struct {
+	db *gorm.DB
+}
+
+func (r conversationRepository) Create(ctx context.Context, conversation *models.Conversation) error {
+	return models.CreateConversationContext(ctx, r.db, conversation)
+}
+
+func (r conversationRepository) Get(ctx context.Context, id uint) (*models.Conversation, error) {
+	return models.GetConversationContext(ctx, r.db, id)
+}
+
+func (r conversationRepository) List(ctx context.Context, userID uint, offset, limit int) ([]models.ConversationParticipant, error) {
+	return models.ListConversationsContext(ctx, r.db, userID, offset, limit)
+}
+
+func (r conversationRepository) AddParticipant(ctx context.Context, conversationID, byUserID, userID uint) error {
+	return models.AddConversationParticipantContext(ctx, r.db, conversationID, byUserID, userID)
+}
+
+func (r conversationRepository) MarkRead(ctx context.Context, conversationID, userID uint) error {
+	return models.MarkConversationReadContext(ctx, r.db, conversationID, userID)
+}
+
+func (r conversationRepository) Mute(ctx context.Context, conversationID, userID uint) error {
+	return models.MuteConversationContext(ctx, r.db, conversationID, userID)
+}
+
+func (r conversationRepository) Unmute(ctx context.Context, conversationID, userID uint) error {
+	return models.UnmuteConversationContext(ctx, r.db, conversationID, userID)
+}
+
+func (r conversationRepository) Clear(ctx context.Context, conversationID, userID uint) error {
+	return models.ClearConversationContext(ctx, r.db, conversationID, userID)
+}
+
+func (r conversationRepository) Leave(ctx context.Context, conversationID, userID uint) error {
+	return models.LeaveConversationContext(ctx, r.db, conversationID, userID)
+}
+
+func (r conversationRepository) Send(ctx context.Context, message *models.Message) error {
+	return models.SendMessageContext(ctx, r.db, message)
+}
+
+func (r conversationRepository) ListMessages(ctx context.Context, conversationID, userID uint, offset, limit int) ([]models.Message, error) {
+	return models.ListMessagesContext(ctx, r.db, conversationID, userID, offset, limit)
+}
+
+func (r conversationRepository) CountUnread(ctx context.Context, userID uint, conversationIDs []uint) (map[uint]int64, error) {
+	return models.CountUnreadMessagesContext(ctx, r.db, userID, conversationIDs)
+}
+
+func (r conversationRepository) CountAllUnread(ctx context.Context, userID uint) (int64, error) {
+	return models.CountAllUnreadMessagesContext(ctx, r.db, userID)
+}
+
+type blockRepository struct {
+	db *gorm.DB
+}
+
+func (r blockRepository) Block(ctx context.Context, userID, blockedUserID uint) error {
+	return models.BlockUserContext(ctx, r.db, userID, blockedUserID)
+}
+
+func (r blockRepository) Unblock(ctx context.Context, userID, blockedUserID uint) error {
+	return models.UnblockUserContext(ctx, r.db, userID, blockedUserID)
+}
+
+func (r blockRepository) List(ctx context.Context, userID uint) ([]models.UserBlock, error) {
+	return models.ListBlockedUsersContext(ctx, r.db, userID)
+}
+
+type searchRepository struct {
+	db      *gorm.DB
+	backend search.Backend
+}
+
+func (r searchRepository) Find(ctx context.Context, query search.Query) ([]search.Result, error) {
+	return search.FindContext(ctx, r.db, r.backend, query)
+}
+
+type readStateRepository struct {
+	db *gorm.DB
+}
+
+func (r readStateRepository) MarkDiscussionRead(ctx context.Context, userID, discussionID, postID uint) error {
+	return models.MarkDiscussionReadContext(ctx, r.db, userID, discussionID, postID)
+}
+
+func (r readStateRepository) MarkTopicRead(ctx context.Context, userID, topicID uint) error {
+	return models.MarkTopicReadContext(ctx, r.db, userID, topicID)
+}
+
+func (r readStateRepository) MarkAllRead(ctx context.Context, userID uint) error {
+	return models.MarkAllReadContext(ctx, r.db, userID)
+}
+
+func (r readStateRepository) CountByTopic(ctx context.Context, userID uint, topicIDs []uint) (map[uint]int64, error) {
+	return models.CountUnreadPostsByTopicContext(ctx, r.db, userID, topicIDs)
+}
+
+func (r readStateRepository) CountByDiscussion(ctx context.Context, userID uint, discussionIDs []uint) (map[uint]int64, error) {
+	return models.CountUnreadPostsByDiscussionContext(ctx, r.db, userID, discussionIDs)
+}
+
+func (r readStateRepository) FirstUnread(ctx context.Context, userID, discussionID uint) (*models.Post, int64, error) {
+	return models.FirstUnreadPostContext(ctx, r.db, userID, discussionID)
+}
+
+type subscriptionRepository struct {
+	db *gorm.DB
+}
+
+func (r subscriptionRepository) SubscribeDiscussion(ctx context.Context, userID, discussionID uint) error {
+	return models.SubscribeDiscussionContext(ctx, r.db, userID, discussionID)
+}
+
+func (r subscriptionRepository) UnsubscribeDiscussion(ctx context.Context, userID, discussionID uint) error {
+	return models.UnsubscribeDiscussionContext(ctx, r.db, userID, discussionID)
+}
+
+func (r subscriptionRepository) SubscribeTopic(ctx context.Context, userID, topicID uint) error {
+	return models.SubscribeTopicContext(ctx, r.db, userID, topicID)
+}
+
+func (r subscriptionRepository) UnsubscribeTopic(ctx context.Context, userID, topicID uint) error {
+	return models.UnsubscribeTopicContext(ctx, r.db, userID, topicID)
+}
+
+func (r subscriptionRepository) List(ctx context.Context, userID uint) ([]models.DiscussionSubscription, []models.TopicSubscription, error) {
+	return models.ListSubscriptionsContext(ctx, r.db, userID)
+}
+
+func (r subscriptionRepository) ListSubscribers(ctx context.Context, discussionID, topicID uint) ([]uint, error) {
+	return models.ListSubscribersContext(ctx, r.db, discussionID, topicID)
+}
+
+type notificationRepository struct {
+	db *gorm.DB
+}
+
+func (r notificationRepository) Notify(ctx context.Context, notifications []models.Notification) ([]models.Notification, error) {
+	return models.NotifyContext(ctx, r.db, notifications)
+}
+
+func (r notificationRepository) List(ctx context.Context, userID uint, unreadOnly bool, offset, limit int) ([]models.Notification, error) {
+	return models.ListNotificationsContext(ctx, r.db, userID, unreadOnly, offset, limit)
+}
+
+func (r notificationRepository) CountUnread(ctx context.Context, userID uint) (int64, error) {
+	return models.CountUnreadNotificationsContext(ctx, r.db, userID)
+}
+
+func (r notificationRepository) SetRead(ctx context.Context, id, userID uint, read bool) error {
+	return models.SetNotificationReadContext(ctx, r.db, id, userID, read)
+}
+
+func (r notificationRepository) MarkAllRead(ctx context.Context, userID uint) error {
+	return models.MarkAllNotificationsReadContext(ctx, r.db, userID)
+}
+
+func (r notificationRepository) ListPreferences(ctx context.Context, userID uint) ([]models.NotificationPreference, error) {
+	return models.ListNotificationPreferencesContext(ctx, r.db, userID)
+}
+
+func (r notificationRepository) SetPreference(ctx context.Context, preference *models.NotificationPreference) error {
+	return models.SetNotificationPreferenceContext(ctx, r.db, preference)
+}
+
+func (r notificationRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	return models.ListDueNotificationsContext(ctx, r.db, now, limit)
+}
+
+func (r notificationRepository) ClearEmails(ctx context.Context, ids []uint) error {
+	return models.ClearNotificationEmailsContext(ctx, r.db, ids)
+}
+
+func (r notificationRepository) DisableEmails(ctx context.Context, userID uint, notificationType string) error {
+	return models.DisableNotificationEmailsContext(ctx, r.db, userID, notificationType)
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func (r outboxRepository) Queue(ctx context.Context, email *models.OutboundEmail, notificationIDs []uint) error {
+	return models.QueueOutboundEmailContext(ctx, r.db, email, notificationIDs)
+}
+
+func (r outboxRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]models.OutboundEmail, error) {
+	return models.ListDueOutboundEmailsContext(ctx, r.db, now, limit)
+}
+
+func (r outboxRepository) MarkSent(ctx context.Context, id uint) error {
+	return models.MarkOutboundEmailSentContext(ctx, r.db, id)
+}
+
+func (r outboxRepository) RecordFailure(ctx context.Context, id uint, reason string, retryAt *time.Time) error {
+	return models.RecordOutboundEmailFailureContext(ctx, r.db, id, reason, retryAt)
+}
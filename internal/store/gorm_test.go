@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"regexp"
+)
+
+var _ = Describe("Gorm", func() {
+	var mock sqlmock.Sqlmock
+	var db *sql.DB
+	var s Store
+
+	BeforeEach(func() {
+		sqlDb, sqlMock, err := sqlmock.New()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mock = sqlMock
+		db = sqlDb
+
+		gormDB, err := gorm.Open(sqlite.Dialector{
+			DriverName: "sqlite",
+			Conn:       db,
+		}, &gorm.Config{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		s = New(gormDB)
+	})
+	AfterEach(func() {
+		err := mock.ExpectationsWereMet()
+		Expect(err).ShouldNot(HaveOccurred())
+		db.Close()
+	})
+
+	It("should query the database it was given", func() {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `topics` WHERE `topics`.`id` = ? AND `topics`.`deleted_at` IS NULL LIMIT 1")).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(3, "General"))
+
+		topic, err := s.Topics().Get(context.Background(), 3)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(topic.Title).Should(Equal("General"))
+	})
+
+	It("should run with the context it is given", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.Users().List(ctx, 0, 10)
+		Expect(err).Should(MatchError(context.Canceled))
+	})
+
+	It("should validate before reaching the database", func() {
+		_, err := s.Posts().List(context.Background(), 0, 0, 10)
+		Expect(err).Should(MatchError(models.ErrEmptyDiscussionID))
+	})
+})
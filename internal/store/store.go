@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/search"
+	"time"
+)
+
+// Store gives access to every repository. Handlers depend on a Store rather
+// than on a database connection; their specs run New on SQLite through
+// store/storetest.
+type Store interface {
+	Users() UserRepository
+	Emails() EmailRepository
+	Groups() GroupRepository
+	Sessions() SessionRepository
+	Topics() TopicRepository
+	Discussions() DiscussionRepository
+	Posts() PostRepository
+	Permissions() PermissionRepository
+	TwoFactor() TwoFactorRepository
+	APITokens() APITokenRepository
+	Identities() IdentityRepository
+	LoginAttempts() LoginAttemptRepository
+	Reactions() ReactionRepository
+	Conversations() ConversationRepository
+	Blocks() BlockRepository
+	Search() SearchRepository
+	ReadStates() ReadStateRepository
+	Subscriptions() SubscriptionRepository
+	Notifications() NotificationRepository
+	Outbox() OutboxRepository
+}
+
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id uint) (*models.User, error)
+	GetByUserName(ctx context.Context, userName string) (*models.User, error)
+	List(ctx context.Context, offset, limit int) ([]models.User, error)
+	ListWithGroups(ctx context.Context, ids []uint) ([]models.User, error)
+	Update(ctx context.Context, user *models.User) error
+	UpdatePassword(ctx context.Context, id uint, password string) error
+	VerifyPassword(ctx context.Context, user *models.User, password string) (bool, error)
+	Delete(ctx context.Context, id uint) error
+	Restore(ctx context.Context, id uint) error
+	Purge(ctx context.Context, id uint) error
+	CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) (string, error)
+	ResetPassword(ctx context.Context, token, password string) error
+	DeleteExpiredPasswordResets(ctx context.Context) error
+}
+
+type EmailRepository interface {
+	Create(ctx context.Context, email *models.Email) error
+	Get(ctx context.Context, address string) (*models.Email, error)
+	List(ctx context.Context, userID uint) ([]models.Email, error)
+	Update(ctx context.Context, email *models.Email) error
+	Delete(ctx context.Context, address string) error
+	Restore(ctx context.Context, address string) error
+	Purge(ctx context.Context, address string) error
+	CreateVerification(ctx context.Context, verification *models.EmailVerification) (string, error)
+	Verify(ctx context.Context, token string) (*models.Email, error)
+	SetPrimary(ctx context.Context, address string) error
+	GetPrimary(ctx context.Context, userID uint) (*models.Email, error)
+	DeleteExpiredVerifications(ctx context.Context) error
+}
+
+type GroupRepository interface {
+	Create(ctx context.Context, group *models.Group) error
+	Get(ctx context.Context, id uint) (*models.Group, error)
+	List(ctx context.Context, offset, limit int) ([]models.Group, error)
+	Update(ctx context.Context, group *models.Group) error
+	Delete(ctx context.Context, id uint) error
+	Restore(ctx context.Context, id uint) error
+	Purge(ctx context.Context, id uint) error
+	IsMember(ctx context.Context, userID uint, name string) (bool, error)
+	SetRequireTwoFactor(ctx context.Context, id uint, required bool) error
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) (string, error)
+	Get(ctx context.Context, token string) (*models.Session, error)
+	Delete(ctx context.Context, token string) error
+	DeleteForUser(ctx context.Context, userID uint) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type TopicRepository interface {
+	Create(ctx context.Context, topic *models.Topic) error
+	Get(ctx context.Context, id uint) (*models.Topic, error)
+	List(ctx context.Context) ([]models.Topic, error)
+	Tree(ctx context.Context) ([]models.Topic, error)
+	Ancestors(ctx context.Context, id uint) ([]models.Topic, error)
+	Descendants(ctx context.Context, id uint) ([]models.Topic, error)
+	Update(ctx context.Context, topic *models.Topic) error
+	Move(ctx context.Context, id uint, parentID *uint, position int) error
+	Delete(ctx context.Context, id uint) error
+	Restore(ctx context.Context, id uint) error
+	Purge(ctx context.Context, id uint) error
+}
+
+type DiscussionRepository interface {
+	Create(ctx context.Context, discussion *models.Discussion) error
+	Get(ctx context.Context, id uint) (*models.Discussion, error)
+	TopicID(ctx context.Context, id uint) (uint, error)
+	List(ctx context.Context, topicID uint, offset, limit int) ([]models.Discussion, error)
+	Update(ctx context.Context, discussion *models.Discussion) error
+	Delete(ctx context.Context, id uint) error
+	Restore(ctx context.Context, id uint) error
+	Purge(ctx context.Context, id uint) error
+}
+
+type PostRepository interface {
+	Create(ctx context.Context, post *models.Post) error
+	Get(ctx context.Context, id uint) (*models.Post, error)
+	TopicID(ctx context.Context, id uint) (uint, error)
+	List(ctx context.Context, discussionID uint, offset, limit int) ([]models.Post, error)
+	Update(ctx context.Context, post *models.Post, editorID uint, reason string) error
+	Delete(ctx context.Context, id uint) error
+	Restore(ctx context.Context, id uint) error
+	Purge(ctx context.Context, id uint) error
+	GetRevision(ctx context.Context, id uint) (*models.PostRevision, error)
+	ListRevisions(ctx context.Context, postID uint, offset, limit int) ([]models.PostRevision, error)
+	HideRevision(ctx context.Context, id uint) error
+	UnhideRevision(ctx context.Context, id uint) error
+	ListMentions(ctx context.Context, userID uint, topicIDs []uint, offset, limit int) ([]models.Post, error)
+	DeleteMentions(ctx context.Context, postID uint, userIDs []uint) error
+}
+
+type PermissionRepository interface {
+	Set(ctx context.Context, permission *models.Permission) error
+	Get(ctx context.Context, id uint) (*models.Permission, error)
+	List(ctx context.Context) ([]models.Permission, error)
+	ListForUser(ctx context.Context, userID uint) ([]models.Permission, error)
+	Delete(ctx context.Context, id uint) error
+}
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userID uint) (*models.TwoFactor, error)
+	Enrol(ctx context.Context, userID uint) (*models.TwoFactor, error)
+	Confirm(ctx context.Context, userID uint, code string) ([]string, error)
+	Verify(ctx context.Context, userID uint, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uint) ([]string, error)
+	Disable(ctx context.Context, userID uint) error
+	IsRequired(ctx context.Context, userID uint) (bool, error)
+}
+
+type APITokenRepository interface {
+	Create(ctx context.Context, token *models.APIToken) (string, error)
+	Authenticate(ctx context.Context, secret string) (*models.APIToken, error)
+	List(ctx context.Context, userID uint) ([]models.APIToken, error)
+	Revoke(ctx context.Context, userID, id uint) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type IdentityRepository interface {
+	GetUser(ctx context.Context, issuer, subject string) (*models.User, error)
+	Link(ctx context.Context, identity *models.Identity) error
+}
+
+type LoginAttemptRepository interface {
+	LockedUntil(ctx context.Context, userID uint, ip string) (time.Time, error)
+	RecordFailure(ctx context.Context, failure *models.FailedLogin) (time.Time, error)
+	Unlock(ctx context.Context, userID uint) error
+	ThrottlePasswordReset(ctx context.Context, email, ip string) (time.Time, error)
+	ListFailures(ctx context.Context, userID uint, ip string, offset, limit int) ([]models.FailedLogin, error)
+}
+
+type ReactionRepository interface {
+	Add(ctx context.Context, reaction *models.Reaction) error
+	Remove(ctx context.Context, postID, userID uint, reactionType string) error
+	List(ctx context.Context, postID uint, reactionType string, offset, limit int) ([]models.Reaction, error)
+	CountForPosts(ctx context.Context, postIDs []uint) (map[uint]map[string]int64, error)
+	CountForUser(ctx context.Context, userID uint) (map[string]int64, error)
+}
+
+type ConversationRepository interface {
+	Create(ctx context.Context, conversation *models.Conversation) error
+	Get(ctx context.Context, id uint) (*models.Conversation, error)
+	List(ctx context.Context, userID uint, offset, limit int) ([]models.ConversationParticipant, error)
+	AddParticipant(ctx context.Context, conversationID, byUserID, userID uint) error
+	MarkRead(ctx context.Context, conversationID, userID uint) error
+	Mute(ctx context.Context, conversationID, userID uint) error
+	Unmute(ctx context.Context, conversationID, userID uint) error
+	Clear(ctx context.Context, conversationID, userID uint) error
+	Leave(ctx context.Context, conversationID, userID uint) error
+	Send(ctx context.Context, message *models.Message) error
+	ListMessages(ctx context.Context, conversationID, userID uint, offset, limit int) ([]models.Message, error)
+	CountUnread(ctx context.Context, userID uint, conversationIDs []uint) (map[uint]int64, error)
+	CountAllUnread(ctx context.Context, userID uint) (int64, error)
+}
+
+type BlockRepository interface {
+	Block(ctx context.Context, userID, blockedUserID uint) error
+	Unblock(ctx context.Context, userID, blockedUserID uint) error
+	List(ctx context.Context, userID uint) ([]models.UserBlock, error)
+}
+
+type SearchRepository interface {
+	Find(ctx context.Context, query search.Query) ([]search.Result, error)
+}
+
+type ReadStateRepository interface {
+	MarkDiscussionRead(ctx context.Context, userID, discussionID, postID uint) error
+	MarkTopicRead(ctx context.Context, userID, topicID uint) error
+	MarkAllRead(ctx context.Context, userID uint) error
+	CountByTopic(ctx context.Context, userID uint, topicIDs []uint) (map[uint]int64, error)
+	CountByDiscussion(ctx context.Context, userID uint, discussionIDs []uint) (map[uint]int64, error)
+	FirstUnread(ctx context.Context, userID, discussionID uint) (*models.Post, int64, error)
+}
+
+type SubscriptionRepository interface {
+	SubscribeDiscussion(ctx context.Context, userID, discussionID uint) error
+	UnsubscribeDiscussion(ctx context.Context, userID, discussionID uint) error
+	SubscribeTopic(ctx context.Context, userID, topicID uint) error
+	UnsubscribeTopic(ctx context.Context, userID, topicID uint) error
+	List(ctx context.Context, userID uint) ([]models.DiscussionSubscription, []models.TopicSubscription, error)
+	ListSubscribers(ctx context.Context, discussionID, topicID uint) ([]uint, error)
+}
+
+type NotificationRepository interface {
+	Notify(ctx context.Context, notifications []models.Notification) ([]models.Notification, error)
+	List(ctx context.Context, userID uint, unreadOnly bool, offset, limit int) ([]models.Notification, error)
+	CountUnread(ctx context.Context, userID uint) (int64, error)
+	SetRead(ctx context.Context, id, userID uint, read bool) error
+	MarkAllRead(ctx context.Context, userID uint) error
+	ListPreferences(ctx context.Context, userID uint) ([]models.NotificationPreference, error)
+	SetPreference(ctx context.Context, preference *models.NotificationPreference) error
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.Notification, error)
+	ClearEmails(ctx context.Context, ids []uint) error
+	DisableEmails(ctx context.Context, userID uint, notificationType string) error
+}
+
+type OutboxRepository interface {
+	Queue(ctx context.Context, email *models.OutboundEmail, notificationIDs []uint) error
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.OutboundEmail, error)
+	MarkSent(ctx context.Context, id uint) error
+	RecordFailure(ctx context.Context, id uint, reason string, retryAt *time.Time) error
+}
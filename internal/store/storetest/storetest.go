@@ -0,0 +1,80 @@
+// Package storetest runs the gorm Store on a migrated SQLite database in a
+// temporary directory, for the specs of the packages that depend on a Store.
+package storetest
+
+import (
+	"github.com/golangbb/golangbb/v2/internal/database"
+	"github.com/golangbb/golangbb/v2/internal/migrations"
+	"github.com/golangbb/golangbb/v2/internal/models"
+	"github.com/golangbb/golangbb/v2/internal/store"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Store is a store.Store with the few extras specs need to set up and inspect
+// what the repositories do not expose.
+type Store struct {
+	store.Store
+	DB   *gorm.DB
+	path string
+}
+
+// New migrates a new database and returns the Store on it. It also becomes
+// database.DBConnection until Close.
+func New() (*Store, error) {
+	path, err := ioutil.TempDir("", "golangbb")
+	if err != nil {
+		return nil, err
+	}
+
+	dialector, err := database.Dialector("sqlite://" + filepath.Join(path, "golangbb.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := database.Connect(dialector, gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.Migrate(migrations.All()); err != nil {
+		return nil, err
+	}
+
+	return &Store{Store: store.New(db), DB: db, path: path}, nil
+}
+
+// Close closes the database and removes it.
+func (s *Store) Close() error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	if err := sqlDB.Close(); err != nil {
+		return err
+	}
+
+	database.DBConnection = nil
+	return os.RemoveAll(s.path)
+}
+
+// AddGroupMember makes the User a member of the Group.
+func (s *Store) AddGroupMember(userID, groupID uint) {
+	if err := s.DB.Exec("INSERT INTO users_groups (user_id, group_id) VALUES (?, ?)", userID, groupID).Error; err != nil {
+		panic(err)
+	}
+}
+
+// OutboundEmails returns every queued email, oldest first.
+func (s *Store) OutboundEmails() []models.OutboundEmail {
+	var emails []models.OutboundEmail
+	if err := s.DB.Order("id").Find(&emails).Error; err != nil {
+		panic(err)
+	}
+
+	return emails
+}
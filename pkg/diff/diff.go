@@ -0,0 +1,137 @@
+package diff
+
+import "strings"
+
+const (
+	Unchanged = " "
+	Added     = "+"
+	Removed   = "-"
+)
+
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the shortest edit turning the lines of a into the lines of b,
+// found through their longest common subsequence. Only rows of the lengths of
+// common subsequences are kept, as in Hirschberg's algorithm, so the memory
+// used grows with the number of lines rather than its square.
+func Lines(a, b string) []Line {
+	return edit([]Line{}, split(a), split(b))
+}
+
+// edit appends the shortest edit turning from into to to lines. Common lines
+// at either end are kept as they are, and the rest is split where a longest
+// common subsequence crosses the middle line of from.
+func edit(lines []Line, from, to []string) []Line {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		lines = append(lines, Line{Op: Unchanged, Text: from[prefix]})
+		prefix++
+	}
+	from, to = from[prefix:], to[prefix:]
+
+	suffix := 0
+	for suffix < len(from) && suffix < len(to) && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+	common := from[len(from)-suffix:]
+	from, to = from[:len(from)-suffix], to[:len(to)-suffix]
+
+	switch {
+	case len(from) == 0:
+		lines = appendLines(lines, Added, to)
+	case len(to) == 0:
+		lines = appendLines(lines, Removed, from)
+	case len(from) == 1:
+		// Once the ends are trimmed a single line matches none of to, or one
+		// in its middle.
+		j := 0
+		for j < len(to) && to[j] != from[0] {
+			j++
+		}
+
+		if j == len(to) {
+			lines = appendLines(lines, Removed, from)
+			lines = appendLines(lines, Added, to)
+		} else {
+			lines = appendLines(lines, Added, to[:j])
+			lines = append(lines, Line{Op: Unchanged, Text: from[0]})
+			lines = appendLines(lines, Added, to[j+1:])
+		}
+	default:
+		middle := len(from) / 2
+		before, after := prefixLengths(from[:middle], to), suffixLengths(from[middle:], to)
+
+		split := 0
+		for j := range before {
+			if before[j]+after[j] > before[split]+after[split] {
+				split = j
+			}
+		}
+
+		lines = edit(lines, from[:middle], to[:split])
+		lines = edit(lines, from[middle:], to[split:])
+	}
+
+	return appendLines(lines, Unchanged, common)
+}
+
+// prefixLengths returns, for every j, the length of the longest common
+// subsequence of from and to[:j].
+func prefixLengths(from, to []string) []int {
+	row, next := make([]int, len(to)+1), make([]int, len(to)+1)
+	for i := range from {
+		for j := range to {
+			switch {
+			case from[i] == to[j]:
+				next[j+1] = row[j] + 1
+			case row[j+1] >= next[j]:
+				next[j+1] = row[j+1]
+			default:
+				next[j+1] = next[j]
+			}
+		}
+		row, next = next, row
+	}
+
+	return row
+}
+
+// suffixLengths returns, for every j, the length of the longest common
+// subsequence of from and to[j:].
+func suffixLengths(from, to []string) []int {
+	row, next := make([]int, len(to)+1), make([]int, len(to)+1)
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			switch {
+			case from[i] == to[j]:
+				next[j] = row[j+1] + 1
+			case row[j] >= next[j+1]:
+				next[j] = row[j]
+			default:
+				next[j] = next[j+1]
+			}
+		}
+		row, next = next, row
+	}
+
+	return row
+}
+
+func appendLines(lines []Line, op string, texts []string) []Line {
+	for _, text := range texts {
+		lines = append(lines, Line{Op: op, Text: text})
+	}
+
+	return lines
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n"), "\n")
+}
@@ -0,0 +1,57 @@
+package diff
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"runtime"
+	"strings"
+)
+
+var _ = Describe("Lines", func() {
+	It("should keep the common lines and mark the changed ones", func() {
+		Expect(Lines("Winter\nis\ncoming\n", "Winter\nwas\ncoming\nat last")).Should(Equal([]Line{
+			{Op: Unchanged, Text: "Winter"},
+			{Op: Removed, Text: "is"},
+			{Op: Added, Text: "was"},
+			{Op: Unchanged, Text: "coming"},
+			{Op: Added, Text: "at last"},
+		}))
+	})
+
+	It("should treat Windows line endings like any other", func() {
+		Expect(Lines("a\r\nb", "a\nb")).Should(Equal([]Line{{Op: Unchanged, Text: "a"}, {Op: Unchanged, Text: "b"}}))
+	})
+
+	It("should handle empty texts", func() {
+		Expect(Lines("", "")).Should(BeEmpty())
+		Expect(Lines("", "a")).Should(Equal([]Line{{Op: Added, Text: "a"}}))
+		Expect(Lines("a\nb", "")).Should(Equal([]Line{{Op: Removed, Text: "a"}, {Op: Removed, Text: "b"}}))
+	})
+
+	It("should compare long texts in memory that grows with their number of lines", func() {
+		var a, b []string
+		for i := 0; i < 5000; i++ {
+			a = append(a, fmt.Sprintf("line %d", i))
+			if i%3 == 0 {
+				b = append(b, fmt.Sprintf("edited line %d", i))
+			} else {
+				b = append(b, fmt.Sprintf("line %d", i))
+			}
+		}
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		lines := Lines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+		runtime.ReadMemStats(&after)
+
+		Expect(after.TotalAlloc - before.TotalAlloc).Should(BeNumerically("<", 16<<20))
+		Expect(lines).Should(HaveLen(5000 + 1667))
+		Expect(lines[:4]).Should(Equal([]Line{
+			{Op: Removed, Text: "line 0"},
+			{Op: Added, Text: "edited line 0"},
+			{Op: Unchanged, Text: "line 1"},
+			{Op: Unchanged, Text: "line 2"},
+		}))
+	})
+})
@@ -0,0 +1,175 @@
+// Package fulltext parses search queries and highlights their matches in plain
+// text, for search backends that cannot do either themselves.
+package fulltext
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	markOpen  = "<mark>"
+	markClose = "</mark>"
+	ellipsis  = "…"
+)
+
+// Terms splits a query into the words and "quoted phrases" that must all
+// match. A quote left open runs to the end of the query.
+func Terms(query string) []string {
+	var terms []string
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.Join(strings.Fields(part), " "); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+
+		terms = append(terms, strings.Fields(part)...)
+	}
+
+	return terms
+}
+
+// Matches reports whether text contains every term, ignoring case.
+func Matches(text string, terms []string) bool {
+	lowered := lower(text)
+	for _, term := range terms {
+		if index(lowered, lower(term), 0) < 0 {
+			return false
+		}
+	}
+
+	return len(terms) > 0
+}
+
+// Count returns how often the terms occur in text, ignoring case.
+func Count(text string, terms []string) int {
+	return len(find(lower(text), terms))
+}
+
+// Snippet returns an HTML excerpt of at most width characters of text, taken
+// around the first match, with every match in it wrapped in <mark>.
+func Snippet(text string, terms []string, width int) string {
+	runes := []rune(text)
+	matches := find(lower(text), terms)
+
+	start, end := 0, len(runes)
+	if end > width {
+		if len(matches) > 0 {
+			start = matches[0][0] - width/3
+		}
+
+		if start > len(runes)-width {
+			start = len(runes) - width
+		}
+
+		if start < 0 {
+			start = 0
+		}
+
+		end = start + width
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(ellipsis)
+	}
+
+	at := start
+	for _, match := range matches {
+		from, to := match[0], match[1]
+		if to <= at || from >= end {
+			continue
+		}
+
+		if from < at {
+			from = at
+		}
+
+		if to > end {
+			to = end
+		}
+
+		b.WriteString(html.EscapeString(string(runes[at:from])))
+		b.WriteString(markOpen + html.EscapeString(string(runes[from:to])) + markClose)
+		at = to
+	}
+
+	b.WriteString(html.EscapeString(string(runes[at:end])))
+	if end < len(runes) {
+		b.WriteString(ellipsis)
+	}
+
+	return b.String()
+}
+
+// Mark escapes text for HTML and turns the markers a search engine placed
+// around its matches into <mark> elements.
+func Mark(text, open, close string) string {
+	text = html.EscapeString(text)
+	return strings.NewReplacer(open, markOpen, close, markClose).Replace(text)
+}
+
+// find returns the rune ranges of every occurrence of the terms in the
+// lowered text, in order and without overlaps.
+func find(text []rune, terms []string) [][2]int {
+	var matches [][2]int
+	for _, term := range terms {
+		needle := lower(term)
+		if len(needle) == 0 {
+			continue
+		}
+
+		for at := index(text, needle, 0); at >= 0; at = index(text, needle, at+len(needle)) {
+			matches = append(matches, [2]int{at, at + len(needle)})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i][0] < matches[j][0] })
+
+	merged := [][2]int{}
+	for _, match := range matches {
+		if last := len(merged) - 1; last >= 0 && match[0] < merged[last][1] {
+			if match[1] > merged[last][1] {
+				merged[last][1] = match[1]
+			}
+			continue
+		}
+
+		merged = append(merged, match)
+	}
+
+	return merged
+}
+
+// lower lowers text rune by rune, so that offsets into it are offsets into
+// the original text as well.
+func lower(text string) []rune {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+
+	return runes
+}
+
+func index(text, needle []rune, from int) int {
+	for i := from; i+len(needle) <= len(text); i++ {
+		found := true
+		for j := range needle {
+			if text[i+j] != needle[j] {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,61 @@
+package fulltext
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fulltext", func() {
+	Context("Terms", func() {
+		It("should split words and keep quoted phrases together", func() {
+			Expect(Terms(`winter "is   coming" north`)).Should(Equal([]string{"winter", "is coming", "north"}))
+		})
+
+		It("should run an open quote to the end of the query", func() {
+			Expect(Terms(`stark "king in the`)).Should(Equal([]string{"stark", "king in the"}))
+		})
+
+		It("should drop empty phrases", func() {
+			Expect(Terms(`"" "  " `)).Should(BeEmpty())
+		})
+	})
+
+	Context("Matches", func() {
+		It("should require every term, ignoring case", func() {
+			Expect(Matches("Winter is Coming", []string{"winter", "is coming"})).Should(BeTrue())
+			Expect(Matches("Winter is Coming", []string{"winter", "summer"})).Should(BeFalse())
+			Expect(Matches("Winter is Coming", nil)).Should(BeFalse())
+		})
+	})
+
+	Context("Count", func() {
+		It("should count every occurrence", func() {
+			Expect(Count("Stark, stark and STARK", []string{"stark"})).Should(Equal(3))
+		})
+	})
+
+	Context("Snippet", func() {
+		It("should mark the matches and escape the rest", func() {
+			Expect(Snippet("<b>Winter</b> is coming", []string{"winter"}, 64)).Should(Equal("&lt;b&gt;<mark>Winter</mark>&lt;/b&gt; is coming"))
+		})
+
+		It("should cut long texts around the first match", func() {
+			text := "The north remembers. " + "Nothing happens here. " + "Winter is coming for us all."
+			Expect(Snippet(text, []string{"winter"}, 24)).Should(Equal("…s here. <mark>Winter</mark> is coming…"))
+		})
+
+		It("should merge overlapping matches", func() {
+			Expect(Snippet("Winterfell", []string{"winter", "terfell"}, 64)).Should(Equal("<mark>Winterfell</mark>"))
+		})
+
+		It("should start at the beginning without a match", func() {
+			Expect(Snippet("Winter is coming", []string{"summer"}, 6)).Should(Equal("Winter…"))
+		})
+	})
+
+	Context("Mark", func() {
+		It("should turn the markers into mark elements after escaping", func() {
+			Expect(Mark("<i>\x02Winter\x03</i>", "\x02", "\x03")).Should(Equal("&lt;i&gt;<mark>Winter</mark>&lt;/i&gt;"))
+		})
+	})
+})
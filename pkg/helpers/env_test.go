@@ -4,6 +4,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"os"
+	"time"
 )
 
 var _ = Describe("GetEnv", func() {
@@ -28,3 +29,104 @@ var _ = Describe("GetEnv", func() {
 		})
 	})
 })
+
+var _ = Describe("GetEnvBool", func() {
+	var envVarKey = "envVarKey"
+
+	BeforeEach(func() {
+		os.Unsetenv(envVarKey)
+	})
+	When("Environment Variable is set to a boolean", func() {
+		It("should parse the Environment Variable value from the OS", func() {
+			os.Setenv(envVarKey, "false")
+			Expect(GetEnvBool(envVarKey, true)).Should(BeFalse())
+		})
+	})
+	When("Environment Variable is set to something that is not a boolean", func() {
+		It("should use the fallback value", func() {
+			os.Setenv(envVarKey, "maybe")
+			Expect(GetEnvBool(envVarKey, true)).Should(BeTrue())
+		})
+	})
+	When("Environment Variable is not set", func() {
+		It("should use the fallback value", func() {
+			Expect(GetEnvBool(envVarKey, true)).Should(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("GetEnvDuration", func() {
+	var envVarKey = "envVarKey"
+
+	BeforeEach(func() {
+		os.Unsetenv(envVarKey)
+	})
+	When("Environment Variable is set to a duration", func() {
+		It("should parse the Environment Variable value from the OS", func() {
+			os.Setenv(envVarKey, "90m")
+			Expect(GetEnvDuration(envVarKey, time.Hour)).Should(Equal(90 * time.Minute))
+		})
+	})
+	When("Environment Variable is set to something that is not a duration", func() {
+		It("should use the fallback value", func() {
+			os.Setenv(envVarKey, "soon")
+			Expect(GetEnvDuration(envVarKey, time.Hour)).Should(Equal(time.Hour))
+		})
+	})
+	When("Environment Variable is not set", func() {
+		It("should use the fallback value", func() {
+			Expect(GetEnvDuration(envVarKey, time.Hour)).Should(Equal(time.Hour))
+		})
+	})
+})
+
+var _ = Describe("GetEnvInt", func() {
+	var envVarKey = "envVarKey"
+
+	BeforeEach(func() {
+		os.Unsetenv(envVarKey)
+	})
+	When("Environment Variable is set to an integer", func() {
+		It("should parse the Environment Variable value from the OS", func() {
+			os.Setenv(envVarKey, "12")
+			Expect(GetEnvInt(envVarKey, 5)).Should(Equal(12))
+		})
+	})
+	When("Environment Variable is set to something that is not an integer", func() {
+		It("should use the fallback value", func() {
+			os.Setenv(envVarKey, "a dozen")
+			Expect(GetEnvInt(envVarKey, 5)).Should(Equal(5))
+		})
+	})
+	When("Environment Variable is not set", func() {
+		It("should use the fallback value", func() {
+			Expect(GetEnvInt(envVarKey, 5)).Should(Equal(5))
+		})
+	})
+})
+
+var _ = Describe("GetEnvSlice", func() {
+	var envVarKey = "envVarKey"
+	var fallback = []string{"like"}
+
+	BeforeEach(func() {
+		os.Unsetenv(envVarKey)
+	})
+	When("Environment Variable is set to a comma separated list", func() {
+		It("should split it and trim the entries", func() {
+			os.Setenv(envVarKey, "like, love,,laugh ")
+			Expect(GetEnvSlice(envVarKey, fallback)).Should(Equal([]string{"like", "love", "laugh"}))
+		})
+	})
+	When("Environment Variable is set to nothing but separators", func() {
+		It("should use the fallback value", func() {
+			os.Setenv(envVarKey, " , ")
+			Expect(GetEnvSlice(envVarKey, fallback)).Should(Equal(fallback))
+		})
+	})
+	When("Environment Variable is not set", func() {
+		It("should use the fallback value", func() {
+			Expect(GetEnvSlice(envVarKey, fallback)).Should(Equal(fallback))
+		})
+	})
+})
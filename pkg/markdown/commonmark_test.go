@@ -0,0 +1,37 @@
+package markdown
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+)
+
+// testdata/commonmark.json holds examples from the sections of the CommonMark
+// spec with the HTML a conforming renderer gives for them. Examples whose
+// syntax the GitHub Flavored Markdown extensions change are left out.
+type commonMarkExample struct {
+	Section  string `json:"section"`
+	Markdown string `json:"markdown"`
+	HTML     string `json:"html"`
+}
+
+var _ = Describe("CommonMark", func() {
+	content, err := ioutil.ReadFile("testdata/commonmark.json")
+	if err != nil {
+		panic(err)
+	}
+
+	var examples []commonMarkExample
+	if err := json.Unmarshal(content, &examples); err != nil {
+		panic(err)
+	}
+
+	for i, example := range examples {
+		example := example
+		It(fmt.Sprintf("should render example %d of %s", i+1, example.Section), func() {
+			Expect(Render(example.Markdown)).Should(Equal(example.HTML), example.Markdown)
+		})
+	}
+})
@@ -0,0 +1,554 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	attributeName  = `[A-Za-z_:][A-Za-z0-9_.:-]*`
+	attributeValue = `(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*")`
+	attribute      = `(?:\s+` + attributeName + `(?:\s*=\s*` + attributeValue + `)?)`
+	openTag        = `<[A-Za-z][A-Za-z0-9-]*` + attribute + `*\s*/?>`
+	closeTag       = `</[A-Za-z][A-Za-z0-9-]*\s*>`
+	comment        = `<!---->|<!--(?:[^-]|-[^-])*-->`
+	instruction    = `<\?(?s:.*?)\?>`
+	declaration    = `<![A-Za-z]+[^>]*>`
+	cdata          = `<!\[CDATA\[(?s:.*?)\]\]>`
+)
+
+var (
+	rawHTML       = regexp.MustCompile(`^(?:` + openTag + `|` + closeTag + `|` + comment + `|` + instruction + `|` + declaration + `|` + cdata + `)`)
+	uriAutolink   = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.-]{1,31}:[^\s<>]*)>`)
+	emailAutolink = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	entity        = regexp.MustCompile(`^&(?:#[xX][0-9a-fA-F]{1,6}|#[0-9]{1,7}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	trailingRef   = regexp.MustCompile(`&[A-Za-z0-9]+;$`)
+	tags          = regexp.MustCompile(`<[^>]*>`)
+	imageAlt      = regexp.MustCompile(`<img src="[^"]*" alt="([^"]*)"[^>]*>`)
+)
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// node is a piece of inline output. Delimiter runs of emphasis stay separate
+// until they are matched up, which adds the tags around what is left of them.
+type node struct {
+	html      string
+	delim     byte
+	count     int
+	length    int
+	canOpen   bool
+	canClose  bool
+	openTags  string
+	closeTags string
+}
+
+func (n *node) String() string {
+	if n.delim == 0 {
+		return n.html
+	}
+
+	return n.closeTags + strings.Repeat(string(n.delim), n.count) + n.openTags
+}
+
+func (p *parser) inline(s string) string {
+	var nodes []*node
+	var text strings.Builder
+
+	emit := func(html string) {
+		if text.Len() > 0 {
+			nodes = append(nodes, &node{html: text.String()})
+			text.Reset()
+		}
+
+		if html != "" {
+			nodes = append(nodes, &node{html: html})
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			emit("<br />\n")
+			i = skipSpaces(s, i+2)
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			text.WriteString(escape(s[i+1 : i+2]))
+			i += 2
+		case c == '`':
+			code, next := codeSpan(s, i)
+			if code == "" {
+				text.WriteString(s[i:next])
+			} else {
+				emit(code)
+			}
+			i = next
+		case c == '*' || c == '_' || c == '~':
+			end := i
+			for end < len(s) && s[end] == c {
+				end++
+			}
+
+			if c == '~' && end-i > 2 {
+				text.WriteString(s[i:end])
+			} else {
+				emit("")
+				nodes = append(nodes, delimiterRun(s, i, end))
+			}
+			i = end
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if link, next, ok := p.link(s, i+1, true); ok {
+				emit(link)
+				i = next
+			} else {
+				text.WriteString("!")
+				i++
+			}
+		case c == '[':
+			if link, next, ok := p.link(s, i, false); ok {
+				emit(link)
+				i = next
+			} else {
+				text.WriteString("[")
+				i++
+			}
+		case c == '<':
+			if match := uriAutolink.FindStringSubmatch(s[i:]); match != nil {
+				emit(`<a href="` + escape(normalizeURL(match[1])) + `">` + escape(match[1]) + "</a>")
+				i += len(match[0])
+			} else if match := emailAutolink.FindStringSubmatch(s[i:]); match != nil {
+				emit(`<a href="mailto:` + escape(normalizeURL(match[1])) + `">` + escape(match[1]) + "</a>")
+				i += len(match[0])
+			} else if match := rawHTML.FindString(s[i:]); match != "" {
+				emit(match)
+				i += len(match)
+			} else {
+				text.WriteString("&lt;")
+				i++
+			}
+		case c == '&':
+			if match := entity.FindString(s[i:]); match != "" && html.UnescapeString(match) != match {
+				text.WriteString(escape(html.UnescapeString(match)))
+				i += len(match)
+			} else {
+				text.WriteString("&amp;")
+				i++
+			}
+		case c == '\n':
+			trimmed := strings.TrimRight(text.String(), " ")
+			hard := text.Len()-len(trimmed) >= 2
+			text.Reset()
+			text.WriteString(trimmed)
+			if hard {
+				emit("<br />\n")
+			} else {
+				text.WriteString("\n")
+			}
+			i = skipSpaces(s, i+1)
+		case (c == 'h' || c == 'w') && atWordStart(s, i):
+			if link, next, ok := extendedAutolink(s, i); ok {
+				emit(link)
+				i = next
+			} else {
+				text.WriteByte(c)
+				i++
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == '"' || r == '>' {
+				text.WriteString(escape(string(r)))
+			} else {
+				text.WriteString(s[i : i+size])
+			}
+			i += size
+		}
+	}
+	emit("")
+
+	matchEmphasis(nodes)
+
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(n.String())
+	}
+
+	return b.String()
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+
+	return i
+}
+
+func isASCIIPunct(c byte) bool {
+	return c >= '!' && c <= '/' || c >= ':' && c <= '@' || c >= '[' && c <= '`' || c >= '{' && c <= '~'
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// codeSpan returns the code span starting at the backticks at i, or an empty
+// string when they are not closed, with the index after what was consumed.
+func codeSpan(s string, i int) (string, int) {
+	open := i
+	for open < len(s) && s[open] == '`' {
+		open++
+	}
+
+	run := open - i
+	for j := open; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+
+		end := j
+		for end < len(s) && s[end] == '`' {
+			end++
+		}
+
+		if end-j == run {
+			code := strings.ReplaceAll(s[open:j], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+
+			return "<code>" + escape(code) + "</code>", end
+		}
+
+		j = end
+	}
+
+	return "", open
+}
+
+// delimiterRun classifies the run of emphasis characters s[i:end] by the
+// flanking rules of CommonMark.
+func delimiterRun(s string, i, end int) *node {
+	before, after := ' ', ' '
+	if i > 0 {
+		before, _ = utf8.DecodeLastRuneInString(s[:i])
+	}
+	if end < len(s) {
+		after, _ = utf8.DecodeRuneInString(s[end:])
+	}
+
+	left := !unicode.IsSpace(after) && (!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+	right := !unicode.IsSpace(before) && (!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+
+	n := &node{delim: s[i], count: end - i, length: end - i, canOpen: left, canClose: right}
+	if n.delim == '_' {
+		n.canOpen = left && (!right || isPunct(before))
+		n.canClose = right && (!left || isPunct(after))
+	}
+
+	return n
+}
+
+// matchEmphasis pairs up delimiter runs, innermost first.
+func matchEmphasis(nodes []*node) {
+	for c, closer := range nodes {
+		if closer.delim == 0 || !closer.canClose {
+			continue
+		}
+
+		for closer.count > 0 {
+			o := -1
+			for k := c - 1; k >= 0; k-- {
+				opener := nodes[k]
+				if opener.delim != closer.delim || !opener.canOpen || opener.count == 0 {
+					continue
+				}
+
+				if closer.delim == '~' && opener.count != closer.count {
+					continue
+				}
+
+				sum := opener.length + closer.length
+				if closer.delim != '~' && (opener.canClose || closer.canOpen) && sum%3 == 0 && (opener.length%3 != 0 || closer.length%3 != 0) {
+					continue
+				}
+
+				o = k
+				break
+			}
+
+			if o < 0 {
+				break
+			}
+
+			opener := nodes[o]
+			use, tag := 1, "em"
+			switch {
+			case closer.delim == '~':
+				use, tag = closer.count, "del"
+			case opener.count >= 2 && closer.count >= 2:
+				use, tag = 2, "strong"
+			}
+
+			opener.openTags = "<" + tag + ">" + opener.openTags
+			closer.closeTags += "</" + tag + ">"
+			opener.count -= use
+			closer.count -= use
+
+			for _, between := range nodes[o+1 : c] {
+				between.canOpen, between.canClose = false, false
+			}
+		}
+	}
+}
+
+// link parses a link or image whose text starts at the bracket at i, inline
+// or by reference.
+func (p *parser) link(s string, i int, image bool) (string, int, bool) {
+	end := closingBracket(s, i)
+	if end < 0 {
+		return "", i, false
+	}
+
+	label := s[i+1 : end]
+	var ref reference
+	next := end + 1
+	found := false
+
+	if next < len(s) && s[next] == '(' {
+		ref.destination, ref.title, next, found = inlineDestination(s, next+1)
+	}
+
+	if !found {
+		name := label
+		next = end + 1
+		if next+1 < len(s) && s[next] == '[' {
+			if close := closingBracket(s, next); close > 0 {
+				if close > next+1 {
+					name = s[next+1 : close]
+				}
+				next = close + 1
+			}
+		}
+
+		ref, found = p.refs[normalizeLabel(name)]
+	}
+
+	if !found {
+		return "", i, false
+	}
+
+	content := p.inline(label)
+	if image {
+		html := `<img src="` + escape(normalizeURL(ref.destination)) + `" alt="` + tags.ReplaceAllString(imageAlt.ReplaceAllString(content, "$1"), "") + `"`
+		if ref.title != "" {
+			html += ` title="` + escape(ref.title) + `"`
+		}
+		return html + " />", next, true
+	}
+
+	// Links cannot contain other links, so the innermost one wins.
+	if strings.Contains(content, "<a ") {
+		return "", i, false
+	}
+
+	html := `<a href="` + escape(normalizeURL(ref.destination)) + `"`
+	if ref.title != "" {
+		html += ` title="` + escape(ref.title) + `"`
+	}
+	return html + ">" + content + "</a>", next, true
+}
+
+// closingBracket returns the index of the bracket closing the one at i,
+// skipping escapes and code spans, or -1.
+func closingBracket(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			_, next := codeSpan(s, j)
+			j = next - 1
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+
+	return -1
+}
+
+// inlineDestination parses `destination "title")` starting after the
+// opening parenthesis.
+func inlineDestination(s string, i int) (string, string, int, bool) {
+	j := skipWhitespace(s, i)
+
+	var destination string
+	if j < len(s) && s[j] == '<' {
+		end := strings.IndexAny(s[j+1:], "<>\n")
+		if end < 0 || s[j+1+end] != '>' {
+			return "", "", i, false
+		}
+		destination = s[j+1 : j+1+end]
+		j += end + 2
+	} else {
+		start, depth := j, 0
+		for ; j < len(s) && s[j] > ' '; j++ {
+			if s[j] == '\\' && j+1 < len(s) && isASCIIPunct(s[j+1]) {
+				j++
+			} else if s[j] == '(' {
+				depth++
+			} else if s[j] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+		destination = s[start:j]
+	}
+
+	k := skipWhitespace(s, j)
+	title := ""
+	if k > j && k < len(s) && (s[k] == '"' || s[k] == '\'' || s[k] == '(') {
+		closer := s[k]
+		if closer == '(' {
+			closer = ')'
+		}
+
+		end := k + 1
+		for ; end < len(s) && s[end] != closer; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+
+		if end >= len(s) {
+			return "", "", i, false
+		}
+
+		title = s[k+1 : end]
+		k = skipWhitespace(s, end+1)
+	}
+
+	if k >= len(s) || s[k] != ')' {
+		return "", "", i, false
+	}
+
+	return unescape(destination), unescape(title), k + 1, true
+}
+
+func skipWhitespace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+
+	return i
+}
+
+func atWordStart(s string, i int) bool {
+	return i == 0 || strings.IndexByte(" \t\n*_~(", s[i-1]) >= 0
+}
+
+// extendedAutolink links the bare www. and http(s):// addresses of GitHub
+// Flavored Markdown, leaving out trailing punctuation.
+func extendedAutolink(s string, i int) (string, int, bool) {
+	var prefix string
+	for _, candidate := range []string{"https://", "http://", "www."} {
+		if strings.HasPrefix(s[i:], candidate) {
+			prefix = candidate
+			break
+		}
+	}
+
+	if prefix == "" {
+		return "", i, false
+	}
+
+	end := i
+	for end < len(s) && s[end] > ' ' && s[end] != '<' {
+		end++
+	}
+
+	link := trimAutolink(s[i:end])
+
+	domain := strings.SplitN(link[len(prefix):], "/", 2)[0]
+	if domain == "" || prefix == "www." && !strings.Contains(domain, ".") {
+		return "", i, false
+	}
+
+	href := link
+	if prefix == "www." {
+		href = "http://" + link
+	}
+
+	return `<a href="` + escape(normalizeURL(href)) + `">` + escape(link) + "</a>", i + len(link), true
+}
+
+func trimAutolink(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte("?!.,:*_~'\"", last) >= 0:
+			link = link[:len(link)-1]
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+			link = link[:len(link)-1]
+		case last == ';' && trailingRef.MatchString(link):
+			link = trailingRef.ReplaceAllString(link, "")
+		default:
+			return link
+		}
+	}
+
+	return link
+}
+
+// unescape resolves backslash escapes and entity references.
+func unescape(s string) string {
+	if !strings.ContainsAny(s, `\&`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return html.UnescapeString(b.String())
+}
+
+// normalizeURL percent-encodes the characters that may not appear in a URL,
+// keeping those that already have a meaning in one.
+func normalizeURL(s string) string {
+	const safe = ";/?:@&=+$,-_.!~*'()#%"
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(safe, c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,675 @@
+// Package markdown renders CommonMark to HTML, with the GitHub Flavored
+// Markdown extensions for tables, strikethrough and autolinks. Raw HTML in the
+// source is passed through as CommonMark requires, so the output must be
+// sanitised before it is shown to anybody but its author.
+package markdown
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type kind int
+
+const (
+	paragraphBlock kind = iota
+	headingBlock
+	thematicBreakBlock
+	codeBlock
+	htmlBlock
+	quoteBlock
+	listBlock
+	itemBlock
+	tableBlock
+)
+
+type block struct {
+	kind     kind
+	level    int
+	text     string
+	info     string
+	children []*block
+	ordered  bool
+	start    int
+	tight    bool
+	aligns   []string
+	rows     [][]string
+}
+
+type reference struct {
+	destination string
+	title       string
+}
+
+type parser struct {
+	refs map[string]reference
+}
+
+const blockTags = `address|article|aside|base|basefont|blockquote|body|caption|center|col|colgroup|dd|details|dialog|dir|div|dl|dt|fieldset|figcaption|figure|footer|form|frame|frameset|h[1-6]|head|header|hr|html|iframe|legend|li|link|main|menu|menuitem|nav|noframes|ol|optgroup|option|p|param|section|source|summary|table|tbody|td|tfoot|th|thead|title|tr|track|ul`
+
+var (
+	atxHeading          = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*)|[ \t]*)$`)
+	closingSequence     = regexp.MustCompile(`(?:^|[ \t]+)#+[ \t]*$`)
+	thematicBreak       = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceOpen           = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+	setextUnderline     = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	quoteMarker         = regexp.MustCompile(`^ {0,3}> ?`)
+	listMarker          = regexp.MustCompile(`^( {0,3})([-+*]|[0-9]{1,9}[.)])([ \t]+|$)`)
+	tableDelimiter      = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	referenceStart      = regexp.MustCompile(`^ {0,3}\[`)
+	referenceDefinition = regexp.MustCompile(`^ {0,3}\[((?:[^\\\[\]]|\\.){1,999})\]:[ \t]*\n?[ \t]*(<[^<>\n]*>|\S+)(?:(?:[ \t]+|[ \t]*\n[ \t]*)("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|\((?:[^()\\]|\\.)*\)))?[ \t]*$`)
+	rawTextStart        = regexp.MustCompile(`^ {0,3}<(?i:(script|pre|style|textarea))(?:[ \t>]|$)`)
+	commentStart        = regexp.MustCompile(`^ {0,3}<!--`)
+	blockTagStart       = regexp.MustCompile(`^ {0,3}</?(?i:` + blockTags + `)(?:[ \t>]|/>|$)`)
+	tagLine             = regexp.MustCompile(`^ {0,3}(?:` + openTag + `|` + closeTag + `)[ \t]*$`)
+)
+
+// Render returns the HTML of source.
+func Render(source string) string {
+	source = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x00", "�").Replace(source)
+
+	p := &parser{refs: map[string]reference{}}
+	blocks, _ := p.parseBlocks(strings.Split(strings.TrimSuffix(source, "\n"), "\n"))
+
+	var b strings.Builder
+	p.renderBlocks(&b, blocks)
+	return b.String()
+}
+
+// parseBlocks also reports whether a blank line separated two of the blocks,
+// which makes the list item they are in loose.
+func (p *parser) parseBlocks(lines []string) ([]*block, bool) {
+	var blocks []*block
+	blankBetween, sawBlank := false, false
+
+	for i := 0; i < len(lines); {
+		if isBlank(lines[i]) {
+			sawBlank = len(blocks) > 0
+			i++
+			continue
+		}
+
+		if sawBlank {
+			blankBetween = true
+			sawBlank = false
+		}
+
+		b, next := p.parseBlock(lines, i)
+		i = next
+		if b != nil {
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks, blankBetween
+}
+
+func (p *parser) parseBlock(lines []string, i int) (*block, int) {
+	line := lines[i]
+
+	switch {
+	case indentation(line) >= 4:
+		return parseIndentedCode(lines, i)
+	case fenceOpen.MatchString(line) && isFence(line):
+		return parseFencedCode(lines, i)
+	case rawTextStart.MatchString(line):
+		match := rawTextStart.FindStringSubmatch(line)
+		return parseHTML(lines, i, "</"+strings.ToLower(match[1])+">")
+	case commentStart.MatchString(line):
+		return parseHTML(lines, i, "-->")
+	case blockTagStart.MatchString(line), tagLine.MatchString(line):
+		return parseHTML(lines, i, "")
+	case atxHeading.MatchString(line):
+		return parseATXHeading(line), i + 1
+	case thematicBreak.MatchString(line):
+		return &block{kind: thematicBreakBlock}, i + 1
+	case quoteMarker.MatchString(line):
+		return p.parseQuote(lines, i)
+	case listMarker.MatchString(line):
+		return p.parseList(lines, i)
+	}
+
+	if b, next, ok := parseTable(lines, i); ok {
+		return b, next
+	}
+
+	return p.parseParagraph(lines, i)
+}
+
+// interrupts tells whether line ends the paragraph before it.
+func interrupts(line string) bool {
+	if indentation(line) >= 4 {
+		return false
+	}
+
+	if fenceOpen.MatchString(line) && isFence(line) || atxHeading.MatchString(line) || thematicBreak.MatchString(line) {
+		return true
+	}
+
+	if quoteMarker.MatchString(line) || rawTextStart.MatchString(line) || commentStart.MatchString(line) || blockTagStart.MatchString(line) {
+		return true
+	}
+
+	match := listMarker.FindStringSubmatch(line)
+	if match == nil || isBlank(line[len(match[0]):]) {
+		return false
+	}
+
+	marker := match[2]
+	return !isOrdered(marker) || marker[:len(marker)-1] == "1"
+}
+
+func parseIndentedCode(lines []string, i int) (*block, int) {
+	var code []string
+	j := i
+	for ; j < len(lines) && (isBlank(lines[j]) || indentation(lines[j]) >= 4); j++ {
+		code = append(code, stripIndent(lines[j], 4))
+	}
+
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+
+	return &block{kind: codeBlock, text: strings.Join(code, "\n") + "\n"}, j
+}
+
+func isFence(line string) bool {
+	match := fenceOpen.FindStringSubmatch(line)
+	return match[2][0] != '`' || !strings.Contains(match[3], "`")
+}
+
+func parseFencedCode(lines []string, i int) (*block, int) {
+	match := fenceOpen.FindStringSubmatch(lines[i])
+	indent, fence := len(match[1]), match[2]
+	info := unescape(strings.TrimSpace(match[3]))
+
+	var code []string
+	j := i + 1
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		closing := strings.TrimRight(strings.TrimLeft(line, " "), " \t")
+		if indentation(line) < 4 && len(closing) >= len(fence) && strings.Trim(closing, fence[:1]) == "" {
+			j++
+			break
+		}
+
+		code = append(code, stripIndent(line, indent))
+	}
+
+	text := strings.Join(code, "\n")
+	if len(code) > 0 {
+		text += "\n"
+	}
+
+	return &block{kind: codeBlock, text: text, info: info}, j
+}
+
+// parseHTML passes lines through until one containing end, or until a blank
+// line when end is empty.
+func parseHTML(lines []string, i int, end string) (*block, int) {
+	j := i
+	for ; j < len(lines); j++ {
+		if end == "" && isBlank(lines[j]) {
+			break
+		}
+
+		if end != "" && strings.Contains(strings.ToLower(lines[j]), end) {
+			j++
+			break
+		}
+	}
+
+	return &block{kind: htmlBlock, text: strings.Join(lines[i:j], "\n")}, j
+}
+
+func parseATXHeading(line string) *block {
+	match := atxHeading.FindStringSubmatch(line)
+	text := closingSequence.ReplaceAllString(strings.TrimRight(match[2], " \t"), "")
+	return &block{kind: headingBlock, level: len(match[1]), text: strings.TrimSpace(text)}
+}
+
+func (p *parser) parseQuote(lines []string, i int) (*block, int) {
+	var inner []string
+	j := i
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		if loc := quoteMarker.FindStringIndex(line); loc != nil {
+			inner = append(inner, quoted(line, loc))
+			continue
+		}
+
+		// A paragraph in the quote may go on without markers.
+		if isBlank(line) || len(inner) == 0 || isBlank(inner[len(inner)-1]) || interrupts(line) || listMarker.MatchString(line) || !endsInParagraph(inner) {
+			break
+		}
+
+		inner = append(inner, line)
+	}
+
+	children, _ := p.parseBlocks(inner)
+	return &block{kind: quoteBlock, children: children}, j
+}
+
+// quoted returns what follows the block quote marker at loc in line. A tab
+// after the > counts as the columns it advances, one of which is taken as the
+// optional space.
+func quoted(line string, loc []int) string {
+	gt := strings.IndexByte(line, '>')
+	if gt+1 >= len(line) || line[gt+1] != '\t' {
+		return line[loc[1]:]
+	}
+
+	rest := strings.TrimLeft(line[gt+1:], " \t")
+	width := indentation(strings.Repeat(" ", gt+1)+line[gt+1:len(line)-len(rest)]) - gt - 1
+	return strings.Repeat(" ", width-1) + rest
+}
+
+// endsInParagraph tells whether the last of the blocks in lines is a
+// paragraph, which a lazy continuation line can go on.
+func endsInParagraph(lines []string) bool {
+	blocks, _ := (&parser{refs: map[string]reference{}}).parseBlocks(lines)
+	for len(blocks) > 0 {
+		last := blocks[len(blocks)-1]
+		switch last.kind {
+		case paragraphBlock:
+			return true
+		case quoteBlock, listBlock, itemBlock:
+			blocks = last.children
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+func isOrdered(marker string) bool {
+	return marker[len(marker)-1] == '.' || marker[len(marker)-1] == ')'
+}
+
+func sameListType(a, b string) bool {
+	if isOrdered(a) != isOrdered(b) {
+		return false
+	}
+
+	return a[len(a)-1] == b[len(b)-1]
+}
+
+func (p *parser) parseList(lines []string, i int) (*block, int) {
+	first := listMarker.FindStringSubmatch(lines[i])
+	list := &block{kind: listBlock, ordered: isOrdered(first[2]), tight: true}
+	if list.ordered {
+		list.start, _ = strconv.Atoi(first[2][:len(first[2])-1])
+	}
+
+	j := i
+	for j < len(lines) {
+		// Blank lines between two items make the list loose. Those after the
+		// last one are left to the blocks around the list.
+		next := j
+		for next < len(lines) && isBlank(lines[next]) {
+			next++
+		}
+
+		if next == len(lines) {
+			break
+		}
+
+		match := listMarker.FindStringSubmatch(lines[next])
+		if match == nil || !sameListType(match[2], first[2]) || thematicBreak.MatchString(lines[next]) {
+			break
+		}
+
+		if next > j {
+			list.tight = false
+		}
+
+		var item *block
+		item, j = p.parseItem(lines, next, match)
+		list.children = append(list.children, item)
+		if !item.tight {
+			list.tight = false
+		}
+	}
+
+	return list, j
+}
+
+// parseItem returns the item and the next line, leaving the blank lines after
+// the item to the list.
+func (p *parser) parseItem(lines []string, i int, match []string) (*block, int) {
+	rest := lines[i][len(match[0]):]
+	markerEnd := len(match[1]) + len(match[2])
+	contentIndent := markerEnd + indentation(match[3])
+
+	var first string
+	switch {
+	case isBlank(rest):
+		contentIndent = markerEnd + 1
+	case indentation(match[3]) > 4:
+		contentIndent = markerEnd + 1
+		first = stripIndent(match[3], 1) + rest
+	default:
+		first = rest
+	}
+
+	itemLines := []string{first}
+	j := i + 1
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		if isBlank(line) {
+			// An item can start with at most one blank line.
+			if isBlank(first) && len(itemLines) == 1 {
+				break
+			}
+
+			itemLines = append(itemLines, "")
+			continue
+		}
+
+		if indentation(line) >= contentIndent {
+			itemLines = append(itemLines, stripIndent(line, contentIndent))
+			continue
+		}
+
+		last := itemLines[len(itemLines)-1]
+		if isBlank(last) || interrupts(line) || listMarker.MatchString(line) {
+			break
+		}
+
+		itemLines = append(itemLines, line)
+	}
+
+	for len(itemLines) > 1 && isBlank(itemLines[len(itemLines)-1]) {
+		itemLines = itemLines[:len(itemLines)-1]
+		j--
+	}
+
+	children, blankBetween := p.parseBlocks(itemLines)
+	item := &block{kind: itemBlock, children: children, tight: !blankBetween}
+	return item, j
+}
+
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func parseTable(lines []string, i int) (*block, int, bool) {
+	if i+1 >= len(lines) || !strings.Contains(lines[i], "|") || !strings.Contains(lines[i+1], "|") || !tableDelimiter.MatchString(lines[i+1]) {
+		return nil, i, false
+	}
+
+	header := splitRow(lines[i])
+	delimiters := splitRow(lines[i+1])
+	if len(header) != len(delimiters) {
+		return nil, i, false
+	}
+
+	aligns := make([]string, len(delimiters))
+	for k, delimiter := range delimiters {
+		left, right := strings.HasPrefix(delimiter, ":"), strings.HasSuffix(delimiter, ":")
+		switch {
+		case left && right:
+			aligns[k] = "center"
+		case left:
+			aligns[k] = "left"
+		case right:
+			aligns[k] = "right"
+		}
+	}
+
+	table := &block{kind: tableBlock, aligns: aligns, rows: [][]string{header}}
+	j := i + 2
+	for ; j < len(lines) && !isBlank(lines[j]) && !interrupts(lines[j]); j++ {
+		row := make([]string, len(aligns))
+		copy(row, splitRow(lines[j]))
+		table.rows = append(table.rows, row)
+	}
+
+	return table, j, true
+}
+
+// referenceAt matches the longest link reference definition starting at line
+// i, which may go on over the lines up to the next blank one.
+func referenceAt(lines []string, i int) ([]string, int) {
+	if !referenceStart.MatchString(lines[i]) {
+		return nil, i
+	}
+
+	end := i
+	for end < len(lines) && !isBlank(lines[end]) {
+		end++
+	}
+
+	for ; end > i; end-- {
+		if match := referenceDefinition.FindStringSubmatch(strings.Join(lines[i:end], "\n")); match != nil {
+			return match, end
+		}
+	}
+
+	return nil, i
+}
+
+func (p *parser) parseParagraph(lines []string, i int) (*block, int) {
+	j := i
+	for j < len(lines) {
+		match, next := referenceAt(lines, j)
+		if match == nil {
+			break
+		}
+		j = next
+
+		label := normalizeLabel(match[1])
+		if _, ok := p.refs[label]; !ok && label != "" {
+			destination := strings.TrimSuffix(strings.TrimPrefix(match[2], "<"), ">")
+			title := ""
+			if len(match[3]) >= 2 {
+				title = match[3][1 : len(match[3])-1]
+			}
+			p.refs[label] = reference{destination: unescape(destination), title: unescape(title)}
+		}
+	}
+
+	if j > i && (j == len(lines) || isBlank(lines[j]) || interrupts(lines[j])) {
+		return nil, j
+	}
+
+	text := []string{strings.TrimLeft(lines[j], " \t")}
+	for j++; j < len(lines); j++ {
+		line := lines[j]
+		if isBlank(line) {
+			break
+		}
+
+		if match := setextUnderline.FindStringSubmatch(line); match != nil {
+			level := 1
+			if match[1][0] == '-' {
+				level = 2
+			}
+
+			return &block{kind: headingBlock, level: level, text: strings.TrimSpace(strings.Join(text, "\n"))}, j + 1
+		}
+
+		if interrupts(line) {
+			break
+		}
+
+		text = append(text, strings.TrimLeft(line, " \t"))
+	}
+
+	return &block{kind: paragraphBlock, text: strings.TrimRight(strings.Join(text, "\n"), " \t")}, j
+}
+
+func (p *parser) renderBlocks(b *strings.Builder, blocks []*block) {
+	for _, child := range blocks {
+		p.renderBlock(b, child)
+	}
+}
+
+func (p *parser) renderBlock(b *strings.Builder, bl *block) {
+	switch bl.kind {
+	case paragraphBlock:
+		b.WriteString("<p>" + p.inline(bl.text) + "</p>\n")
+	case headingBlock:
+		level := strconv.Itoa(bl.level)
+		b.WriteString("<h" + level + ">" + p.inline(bl.text) + "</h" + level + ">\n")
+	case thematicBreakBlock:
+		b.WriteString("<hr />\n")
+	case codeBlock:
+		b.WriteString("<pre><code")
+		if language := strings.Fields(bl.info); len(language) > 0 {
+			b.WriteString(` class="language-` + escape(language[0]) + `"`)
+		}
+		b.WriteString(">" + escape(bl.text) + "</code></pre>\n")
+	case htmlBlock:
+		b.WriteString(bl.text + "\n")
+	case quoteBlock:
+		b.WriteString("<blockquote>\n")
+		p.renderBlocks(b, bl.children)
+		b.WriteString("</blockquote>\n")
+	case listBlock:
+		p.renderList(b, bl)
+	case tableBlock:
+		p.renderTable(b, bl)
+	}
+}
+
+// renderList leaves out the paragraphs of tight lists, keeping their text.
+func (p *parser) renderList(b *strings.Builder, list *block) {
+	tag := "ul"
+	if list.ordered {
+		tag = "ol"
+	}
+
+	b.WriteString("<" + tag)
+	if list.ordered && list.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(list.start) + `"`)
+	}
+	b.WriteString(">\n")
+
+	for _, item := range list.children {
+		b.WriteString("<li>")
+		needsNewline := true
+		for k, child := range item.children {
+			if list.tight && child.kind == paragraphBlock {
+				if k > 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString(p.inline(child.text))
+				needsNewline = true
+				continue
+			}
+
+			if needsNewline {
+				b.WriteString("\n")
+			}
+			p.renderBlock(b, child)
+			needsNewline = false
+		}
+		b.WriteString("</li>\n")
+	}
+
+	b.WriteString("</" + tag + ">\n")
+}
+
+func (p *parser) renderTable(b *strings.Builder, table *block) {
+	row := func(cells []string, tag string) {
+		b.WriteString("<tr>\n")
+		for k, cell := range cells {
+			b.WriteString("<" + tag)
+			if table.aligns[k] != "" {
+				b.WriteString(` align="` + table.aligns[k] + `"`)
+			}
+			b.WriteString(">" + p.inline(cell) + "</" + tag + ">\n")
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	row(table.rows[0], "th")
+	b.WriteString("</thead>\n")
+
+	if len(table.rows) > 1 {
+		b.WriteString("<tbody>\n")
+		for _, cells := range table.rows[1:] {
+			row(cells, "td")
+		}
+		b.WriteString("</tbody>\n")
+	}
+
+	b.WriteString("</table>\n")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// indentation returns the width of the leading whitespace of line, with tabs
+// advancing to the next multiple of four.
+func indentation(line string) int {
+	width := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return width
+		}
+	}
+
+	return width
+}
+
+// stripIndent removes up to n columns of leading whitespace, splitting a tab
+// that straddles column n into spaces.
+func stripIndent(line string, n int) string {
+	width := 0
+	for i := 0; i < len(line); i++ {
+		if width >= n {
+			return line[i:]
+		}
+
+		switch line[i] {
+		case ' ':
+			width++
+		case '\t':
+			next := width + 4 - width%4
+			if next > n {
+				return strings.Repeat(" ", next-n) + line[i+1:]
+			}
+			width = next
+		default:
+			return line[i:]
+		}
+	}
+
+	return ""
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
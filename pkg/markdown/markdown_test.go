@@ -0,0 +1,64 @@
+package markdown
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Render", func() {
+	It("should render headings and paragraphs", func() {
+		Expect(Render("# Winter *is* coming\n\nThe North\nremembers.")).Should(Equal(
+			"<h1>Winter <em>is</em> coming</h1>\n<p>The North\nremembers.</p>\n"))
+		Expect(Render("Title\n=====\n\nSubtitle\n---")).Should(Equal("<h1>Title</h1>\n<h2>Subtitle</h2>\n"))
+	})
+
+	It("should render emphasis, strikethrough and code spans", func() {
+		Expect(Render("*em* **strong** ***both*** ~~del~~ `a < b` snake_case_word")).Should(Equal(
+			"<p><em>em</em> <strong>strong</strong> <em><strong>both</strong></em> <del>del</del> <code>a &lt; b</code> snake_case_word</p>\n"))
+	})
+
+	It("should render hard line breaks", func() {
+		Expect(Render("Hodor  \nHodor\\\nHodor")).Should(Equal("<p>Hodor<br />\nHodor<br />\nHodor</p>\n"))
+	})
+
+	It("should render tight, loose and nested lists", func() {
+		Expect(Render("- Stark\n  - Jon\n- Lannister\n\n3. three\n4. four")).Should(Equal(
+			"<ul>\n<li>Stark\n<ul>\n<li>Jon</li>\n</ul>\n</li>\n<li>Lannister</li>\n</ul>\n<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"))
+		Expect(Render("- a\n\n- b")).Should(Equal("<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n</ul>\n"))
+	})
+
+	It("should render block quotes and thematic breaks", func() {
+		Expect(Render("> You know nothing\nJon Snow\n\n***")).Should(Equal(
+			"<blockquote>\n<p>You know nothing\nJon Snow</p>\n</blockquote>\n<hr />\n"))
+	})
+
+	It("should render fenced and indented code blocks", func() {
+		Expect(Render("```go\nif a < b {\n}\n```")).Should(Equal(
+			"<pre><code class=\"language-go\">if a &lt; b {\n}\n</code></pre>\n"))
+		Expect(Render("    indented\n")).Should(Equal("<pre><code>indented\n</code></pre>\n"))
+	})
+
+	It("should render tables with their alignment", func() {
+		Expect(Render("| House | Words |\n|:--|:-:|\n| Stark | Winter \\| is coming |")).Should(Equal(
+			"<table>\n<thead>\n<tr>\n<th align=\"left\">House</th>\n<th align=\"center\">Words</th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td align=\"left\">Stark</td>\n<td align=\"center\">Winter | is coming</td>\n</tr>\n</tbody>\n</table>\n"))
+	})
+
+	It("should render inline and reference links and images", func() {
+		Expect(Render("[Winterfell](https://example.com \"North\") ![wolf](/ghost.png)")).Should(Equal(
+			"<p><a href=\"https://example.com\" title=\"North\">Winterfell</a> <img src=\"/ghost.png\" alt=\"wolf\" /></p>\n"))
+		Expect(Render("[wall] and [the wall][Wall]\n\n[wall]: https://example.com/wall")).Should(Equal(
+			"<p><a href=\"https://example.com/wall\">wall</a> and <a href=\"https://example.com/wall\">the wall</a></p>\n"))
+	})
+
+	It("should autolink URLs, bare domains and emails", func() {
+		Expect(Render("<https://example.com> <jon@example.com> see www.example.com/north, or https://example.com/x).")).Should(Equal(
+			"<p><a href=\"https://example.com\">https://example.com</a> <a href=\"mailto:jon@example.com\">jon@example.com</a> " +
+				"see <a href=\"http://www.example.com/north\">www.example.com/north</a>, or <a href=\"https://example.com/x\">https://example.com/x</a>).</p>\n"))
+	})
+
+	It("should escape text and pass raw HTML through for sanitising", func() {
+		Expect(Render("1 < 2 & \"3\" > 0 &copy;")).Should(Equal("<p>1 &lt; 2 &amp; &quot;3&quot; &gt; 0 ©</p>\n"))
+		Expect(Render("<div>\nhi\n</div>\n\nsome <b>bold</b>")).Should(Equal("<div>\nhi\n</div>\n<p>some <b>bold</b></p>\n"))
+	})
+})
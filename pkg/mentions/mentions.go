@@ -0,0 +1,117 @@
+// Package mentions finds the @name mentions in rendered HTML and links them,
+// leaving alone the ones in links and code.
+package mentions
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// MaxLength is the longest name a mention can carry.
+const MaxLength = 32
+
+var pattern = regexp.MustCompile(`@[A-Za-z0-9_][A-Za-z0-9_.-]*`)
+
+// skipped elements are not searched for mentions.
+var skipped = map[string]bool{"a": true, "code": true, "pre": true}
+
+// Names lists the names mentioned in s, each once, in the order they first
+// appear.
+func Names(s string) []string {
+	var names []string
+	seen := map[string]bool{}
+
+	walk(s, func(text string) string {
+		for _, match := range find(text) {
+			if name := text[match[0]+1 : match[1]]; !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		return html.EscapeString(text)
+	})
+
+	return names
+}
+
+// Link turns the mentions in s into links to the URL href gives for their
+// name. Mentions it gives none for are left as text.
+func Link(s string, href func(name string) (string, bool)) string {
+	return walk(s, func(text string) string {
+		var b strings.Builder
+		last := 0
+		for _, match := range find(text) {
+			url, ok := href(text[match[0]+1 : match[1]])
+			if !ok {
+				continue
+			}
+
+			b.WriteString(html.EscapeString(text[last:match[0]]))
+			b.WriteString(`<a href="` + html.EscapeString(url) + `" class="mention">`)
+			b.WriteString(html.EscapeString(text[match[0]:match[1]]) + "</a>")
+			last = match[1]
+		}
+
+		b.WriteString(html.EscapeString(text[last:]))
+		return b.String()
+	})
+}
+
+// walk copies s, passing the text outside skipped elements through replace,
+// which must return it escaped.
+func walk(s string, replace func(text string) string) string {
+	var b strings.Builder
+	depth := 0
+
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		raw := string(tokenizer.Raw())
+		token := tokenizer.Token()
+		switch {
+		case tokenType == html.TextToken && depth == 0:
+			b.WriteString(replace(token.Data))
+			continue
+		case tokenType == html.StartTagToken && skipped[token.Data]:
+			depth++
+		case tokenType == html.EndTagToken && skipped[token.Data] && depth > 0:
+			depth--
+		}
+
+		b.WriteString(raw)
+	}
+
+	return b.String()
+}
+
+// find returns the start and end of each mention in text. A mention starts
+// at a word boundary, so that email addresses are not taken for one, and
+// does not end in punctuation.
+func find(text string) [][]int {
+	var found [][]int
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		if match[0] > 0 && wordByte(text[match[0]-1]) {
+			continue
+		}
+
+		for match[1] > match[0]+1 && (text[match[1]-1] == '.' || text[match[1]-1] == '-') {
+			match[1]--
+		}
+
+		if match[1]-match[0]-1 <= MaxLength {
+			found = append(found, match)
+		}
+	}
+
+	return found
+}
+
+func wordByte(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '@' || c == '/' ||
+		'0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
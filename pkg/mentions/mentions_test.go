@@ -0,0 +1,57 @@
+package mentions
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Names", func() {
+	It("should find each mentioned name once, in order", func() {
+		Expect(Names("<p>@jon and @arya_s, then @jon again</p>")).Should(Equal([]string{"jon", "arya_s"}))
+	})
+
+	It("should not end names in punctuation", func() {
+		Expect(Names("<p>Thanks @jon.snow. Ask @sam-, or @gilly!</p>")).Should(Equal([]string{"jon.snow", "sam", "gilly"}))
+	})
+
+	It("should ignore email addresses and paths", func() {
+		Expect(Names("<p>jon@example.com, /u/@jon and @@jon</p>")).Should(BeEmpty())
+	})
+
+	It("should ignore names that are too long", func() {
+		Expect(Names("<p>@abcdefghijklmnopqrstuvwxyz0123456789</p>")).Should(BeEmpty())
+	})
+
+	It("should ignore mentions in links and code", func() {
+		Expect(Names(`<p><a href="/x">@jon</a> <code>@arya</code></p><pre><code>@sam</code></pre><p>@bran</p>`)).Should(Equal([]string{"bran"}))
+	})
+
+	It("should find mentions next to escaped text", func() {
+		Expect(Names("<p>&lt;@jon&gt;</p>")).Should(Equal([]string{"jon"}))
+	})
+})
+
+var _ = Describe("Link", func() {
+	ids := map[string]int{"jon": 1, "arya": 2}
+	href := func(name string) (string, bool) {
+		id, ok := ids[name]
+		return fmt.Sprintf("/users/%d", id), ok
+	}
+
+	It("should link the mentions href knows", func() {
+		Expect(Link("<p>Hi @jon, @sam and @arya.</p>", href)).Should(Equal(
+			`<p>Hi <a href="/users/1" class="mention">@jon</a>, @sam and <a href="/users/2" class="mention">@arya</a>.</p>`))
+	})
+
+	It("should keep the rest of the HTML as it was", func() {
+		s := `<p><a href="/x" rel="nofollow ugc">@jon</a> &amp; <code>@arya</code><br />a &lt; b</p>`
+		Expect(Link(s, href)).Should(Equal(s))
+	})
+
+	It("should keep text escaped around the links", func() {
+		Expect(Link("<p>&lt;@jon&gt; &amp;</p>", href)).Should(Equal(
+			`<p>&lt;<a href="/users/1" class="mention">@jon</a>&gt; &amp;</p>`))
+	})
+})
@@ -0,0 +1,377 @@
+// Package oidc is an OpenID Connect relying party for the authorization code
+// flow with PKCE. It discovers the provider from its issuer URL and validates
+// RS256 signed ID tokens against the published JSON Web Key Set.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golangbb/golangbb/v2/pkg/tokens"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClockSkew is how far the clocks of the provider and the relying party may
+// drift apart before ID tokens are rejected.
+const ClockSkew = time.Minute
+
+var ErrIssuerMismatch = errors.New("oidc: discovered issuer does not match the configured issuer")
+var ErrNoIDToken = errors.New("oidc: token response has no id_token")
+var ErrInvalidIDToken = errors.New("oidc: id token is malformed or its signature is invalid")
+var ErrUnsupportedAlgorithm = errors.New("oidc: id token is not signed with RS256")
+var ErrUnknownKey = errors.New("oidc: id token is signed with an unknown key")
+var ErrInvalidClaims = errors.New("oidc: id token has the wrong issuer, audience or nonce, or has expired")
+
+// Config describes the client as registered with the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Metadata is the part of the discovery document the relying party uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the standard claims of a validated ID token.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience accepts both forms the aud claim may take.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+
+	*a = many
+	return nil
+}
+
+// RelyingParty discovers the provider lazily, so that a provider which is
+// down while the forum starts only breaks single sign-on until it is back.
+type RelyingParty struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     map[string]*rsa.PublicKey
+}
+
+// New returns a RelyingParty that makes its requests with client, or with
+// http.DefaultClient when it is nil.
+func New(config Config, client *http.Client) *RelyingParty {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+
+	return &RelyingParty{config: config, client: client}
+}
+
+func (rp *RelyingParty) Issuer() string {
+	return rp.config.Issuer
+}
+
+// Discover fetches the discovery document of the issuer once.
+func (rp *RelyingParty) Discover(ctx context.Context) (*Metadata, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.metadata != nil {
+		return rp.metadata, nil
+	}
+
+	metadata := &Metadata{}
+	target := strings.TrimSuffix(rp.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := rp.getJSON(ctx, target, metadata); err != nil {
+		return nil, err
+	}
+
+	if metadata.Issuer != rp.config.Issuer {
+		return nil, ErrIssuerMismatch
+	}
+
+	rp.metadata = metadata
+	return metadata, nil
+}
+
+// GenerateVerifier returns a random PKCE code verifier.
+func GenerateVerifier() (string, error) {
+	return tokens.Generate(tokens.DefaultLength)
+}
+
+// Challenge returns the S256 code challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns where to send the browser to sign in.
+func (rp *RelyingParty) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := rp.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.config.ClientID},
+		"redirect_uri":          {rp.config.RedirectURL},
+		"scope":                 {strings.Join(rp.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the raw ID token, which
+// still has to be checked with Verify.
+func (rp *RelyingParty) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	metadata, err := rp.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {rp.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(rp.config.ClientID), url.QueryEscape(rp.config.ClientSecret))
+
+	response, err := rp.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: token endpoint returned %s", response.Status)
+	}
+
+	body := &struct {
+		IDToken string `json:"id_token"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(body); err != nil {
+		return "", err
+	}
+
+	if body.IDToken == "" {
+		return "", ErrNoIDToken
+	}
+
+	return body.IDToken, nil
+}
+
+// Verify checks the signature of an ID token and that it was issued to this
+// client for the sign in that nonce belongs to.
+func (rp *RelyingParty) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	header := &struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if header.Algorithm != "RS256" {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	key, err := rp.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if !rp.validClaims(claims, nonce, time.Now()) {
+		return nil, ErrInvalidClaims
+	}
+
+	return claims, nil
+}
+
+func (rp *RelyingParty) validClaims(claims *Claims, nonce string, now time.Time) bool {
+	if claims.Issuer != rp.config.Issuer || claims.Subject == "" {
+		return false
+	}
+
+	audienceMatches := false
+	for _, candidate := range claims.Audience {
+		if candidate == rp.config.ClientID {
+			audienceMatches = true
+		}
+	}
+
+	if !audienceMatches {
+		return false
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != rp.config.ClientID {
+		return false
+	}
+
+	if !now.Before(time.Unix(claims.Expiry, 0).Add(ClockSkew)) || now.Add(ClockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) == 1
+}
+
+// key returns the signing key with id, fetching the key set again once when it
+// is unknown because the provider may have rotated its keys.
+func (rp *RelyingParty) key(ctx context.Context, id string) (*rsa.PublicKey, error) {
+	rp.mu.Lock()
+	key, ok := rp.keys[id]
+	rp.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	metadata, err := rp.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := rp.getJSON(ctx, metadata.JWKSURI, set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "RSA" || jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			continue
+		}
+
+		keys[jwk.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	rp.mu.Lock()
+	rp.keys = keys
+	rp.mu.Unlock()
+
+	if key, ok := keys[id]; ok {
+		return key, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (rp *RelyingParty) getJSON(ctx context.Context, target string, v interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := rp.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s returned %s", target, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,141 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/golangbb/golangbb/v2/pkg/oidc"
+	"github.com/golangbb/golangbb/v2/pkg/oidc/oidctest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const redirectURL = "http://forum.test/callback"
+
+var _ = Describe("RelyingParty", func() {
+	ctx := context.Background()
+	var issuer *oidctest.Server
+	var rp *oidc.RelyingParty
+
+	// signIn follows the authorization endpoint back to the redirect URL and
+	// returns the code and state it was given.
+	signIn := func(state, nonce, verifier string) (string, string) {
+		target, err := rp.AuthCodeURL(ctx, state, nonce, verifier)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		response, err := client.Get(target)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(response.StatusCode).Should(Equal(http.StatusFound))
+
+		location, err := url.Parse(response.Header.Get("Location"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(location.Host).Should(Equal("forum.test"))
+		return location.Query().Get("code"), location.Query().Get("state")
+	}
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   issuer.URL,
+			"sub":   "ygritte",
+			"aud":   "forum",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	sign := func(claims map[string]interface{}) string {
+		token, err := issuer.Sign(claims)
+		Expect(err).ShouldNot(HaveOccurred())
+		return token
+	}
+
+	BeforeEach(func() {
+		var err error
+		issuer, err = oidctest.NewServer("forum", "secret")
+		Expect(err).ShouldNot(HaveOccurred())
+		issuer.Subject = "ygritte"
+		issuer.Claims["email"] = "ygritte@wildlings.test"
+		issuer.Claims["email_verified"] = true
+
+		rp = oidc.New(issuer.Config(redirectURL), nil)
+	})
+	AfterEach(func() {
+		issuer.Close()
+	})
+
+	Context("the authorization code flow", func() {
+		It("should return the claims of the signed in subject", func() {
+			verifier, err := oidc.GenerateVerifier()
+			Expect(err).ShouldNot(HaveOccurred())
+
+			code, state := signIn("state", "nonce", verifier)
+			Expect(state).Should(Equal("state"))
+
+			idToken, err := rp.Exchange(ctx, code, verifier)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			claims, err := rp.Verify(ctx, idToken, "nonce")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(claims.Subject).Should(Equal("ygritte"))
+			Expect(claims.Email).Should(Equal("ygritte@wildlings.test"))
+			Expect(claims.EmailVerified).Should(BeTrue())
+		})
+
+		It("should not redeem a code without the matching verifier", func() {
+			code, _ := signIn("state", "nonce", "verifier")
+
+			_, err := rp.Exchange(ctx, code, "another verifier")
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("Verify", func() {
+		It("should reject ID tokens for another sign in, client or time", func() {
+			_, err := rp.Verify(ctx, sign(validClaims()), "another nonce")
+			Expect(err).Should(Equal(oidc.ErrInvalidClaims))
+
+			claims := validClaims()
+			claims["aud"] = []string{"forum", "wiki"}
+			_, err = rp.Verify(ctx, sign(claims), "nonce")
+			Expect(err).Should(Equal(oidc.ErrInvalidClaims))
+
+			claims["azp"] = "forum"
+			_, err = rp.Verify(ctx, sign(claims), "nonce")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			claims = validClaims()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			_, err = rp.Verify(ctx, sign(claims), "nonce")
+			Expect(err).Should(Equal(oidc.ErrInvalidClaims))
+		})
+
+		It("should reject tampered and unsigned ID tokens", func() {
+			parts := strings.Split(sign(validClaims()), ".")
+			forged := validClaims()
+			forged["sub"] = "jon"
+			parts[1] = strings.Split(sign(forged), ".")[1]
+
+			_, err := rp.Verify(ctx, strings.Join(parts, "."), "nonce")
+			Expect(err).Should(Equal(oidc.ErrInvalidIDToken))
+
+			unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+			_, err = rp.Verify(ctx, unsigned, "nonce")
+			Expect(err).Should(Equal(oidc.ErrUnsupportedAlgorithm))
+		})
+	})
+
+	Context("Discover", func() {
+		It("should reject a provider that claims to be another issuer", func() {
+			config := issuer.Config(redirectURL)
+			config.Issuer += "/"
+
+			_, err := oidc.New(config, nil).Discover(ctx)
+			Expect(err).Should(Equal(oidc.ErrIssuerMismatch))
+		})
+	})
+})
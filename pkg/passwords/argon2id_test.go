@@ -0,0 +1,120 @@
+package passwords
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = Describe("Argon2id", func() {
+	var hasher *Argon2id
+
+	BeforeEach(func() {
+		hasher = &Argon2id{
+			Memory:      1024,
+			Iterations:  1,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		}
+	})
+
+	Context("NewArgon2id", func() {
+		It("should return a hasher with sensible default parameters", func() {
+			defaults := NewArgon2id()
+			Expect(defaults.Memory).Should(BeNumerically(">=", 64*1024))
+			Expect(defaults.Iterations).Should(BeNumerically(">=", 1))
+			Expect(defaults.SaltLength).Should(BeNumerically(">=", 16))
+			Expect(defaults.KeyLength).Should(BeNumerically(">=", 32))
+		})
+	})
+
+	Context("Hash", func() {
+		When("hashing a password", func() {
+			It("should encode the algorithm and parameters into the hash", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(hash).Should(HavePrefix("$argon2id$v=19$m=1024,t=1,p=1$"))
+				Expect(strings.Split(hash, "$")).Should(HaveLen(6))
+			})
+		})
+
+		When("hashing the same password twice", func() {
+			It("should produce different hashes because of the random salt", func() {
+				first, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				second, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(first).ShouldNot(Equal(second))
+			})
+		})
+	})
+
+	Context("Verify", func() {
+		When("verifying the correct password", func() {
+			It("should return true", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				ok, err := hasher.Verify("password", hash)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeTrue())
+			})
+		})
+
+		When("verifying an incorrect password", func() {
+			It("should return false", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				ok, err := hasher.Verify("not the password", hash)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeFalse())
+			})
+		})
+
+		When("verifying against a malformed hash", func() {
+			It("should return an error", func() {
+				ok, err := hasher.Verify("password", "$argon2id$v=19$garbage")
+				Expect(err).Should(Equal(ErrInvalidHash))
+				Expect(ok).Should(BeFalse())
+			})
+		})
+
+		When("verifying against a hash with an unsupported version", func() {
+			It("should return an error", func() {
+				ok, err := hasher.Verify("password", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5")
+				Expect(err).Should(Equal(ErrIncompatibleVersion))
+				Expect(ok).Should(BeFalse())
+			})
+		})
+	})
+
+	Context("NeedsRehash", func() {
+		When("the hash was produced with the same parameters", func() {
+			It("should return false", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(hasher.NeedsRehash(hash)).Should(BeFalse())
+			})
+		})
+
+		When("the hasher parameters have been raised", func() {
+			It("should return true", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				hasher.Iterations = 2
+				Expect(hasher.NeedsRehash(hash)).Should(BeTrue())
+			})
+		})
+
+		When("the hash was produced by a different algorithm", func() {
+			It("should return true", func() {
+				hash, err := (&Bcrypt{Cost: 4}).Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(hasher.NeedsRehash(hash)).Should(BeTrue())
+			})
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package passwords
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bcrypt", func() {
+	var hasher *Bcrypt
+
+	BeforeEach(func() {
+		hasher = &Bcrypt{Cost: 4}
+	})
+
+	Context("Hash", func() {
+		When("hashing a password", func() {
+			It("should encode the cost into the hash", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(hash).Should(HavePrefix("$2a$04$"))
+			})
+		})
+	})
+
+	Context("Verify", func() {
+		When("verifying the correct password", func() {
+			It("should return true", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				ok, err := hasher.Verify("password", hash)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeTrue())
+			})
+		})
+
+		When("verifying an incorrect password", func() {
+			It("should return false", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				ok, err := hasher.Verify("not the password", hash)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ok).Should(BeFalse())
+			})
+		})
+	})
+
+	Context("NeedsRehash", func() {
+		When("the hash was produced with the same cost", func() {
+			It("should return false", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(hasher.NeedsRehash(hash)).Should(BeFalse())
+			})
+		})
+
+		When("the cost has been raised", func() {
+			It("should return true", func() {
+				hash, err := hasher.Hash("password")
+				Expect(err).ShouldNot(HaveOccurred())
+
+				hasher.Cost = 5
+				Expect(hasher.NeedsRehash(hash)).Should(BeTrue())
+			})
+		})
+	})
+})
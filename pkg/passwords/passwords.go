@@ -0,0 +1,31 @@
+package passwords
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidHash = errors.New("encoded hash is not in a recognised format")
+var ErrIncompatibleVersion = errors.New("encoded hash uses an incompatible algorithm version")
+
+// Hasher hashes passwords into self-describing encoded strings. The encoding
+// carries the algorithm and its cost parameters so that NeedsRehash can tell
+// when a stored hash was produced with weaker settings than the current ones.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encodedHash string) (bool, error)
+	NeedsRehash(encodedHash string) bool
+}
+
+// Verify checks password against an encoded hash produced by any supported
+// algorithm, regardless of which Hasher is currently configured.
+func Verify(password, encodedHash string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encodedHash, argon2idPrefix):
+		return verifyArgon2id(password, encodedHash)
+	case isBcrypt(encodedHash):
+		return verifyBcrypt(password, encodedHash)
+	}
+
+	return false, ErrInvalidHash
+}
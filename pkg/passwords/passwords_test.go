@@ -0,0 +1,38 @@
+package passwords
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verify", func() {
+	When("verifying against an argon2id hash", func() {
+		It("should verify the password", func() {
+			hash, err := (&Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("password")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			ok, err := Verify("password", hash)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ok).Should(BeTrue())
+		})
+	})
+
+	When("verifying against a bcrypt hash", func() {
+		It("should verify the password", func() {
+			hash, err := (&Bcrypt{Cost: 4}).Hash("password")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			ok, err := Verify("password", hash)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ok).Should(BeTrue())
+		})
+	})
+
+	When("verifying against a plaintext value", func() {
+		It("should return an error", func() {
+			ok, err := Verify("password", "password")
+			Expect(err).Should(Equal(ErrInvalidHash))
+			Expect(ok).Should(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,190 @@
+package sanitize
+
+import (
+	"golang.org/x/net/html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var languageClass = regexp.MustCompile(`^language-[A-Za-z0-9_+-]+$`)
+
+// allowed maps the elements that survive to the attributes they may keep.
+var allowed = map[string][]string{
+	"a":          {"href", "title"},
+	"blockquote": nil,
+	"br":         nil,
+	"code":       {"class"},
+	"del":        nil,
+	"em":         nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"img":        {"src", "alt", "title"},
+	"kbd":        nil,
+	"li":         nil,
+	"ol":         {"start"},
+	"p":          nil,
+	"pre":        nil,
+	"s":          nil,
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"align"},
+	"th":         {"align"},
+	"thead":      nil,
+	"tr":         nil,
+	"ul":         nil,
+}
+
+// dropped elements are removed together with everything inside them.
+var dropped = map[string]bool{
+	"embed":    true,
+	"iframe":   true,
+	"math":     true,
+	"noscript": true,
+	"object":   true,
+	"script":   true,
+	"style":    true,
+	"svg":      true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+}
+
+var void = map[string]bool{"br": true, "hr": true, "img": true}
+
+// HTML keeps only the allowlisted elements and attributes of s, drops
+// comments, and closes whatever was left open.
+func HTML(s string) string {
+	var b strings.Builder
+	var open []string
+	skip := ""
+	depth := 0
+
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		if skip != "" {
+			switch {
+			case tokenType == html.StartTagToken && token.Data == skip:
+				depth++
+			case tokenType == html.EndTagToken && token.Data == skip:
+				depth--
+				if depth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+
+		switch tokenType {
+		case html.TextToken:
+			b.WriteString(html.EscapeString(token.Data))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if dropped[token.Data] {
+				if tokenType == html.StartTagToken {
+					skip, depth = token.Data, 1
+				}
+				continue
+			}
+
+			attributes, ok := allowed[token.Data]
+			if !ok {
+				continue
+			}
+
+			b.WriteString("<" + token.Data)
+			for _, attribute := range token.Attr {
+				if value, ok := attributeValue(token.Data, attribute, attributes); ok {
+					b.WriteString(" " + attribute.Key + `="` + html.EscapeString(value) + `"`)
+				}
+			}
+
+			if token.Data == "a" {
+				b.WriteString(` rel="nofollow ugc"`)
+			}
+
+			if void[token.Data] {
+				b.WriteString(" />")
+				continue
+			}
+
+			b.WriteString(">")
+			open = append(open, token.Data)
+		case html.EndTagToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != token.Data {
+					continue
+				}
+
+				for len(open) > i {
+					b.WriteString("</" + open[len(open)-1] + ">")
+					open = open[:len(open)-1]
+				}
+				break
+			}
+		}
+	}
+
+	for len(open) > 0 {
+		b.WriteString("</" + open[len(open)-1] + ">")
+		open = open[:len(open)-1]
+	}
+
+	return b.String()
+}
+
+func attributeValue(element string, attribute html.Attribute, attributes []string) (string, bool) {
+	if attribute.Namespace != "" || !contains(attributes, attribute.Key) {
+		return "", false
+	}
+
+	value := attribute.Val
+	switch attribute.Key {
+	case "href":
+		return value, safeURL(value, "http", "https", "mailto")
+	case "src":
+		return value, safeURL(value, "http", "https")
+	case "class":
+		return value, element == "code" && languageClass.MatchString(value)
+	case "align":
+		return value, value == "left" || value == "center" || value == "right"
+	case "start":
+		_, err := strconv.ParseUint(value, 10, 31)
+		return value, err == nil
+	}
+
+	return value, true
+}
+
+func safeURL(value string, schemes ...string) bool {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "" || contains(schemes, strings.ToLower(u.Scheme))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,52 @@
+package sanitize
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTML", func() {
+	It("should keep the allowlisted elements", func() {
+		Expect(HTML("<h2>North</h2>\n<p><em>a</em> <strong>b</strong><br />c</p><hr>")).Should(Equal(
+			"<h2>North</h2>\n<p><em>a</em> <strong>b</strong><br />c</p><hr />"))
+		Expect(HTML(`<ol start="3"><li>x</li></ol><table><tbody><tr><td align="center">y</td></tr></tbody></table>`)).Should(Equal(
+			`<ol start="3"><li>x</li></ol><table><tbody><tr><td align="center">y</td></tr></tbody></table>`))
+	})
+
+	It("should drop other elements but keep their text", func() {
+		Expect(HTML(`<div class="x"><span onclick="evil()">hi</span></div>`)).Should(Equal("hi"))
+	})
+
+	It("should drop scripts, styles and embeds with their content", func() {
+		Expect(HTML("a<script>alert(1)</script>b<style>p{}</style>c<iframe src=\"x\"><p>d</p></iframe>e")).Should(Equal("abce"))
+		Expect(HTML("<svg><svg></svg><script>x</script></svg>ok<!-- comment -->")).Should(Equal("ok"))
+	})
+
+	It("should strip attributes that are not allowed", func() {
+		Expect(HTML(`<p style="color:red" onmouseover="x()">a</p>`)).Should(Equal("<p>a</p>"))
+		Expect(HTML(`<td align="justify">a</td><ol start="-1"></ol>`)).Should(Equal("<td>a</td><ol></ol>"))
+		Expect(HTML(`<code class="language-go">x</code><code class="evil">y</code>`)).Should(Equal(
+			`<code class="language-go">x</code><code>y</code>`))
+	})
+
+	It("should only keep safe link and image URLs", func() {
+		Expect(HTML(`<a href="https://example.com" title="t">a</a>`)).Should(Equal(
+			`<a href="https://example.com" title="t" rel="nofollow ugc">a</a>`))
+		Expect(HTML(`<a href="/wiki">a</a><a href="mailto:jon@example.com">b</a>`)).Should(Equal(
+			`<a href="/wiki" rel="nofollow ugc">a</a><a href="mailto:jon@example.com" rel="nofollow ugc">b</a>`))
+		Expect(HTML(`<a href="javascript:alert(1)">a</a><a href="JaVaScRiPt&#58;alert(1)">b</a>`)).Should(Equal(
+			`<a rel="nofollow ugc">a</a><a rel="nofollow ugc">b</a>`))
+		Expect(HTML(`<img src="data:image/png;base64,xx" alt="a"><img src="mailto:x@y.z">`)).Should(Equal(
+			`<img alt="a" /><img />`))
+	})
+
+	It("should escape text and attribute values", func() {
+		Expect(HTML(`<p title="x">1 &lt; 2 &amp;&amp; "3"</p>`)).Should(Equal("<p>1 &lt; 2 &amp;&amp; &#34;3&#34;</p>"))
+		Expect(HTML(`<img alt="&quot;><script>">`)).Should(Equal(`<img alt="&#34;&gt;&lt;script&gt;" />`))
+	})
+
+	It("should balance the tags", func() {
+		Expect(HTML("<p><em>open")).Should(Equal("<p><em>open</em></p>"))
+		Expect(HTML("<p><em>a</p>b</em></strong>")).Should(Equal("<p><em>a</em></p>b"))
+	})
+})
@@ -0,0 +1,72 @@
+package tokens
+
+import (
+	"encoding/base64"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tokens", func() {
+	Context("Generate", func() {
+		When("generating a token", func() {
+			It("should return a URL-safe encoding of the requested number of bytes", func() {
+				token, err := Generate(DefaultLength)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				decoded, err := base64.RawURLEncoding.DecodeString(token)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(decoded).Should(HaveLen(DefaultLength))
+			})
+		})
+
+		When("generating two tokens", func() {
+			It("should return different values", func() {
+				first, err := Generate(DefaultLength)
+				Expect(err).ShouldNot(HaveOccurred())
+				second, err := Generate(DefaultLength)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(first).ShouldNot(Equal(second))
+			})
+		})
+	})
+
+	Context("Hash", func() {
+		When("hashing a token", func() {
+			It("should return a stable hex encoded SHA-256 digest", func() {
+				Expect(Hash("token")).Should(Equal("3c469e9d6c5875d37a43f353d4f88e61fcf812c66eee3457465a40b0da4153e0"))
+				Expect(Hash("token")).Should(Equal(Hash("token")))
+				Expect(Hash("token")).ShouldNot(Equal(Hash("other")))
+			})
+		})
+	})
+
+	Context("Sign", func() {
+		key := []byte("secret")
+
+		When("verifying a token signed with the same key", func() {
+			It("should return the payload", func() {
+				payload, err := Verify(key, Sign(key, "some.payload"))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(payload).Should(Equal("some.payload"))
+			})
+		})
+
+		When("verifying a token signed with another key", func() {
+			It("should return ErrInvalidSignature", func() {
+				_, err := Verify(key, Sign([]byte("other"), "payload"))
+				Expect(err).Should(Equal(ErrInvalidSignature))
+			})
+		})
+
+		When("verifying a tampered or malformed token", func() {
+			It("should return ErrInvalidSignature", func() {
+				token := Sign(key, "payload")
+				_, err := Verify(key, "x"+token)
+				Expect(err).Should(Equal(ErrInvalidSignature))
+
+				_, err = Verify(key, "payload")
+				Expect(err).Should(Equal(ErrInvalidSignature))
+			})
+		})
+	})
+})
@@ -0,0 +1,83 @@
+package totp
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/url"
+	"time"
+)
+
+// The SHA1 secret of the RFC 6238 test vectors, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+var _ = Describe("TOTP", func() {
+	Context("Code", func() {
+		It("should match the RFC 6238 test vectors", func() {
+			vectors := map[int64]string{
+				59:         "287082",
+				1111111109: "081804",
+				1234567890: "005924",
+				2000000000: "279037",
+			}
+
+			for unix, expected := range vectors {
+				code, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(code).Should(Equal(expected))
+			}
+		})
+
+		When("the secret is not base32", func() {
+			It("should return ErrInvalidSecret", func() {
+				_, err := Code("not base32!", 1)
+				Expect(err).Should(Equal(ErrInvalidSecret))
+			})
+		})
+	})
+
+	Context("Validate", func() {
+		now := time.Unix(1234567890, 0)
+
+		It("should accept codes of neighbouring steps and report the step", func() {
+			code, err := Code(rfcSecret, Step(now)-1)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			step, ok, err := Validate(rfcSecret, code, now, 1)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ok).Should(BeTrue())
+			Expect(step).Should(Equal(Step(now) - 1))
+		})
+
+		It("should refuse codes outside the skew", func() {
+			code, err := Code(rfcSecret, Step(now)-2)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			_, ok, err := Validate(rfcSecret, code, now, 1)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ok).Should(BeFalse())
+		})
+	})
+
+	Context("GenerateSecret", func() {
+		It("should return a secret that codes can be derived from", func() {
+			secret, err := GenerateSecret()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(secret).Should(HaveLen(32))
+
+			_, err = Code(secret, 1)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("URI", func() {
+		It("should label the account with the issuer", func() {
+			parsed, err := url.Parse(URI("golangbb", "JonSnow", rfcSecret))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parsed.Scheme).Should(Equal("otpauth"))
+			Expect(parsed.Host).Should(Equal("totp"))
+			Expect(parsed.Path).Should(Equal("/golangbb:JonSnow"))
+			Expect(parsed.Query().Get("secret")).Should(Equal(rfcSecret))
+			Expect(parsed.Query().Get("issuer")).Should(Equal("golangbb"))
+		})
+	})
+})